@@ -30,6 +30,30 @@ func (ai *AuthInterceptor) intercept(ctx context.Context, req interface{}, info
 	return handler(ctx, req)
 }
 
+// sessionStream carries the authorized session in the context of a stream.
+type sessionStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *sessionStream) Context() context.Context {
+	return s.ctx
+}
+
+func (ai *AuthInterceptor) interceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !strings.HasPrefix(info.FullMethod, "/xmaslist.AuthService/") {
+		session, err := ai.authorize(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		ctx := context.WithValue(ss.Context(), request.SessionKey, session)
+		ss = &sessionStream{ServerStream: ss, ctx: ctx}
+	}
+
+	return handler(srv, ss)
+}
+
 func (ai *AuthInterceptor) authorize(ctx context.Context) (*sessions.Session, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -0,0 +1,52 @@
+// Package blobstore stores immutable blobs by content. Blobs are named by the
+// hex SHA-256 of their contents, so storing the same data twice yields the
+// same key.
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("blob not found")
+
+	keyRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	Created time.Time
+}
+
+type Store interface {
+	// Put stores data, returning its key. Storing data that's already
+	// present resets its Created time.
+	Put(ctx context.Context, data []byte) (string, error)
+
+	// Get returns the blob with the given key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Delete removes the blob with the given key. Deleting a blob that
+	// doesn't exist isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns every blob in the store.
+	List(ctx context.Context) ([]*BlobInfo, error)
+}
+
+// Key returns the key for data.
+func Key(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// ValidKey returns true if key is well-formed. Keys come from clients, so
+// they should be checked before use.
+func ValidKey(key string) bool {
+	return keyRE.MatchString(key)
+}
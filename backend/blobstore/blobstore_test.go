@@ -0,0 +1,125 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() = %v", err)
+	}
+
+	data := []byte("hello")
+	key, err := store.Put(ctx, data)
+	if err != nil || key != Key(data) {
+		t.Fatalf("Put(_, %q) = %v, %v, want %v, nil", data, key, err,
+			Key(data))
+	}
+
+	// Putting the same data again only refreshes its creation time.
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(store.path(key), old, old); err != nil {
+		t.Fatalf("Chtimes() = %v", err)
+	}
+	if key2, err := store.Put(ctx, data); err != nil || key2 != key {
+		t.Errorf("Put(_, %q) = %v, %v, want %v, nil", data, key2, err,
+			key)
+	}
+
+	if got, err := store.Get(ctx, key); err != nil || string(got) != "hello" {
+		t.Errorf("Get(_, %v) = %q, %v, want %q, nil", key, got, err,
+			data)
+	}
+
+	blobs, err := store.List(ctx)
+	if err != nil || len(blobs) != 1 || blobs[0].Key != key ||
+		blobs[0].Size != int64(len(data)) {
+		t.Errorf("List() = %+v, %v, want one blob %v", blobs, err, key)
+	} else if !blobs[0].Created.After(old) {
+		t.Errorf("List() created = %v, want after %v", blobs[0].Created,
+			old)
+	}
+
+	if _, err := store.Get(ctx, "../../etc/passwd"); err == nil {
+		t.Errorf("Get(_, bad key) = _, nil, want error")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete(_, %v) = %v, want nil", key, err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete(_, %v) again = %v, want nil", key, err)
+	}
+
+	if _, err := store.Get(ctx, key); err != ErrNotFound {
+		t.Errorf("Get(_, %v) = _, %v, want ErrNotFound", key, err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() = %v", err)
+	}
+
+	data := []byte("GIF89a some gif")
+	key, err := store.Put(ctx, data)
+	if err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+
+	srv := httptest.NewServer(Handler(store))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/images/" + key)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != string(data) {
+		t.Errorf("GET %v = %v %q, want 200 %q", key, resp.StatusCode,
+			body, data)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "image/gif" {
+		t.Errorf("Content-Type = %v, want image/gif", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != cacheControl {
+		t.Errorf("Cache-Control = %v, want %v", got, cacheControl)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/images/"+key, nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("conditional Get() = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET = %v, want 304", resp.StatusCode)
+	}
+
+	for _, path := range []string{"/images/" + Key([]byte("nope")), "/images/bad"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Get(%v) = %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %v = %v, want 404", path,
+				resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package blobstore
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Blobs never change, so clients can cache them forever.
+const cacheControl = "public, max-age=31536000, immutable"
+
+// Handler serves blobs from store. The blob key is the last element of the
+// request path.
+func Handler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if !ValidKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+
+		etag := `"` + key + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data, err := store.Get(r.Context(), key)
+		if err == ErrNotFound {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "internal error",
+				http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(data)
+	})
+}
@@ -0,0 +1,237 @@
+// Package calendar serves iCalendar feeds of upcoming list events. Each user
+// has a feed, reached by a secret token rather than a session so that
+// calendar apps can subscribe to it.
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var logger = grpclog.Component("calendar")
+
+const (
+	// PathPrefix is where feeds are served. A feed's URL is PathPrefix,
+	// its token, and ".ics".
+	PathPrefix = "/calendar/"
+
+	prodID = "-//xmaslist//xmaslist//EN"
+
+	// RFC 5545 lines are folded at 75 octets.
+	maxLineLen = 75
+
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+)
+
+// FeedPath returns the path of the feed with the given token.
+func FeedPath(token string) string {
+	return PathPrefix + token + ".ics"
+}
+
+type Server struct {
+	db        *database.DB
+	clock     util.Clock
+	appURL    string
+	alarmDays []int
+}
+
+// NewServer returns a Server whose events link to lists in the web app at
+// appURL, if it's set, and have alarms the given numbers of days before
+// each event.
+func NewServer(db *database.DB, clock util.Clock, appURL string, alarmDays []int) *Server {
+	alarmDays = append([]int{}, alarmDays...)
+	sort.Sort(sort.Reverse(sort.IntSlice(alarmDays)))
+
+	return &Server{
+		db:        db,
+		clock:     clock,
+		appURL:    strings.TrimSuffix(appURL, "/"),
+		alarmDays: alarmDays,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	if !strings.HasSuffix(name, ".ics") {
+		http.NotFound(w, r)
+		return
+	}
+
+	feed, err := s.db.LookupCalendarFeed(r.Context(),
+		strings.TrimSuffix(name, ".ics"))
+	if err != nil {
+		logger.Errorf("calendar feed lookup failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if feed == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := s.Render(r.Context(), buf, s.clock.Now()); err != nil {
+		logger.Errorf("failed to render calendar feed for user %v: %v",
+			feed.UserID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// Render writes a calendar of the events of visible lists that haven't
+// happened yet at now. Lists without event dates are left out.
+func (s *Server) Render(ctx context.Context, w io.Writer, now time.Time) error {
+	lists, err := s.db.ListLists(ctx, database.IncludeInactiveLists(false))
+	if err != nil {
+		return err
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	upcoming := []*database.List{}
+	for _, list := range lists {
+		if list.EventDate.IsZero() || list.EventDate.UTC().Before(today) {
+			continue
+		}
+		upcoming = append(upcoming, list)
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		a, b := upcoming[i], upcoming[j]
+		if !a.EventDate.Equal(b.EventDate) {
+			return a.EventDate.Before(b.EventDate)
+		}
+		return a.ID < b.ID
+	})
+
+	cw := &contentWriter{w: w}
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", prodID)
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	cw.line("X-WR-CALNAME", "xmaslist")
+	for _, list := range upcoming {
+		s.writeEvent(cw, list)
+	}
+	cw.line("END", "VCALENDAR")
+	return cw.err
+}
+
+func (s *Server) listURL(list *database.List) string {
+	if s.appURL == "" {
+		return ""
+	}
+	return s.appURL + "/view/" + strconv.Itoa(list.ID)
+}
+
+// writeEvent writes an all-day event for a list. Event dates are stored as
+// times, but only their (UTC) date is meaningful.
+func (s *Server) writeEvent(cw *contentWriter, list *database.List) {
+	start := list.EventDate.UTC()
+	url := s.listURL(list)
+
+	desc := []string{}
+	if list.Beneficiary != "" {
+		desc = append(desc, "Gifts for "+list.Beneficiary)
+	}
+	if url != "" {
+		desc = append(desc, url)
+	}
+
+	cw.line("BEGIN", "VEVENT")
+	cw.line("UID", fmt.Sprintf("list-%d@xmaslist", list.ID))
+	cw.line("DTSTAMP", list.Updated.UTC().Format(dateTimeFormat))
+	cw.line("LAST-MODIFIED", list.Updated.UTC().Format(dateTimeFormat))
+	cw.line("DTSTART;VALUE=DATE", start.Format(dateFormat))
+	cw.line("DTEND;VALUE=DATE", start.AddDate(0, 0, 1).Format(dateFormat))
+	cw.line("SUMMARY", escapeText(list.Name))
+	if len(desc) > 0 {
+		cw.line("DESCRIPTION", escapeText(strings.Join(desc, "\n")))
+	}
+	if url != "" {
+		cw.line("URL", url)
+	}
+	cw.line("TRANSP", "TRANSPARENT")
+
+	for _, days := range s.alarmDays {
+		when := fmt.Sprintf("in %d days", days)
+		if days == 1 {
+			when = "tomorrow"
+		}
+
+		cw.line("BEGIN", "VALARM")
+		cw.line("ACTION", "DISPLAY")
+		cw.line("DESCRIPTION", escapeText(list.Name+" is "+when))
+		cw.line("TRIGGER", fmt.Sprintf("-P%dD", days))
+		cw.line("END", "VALARM")
+	}
+
+	cw.line("END", "VEVENT")
+}
+
+// escapeText escapes a TEXT property value.
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`;`, `\;`,
+		`,`, `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// contentWriter writes content lines, folding them as needed and keeping
+// the first error.
+type contentWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *contentWriter) line(name, value string) {
+	if cw.err != nil {
+		return
+	}
+
+	line := name + ":" + value
+	out := &strings.Builder{}
+	limit := maxLineLen
+	for len(line) > limit {
+		// Don't split UTF-8 sequences.
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		out.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+
+		// Continuation lines start with a space, which counts toward
+		// their length.
+		limit = maxLineLen - 1
+	}
+	out.WriteString(line + "\r\n")
+
+	_, cw.err = io.WriteString(cw.w, out.String())
+}
@@ -0,0 +1,148 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+var (
+	ctx = context.Background()
+
+	update = flag.Bool("update", false, "update golden files")
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func setupTestServer(t *testing.T) (*database.DB, *Server) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	userA, userB := users.UserByUsername("a"), users.UserByUsername("b")
+
+	created := date(2021, time.October, 1)
+	lists := []struct {
+		ownerID int
+		data    database.ListData
+	}{
+		{userA.ID, database.ListData{
+			Name:        "Christmas",
+			Beneficiary: "Alice",
+			EventDate:   date(2021, time.December, 25),
+			Active:      true,
+		}},
+		{userB.ID, database.ListData{
+			Name: "Bob's birthday, with cake; and a name long " +
+				"enough to need folding ✓✓✓",
+			EventDate: date(2021, time.November, 2),
+			Active:    true,
+		}},
+		{userA.ID, database.ListData{
+			Name:   "No date",
+			Active: true,
+		}},
+		{userA.ID, database.ListData{
+			Name:      "Already happened",
+			EventDate: date(2021, time.October, 31),
+			Active:    true,
+		}},
+		{userB.ID, database.ListData{
+			Name:      "Archived",
+			EventDate: date(2021, time.December, 31),
+		}},
+	}
+	for _, l := range lists {
+		if _, err := db.CreateList(ctx, l.ownerID, &l.data, created); err != nil {
+			t.Fatalf("CreateList(%v) = _, %v, want _, nil", l.data.Name,
+				err)
+		}
+	}
+
+	clock := &util.MonoClock{Time: date(2021, time.November, 1).Add(time.Hour)}
+	return db, NewServer(db, clock, "https://xmaslist.example.com/",
+		[]int{1, 7})
+}
+
+func TestRender(t *testing.T) {
+	db, server := setupTestServer(t)
+	defer db.Close()
+
+	buf := &bytes.Buffer{}
+	if err := server.Render(ctx, buf, server.clock.Now()); err != nil {
+		t.Fatalf("Render() = %v, want nil", err)
+	}
+
+	golden := filepath.Join("testdata", "feed.ics")
+	if *update {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if diff := cmp.Diff(string(want), buf.String()); diff != "" {
+		t.Errorf("Render() mismatch; -want,+got:\n%s", diff)
+	}
+
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\r\n")) {
+		if len(line) > maxLineLen {
+			t.Errorf("line %q is longer than %d octets", line,
+				maxLineLen)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	db, server := setupTestServer(t)
+	defer db.Close()
+
+	users, err := db.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers() = _, %v, want _, nil", err)
+	}
+	if _, err := db.SetCalendarFeed(ctx, users[0].ID, "secret", time.Unix(1, 0)); err != nil {
+		t.Fatalf("SetCalendarFeed() = _, %v, want _, nil", err)
+	}
+
+	for _, path := range []string{
+		FeedPath("wrong"),
+		FeedPath(""),
+		PathPrefix + "secret",
+	} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %v = %v, want %v", path, rec.Code,
+				http.StatusNotFound)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec,
+		httptest.NewRequest(http.MethodGet, FeedPath("secret"), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %v = %v, want %v", FeedPath("secret"), rec.Code,
+			http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/calendar; charset=utf-8" {
+		t.Errorf("Content-Type = %v, want text/calendar", ct)
+	}
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("BEGIN:VCALENDAR\r\n")) {
+		t.Errorf("body = %q, want calendar", rec.Body.String())
+	}
+}
@@ -0,0 +1,193 @@
+// Package claimexpiry releases claims that haven't turned into purchases
+// within their list's claim timeout, reminding claimers before it happens.
+package claimexpiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	logger = grpclog.Component("claimexpiry")
+
+	errNoChange = errors.New("no claims changed")
+)
+
+// A Reminder tells a claimer that their claim is about to expire.
+type Reminder interface {
+	RemindClaimExpiring(ctx context.Context, userID int, list *database.List, item *database.ListItem, expiry time.Time) error
+}
+
+// LogReminder is a Reminder that only logs.
+type LogReminder struct{}
+
+func (r *LogReminder) RemindClaimExpiring(ctx context.Context, userID int, list *database.List, item *database.ListItem, expiry time.Time) error {
+	logger.Infof("claim by user %v on item %v (list %v) expires %v",
+		userID, item.ID, list.ID, expiry)
+	return nil
+}
+
+// OutboxReminder is a Reminder that queues a notification for the claimer.
+type OutboxReminder struct {
+	db    *database.DB
+	clock util.Clock
+}
+
+func NewOutboxReminder(db *database.DB, clock util.Clock) *OutboxReminder {
+	return &OutboxReminder{db: db, clock: clock}
+}
+
+func (r *OutboxReminder) RemindClaimExpiring(ctx context.Context, userID int, list *database.List, item *database.ListItem, expiry time.Time) error {
+	return r.db.EnqueueNotification(ctx, userID, &database.Notification{
+		Kind:   database.NotifyClaimExpiring,
+		ListID: list.ID,
+		ItemID: item.ID,
+		Message: fmt.Sprintf("Your claim on %q from %q will be released "+
+			"on %v unless you mark it purchased", item.Name,
+			list.Name, expiry.Format("Jan 2")),
+		Created: r.clock.Now(),
+	})
+}
+
+type Expirer struct {
+	db       *database.DB
+	clock    util.Clock
+	reminder Reminder
+	lead     time.Duration
+}
+
+// NewExpirer returns an Expirer that reminds claimers lead before their claims
+// expire.
+func NewExpirer(db *database.DB, clock util.Clock, reminder Reminder, lead time.Duration) *Expirer {
+	return &Expirer{
+		db:       db,
+		clock:    clock,
+		reminder: reminder,
+		lead:     lead,
+	}
+}
+
+// ClaimExpiry returns the time at which claim will be released. Claims that go
+// back to being unpurchased start over, so the timeout runs from then.
+func ClaimExpiry(list *database.List, claim *database.Claim) time.Time {
+	return claim.When.AddDate(0, 0, list.ClaimTimeoutDays)
+}
+
+// Run calls RunOnce every interval, as measured by the Expirer's clock, until
+// ctx is done.
+func (e *Expirer) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := e.RunOnce(ctx); err != nil {
+			logger.Errorf("claim expiry failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce releases expired claims and sends reminders for claims that are
+// about to expire. Failures for individual items are logged and retried on
+// the next run.
+func (e *Expirer) RunOnce(ctx context.Context) error {
+	claimedItems, err := e.db.ListExpirableClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := e.clock.Now()
+	for _, claimedItem := range claimedItems {
+		list, item := claimedItem.List, claimedItem.Item
+
+		// Group gift claims belong to the organizer, and are released
+		// by them.
+		if item.GroupGift {
+			continue
+		}
+
+		expired := []*database.Claim{}
+		for _, claim := range item.Claims {
+			if claim.Purchase != database.PurchaseClaimed {
+				continue
+			}
+
+			expiry := ClaimExpiry(list, claim)
+			if !now.Before(expiry) {
+				expired = append(expired, claim)
+				continue
+			}
+
+			if claim.RemindedWhen.IsZero() && !now.Before(expiry.Add(-e.lead)) {
+				if err := e.remind(ctx, list, item, claim, expiry, now); err != nil {
+					logger.Errorf("failed to remind user %v about item %v: %v",
+						claim.UserID, item.ID, err)
+				}
+			}
+		}
+
+		if len(expired) > 0 {
+			if err := e.expire(ctx, item, expired, now); err != nil {
+				logger.Errorf("failed to expire claims on item %v: %v",
+					item.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *Expirer) remind(ctx context.Context, list *database.List, item *database.ListItem, claim *database.Claim, expiry, now time.Time) error {
+	err := e.reminder.RemindClaimExpiring(ctx, claim.UserID, list, item,
+		expiry)
+	if err != nil {
+		return err
+	}
+
+	return e.db.SetClaimReminded(ctx, item.ID, claim.UserID, now)
+}
+
+// expire releases the expired claims on item. The release goes through the
+// usual versioned update, so it loses to any concurrent change to the item.
+func (e *Expirer) expire(ctx context.Context, item *database.ListItem, expired []*database.Claim, now time.Time) error {
+	_, err := e.db.UpdateListItem(ctx, item.ListID, item.ID, item.Version,
+		0, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			num := 0
+			for _, old := range expired {
+				// Make sure the claim we're releasing is the
+				// one we read.
+				claim := state.UserClaim(old.UserID)
+				if claim == nil || claim.Purchase != database.PurchaseClaimed || !claim.When.Equal(old.When) {
+					continue
+				}
+
+				logger.Infof("releasing claim by user %v on item %v",
+					old.UserID, item.ID)
+				state.SetClaim(old.UserID, 0)
+				num++
+			}
+
+			if num == 0 {
+				return errNoChange
+			}
+			return nil
+		})
+
+	if err == errNoChange || status.Code(err) == codes.FailedPrecondition {
+		// Someone else got there first. If the claim is still
+		// expired, we'll get it next time.
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,339 @@
+package claimexpiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+var (
+	ctx = context.Background()
+)
+
+type reminder struct {
+	UserID int
+	ItemID int
+	Expiry time.Time
+}
+
+type fakeReminder struct {
+	reminders []reminder
+}
+
+func (r *fakeReminder) RemindClaimExpiring(ctx context.Context, userID int, list *database.List, item *database.ListItem, expiry time.Time) error {
+	r.reminders = append(r.reminders, reminder{userID, item.ID, expiry})
+	return nil
+}
+
+func TestExpirer(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b", "c"})
+
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: time.Unix(1, 0), Active: true,
+				ClaimTimeoutDays: 7},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+				&database.ListItemData{Name: "l1i2"},
+			},
+		},
+	})
+
+	userB := users.UserByUsername("b")
+	userC := users.UserByUsername("c")
+	claimed := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	claim := func(itemName string, userID int, purchase bool) *database.ListItem {
+		list, item := resps.GetItem("l1", itemName)
+		item, err := db.UpdateListItem(ctx, list.ID, item.ID,
+			item.Version, userID, claimed,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				state.SetClaim(userID, 1)
+				if purchase {
+					return state.UserClaim(userID).SetPurchaseState(
+						database.PurchasePurchased, claimed)
+				}
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %v, %v) = _, %v, want _, nil",
+				list.ID, item.ID, err)
+		}
+		return item
+	}
+
+	// c has bought their item, so only b's claim is at risk.
+	i1 := claim("l1i1", userB.ID, false)
+	i2 := claim("l1i2", userC.ID, true)
+
+	expiry := claimed.AddDate(0, 0, 7)
+	clock := &util.MonoClock{Time: expiry.Add(-72 * time.Hour)}
+	rem := &fakeReminder{}
+	expirer := NewExpirer(db, clock, rem, 48*time.Hour)
+
+	runOnce := func() {
+		if err := expirer.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce() = %v, want nil", err)
+		}
+	}
+
+	// Too early for a reminder.
+	runOnce()
+	if len(rem.reminders) != 0 {
+		t.Errorf("early reminders = %v, want none", rem.reminders)
+	}
+
+	// Reminders are only sent once.
+	clock.Advance(36 * time.Hour)
+	runOnce()
+	runOnce()
+	want := []reminder{{userB.ID, i1.ID, expiry}}
+	if len(rem.reminders) != 1 || rem.reminders[0] != want[0] {
+		t.Errorf("reminders = %v, want %v", rem.reminders, want)
+	}
+
+	got, err := dbutil.GetListItem(ctx, db, i1.ListID, i1.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			i1.ListID, i1.ID, err)
+	}
+	if got.Version != i1.Version || got.UserClaim(userB.ID).RemindedWhen.IsZero() {
+		t.Errorf("reminded item = %+v, want version %v, reminded",
+			got, i1.Version)
+	}
+
+	clock.Time = expiry
+	runOnce()
+
+	got, err = dbutil.GetListItem(ctx, db, i1.ListID, i1.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			i1.ListID, i1.ID, err)
+	}
+	if got.Version != i1.Version+1 || len(got.Claims) != 0 {
+		t.Errorf("expired item = %+v, want version %v, no claims",
+			got, i1.Version+1)
+	}
+
+	got, err = dbutil.GetListItem(ctx, db, i2.ListID, i2.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			i2.ListID, i2.ID, err)
+	}
+	if got.Version != i2.Version || got.UserClaim(userC.ID) == nil {
+		t.Errorf("purchased item = %+v, want unchanged", got)
+	}
+}
+
+func TestExpirer_ReturnedPurchase(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: time.Unix(1, 0), Active: true,
+				ClaimTimeoutDays: 7},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+			},
+		},
+	})
+
+	userB := users.UserByUsername("b")
+	list, item := resps.GetItem("l1", "l1i1")
+	claimed := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	update := func(version int, now time.Time, update func(state *database.ListItemState) error) *database.ListItem {
+		t.Helper()
+		item, err := db.UpdateListItem(ctx, list.ID, item.ID, version,
+			userB.ID, now,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				return update(state)
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %v, %v) = _, %v, want _, nil",
+				list.ID, item.ID, err)
+		}
+		return item
+	}
+
+	item = update(item.Version, claimed, func(state *database.ListItemState) error {
+		state.SetClaim(userB.ID, 1)
+		return state.UserClaim(userB.ID).SetPurchaseState(
+			database.PurchasePurchased, claimed)
+	})
+
+	// Returning the purchase well after the original claim would have
+	// expired restarts the timeout.
+	returned := claimed.AddDate(0, 0, 30)
+	item = update(item.Version, returned, func(state *database.ListItemState) error {
+		return state.UserClaim(userB.ID).SetPurchaseState(
+			database.PurchaseClaimed, returned)
+	})
+
+	clock := &util.MonoClock{Time: returned.Add(time.Hour)}
+	rem := &fakeReminder{}
+	expirer := NewExpirer(db, clock, rem, 48*time.Hour)
+
+	if err := expirer.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	if len(rem.reminders) != 0 {
+		t.Errorf("reminders = %v, want none", rem.reminders)
+	}
+
+	got, err := dbutil.GetListItem(ctx, db, item.ListID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			item.ListID, item.ID, err)
+	}
+	if got.Version != item.Version || got.UserClaim(userB.ID) == nil {
+		t.Errorf("returned item = %+v, want unchanged", got)
+	}
+
+	expiry := returned.AddDate(0, 0, 7)
+	clock.Time = expiry.Add(-time.Hour)
+	if err := expirer.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	want := reminder{userB.ID, item.ID, expiry}
+	if len(rem.reminders) != 1 || rem.reminders[0] != want {
+		t.Errorf("reminders = %v, want [%v]", rem.reminders, want)
+	}
+}
+
+// stoppingClock is a MonoClock that cancels a context, and never fires
+// again, once After has been called stopAfter times.
+type stoppingClock struct {
+	util.MonoClock
+	cancel    context.CancelFunc
+	stopAfter int
+}
+
+func (c *stoppingClock) After(d time.Duration) <-chan time.Time {
+	c.stopAfter--
+	if c.stopAfter < 0 {
+		c.cancel()
+		return nil
+	}
+	return c.MonoClock.After(d)
+}
+
+func TestExpirer_Run(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: time.Unix(1, 0), Active: true,
+				ClaimTimeoutDays: 7},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+			},
+		},
+	})
+
+	userB := users.UserByUsername("b")
+	list, item := resps.GetItem("l1", "l1i1")
+	claimed := time.Unix(testutil.SetupListsUserStamp, 0)
+	item, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		userB.ID, claimed,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %v, %v) = _, %v, want _, nil",
+			list.ID, item.ID, err)
+	}
+
+	// The first run reminds, and the second, an interval later by the
+	// injected clock, releases the claim.
+	expiry := claimed.AddDate(0, 0, 7)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	clock := &stoppingClock{
+		MonoClock: util.MonoClock{Time: expiry.Add(-time.Hour)},
+		cancel:    cancel,
+		stopAfter: 1,
+	}
+	rem := &fakeReminder{}
+	NewExpirer(db, clock, rem, 48*time.Hour).Run(runCtx, 2*time.Hour)
+
+	if len(rem.reminders) != 1 {
+		t.Errorf("reminders = %v, want 1", rem.reminders)
+	}
+
+	got, err := dbutil.GetListItem(ctx, db, item.ListID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			item.ListID, item.ID, err)
+	}
+	if len(got.Claims) != 0 {
+		t.Errorf("item = %+v, want no claims", got)
+	}
+}
+
+func TestOutboxReminder(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: time.Unix(1, 0), Active: true,
+				ClaimTimeoutDays: 7},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+			},
+		},
+	})
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+
+	now := time.Date(2021, time.December, 1, 12, 0, 0, 0, time.UTC)
+	reminder := NewOutboxReminder(db, &util.MonoClock{Time: now})
+	err := reminder.RemindClaimExpiring(ctx, userB.ID, list, item,
+		now.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("RemindClaimExpiring() = %v, want nil", err)
+	}
+
+	got, err := db.ListPendingNotifications(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ListPendingNotifications() = _, %v, want _, nil", err)
+	}
+	want := []*database.Notification{{
+		UserID:      userB.ID,
+		Kind:        database.NotifyClaimExpiring,
+		ListID:      list.ID,
+		ItemID:      item.ID,
+		Message:     `Your claim on "l1i1" from "l1" will be released on Dec 3 unless you mark it purchased`,
+		Created:     now,
+		NextAttempt: now,
+	}}
+	for _, n := range got {
+		n.ID = 0
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("notifications mismatch; -want,+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A CalendarFeed is a user's iCalendar feed of upcoming events. Calendar
+// apps can't log in, so the token is the feed's only credential.
+type CalendarFeed struct {
+	UserID  int
+	Token   string
+	Created time.Time
+}
+
+func readCalendarFeed(ctx context.Context, q queryer, column string, value interface{}) (*CalendarFeed, error) {
+	feed := &CalendarFeed{}
+	err := q.QueryRowContext(ctx,
+		`SELECT user_id, token, created FROM calendar_feeds
+		  WHERE `+column+` = ?`, value).Scan(
+		&feed.UserID, &feed.Token, asSeconds{&feed.Created})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return feed, nil
+}
+
+// GetCalendarFeed returns a user's calendar feed, or nil if they don't
+// have one.
+func (db *DB) GetCalendarFeed(ctx context.Context, userID int) (*CalendarFeed, error) {
+	return readCalendarFeed(ctx, db.db, "user_id", userID)
+}
+
+// LookupCalendarFeed returns the calendar feed with the given token, or nil
+// if there isn't one.
+func (db *DB) LookupCalendarFeed(ctx context.Context, token string) (*CalendarFeed, error) {
+	if token == "" {
+		return nil, nil
+	}
+	return readCalendarFeed(ctx, db.db, "token", token)
+}
+
+// SetCalendarFeed gives a user a calendar feed with the given token,
+// replacing their existing one if any.
+func (db *DB) SetCalendarFeed(ctx context.Context, userID int, token string, now time.Time) (*CalendarFeed, error) {
+	_, err := db.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO calendar_feeds (user_id, token, created)
+		 VALUES (?, ?, ?)`, userID, token, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("calendar feed write failed: %v", err)
+	}
+
+	return &CalendarFeed{
+		UserID:  userID,
+		Token:   token,
+		Created: time.Unix(now.Unix(), 0),
+	}, nil
+}
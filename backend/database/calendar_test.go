@@ -0,0 +1,59 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestCalendarFeeds(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	userA, userB := users.UserByUsername("a"), users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	if feed, err := db.GetCalendarFeed(ctx, userA.ID); feed != nil || err != nil {
+		t.Errorf("GetCalendarFeed() = %v, %v, want nil, nil", feed, err)
+	}
+
+	feedA, err := db.SetCalendarFeed(ctx, userA.ID, "token-a", now)
+	if err != nil {
+		t.Fatalf("SetCalendarFeed() = _, %v, want _, nil", err)
+	}
+	if _, err := db.SetCalendarFeed(ctx, userB.ID, "token-b", now); err != nil {
+		t.Fatalf("SetCalendarFeed() = _, %v, want _, nil", err)
+	}
+
+	got, err := db.LookupCalendarFeed(ctx, "token-a")
+	if err != nil {
+		t.Fatalf("LookupCalendarFeed() = _, %v, want _, nil", err)
+	}
+	if diff := cmp.Diff(feedA, got); diff != "" {
+		t.Errorf("LookupCalendarFeed() mismatch; -want,+got:\n%s", diff)
+	}
+
+	// Rotating the token invalidates the old one.
+	rotated, err := db.SetCalendarFeed(ctx, userA.ID, "token-a2",
+		now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("SetCalendarFeed(rotate) = _, %v, want _, nil", err)
+	}
+	if feed, err := db.LookupCalendarFeed(ctx, "token-a"); feed != nil || err != nil {
+		t.Errorf("LookupCalendarFeed(old) = %v, %v, want nil, nil", feed, err)
+	}
+	got, err = db.GetCalendarFeed(ctx, userA.ID)
+	if err != nil {
+		t.Fatalf("GetCalendarFeed() = _, %v, want _, nil", err)
+	}
+	if diff := cmp.Diff(rotated, got); diff != "" {
+		t.Errorf("GetCalendarFeed() mismatch; -want,+got:\n%s", diff)
+	}
+
+	if feed, err := db.LookupCalendarFeed(ctx, ""); feed != nil || err != nil {
+		t.Errorf(`LookupCalendarFeed("") = %v, %v, want nil, nil`, feed, err)
+	}
+}
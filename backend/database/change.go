@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// A Change says that a list or item was changed or deleted. Only the latest
+// change to each list, and to each item in each list, is kept, so each
+// appears at most once in a change feed.
+type Change struct {
+	// Changes are numbered in the order they were made.
+	Seq int64
+
+	ListID int
+	ItemID int // zero for changes to the list itself
+
+	// Set when an item was deleted outright or moved out of the list.
+	Deleted bool
+}
+
+// recordChange records a change to a list or, if itemID is nonzero, to one
+// of its items, replacing any earlier change to it in that list. Items moved
+// between lists are recorded as deleted from the old list and changed in the
+// new one. The change is also queued for the webhooks that want it.
+func recordChange(ctx context.Context, txn *sql.Tx, listID, itemID int, deleted bool) error {
+	result, err := txn.ExecContext(ctx,
+		`DELETE FROM changes WHERE item_id = ? AND list_id = ?`,
+		itemID, listID)
+	if err != nil {
+		return fmt.Errorf("change delete failed: %v", err)
+	}
+	replaced, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx,
+		`INSERT INTO changes (list_id, item_id, deleted) VALUES (?, ?, ?)`,
+		listID, itemID, deleted)
+	if err != nil {
+		return fmt.Errorf("change write failed: %v", err)
+	}
+
+	// The first change to a list or item is its creation.
+	var event WebhookEvent
+	switch {
+	case itemID == 0 && replaced == 0:
+		event = WebhookListCreated
+	case itemID == 0:
+		event = WebhookListUpdated
+	case deleted:
+		event = WebhookItemDeleted
+	case replaced == 0:
+		event = WebhookItemCreated
+	default:
+		event = WebhookItemUpdated
+	}
+	return enqueueWebhookDeliveries(ctx, txn, event, listID, itemID)
+}
+
+// ListChanges returns up to limit changes made after since, oldest first.
+func (db *DB) ListChanges(ctx context.Context, since int64, limit int) ([]*Change, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT seq, list_id, item_id, deleted
+		   FROM changes
+		  WHERE seq > ?
+	       ORDER BY seq
+		  LIMIT ?`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*Change{}
+	for rows.Next() {
+		change := &Change{}
+		if err := rows.Scan(&change.Seq, &change.ListID, &change.ItemID,
+			&change.Deleted); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// LatestChangeSeq returns the sequence number of the most recent change, or
+// zero if nothing has changed.
+func (db *DB) LatestChangeSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := db.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(seq), 0) FROM changes`).Scan(&seq)
+	return seq, err
+}
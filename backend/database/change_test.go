@@ -0,0 +1,109 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestChanges(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	l1, l2 := resps.GetList("l1").List, resps.GetList("l2").List
+	_, l1i1 := resps.GetItem("l1", "l1i1")
+	_, l1i2 := resps.GetItem("l1", "l1i2")
+	_, l2i1 := resps.GetItem("l2", "l2i1")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	// listChanges returns the changes after since with their sequence
+	// numbers cleared, checking along the way that they're in order.
+	listChanges := func(since int64) ([]*database.Change, int64) {
+		t.Helper()
+		changes, err := db.ListChanges(ctx, since, 100)
+		if err != nil {
+			t.Fatalf("ListChanges(%v) = _, %v, want _, nil", since, err)
+		}
+		last := since
+		for _, change := range changes {
+			if change.Seq <= last {
+				t.Errorf("ListChanges(%v) seq %v follows %v",
+					since, change.Seq, last)
+			}
+			last = change.Seq
+			change.Seq = 0
+		}
+		return changes, last
+	}
+
+	got, seq := listChanges(0)
+	want := []*database.Change{
+		{ListID: l1.ID},
+		{ListID: l1.ID, ItemID: l1i1.ID},
+		{ListID: l1.ID, ItemID: l1i2.ID},
+		{ListID: l2.ID},
+		{ListID: l2.ID, ItemID: l2i1.ID},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListChanges(0) mismatch; -want,+got:\n%s", diff)
+	}
+
+	if latest, err := db.LatestChangeSeq(ctx); err != nil || latest != seq {
+		t.Errorf("LatestChangeSeq() = %v, %v, want %v, nil", latest, err,
+			seq)
+	}
+
+	// Nothing has changed since the latest change.
+	if got, _ := listChanges(seq); len(got) != 0 {
+		t.Errorf("ListChanges(%v) = %v, want []", seq, got)
+	}
+
+	l1, err := db.UpdateList(ctx, l1.ID, l1.Version, l1.OwnerID, now,
+		func(listData *database.ListData) error {
+			listData.Name = "renamed"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+	}
+
+	if err := db.DeleteListItem(ctx, l1.ID, l1i1.ID, l1.OwnerID, now); err != nil {
+		t.Fatalf("DeleteListItem() = %v, want nil", err)
+	}
+
+	l3, err := db.CreateList(ctx, l1.OwnerID,
+		&database.ListData{Name: "l3", Active: true}, now)
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	_, _, err = db.MoveListItems(ctx, l1.ID, l1.Version, l3.ID,
+		l3.Version, l1.OwnerID, now, []int{l1i2.ID})
+	if err != nil {
+		t.Fatalf("MoveListItems() = _, _, %v, want nil", err)
+	}
+
+	// Only the latest change to each list and item is kept. The moved
+	// item is gone from its old list and shows up in its new one.
+	got, _ = listChanges(seq)
+	want = []*database.Change{
+		{ListID: l1.ID, ItemID: l1i1.ID, Deleted: true},
+		{ListID: l1.ID},
+		{ListID: l3.ID},
+		{ListID: l1.ID, ItemID: l1i2.ID, Deleted: true},
+		{ListID: l3.ID, ItemID: l1i2.ID},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListChanges(%v) mismatch; -want,+got:\n%s", seq, diff)
+	}
+
+	// Limits are respected.
+	if got, err := db.ListChanges(ctx, 0, 2); err != nil || len(got) != 2 {
+		t.Errorf("ListChanges(0, 2) = %v, %v, want 2 changes", got, err)
+	}
+}
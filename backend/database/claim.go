@@ -0,0 +1,514 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PurchaseState tracks a claim from promise to present. It's private to the
+// claimer.
+type PurchaseState int
+
+const (
+	PurchaseClaimed PurchaseState = iota + 1
+	PurchasePurchased
+	PurchaseDelivered
+	PurchaseWrapped
+)
+
+func (s PurchaseState) String() string {
+	switch s {
+	case PurchaseClaimed:
+		return "claimed"
+	case PurchasePurchased:
+		return "purchased"
+	case PurchaseDelivered:
+		return "delivered"
+	case PurchaseWrapped:
+		return "wrapped"
+	default:
+		return fmt.Sprintf("PurchaseState(%d)", int(s))
+	}
+}
+
+// Purchases can move forward, though delivery is optional for things that
+// were bought in person. Purchases can also be undone (returned).
+var validPurchaseTransitions = map[PurchaseState][]PurchaseState{
+	PurchaseClaimed:   {PurchasePurchased},
+	PurchasePurchased: {PurchaseClaimed, PurchaseDelivered, PurchaseWrapped},
+	PurchaseDelivered: {PurchaseWrapped},
+}
+
+// A Claim records that a user has promised to buy Count units of an item.
+type Claim struct {
+	UserID int
+	Count  int
+	When   time.Time
+
+	Purchase      PurchaseState
+	PurchasedWhen time.Time
+	DeliveredWhen time.Time
+	WrappedWhen   time.Time
+
+	// Free-form notes for the claimer, like where the item is hidden.
+	Notes string
+
+	// When the claimer was reminded that the claim will expire. Zero if
+	// they haven't been.
+	RemindedWhen time.Time
+
+	// Changes made to the item by its owner since it was claimed, ordered
+	// by field. Cleared when the claimer acknowledges them.
+	Changes []*FieldChange
+}
+
+// A FieldChange records that an item field changed from Old to New. Repeated
+// changes to a field are merged, keeping the oldest Old.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+	When  time.Time
+}
+
+// NoteChange records a change to field. Changes that put a field back the
+// way it was when the claimer last looked are forgotten.
+func (c *Claim) NoteChange(field, oldValue, newValue string, now time.Time) {
+	for i, change := range c.Changes {
+		if change.Field != field {
+			continue
+		}
+
+		if change.Old == newValue {
+			c.Changes = append(c.Changes[:i], c.Changes[i+1:]...)
+			if len(c.Changes) == 0 {
+				c.Changes = nil
+			}
+		} else {
+			change.New = newValue
+			change.When = now
+		}
+		return
+	}
+
+	c.Changes = append(c.Changes, &FieldChange{
+		Field: field,
+		Old:   oldValue,
+		New:   newValue,
+		When:  now,
+	})
+	sort.Slice(c.Changes, func(i, j int) bool {
+		return c.Changes[i].Field < c.Changes[j].Field
+	})
+}
+
+// SetPurchaseState moves the claim to a new purchase state, recording when
+// that happened. Moving back to claimed clears the purchase timestamps and
+// restarts the claim, so its timeout (and expiry reminder) starts over.
+func (c *Claim) SetPurchaseState(state PurchaseState, now time.Time) error {
+	if state == c.Purchase {
+		return nil
+	}
+
+	valid := false
+	for _, next := range validPurchaseTransitions[c.Purchase] {
+		if next == state {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return status.Errorf(codes.FailedPrecondition,
+			"can't go from %v to %v", c.Purchase, state)
+	}
+
+	switch state {
+	case PurchaseClaimed:
+		c.When = now
+		c.RemindedWhen = time.Time{}
+		c.PurchasedWhen = time.Time{}
+		c.DeliveredWhen = time.Time{}
+		c.WrappedWhen = time.Time{}
+	case PurchasePurchased:
+		c.PurchasedWhen = now
+	case PurchaseDelivered:
+		c.DeliveredWhen = now
+	case PurchaseWrapped:
+		c.WrappedWhen = now
+	}
+
+	c.Purchase = state
+	return nil
+}
+
+type ClaimsByWhen []*Claim
+
+func (a ClaimsByWhen) Len() int      { return len(a) }
+func (a ClaimsByWhen) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ClaimsByWhen) Less(i, j int) bool {
+	if !a[i].When.Equal(a[j].When) {
+		return a[i].When.Before(a[j].When)
+	}
+	return a[i].UserID < a[j].UserID
+}
+
+// ClaimedCount returns the number of units claimed across all users.
+func (s *ListItemState) ClaimedCount() int {
+	num := 0
+	for _, claim := range s.Claims {
+		num += claim.Count
+	}
+	return num
+}
+
+// UserClaim returns the claim made by userID, or nil if that user hasn't
+// claimed the item.
+func (s *ListItemState) UserClaim(userID int) *Claim {
+	for _, claim := range s.Claims {
+		if claim.UserID == userID {
+			return claim
+		}
+	}
+	return nil
+}
+
+// SetClaim sets the number of units claimed by userID. A count of zero removes
+// the user's claim. New claims are timestamped when they're written.
+func (s *ListItemState) SetClaim(userID, count int) {
+	for i, claim := range s.Claims {
+		if claim.UserID != userID {
+			continue
+		}
+
+		if count == 0 {
+			s.Claims = append(s.Claims[:i], s.Claims[i+1:]...)
+			if len(s.Claims) == 0 {
+				s.Claims = nil
+			}
+		} else {
+			claim.Count = count
+		}
+		return
+	}
+
+	if count > 0 {
+		s.Claims = append(s.Claims, &Claim{
+			UserID:   userID,
+			Count:    count,
+			Purchase: PurchaseClaimed,
+		})
+	}
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// readClaims returns the claims, keyed by item ID, for the items matched by
+// the where clause. The clause is evaluated against the items table.
+func readClaims(ctx context.Context, q queryer, where string, args ...interface{}) (map[int][]*Claim, error) {
+	query := `SELECT claims.item_id, claims.user, claims.count,
+	                 claims.created, claims.purchase_state,
+	                 claims.purchased, claims.delivered, claims.wrapped,
+	                 claims.notes, claims.reminded
+	            FROM claims JOIN items ON claims.item_id = items.id
+	           WHERE ` + where + `
+	        ORDER BY claims.created ASC, claims.user ASC`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := map[int][]*Claim{}
+	for rows.Next() {
+		var itemID int
+		var purchased, delivered, wrapped, reminded nullSeconds
+		claim := &Claim{}
+		err := rows.Scan(&itemID, &claim.UserID, &claim.Count,
+			asSeconds{&claim.When}, &claim.Purchase,
+			&purchased, &delivered, &wrapped, &claim.Notes,
+			&reminded)
+		if err != nil {
+			return nil, err
+		}
+
+		claim.PurchasedWhen = purchased.Time
+		claim.DeliveredWhen = delivered.Time
+		claim.WrappedWhen = wrapped.Time
+		claim.RemindedWhen = reminded.Time
+		claims[itemID] = append(claims[itemID], claim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := readClaimChanges(ctx, q, claims, where, args...); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func readClaimChanges(ctx context.Context, q queryer, claims map[int][]*Claim, where string, args ...interface{}) error {
+	query := `SELECT claim_changes.item_id, claim_changes.user,
+	                 claim_changes.field, claim_changes.old_value,
+	                 claim_changes.new_value, claim_changes.changed
+	            FROM claim_changes
+	            JOIN items ON claim_changes.item_id = items.id
+	           WHERE ` + where + `
+	        ORDER BY claim_changes.field ASC`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var itemID, userID int
+		change := &FieldChange{}
+		err := rows.Scan(&itemID, &userID, &change.Field, &change.Old,
+			&change.New, asSeconds{&change.When})
+		if err != nil {
+			return err
+		}
+
+		for _, claim := range claims[itemID] {
+			if claim.UserID == userID {
+				claim.Changes = append(claim.Changes, change)
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// writeClaims replaces the stored claims for itemID. Claims without a
+// timestamp are given now.
+func writeClaims(ctx context.Context, txn *sql.Tx, itemID int, claims []*Claim, now time.Time) error {
+	_, err := txn.ExecContext(ctx, `DELETE FROM claims WHERE item_id = ?`,
+		itemID)
+	if err != nil {
+		return fmt.Errorf("claim delete failed: %v", err)
+	}
+
+	_, err = txn.ExecContext(ctx,
+		`DELETE FROM claim_changes WHERE item_id = ?`, itemID)
+	if err != nil {
+		return fmt.Errorf("claim change delete failed: %v", err)
+	}
+
+	if len(claims) == 0 {
+		return nil
+	}
+
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, claim := range claims {
+		if claim.When.IsZero() {
+			claim.When = now
+		}
+
+		placeholders = append(placeholders,
+			"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, itemID, claim.UserID, claim.Count,
+			claim.When.Unix(), claim.Purchase,
+			timeOrNull(claim.PurchasedWhen),
+			timeOrNull(claim.DeliveredWhen),
+			timeOrNull(claim.WrappedWhen), claim.Notes,
+			timeOrNull(claim.RemindedWhen))
+	}
+
+	query := `INSERT INTO claims (item_id, user, count, created,
+	                              purchase_state, purchased, delivered,
+	                              wrapped, notes, reminded)
+	               VALUES ` + strings.Join(placeholders, ", ")
+	if _, err := txn.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("claim write failed: %v", err)
+	}
+
+	if err := writeClaimChanges(ctx, txn, itemID, claims); err != nil {
+		return err
+	}
+
+	sort.Sort(ClaimsByWhen(claims))
+	return nil
+}
+
+func writeClaimChanges(ctx context.Context, txn *sql.Tx, itemID int, claims []*Claim) error {
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, claim := range claims {
+		for _, change := range claim.Changes {
+			placeholders = append(placeholders,
+				"(?, ?, ?, ?, ?, ?)")
+			args = append(args, itemID, claim.UserID, change.Field,
+				change.Old, change.New, change.When.Unix())
+		}
+	}
+
+	if len(placeholders) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO claim_changes (item_id, user, field, old_value,
+	                                     new_value, changed)
+	               VALUES ` + strings.Join(placeholders, ", ")
+	if _, err := txn.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("claim change write failed: %v", err)
+	}
+
+	return nil
+}
+
+// A ClaimedItem is an item claimed by a user, along with the list it's on.
+type ClaimedItem struct {
+	List *List
+	Item *ListItem
+}
+
+// ListClaimedItems returns every item claimed by userID, across all lists.
+// Items are ordered by event date, then list, then position in the list.
+func (db *DB) ListClaimedItems(ctx context.Context, userID int) ([]*ClaimedItem, error) {
+	return db.listClaimedItems(ctx, "claims.user = @user",
+		sql.Named("user", userID))
+}
+
+// ListExpirableClaims returns the items on active lists with claim timeouts
+// that have at least one claim that hasn't been purchased.
+func (db *DB) ListExpirableClaims(ctx context.Context) ([]*ClaimedItem, error) {
+	return db.listClaimedItems(ctx,
+		`lists.active = TRUE AND lists.claim_timeout_days > 0 AND
+		 claims.purchase_state = @claimed`,
+		sql.Named("claimed", PurchaseClaimed))
+}
+
+// listClaimedItems returns the items with claims matched by the where clause,
+// which is evaluated against claims joined with items and lists.
+func (db *DB) listClaimedItems(ctx context.Context, where string, args ...interface{}) ([]*ClaimedItem, error) {
+	query := `SELECT DISTINCT
+	                 lists.id, lists.version, lists.owner, lists.name,
+	                 lists.beneficiary, lists.event_date, lists.created,
+	                 lists.updated, lists.active, lists.budget,
+	                 lists.budget_currency, lists.claim_timeout_days,
+	                 items.id, items.version, items.name, items.desc,
+	                 items.url, items.price, items.currency,
+	                 items.quantity, items.group_gift, items.organizer,
+	                 items.priority, items.position, items.created,
+	                 items.updated, items.deleted
+	            FROM claims
+	            JOIN items ON claims.item_id = items.id
+	            JOIN lists ON items.list_id = lists.id
+	           WHERE ` + where + `
+	        ORDER BY lists.event_date ASC, lists.id ASC,
+	                 items.position ASC, items.id ASC`
+
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := map[int]*List{}
+	claimedItems := []*ClaimedItem{}
+	for rows.Next() {
+		list := &List{}
+		item := &ListItem{}
+		var organizer sql.NullInt64
+		var deleted nullSeconds
+		err := rows.Scan(&list.ID, &list.Version, &list.OwnerID,
+			&list.Name, &list.Beneficiary,
+			asSeconds{&list.EventDate},
+			asSeconds{&list.Created}, asSeconds{&list.Updated},
+			&list.Active, &list.Budget, &list.BudgetCurrency,
+			&list.ClaimTimeoutDays,
+			&item.ID, &item.Version,
+			&item.Name, &item.Desc, &item.URL,
+			&item.Price, &item.Currency, &item.Quantity,
+			&item.GroupGift, &organizer,
+			&item.Priority, &item.Position,
+			asSeconds{&item.Created}, asSeconds{&item.Updated},
+			&deleted)
+		if err != nil {
+			return nil, err
+		}
+		item.ListID = list.ID
+		item.Organizer = int(organizer.Int64)
+		item.Deleted = deleted.Time
+
+		// Items on the same list share a List.
+		if existing, found := lists[list.ID]; found {
+			list = existing
+		} else {
+			lists[list.ID] = list
+		}
+
+		claimedItems = append(claimedItems,
+			&ClaimedItem{List: list, Item: item})
+	}
+	rows.Close()
+
+	itemsWhere := `items.id IN (
+	                 SELECT claims.item_id
+	                   FROM claims
+	                   JOIN items ON claims.item_id = items.id
+	                   JOIN lists ON items.list_id = lists.id
+	                  WHERE ` + where + `)`
+	claims, err := readClaims(ctx, db.db, itemsWhere, args...)
+	if err != nil {
+		return nil, err
+	}
+	pledges, err := readPledges(ctx, db.db, itemsWhere, args...)
+	if err != nil {
+		return nil, err
+	}
+	images, err := readItemImages(ctx, db.db, itemsWhere, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, claimedItem := range claimedItems {
+		item := claimedItem.Item
+		item.setClaims(claims[item.ID])
+		item.Pledges = pledges[item.ID]
+		item.Images = images[item.ID]
+	}
+
+	return claimedItems, nil
+}
+
+// SetClaimReminded records that userID has been reminded that their claim
+// on itemID will expire. Reminders aren't a change to the item, so its
+// version is left alone.
+func (db *DB) SetClaimReminded(ctx context.Context, itemID, userID int, now time.Time) error {
+	query := `UPDATE claims SET reminded = @reminded
+	           WHERE item_id = @itemID AND user = @user`
+
+	result, err := db.db.ExecContext(ctx, query,
+		sql.Named("reminded", now.Unix()),
+		sql.Named("itemID", itemID),
+		sql.Named("user", userID))
+	if err != nil {
+		return err
+	}
+
+	if num, err := result.RowsAffected(); err != nil {
+		return err
+	} else if num != 1 {
+		return status.Errorf(codes.NotFound,
+			"no claim on item %v by user %v", itemID, userID)
+	}
+
+	return nil
+}
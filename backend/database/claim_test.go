@@ -0,0 +1,63 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestListClaimedItems(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b", "c"})
+	resps := createListItemTestLists(t, db)
+
+	userB := users.UserByUsername("b")
+	userC := users.UserByUsername("c")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	claim := func(listName, itemName string, userID int) *database.ListItem {
+		list, item := resps.GetItem(listName, itemName)
+		got, err := db.UpdateListItem(ctx, list.ID, item.ID,
+			item.Version, userID, now,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				state.SetClaim(userID, 1)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %v, %v) = _, %v, want _, nil",
+				list.ID, item.ID, err)
+		}
+		return got
+	}
+
+	// l2 has the later event, so its item should come last even though
+	// it's claimed first.
+	l2i1 := claim("l2", "l2i1", userC.ID)
+	l1i2 := claim("l1", "l1i2", userC.ID)
+	claim("l1", "l1i1", userB.ID)
+
+	got, err := db.ListClaimedItems(ctx, userC.ID)
+	if err != nil {
+		t.Fatalf("ListClaimedItems(_, %v) = _, %v, want _, nil",
+			userC.ID, err)
+	}
+
+	want := []*database.ClaimedItem{
+		{List: resps.GetList("l1").List, Item: l1i2},
+		{List: resps.GetList("l2").List, Item: l2i1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListClaimedItems(_, %v) mismatch; -want,+got:\n%v",
+			userC.ID, diff)
+	}
+
+	got, err = db.ListClaimedItems(ctx, users.UserByUsername("a").ID)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ListClaimedItems(_, a) = %v, %v, want [], nil",
+			got, err)
+	}
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Comment struct {
+	ID     int
+	ListID int
+	ItemID int // zero for comments on the list itself
+
+	AuthorID int
+	Body     string
+
+	Created time.Time
+	Updated time.Time
+}
+
+func (db *DB) CreateComment(ctx context.Context, listID, itemID, authorID int, body string, now time.Time) (*Comment, error) {
+	comment := &Comment{
+		ListID:   listID,
+		ItemID:   itemID,
+		AuthorID: authorID,
+		Body:     body,
+		Created:  now,
+		Updated:  now,
+	}
+
+	query := `INSERT INTO comments (list_id, item_id, author, body,
+	                                created, updated)
+	                        VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := db.db.ExecContext(ctx, query, listID,
+		sql.NullInt64{Int64: int64(itemID), Valid: itemID != 0},
+		authorID, body, now.Unix(), now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("comment create failed: %v", err)
+	}
+
+	commentID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment ID")
+	}
+
+	comment.ID = int(commentID)
+	return comment, nil
+}
+
+func (db *DB) GetComment(ctx context.Context, commentID int) (*Comment, error) {
+	comments, err := db.readComments(ctx, "id = @id", sql.Named("id", commentID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(comments) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no comment with ID %v",
+			commentID)
+	}
+	return comments[0], nil
+}
+
+// ListComments returns up to limit comments from a thread, oldest first,
+// starting after the comment with ID afterID. An itemID of zero selects the
+// list's own thread.
+func (db *DB) ListComments(ctx context.Context, listID, itemID, afterID, limit int) ([]*Comment, error) {
+	where := `list_id = @listID AND item_id IS NULL`
+	if itemID != 0 {
+		where = `list_id = @listID AND item_id = @itemID`
+	}
+
+	return db.readComments(ctx, where+` AND id > @afterID
+	                                    ORDER BY id ASC LIMIT @limit`,
+		sql.Named("listID", listID), sql.Named("itemID", itemID),
+		sql.Named("afterID", afterID), sql.Named("limit", limit))
+}
+
+func (db *DB) readComments(ctx context.Context, where string, args ...interface{}) ([]*Comment, error) {
+	query := `SELECT id, list_id, item_id, author, body, created, updated
+	            FROM comments
+	           WHERE ` + where
+
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		comment := &Comment{}
+		var itemID sql.NullInt64
+		err := rows.Scan(&comment.ID, &comment.ListID, &itemID,
+			&comment.AuthorID, &comment.Body,
+			asSeconds{&comment.Created}, asSeconds{&comment.Updated})
+		if err != nil {
+			return nil, err
+		}
+		comment.ItemID = int(itemID.Int64)
+
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// UpdateComment replaces the body of a comment. Only the author can edit a
+// comment.
+func (db *DB) UpdateComment(ctx context.Context, commentID, authorID int, body string, now time.Time) (*Comment, error) {
+	comment, err := db.GetComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.AuthorID != authorID {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"user %v did not write comment %v", authorID, commentID)
+	}
+
+	query := `UPDATE comments SET body = @body, updated = @updated
+	           WHERE id = @id`
+	_, err = db.db.ExecContext(ctx, query, sql.Named("body", body),
+		sql.Named("updated", now.Unix()), sql.Named("id", commentID))
+	if err != nil {
+		return nil, fmt.Errorf("comment update failed: %v", err)
+	}
+
+	comment.Body = body
+	comment.Updated = now
+	return comment, nil
+}
+
+// DeleteComment deletes a comment. Only the author can delete a comment.
+func (db *DB) DeleteComment(ctx context.Context, commentID, authorID int) error {
+	query := `DELETE FROM comments WHERE id = @id AND author = @author`
+
+	result, err := db.db.ExecContext(ctx, query,
+		sql.Named("id", commentID), sql.Named("author", authorID))
+	if err != nil {
+		return err
+	}
+
+	if num, err := result.RowsAffected(); err != nil {
+		return err
+	} else if num != 1 {
+		return status.Errorf(codes.NotFound,
+			"no comment with ID %v by user %v", commentID, authorID)
+	}
+
+	return nil
+}
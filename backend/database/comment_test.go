@@ -0,0 +1,105 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestComments(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b", "c"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+	userC := users.UserByUsername("c")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	listComments := []*database.Comment{}
+	for i := 0; i < 3; i++ {
+		comment, err := db.CreateComment(ctx, list.ID, 0, userB.ID,
+			"list comment", now)
+		if err != nil {
+			t.Fatalf("CreateComment(_, %v, 0, ...) = _, %v, want _, nil",
+				list.ID, err)
+		}
+		listComments = append(listComments, comment)
+	}
+
+	itemComment, err := db.CreateComment(ctx, list.ID, item.ID, userC.ID,
+		"item comment", now)
+	if err != nil {
+		t.Fatalf("CreateComment(_, %v, %v, ...) = _, %v, want _, nil",
+			list.ID, item.ID, err)
+	}
+
+	// Threads are paged by ID.
+	got, err := db.ListComments(ctx, list.ID, 0, 0, 2)
+	if err != nil {
+		t.Fatalf("ListComments(_, %v, 0, 0, 2) = _, %v, want _, nil",
+			list.ID, err)
+	}
+	if diff := cmp.Diff(listComments[:2], got); diff != "" {
+		t.Errorf("ListComments(_, %v, 0, 0, 2) mismatch; -want,+got:\n%v",
+			list.ID, diff)
+	}
+
+	got, err = db.ListComments(ctx, list.ID, 0, got[1].ID, 2)
+	if err != nil {
+		t.Fatalf("ListComments(_, %v, 0, _, 2) = _, %v, want _, nil",
+			list.ID, err)
+	}
+	if diff := cmp.Diff(listComments[2:], got); diff != "" {
+		t.Errorf("ListComments(_, %v, 0, _, 2) mismatch; -want,+got:\n%v",
+			list.ID, diff)
+	}
+
+	got, err = db.ListComments(ctx, list.ID, item.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("ListComments(_, %v, %v, 0, 10) = _, %v, want _, nil",
+			list.ID, item.ID, err)
+	}
+	if diff := cmp.Diff([]*database.Comment{itemComment}, got); diff != "" {
+		t.Errorf("ListComments(_, %v, %v, 0, 10) mismatch; -want,+got:\n%v",
+			list.ID, item.ID, diff)
+	}
+
+	// Only the author can change a comment.
+	later := now.Add(time.Hour)
+	if _, err := db.UpdateComment(ctx, itemComment.ID, userB.ID, "x", later); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("UpdateComment(_, %v, %v, ...) = _, %v, want _, PermissionDenied",
+			itemComment.ID, userB.ID, err)
+	}
+
+	updated, err := db.UpdateComment(ctx, itemComment.ID, userC.ID, "edited", later)
+	if err != nil {
+		t.Fatalf("UpdateComment(_, %v, %v, ...) = _, %v, want _, nil",
+			itemComment.ID, userC.ID, err)
+	}
+	want := *itemComment
+	want.Body = "edited"
+	want.Updated = later
+	if diff := cmp.Diff(&want, updated); diff != "" {
+		t.Errorf("UpdateComment mismatch; -want,+got:\n%v", diff)
+	}
+
+	if err := db.DeleteComment(ctx, itemComment.ID, userB.ID); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteComment(_, %v, %v) = %v, want NotFound",
+			itemComment.ID, userB.ID, err)
+	}
+	if err := db.DeleteComment(ctx, itemComment.ID, userC.ID); err != nil {
+		t.Errorf("DeleteComment(_, %v, %v) = %v, want nil",
+			itemComment.ID, userC.ID, err)
+	}
+	if _, err := db.GetComment(ctx, itemComment.ID); status.Code(err) != codes.NotFound {
+		t.Errorf("GetComment(_, %v) = _, %v, want _, NotFound",
+			itemComment.ID, err)
+	}
+}
@@ -12,6 +12,8 @@ import (
 
 type DB struct {
 	db *sql.DB
+
+	itemListener func(event *ItemEvent)
 }
 
 func CreateInMemory(ctx context.Context) (*DB, error) {
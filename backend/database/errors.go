@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A VersionError is returned when a change is made against a version of a
+// list or item other than the current one.
+type VersionError struct {
+	Requested int
+
+	// The current version of the list or item, whichever was changed.
+	List *List
+	Item *ListItem
+}
+
+// Current returns the current version of the list or item.
+func (e *VersionError) Current() int {
+	if e.Item != nil {
+		return e.Item.Version
+	}
+	return e.List.Version
+}
+
+func (e *VersionError) Error() string {
+	if e.Item != nil {
+		return fmt.Sprintf("item version ID mismatch; requested %v, need %v",
+			e.Requested, e.Item.Version)
+	}
+	return fmt.Sprintf("version ID mismatch; got %v want %v",
+		e.List.Version, e.Requested)
+}
+
+func (e *VersionError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// A ConflictError is returned when a change made against an old version of
+// a list or item changes fields that have since been changed to something
+// else.
+type ConflictError struct {
+	// The fields changed on both sides, in history field order. Empty if
+	// the changes since the old version aren't known.
+	Fields []string
+
+	// The current version of the list or item, whichever was changed.
+	List *List
+	Item *ListItem
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Fields) == 0 {
+		return "changes since base version unknown"
+	}
+	return fmt.Sprintf("conflicting changes to %v",
+		strings.Join(e.Fields, ", "))
+}
+
+// GRPCStatus reports conflicts the same way as other version mismatches.
+func (e *ConflictError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
@@ -0,0 +1,48 @@
+package database
+
+// ItemEventType says what happened to an item.
+type ItemEventType int
+
+const (
+	ItemCreated ItemEventType = iota + 1
+	ItemUpdated
+	ItemDeleted
+)
+
+// An ItemEvent describes a committed change to an item.
+type ItemEvent struct {
+	Type   ItemEventType
+	ListID int
+
+	// The item after the change. Only ID and ListID are meaningful for
+	// deletes.
+	Item *ListItem
+}
+
+// SetItemListener arranges for listener to be called after every committed
+// change to an item. The listener is called synchronously from the write
+// path, so it mustn't block, and it mustn't modify the events. It should be
+// set before the database is used.
+func (db *DB) SetItemListener(listener func(event *ItemEvent)) {
+	db.itemListener = listener
+}
+
+func (db *DB) publish(events ...*ItemEvent) {
+	if db.itemListener == nil {
+		return
+	}
+	for _, event := range events {
+		db.itemListener(event)
+	}
+}
+
+// updateEvent returns the event for an item that went through
+// doUpdateListItem. Items that doUpdateListItem removed are reported as
+// deleted.
+func updateEvent(item *ListItem) *ItemEvent {
+	event := &ItemEvent{Type: ItemUpdated, ListID: item.ListID, Item: item}
+	if !item.Deleted.IsZero() && len(item.Claims) == 0 {
+		event.Type = ItemDeleted
+	}
+	return event
+}
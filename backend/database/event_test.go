@@ -0,0 +1,71 @@
+package database_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestItemListener(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	var events []*database.ItemEvent
+	db.SetItemListener(func(event *database.ItemEvent) {
+		events = append(events, event)
+	})
+
+	list, item := resps.GetItem("l1", "l1i1")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	created, err := db.CreateListItem(ctx, list.ID, list.OwnerID,
+		&database.ListItemData{Name: "new"}, now)
+	if err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+
+	// Failed updates aren't reported.
+	_, err = db.UpdateListItem(ctx, list.ID, item.ID, item.Version+1,
+		list.OwnerID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			return nil
+		})
+	if err == nil {
+		t.Fatalf("UpdateListItem(bad version) = _, nil, want error")
+	}
+
+	if err := db.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, now); err != nil {
+		t.Fatalf("DeleteListItem() = %v, want nil", err)
+	}
+
+	// Reordering reports the items that moved.
+	_, l1i2 := resps.GetItem("l1", "l1i2")
+	_, err = db.ReorderListItems(ctx, list.ID, list.Version, list.OwnerID,
+		now, []int{created.ID, l1i2.ID})
+	if err != nil {
+		t.Fatalf("ReorderListItems() = _, %v, want _, nil", err)
+	}
+
+	type event struct {
+		Type   database.ItemEventType
+		ListID int
+		ItemID int
+	}
+	var got []event
+	for _, ev := range events {
+		got = append(got, event{ev.Type, ev.ListID, ev.Item.ID})
+	}
+	want := []event{
+		{database.ItemCreated, list.ID, created.ID},
+		{database.ItemDeleted, list.ID, item.ID},
+		{database.ItemUpdated, list.ID, created.ID},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,382 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A HistoryEntry records the fields changed by one mutation of a list or
+// item.
+type HistoryEntry struct {
+	ListID int
+	ItemID int // zero for changes to the list itself
+
+	// The list or item version created by the mutation.
+	Version int
+
+	// The user who made the change. Zero for changes made by the server,
+	// like expired claims.
+	ActorID int
+	When    time.Time
+
+	// Ordered by field. The When fields are unset.
+	Changes []*FieldChange
+}
+
+// itemHistoryFields are the item fields recorded in item history, in the
+// order they're reported.
+var itemHistoryFields = []string{
+	"name", "desc", "url", "price", "currency", "quantity", "group_gift",
+	"priority", "list", "deleted", "claims", "organizer", "pledges",
+	"images",
+}
+
+// ClaimHistoryFields are the item history fields that reveal claims. They
+// must never be shown to the item's owner.
+var ClaimHistoryFields = map[string]bool{
+	"claims":    true,
+	"organizer": true,
+	"pledges":   true,
+}
+
+var listHistoryFields = []string{
+	"name", "beneficiary", "event_date", "active", "budget",
+	"budget_currency", "claim_timeout_days", "order",
+}
+
+func secondsOrEmpty(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// itemHistoryValues returns the item's values for itemHistoryFields.
+func itemHistoryValues(item *ListItem) map[string]string {
+	claims := []string{}
+	for _, claim := range item.Claims {
+		claims = append(claims, fmt.Sprintf("%d:%d:%d", claim.UserID,
+			claim.Count, claim.Purchase))
+	}
+	sort.Strings(claims)
+
+	pledges := []string{}
+	for _, pledge := range item.Pledges {
+		pledges = append(pledges, fmt.Sprintf("%d:%d", pledge.UserID,
+			pledge.Amount))
+	}
+	sort.Strings(pledges)
+
+	organizer := ""
+	if item.Organizer != 0 {
+		organizer = strconv.Itoa(item.Organizer)
+	}
+
+	list := ""
+	if item.ListID != 0 {
+		list = strconv.Itoa(item.ListID)
+	}
+
+	return map[string]string{
+		"name":       item.Name,
+		"desc":       item.Desc,
+		"url":        item.URL,
+		"price":      strconv.FormatInt(item.Price, 10),
+		"currency":   item.Currency,
+		"quantity":   strconv.Itoa(item.Quantity),
+		"group_gift": strconv.FormatBool(item.GroupGift),
+		"priority":   strconv.Itoa(int(item.Priority)),
+		"list":       list,
+		"deleted":    secondsOrEmpty(item.Deleted),
+		"claims":     strings.Join(claims, ","),
+		"organizer":  organizer,
+		"pledges":    strings.Join(pledges, ","),
+		"images":     imagesHistoryValue(item.Images),
+	}
+}
+
+// imagesHistoryValue returns the history value for a set of item images: a
+// list of their IDs.
+func imagesHistoryValue(images []*ItemImage) string {
+	ids := []string{}
+	for _, image := range images {
+		ids = append(ids, strconv.Itoa(image.ID))
+	}
+	return strings.Join(ids, ",")
+}
+
+// setItemHistoryValue sets an item data field from its history value. Fields
+// that aren't part of ListItemData are ignored.
+func setItemHistoryValue(data *ListItemData, field, value string) error {
+	var err error
+	switch field {
+	case "name":
+		data.Name = value
+	case "desc":
+		data.Desc = value
+	case "url":
+		data.URL = value
+	case "price":
+		data.Price, err = strconv.ParseInt(value, 10, 64)
+	case "currency":
+		data.Currency = value
+	case "quantity":
+		data.Quantity, err = strconv.Atoi(value)
+	case "group_gift":
+		data.GroupGift, err = strconv.ParseBool(value)
+	case "priority":
+		var priority int
+		priority, err = strconv.Atoi(value)
+		data.Priority = ItemPriority(priority)
+	}
+	if err != nil {
+		return fmt.Errorf("bad history value %q for %v: %v", value,
+			field, err)
+	}
+	return nil
+}
+
+func listHistoryValues(list *ListData) map[string]string {
+	return map[string]string{
+		"name":               list.Name,
+		"beneficiary":        list.Beneficiary,
+		"event_date":         secondsOrEmpty(list.EventDate),
+		"active":             strconv.FormatBool(list.Active),
+		"budget":             strconv.FormatInt(list.Budget, 10),
+		"budget_currency":    list.BudgetCurrency,
+		"claim_timeout_days": strconv.Itoa(list.ClaimTimeoutDays),
+	}
+}
+
+// setListHistoryValue sets a list data field from its history value. Fields
+// that aren't part of ListData are ignored.
+func setListHistoryValue(data *ListData, field, value string) error {
+	var err error
+	switch field {
+	case "name":
+		data.Name = value
+	case "beneficiary":
+		data.Beneficiary = value
+	case "event_date":
+		data.EventDate = time.Time{}
+		if value != "" {
+			var secs int64
+			secs, err = strconv.ParseInt(value, 10, 64)
+			data.EventDate = time.Unix(secs, 0)
+		}
+	case "active":
+		data.Active, err = strconv.ParseBool(value)
+	case "budget":
+		data.Budget, err = strconv.ParseInt(value, 10, 64)
+	case "budget_currency":
+		data.BudgetCurrency = value
+	case "claim_timeout_days":
+		data.ClaimTimeoutDays, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return fmt.Errorf("bad history value %q for %v: %v", value,
+			field, err)
+	}
+	return nil
+}
+
+// historyChanges returns the fields whose values differ between before and
+// after, in fields order.
+func historyChanges(fields []string, before, after map[string]string) []*FieldChange {
+	changes := []*FieldChange{}
+	for _, field := range fields {
+		if before[field] != after[field] {
+			changes = append(changes, &FieldChange{
+				Field: field,
+				Old:   before[field],
+				New:   after[field],
+			})
+		}
+	}
+	return changes
+}
+
+// writeHistory records changes made to a list or item (if itemID is nonzero)
+// by a mutation that produced version.
+func writeHistory(ctx context.Context, txn *sql.Tx, listID, itemID, version, actorID int, now time.Time, changes []*FieldChange) error {
+	query := `INSERT INTO history (list_id, item_id, version, actor,
+	                               changed, field, old_value, new_value)
+	                       VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, change := range changes {
+		_, err := txn.ExecContext(ctx, query, listID,
+			sql.NullInt64{Int64: int64(itemID), Valid: itemID != 0},
+			version, actorID, now.Unix(), change.Field, change.Old,
+			change.New)
+		if err != nil {
+			return fmt.Errorf("history write failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// A historyUndo is the value a field had before a change.
+type historyUndo struct{ field, value string }
+
+// undoHistory returns the changes made to an item (or, if itemID is zero, to
+// the list itself) after version, as the values they replaced, newest first.
+// Applying them in order to the current values gives the values at version.
+// known is false if there's no history at or before version, as for items
+// created before history was kept, in which case the undos can't be trusted.
+func undoHistory(ctx context.Context, txn *sql.Tx, listID, itemID, version int) (undos []historyUndo, known bool, err error) {
+	where := "item_id = @itemID"
+	if itemID == 0 {
+		where = "list_id = @listID AND item_id IS NULL"
+	}
+	args := []interface{}{
+		sql.Named("listID", listID),
+		sql.Named("itemID", itemID),
+		sql.Named("version", version),
+	}
+
+	var num int
+	err = txn.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM history WHERE `+where+` AND version <= @version`,
+		args...).Scan(&num)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := txn.QueryContext(ctx,
+		`SELECT field, old_value
+		   FROM history
+		  WHERE `+where+` AND version > @version
+	       ORDER BY version DESC`,
+		args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	undos = []historyUndo{}
+	for rows.Next() {
+		var undo historyUndo
+		if err := rows.Scan(&undo.field, &undo.value); err != nil {
+			return nil, false, err
+		}
+		undos = append(undos, undo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	return undos, num > 0, nil
+}
+
+// ListHistory returns the history of an item or, if itemID is zero, of the
+// list itself, newest first. Item history follows items moved between lists.
+func (db *DB) ListHistory(ctx context.Context, listID, itemID int) ([]*HistoryEntry, error) {
+	where := "item_id = @itemID"
+	if itemID == 0 {
+		where = "list_id = @listID AND item_id IS NULL"
+	}
+
+	query := `SELECT list_id, version, actor, changed, field, old_value,
+	                 new_value
+	            FROM history
+	           WHERE ` + where + `
+	        ORDER BY version DESC, rowid`
+
+	rows, err := db.db.QueryContext(ctx, query,
+		sql.Named("listID", listID), sql.Named("itemID", itemID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*HistoryEntry{}
+	var cur *HistoryEntry
+	for rows.Next() {
+		entry := &HistoryEntry{ItemID: itemID}
+		change := &FieldChange{}
+		if err := rows.Scan(&entry.ListID, &entry.Version,
+			&entry.ActorID, asSeconds{&entry.When}, &change.Field,
+			&change.Old, &change.New); err != nil {
+			return nil, err
+		}
+
+		if cur == nil || cur.Version != entry.Version {
+			cur = entry
+			entries = append(entries, cur)
+		}
+		cur.Changes = append(cur.Changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RevertListItem restores an item's data to the way it was at toVersion,
+// as a new version. itemVersion is the item's current version. Claims and
+// other state are left alone.
+func (db *DB) RevertListItem(ctx context.Context, listID, itemID, itemVersion, toVersion, actorID int, now time.Time) (*ListItem, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := db.doRevertListItem(ctx, txn, listID, itemID, itemVersion,
+		toVersion, actorID, now)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.publish(updateEvent(item))
+	return item, nil
+}
+
+func (db *DB) doRevertListItem(ctx context.Context, txn *sql.Tx, listID, itemID, itemVersion, toVersion, actorID int, now time.Time) (*ListItem, error) {
+	if toVersion <= 0 || toVersion >= itemVersion {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"can't revert version %v to version %v", itemVersion,
+			toVersion)
+	}
+
+	undos, known, err := undoHistory(ctx, txn, listID, itemID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"no history for version %v", toVersion)
+	}
+
+	return db.doUpdateListItem(ctx, txn, listID, itemID, itemVersion,
+		actorID, now, func(data *ListItemData, state *ListItemState) error {
+			if !state.Deleted.IsZero() {
+				return status.Errorf(codes.NotFound,
+					"no item with ID %v", itemID)
+			}
+
+			// Undoing changes newest first leaves each field with
+			// the value it had at toVersion.
+			for _, undo := range undos {
+				err := setItemHistoryValue(data, undo.field,
+					undo.value)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
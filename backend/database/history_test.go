@@ -0,0 +1,152 @@
+package database_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestItemHistory(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	update := func(actorID int, update func(data *database.ListItemData, state *database.ListItemState)) {
+		t.Helper()
+		var err error
+		item, err = db.UpdateListItem(ctx, list.ID, item.ID,
+			item.Version, actorID, now,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				update(data, state)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+		}
+	}
+
+	update(list.OwnerID, func(data *database.ListItemData, state *database.ListItemState) {
+		data.Desc = ""
+		data.Price = 500
+	})
+	update(userB.ID, func(data *database.ListItemData, state *database.ListItemState) {
+		state.SetClaim(userB.ID, 1)
+	})
+	update(list.OwnerID, func(data *database.ListItemData, state *database.ListItemState) {
+		data.Name = "renamed"
+	})
+
+	entries, err := db.ListHistory(ctx, list.ID, item.ID)
+	if err != nil {
+		t.Fatalf("ListHistory() = _, %v, want _, nil", err)
+	}
+
+	itemCreated := time.Unix(testutil.SetupListsBaseStamp, 0)
+	want := []*database.HistoryEntry{
+		{ListID: list.ID, ItemID: item.ID, Version: 4, ActorID: list.OwnerID, When: now,
+			Changes: []*database.FieldChange{{Field: "name", Old: "l1i1", New: "renamed"}}},
+		{ListID: list.ID, ItemID: item.ID, Version: 3, ActorID: userB.ID, When: now,
+			Changes: []*database.FieldChange{{Field: "claims", Old: "",
+				New: fmt.Sprintf("%d:1:%d", userB.ID, database.PurchaseClaimed)}}},
+		{ListID: list.ID, ItemID: item.ID, Version: 2, ActorID: list.OwnerID, When: now,
+			Changes: []*database.FieldChange{
+				{Field: "desc", Old: "l1i1desc", New: ""},
+				{Field: "price", Old: "0", New: "500"},
+			}},
+		{ListID: list.ID, ItemID: item.ID, Version: 1, ActorID: list.OwnerID, When: itemCreated,
+			Changes: []*database.FieldChange{
+				{Field: "name", Old: "", New: "l1i1"},
+				{Field: "desc", Old: "", New: "l1i1desc"},
+				{Field: "url", Old: "", New: "l1i1url"},
+				{Field: "quantity", Old: "0", New: "1"},
+			}},
+	}
+	if diff := cmp.Diff(want, entries); diff != "" {
+		t.Errorf("ListHistory() mismatch; -want,+got:\n%s", diff)
+	}
+
+	if _, err := db.RevertListItem(ctx, list.ID, item.ID, item.Version-1, 1, list.OwnerID, now); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RevertListItem(stale) = _, %v, want FailedPrecondition", err)
+	}
+	if _, err := db.RevertListItem(ctx, list.ID, item.ID, item.Version, item.Version, list.OwnerID, now); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("RevertListItem(current) = _, %v, want InvalidArgument", err)
+	}
+
+	// Reverting to version 1 restores the data but leaves the claim.
+	reverted, err := db.RevertListItem(ctx, list.ID, item.ID, item.Version,
+		1, list.OwnerID, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("RevertListItem() = _, %v, want _, nil", err)
+	}
+	if reverted.Name != "l1i1" || reverted.Desc != "l1i1desc" ||
+		reverted.Price != 0 || reverted.Version != 5 ||
+		reverted.UserClaim(userB.ID) == nil {
+		t.Errorf("RevertListItem() = %+v, want version 1 data, claimed, version 5",
+			reverted)
+	}
+
+	// Deletes show up in the history too.
+	if err := db.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, now); err != nil {
+		t.Fatalf("DeleteListItem() = %v, want nil", err)
+	}
+	entries, err = db.ListHistory(ctx, list.ID, item.ID)
+	if err != nil || len(entries) == 0 || entries[0].Version != 6 ||
+		entries[0].Changes[0].Field != "deleted" {
+		t.Errorf("ListHistory() = %v, %v, want delete at version 6",
+			entries, err)
+	}
+}
+
+func TestListHistory(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list := resps.GetList("l1").List
+	item1, item2 := resps.GetList("l1").ListItems[0], resps.GetList("l1").ListItems[1]
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	list, err := db.UpdateList(ctx, list.ID, list.Version, list.OwnerID, now,
+		func(listData *database.ListData) error {
+			listData.Beneficiary = "someone"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+	}
+
+	list, err = db.ReorderListItems(ctx, list.ID, list.Version, list.OwnerID,
+		now, []int{item2.ID, item1.ID})
+	if err != nil {
+		t.Fatalf("ReorderListItems() = _, %v, want _, nil", err)
+	}
+
+	entries, err := db.ListHistory(ctx, list.ID, 0)
+	if err != nil {
+		t.Fatalf("ListHistory() = _, %v, want _, nil", err)
+	}
+
+	var got []string
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			got = append(got, change.Field)
+		}
+	}
+	want := []string{"order", "beneficiary", "name", "beneficiary",
+		"event_date", "active"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListHistory() fields mismatch; -want,+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ItemImage is an image attached to an item. The image data itself lives in
+// the blob store; Blob and Thumbnail are blob keys.
+type ItemImage struct {
+	ID     int
+	ItemID int
+
+	Blob        string
+	Thumbnail   string
+	ContentType string
+	Width       int
+	Height      int
+
+	Created time.Time
+}
+
+// AddItemImage attaches an image to an item. Like any other change to the
+// item, it bumps the item's version and is recorded in the item's history.
+func (db *DB) AddItemImage(ctx context.Context, listID, itemID, actorID int, image *ItemImage, now time.Time) (*ItemImage, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out *ItemImage
+	item, err := db.doChangeItemImages(ctx, txn, listID, itemID, actorID, now,
+		func() error {
+			var err error
+			out, err = doAddItemImage(ctx, txn, itemID, image, now)
+			return err
+		})
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.publish(updateEvent(item))
+	return out, nil
+}
+
+func doAddItemImage(ctx context.Context, txn *sql.Tx, itemID int, image *ItemImage, now time.Time) (*ItemImage, error) {
+	query := `INSERT INTO item_images (item_id, blob, thumbnail,
+	                                   content_type, width, height, created)
+	                           VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := txn.ExecContext(ctx, query, itemID, image.Blob,
+		image.Thumbnail, image.ContentType, image.Width, image.Height,
+		now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("image create failed: %v", err)
+	}
+
+	imageID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image ID")
+	}
+
+	out := *image
+	out.ID = int(imageID)
+	out.ItemID = itemID
+	out.Created = now
+	return &out, nil
+}
+
+// DeleteItemImage removes an image from an item, bumping the item's version.
+// The blobs it refers to are left for the garbage collector, as other images
+// may share them.
+func (db *DB) DeleteItemImage(ctx context.Context, listID, itemID, imageID, actorID int, now time.Time) error {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	item, err := db.doChangeItemImages(ctx, txn, listID, itemID, actorID, now,
+		func() error {
+			return doDeleteItemImage(ctx, txn, itemID, imageID)
+		})
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	db.publish(updateEvent(item))
+	return nil
+}
+
+func doDeleteItemImage(ctx context.Context, txn *sql.Tx, itemID, imageID int) error {
+	query := `DELETE FROM item_images WHERE id = @id AND item_id = @itemID`
+
+	result, err := txn.ExecContext(ctx, query,
+		sql.Named("id", imageID), sql.Named("itemID", itemID))
+	if err != nil {
+		return err
+	}
+
+	if num, err := result.RowsAffected(); err != nil {
+		return err
+	} else if num != 1 {
+		return status.Errorf(codes.NotFound,
+			"no image with ID %v on item %v", imageID, itemID)
+	}
+
+	return nil
+}
+
+// doChangeItemImages calls change to add or remove an item's images, then
+// updates the item as UpdateListItem would, so the change gets a new item
+// version, a change record for watchers, and an entry in the item's history.
+// It returns the updated item.
+func (db *DB) doChangeItemImages(ctx context.Context, txn *sql.Tx, listID, itemID, actorID int, now time.Time, change func() error) (*ListItem, error) {
+	var version int
+	err := txn.QueryRowContext(ctx,
+		`SELECT version FROM items WHERE id = ? AND list_id = ?`,
+		itemID, listID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, status.Errorf(codes.NotFound, "no item with ID %v",
+			itemID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	before, err := readItemImages(ctx, txn, "items.id = @id",
+		sql.Named("id", itemID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := change(); err != nil {
+		return nil, err
+	}
+
+	item, err := db.doUpdateListItem(ctx, txn, listID, itemID, version,
+		actorID, now,
+		func(data *ListItemData, state *ListItemState) error {
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// doUpdateListItem read the images after the change, so it didn't
+	// see them change.
+	err = writeHistory(ctx, txn, listID, itemID, item.Version, actorID, now,
+		[]*FieldChange{&FieldChange{
+			Field: "images",
+			Old:   imagesHistoryValue(before[itemID]),
+			New:   imagesHistoryValue(item.Images),
+		}})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListReferencedBlobs returns the keys of every blob referred to by an item
+// image.
+func (db *DB) ListReferencedBlobs(ctx context.Context) (map[string]bool, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT blob, thumbnail FROM item_images`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var blob, thumbnail string
+		if err := rows.Scan(&blob, &thumbnail); err != nil {
+			return nil, err
+		}
+		keys[blob] = true
+		keys[thumbnail] = true
+	}
+
+	return keys, rows.Err()
+}
+
+// readItemImages returns the images, keyed by item ID, for the items matched
+// by the where clause. The clause is evaluated against the items table.
+func readItemImages(ctx context.Context, q queryer, where string, args ...interface{}) (map[int][]*ItemImage, error) {
+	query := `SELECT item_images.id, item_images.item_id,
+	                 item_images.blob, item_images.thumbnail,
+	                 item_images.content_type, item_images.width,
+	                 item_images.height, item_images.created
+	            FROM item_images JOIN items ON item_images.item_id = items.id
+	           WHERE ` + where + `
+	        ORDER BY item_images.id ASC`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[int][]*ItemImage{}
+	for rows.Next() {
+		image := &ItemImage{}
+		err := rows.Scan(&image.ID, &image.ItemID, &image.Blob,
+			&image.Thumbnail, &image.ContentType, &image.Width,
+			&image.Height, asSeconds{&image.Created})
+		if err != nil {
+			return nil, err
+		}
+		images[image.ItemID] = append(images[image.ItemID], image)
+	}
+
+	return images, rows.Err()
+}
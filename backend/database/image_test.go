@@ -0,0 +1,121 @@
+package database_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestItemImages(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	var events []*database.ItemEvent
+	db.SetItemListener(func(event *database.ItemEvent) {
+		events = append(events, event)
+	})
+
+	in := &database.ItemImage{
+		Blob:        "blob1",
+		Thumbnail:   "thumb1",
+		ContentType: "image/png",
+		Width:       640,
+		Height:      480,
+	}
+	image, err := db.AddItemImage(ctx, list.ID, item.ID, list.OwnerID, in,
+		now)
+	if err != nil {
+		t.Fatalf("AddItemImage(_, %v, %+v) = _, %v, want _, nil",
+			item.ID, in, err)
+	}
+
+	want := *in
+	want.ID = image.ID
+	want.ItemID = item.ID
+	want.Created = now
+	if diff := cmp.Diff(&want, image); diff != "" {
+		t.Errorf("AddItemImage mismatch; -want,+got:\n%v", diff)
+	}
+
+	items, err := db.ListListItems(ctx, list.ID,
+		database.OnlyItemWithID(item.ID))
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ListListItems(_, %v, %v) = %v, %v, want 1 item, nil",
+			list.ID, item.ID, items, err)
+	}
+	if diff := cmp.Diff([]*database.ItemImage{&want}, items[0].Images); diff != "" {
+		t.Errorf("ListListItems images mismatch; -want,+got:\n%v", diff)
+	}
+	if items[0].Version != item.Version+1 {
+		t.Errorf("version after add = %v, want %v", items[0].Version,
+			item.Version+1)
+	}
+
+	blobs, err := db.ListReferencedBlobs(ctx)
+	if err != nil {
+		t.Fatalf("ListReferencedBlobs() = _, %v, want _, nil", err)
+	}
+	if want := map[string]bool{"blob1": true, "thumb1": true}; !cmp.Equal(want, blobs) {
+		t.Errorf("ListReferencedBlobs() = %v, want %v", blobs, want)
+	}
+
+	_, l1i2 := resps.GetItem("l1", "l1i2")
+	if err := db.DeleteItemImage(ctx, list.ID, l1i2.ID, image.ID, list.OwnerID, now); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteItemImage(_, wrong item, %v) = %v, want NotFound",
+			image.ID, err)
+	}
+	if err := db.DeleteItemImage(ctx, list.ID, item.ID, image.ID, list.OwnerID, now); err != nil {
+		t.Errorf("DeleteItemImage(_, %v, %v) = %v, want nil",
+			item.ID, image.ID, err)
+	}
+
+	if blobs, err := db.ListReferencedBlobs(ctx); err != nil || len(blobs) != 0 {
+		t.Errorf("ListReferencedBlobs() = %v, %v, want empty, nil",
+			blobs, err)
+	}
+
+	history, err := db.ListHistory(ctx, list.ID, item.ID)
+	if err != nil || len(history) < 2 {
+		t.Fatalf("ListHistory() = %v, %v, want 2+ entries, nil", history,
+			err)
+	}
+	var got []database.FieldChange
+	for _, entry := range history[:2] {
+		for _, change := range entry.Changes {
+			got = append(got, *change)
+		}
+	}
+	imageID := strconv.Itoa(image.ID)
+	wantHistory := []database.FieldChange{
+		{Field: "images", Old: imageID, New: ""},
+		{Field: "images", Old: "", New: imageID},
+	}
+	if diff := cmp.Diff(wantHistory, got); diff != "" {
+		t.Errorf("history mismatch; -want,+got:\n%v", diff)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("events = %v, want 2", events)
+	}
+	for _, event := range events {
+		if event.Type != database.ItemUpdated || event.Item.ID != item.ID {
+			t.Errorf("event = %+v, want update of item %v", event,
+				item.ID)
+		}
+	}
+	if got := events[1].Item; got.Version != item.Version+2 || len(got.Images) != 0 {
+		t.Errorf("delete event item = %+v, want version %v with no images",
+			got, item.Version+2)
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/simmonmt/xmaslist/backend/rpcerror"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 type ListsByID []*List
@@ -21,6 +21,15 @@ type ListData struct {
 	Beneficiary string
 	EventDate   time.Time
 	Active      bool
+
+	// Suggested per-giver budget in minor currency units (e.g. cents).
+	// Zero means no budget.
+	Budget         int64
+	BudgetCurrency string
+
+	// Unpurchased claims are released after this many days. Zero means
+	// claims don't expire.
+	ClaimTimeoutDays int
 }
 
 type List struct {
@@ -44,22 +53,47 @@ func (db *DB) CreateList(ctx context.Context, ownerID int, listData *ListData, n
 
 	query := `INSERT INTO lists (version, owner, name, beneficiary,
                                      event_date, created, updated,
-                                     active)
-                         VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	result, err := db.db.ExecContext(ctx, query,
+                                     active, budget, budget_currency,
+                                     claim_timeout_days)
+                         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := txn.ExecContext(ctx, query,
 		list.Version, list.OwnerID, list.Name,
 		list.Beneficiary, list.EventDate.Unix(),
-		list.Created.Unix(), list.Updated.Unix(), list.Active)
+		list.Created.Unix(), list.Updated.Unix(), list.Active,
+		list.Budget, list.BudgetCurrency, list.ClaimTimeoutDays)
 	if err != nil {
+		_ = txn.Rollback()
 		return nil, fmt.Errorf("list create failed: %v", err)
 	}
 
 	listID, err := result.LastInsertId()
 	if err != nil {
+		_ = txn.Rollback()
 		return nil, fmt.Errorf("failed to get list ID")
 	}
-
 	list.ID = int(listID)
+
+	changes := historyChanges(listHistoryFields,
+		listHistoryValues(&ListData{}), listHistoryValues(&list.ListData))
+	err = writeHistory(ctx, txn, list.ID, 0, list.Version, ownerID, now,
+		changes)
+	if err == nil {
+		err = recordChange(ctx, txn, list.ID, 0, false)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
 	return list, nil
 }
 
@@ -84,7 +118,8 @@ func (db *DB) UpdateList(ctx context.Context, listID int, listVersion int, userI
 
 func (db *DB) doUpdateList(ctx context.Context, txn *sql.Tx, listID int, listVersion int, userID int, now time.Time, update func(listData *ListData) error) (*List, error) {
 	readQuery := `SELECT version, owner, name, beneficiary, event_date,
-                             created, active
+                             created, active, budget, budget_currency,
+                             claim_timeout_days
                         FROM lists
                        WHERE id = @id`
 
@@ -92,23 +127,24 @@ func (db *DB) doUpdateList(ctx context.Context, txn *sql.Tx, listID int, listVer
 	err := txn.QueryRowContext(ctx, readQuery, sql.Named("id", listID)).Scan(
 		&list.Version, &list.OwnerID, &list.Name,
 		&list.Beneficiary, asSeconds{&list.EventDate},
-		asSeconds{&list.Created}, &list.Active)
+		asSeconds{&list.Created}, &list.Active,
+		&list.Budget, &list.BudgetCurrency, &list.ClaimTimeoutDays)
 	if err != nil {
 		return nil, err
 	}
 
 	if list.Version != listVersion {
-		return nil, status.Errorf(codes.FailedPrecondition,
-			"version ID mismatch; got %v want %v",
-			list.Version, listVersion)
+		return nil, &VersionError{Requested: listVersion, List: list}
 	}
 
 	if list.OwnerID != userID {
-		return nil, status.Errorf(codes.PermissionDenied,
+		return nil, rpcerror.Errorf(codes.PermissionDenied,
+			rpcerror.ReasonNotOwner,
 			"user %v does not own list %v (owner %v)",
 			userID, list.ID, list.OwnerID)
 	}
 
+	before := listHistoryValues(&list.ListData)
 	if err := update(&list.ListData); err != nil {
 		return nil, err
 	}
@@ -116,11 +152,27 @@ func (db *DB) doUpdateList(ctx context.Context, txn *sql.Tx, listID int, listVer
 	list.Version++
 	list.Updated = now
 
+	changes := historyChanges(listHistoryFields, before,
+		listHistoryValues(&list.ListData))
+	err = writeHistory(ctx, txn, listID, 0, list.Version, userID, now,
+		changes)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordChange(ctx, txn, listID, 0, false); err != nil {
+		return nil, err
+	}
+	if err := notifyListUpdated(ctx, txn, list, changes, userID); err != nil {
+		return nil, err
+	}
+
 	writeQuery := `UPDATE lists
                           SET ( name, beneficiary, event_date, active,
-                                version, updated ) =
+                                budget, budget_currency,
+                                claim_timeout_days, version, updated ) =
                               ( @name, @beneficiary, @eventDate, @active,
-                                @version, @updated )
+                                @budget, @budgetCurrency,
+                                @claimTimeoutDays, @version, @updated )
                         WHERE id = @id`
 
 	_, err = txn.ExecContext(ctx, writeQuery,
@@ -128,6 +180,9 @@ func (db *DB) doUpdateList(ctx context.Context, txn *sql.Tx, listID int, listVer
 		sql.Named("beneficiary", list.Beneficiary),
 		sql.Named("eventDate", list.EventDate.Unix()),
 		sql.Named("active", list.Active),
+		sql.Named("budget", list.Budget),
+		sql.Named("budgetCurrency", list.BudgetCurrency),
+		sql.Named("claimTimeoutDays", list.ClaimTimeoutDays),
 		sql.Named("version", list.Version),
 		sql.Named("updated", list.Updated.Unix()),
 		sql.Named("id", listID))
@@ -155,7 +210,8 @@ func IncludeInactiveLists(include bool) ListFilter {
 
 func (db *DB) ListLists(ctx context.Context, filter ListFilter) ([]*List, error) {
 	query := `SELECT id, version, owner, name, beneficiary,
-                         event_date, created, updated, active
+                         event_date, created, updated, active,
+                         budget, budget_currency, claim_timeout_days
                   FROM lists`
 	if filter.where != "" {
 		query += " WHERE " + filter.where
@@ -175,7 +231,8 @@ func (db *DB) ListLists(ctx context.Context, filter ListFilter) ([]*List, error)
 			&list.Name, &list.Beneficiary,
 			asSeconds{&list.EventDate},
 			asSeconds{&list.Created}, asSeconds{&list.Updated},
-			&list.Active)
+			&list.Active, &list.Budget, &list.BudgetCurrency,
+			&list.ClaimTimeoutDays)
 		if err != nil {
 			return nil, err
 		}
@@ -4,32 +4,124 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/simmonmt/xmaslist/backend/rpcerror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type ListItemState struct {
-	ClaimedBy int
+	// Claims, ordered by claim time.
+	Claims []*Claim
+
+	// Group gift contributions, ordered by pledge time, and the user
+	// who will make the purchase.
+	Pledges   []*Pledge
+	Organizer int
+
+	// Set when the owner deletes an item that has been claimed. The item
+	// is kept for its claimers until they've all released their claims.
+	Deleted time.Time
 }
 
+type ItemPriority int
+
+const (
+	PriorityUnspecified ItemPriority = iota
+	PriorityMustHave
+	PriorityNiceToHave
+)
+
 type ListItemData struct {
 	Name string
 	Desc string
 	URL  string
+
+	// Price in minor currency units (e.g. cents). Zero means no price.
+	Price    int64
+	Currency string
+
+	// The number of units wanted. Zero is treated as one.
+	Quantity int
+
+	// Whether givers can pool money toward the item.
+	GroupGift bool
+
+	Priority ItemPriority
 }
 
 type ListItem struct {
 	ListItemData
 	ListItemState
 
-	ID          int
-	Version     int
-	ListID      int
-	Created     time.Time
-	Updated     time.Time
+	ID      int
+	Version int
+	ListID  int
+	Created time.Time
+	Updated time.Time
+
+	// Items are returned in position order. Set by ReorderListItems.
+	Position int
+
+	// Derived from Claims for compatibility with single-claimer
+	// clients: the first user to claim the item and when they did so.
+	ClaimedBy   int
 	ClaimedWhen time.Time
+
+	// Images attached by the owner, oldest first.
+	Images []*ItemImage
+}
+
+// FullyClaimed returns true if the claimed count has reached the desired
+// quantity.
+func (item *ListItem) FullyClaimed() bool {
+	return item.ClaimedCount() >= item.Quantity
+}
+
+// VisibleTo returns true if userID should be shown the item. Deleted items
+// are only shown to their claimers.
+func (item *ListItem) VisibleTo(userID int) bool {
+	return item.Deleted.IsZero() || item.UserClaim(userID) != nil
+}
+
+// substantiveChanges returns the changes from before to after that matter to
+// somebody who has claimed the item.
+func substantiveChanges(before, after *ListItemData) []*FieldChange {
+	changes := []*FieldChange{}
+	add := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, &FieldChange{
+				Field: field,
+				Old:   oldValue,
+				New:   newValue,
+			})
+		}
+	}
+
+	add("name", before.Name, after.Name)
+	add("desc", before.Desc, after.Desc)
+	add("url", before.URL, after.URL)
+	add("price", strconv.FormatInt(before.Price, 10),
+		strconv.FormatInt(after.Price, 10))
+	add("currency", before.Currency, after.Currency)
+	add("quantity", strconv.Itoa(before.Quantity),
+		strconv.Itoa(after.Quantity))
+
+	return changes
+}
+
+func (item *ListItem) setClaims(claims []*Claim) {
+	item.Claims = claims
+	item.ClaimedBy = 0
+	item.ClaimedWhen = time.Time{}
+	if len(claims) > 0 {
+		item.ClaimedBy = claims[0].UserID
+		item.ClaimedWhen = claims[0].When
+	}
 }
 
 type ItemFilter struct {
@@ -41,10 +133,32 @@ func AllItems() ItemFilter {
 }
 
 func OnlyItemWithID(id int) ItemFilter {
-	return ItemFilter{fmt.Sprintf("id = %d", id)}
+	return ItemFilter{fmt.Sprintf("items.id = %d", id)}
+}
+
+// CreateListItem adds an item to the end of a list. actorID is recorded as
+// the creator in the item's history.
+func (db *DB) CreateListItem(ctx context.Context, listID int, actorID int, itemData *ListItemData, now time.Time) (*ListItem, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := doCreateListItem(ctx, txn, listID, actorID, itemData, now)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.publish(&ItemEvent{Type: ItemCreated, ListID: listID, Item: item})
+	return item, nil
 }
 
-func (db *DB) CreateListItem(ctx context.Context, listID int, itemData *ListItemData, now time.Time) (*ListItem, error) {
+func doCreateListItem(ctx context.Context, txn *sql.Tx, listID int, actorID int, itemData *ListItemData, now time.Time) (*ListItem, error) {
 	item := &ListItem{
 		ListItemData: *itemData,
 		Version:      1,
@@ -52,13 +166,24 @@ func (db *DB) CreateListItem(ctx context.Context, listID int, itemData *ListItem
 		Created:      now,
 		Updated:      now,
 	}
+	if item.Quantity <= 0 {
+		item.Quantity = 1
+	}
+
+	position, err := nextItemPosition(ctx, txn, listID)
+	if err != nil {
+		return nil, err
+	}
+	item.Position = position
 
 	listInsert := `INSERT INTO items (version, list_id, name, desc, url,
-	                                  created, updated)
-	                      VALUES (?, ?, ?, ?, ?, ?, ?)`
-	result, err := db.db.ExecContext(ctx, listInsert,
+	                                  price, currency, quantity, group_gift,
+	                                  priority, position, created, updated)
+	                      VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := txn.ExecContext(ctx, listInsert,
 		item.Version, item.ListID,
-		item.Name, item.Desc, item.URL,
+		item.Name, item.Desc, item.URL, item.Price, item.Currency,
+		item.Quantity, item.GroupGift, item.Priority, item.Position,
 		item.Created.Unix(), item.Updated.Unix())
 	if err != nil {
 		return nil, fmt.Errorf("item create failed: %v", err)
@@ -70,18 +195,48 @@ func (db *DB) CreateListItem(ctx context.Context, listID int, itemData *ListItem
 	}
 	item.ID = int(itemID)
 
+	changes := historyChanges(itemHistoryFields,
+		itemHistoryValues(&ListItem{ListID: listID}),
+		itemHistoryValues(item))
+	err = writeHistory(ctx, txn, listID, item.ID, item.Version, actorID,
+		now, changes)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordChange(ctx, txn, listID, item.ID, false); err != nil {
+		return nil, err
+	}
+	if err := notifyItemCreated(ctx, txn, item, actorID); err != nil {
+		return nil, err
+	}
+
 	return item, nil
 }
 
+// nextItemPosition returns the position for an item added to the end of a
+// list.
+func nextItemPosition(ctx context.Context, txn *sql.Tx, listID int) (int, error) {
+	var position int
+	positionQuery := `SELECT COALESCE(MAX(position), 0) FROM items
+	                   WHERE list_id = ?`
+	if err := txn.QueryRowContext(ctx, positionQuery, listID).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to get item position: %v", err)
+	}
+	return position + 1, nil
+}
+
 func (db *DB) ListListItems(ctx context.Context, listID int, filter ItemFilter) ([]*ListItem, error) {
-	query := `SELECT id, version, name, desc, url, created, updated,
-	                 claimed_by, claimed_when
-	          FROM items
-                  WHERE list_id = @listID`
+	where := "list_id = @listID"
 	if filter.where != "" {
-		query += " AND " + filter.where
+		where += " AND " + filter.where
 	}
-	query += " ORDER BY id ASC"
+
+	query := `SELECT id, version, name, desc, url, price, currency,
+	                 quantity, group_gift, organizer, priority, position,
+	                 created, updated, deleted
+	          FROM items
+                  WHERE ` + where + `
+                  ORDER BY position ASC, id ASC`
 
 	items := []*ListItem{}
 	rows, err := db.db.QueryContext(ctx, query, sql.Named("listID", listID))
@@ -92,36 +247,57 @@ func (db *DB) ListListItems(ctx context.Context, listID int, filter ItemFilter)
 
 	for rows.Next() {
 		item := &ListItem{ListID: listID}
-		var claimedBy sql.NullInt64
-		var claimedWhen nullSeconds
+		var organizer sql.NullInt64
+		var deleted nullSeconds
 		err := rows.Scan(&item.ID, &item.Version,
 			&item.Name, &item.Desc, &item.URL,
+			&item.Price, &item.Currency, &item.Quantity,
+			&item.GroupGift, &organizer,
+			&item.Priority, &item.Position,
 			asSeconds{&item.Created}, asSeconds{&item.Updated},
-			&claimedBy, &claimedWhen)
+			&deleted)
 		if err != nil {
 			return nil, err
 		}
-
-		if claimedBy.Valid {
-			item.ClaimedBy = int(claimedBy.Int64)
-		}
-		if claimedWhen.Valid {
-			item.ClaimedWhen = claimedWhen.Time
-		}
+		item.Organizer = int(organizer.Int64)
+		item.Deleted = deleted.Time
 
 		items = append(items, item)
 	}
+	rows.Close()
+
+	claims, err := readClaims(ctx, db.db, where, sql.Named("listID", listID))
+	if err != nil {
+		return nil, err
+	}
+	pledges, err := readPledges(ctx, db.db, where, sql.Named("listID", listID))
+	if err != nil {
+		return nil, err
+	}
+	images, err := readItemImages(ctx, db.db, where, sql.Named("listID", listID))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		item.setClaims(claims[item.ID])
+		item.Pledges = pledges[item.ID]
+		item.Images = images[item.ID]
+	}
 
 	return items, nil
 }
 
-func (db *DB) UpdateListItem(ctx context.Context, listID int, itemID int, itemVersion int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (*ListItem, error) {
+// UpdateListItem applies update to an item, which must be at itemVersion.
+// actorID, which is zero for changes made by the server, is recorded in the
+// item's history.
+func (db *DB) UpdateListItem(ctx context.Context, listID int, itemID int, itemVersion int, actorID int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (*ListItem, error) {
 	txn, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	newItem, err := db.doUpdateListItem(ctx, txn, listID, itemID, itemVersion, now, update)
+	newItem, err := db.doUpdateListItem(ctx, txn, listID, itemID, itemVersion, actorID, now, update)
 	if err != nil {
 		_ = txn.Rollback()
 		return nil, err
@@ -131,70 +307,159 @@ func (db *DB) UpdateListItem(ctx context.Context, listID int, itemID int, itemVe
 		return nil, err
 	}
 
+	db.publish(updateEvent(newItem))
 	return newItem, nil
 }
 
-func (db *DB) doUpdateListItem(ctx context.Context, txn *sql.Tx, listID int, itemID int, itemVersion int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (*ListItem, error) {
-	readQuery := `SELECT version, name, desc, url, created, updated,
-	                     claimed_by, claimed_when
+func (db *DB) doUpdateListItem(ctx context.Context, txn *sql.Tx, listID int, itemID int, itemVersion int, actorID int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (*ListItem, error) {
+	readQuery := `SELECT version, name, desc, url, price, currency,
+	                     quantity, group_gift, organizer, priority,
+	                     position, created, updated, deleted
 	                FROM items
 	               WHERE id = @id AND list_id = @listID`
 
 	item := &ListItem{ID: itemID, ListID: listID}
-	var claimedBy sql.NullInt64
-	var claimedWhen nullSeconds
+	var organizer sql.NullInt64
+	var deleted nullSeconds
 	err := txn.QueryRowContext(ctx, readQuery, sql.Named("id", itemID), sql.Named("listID", listID)).Scan(
 		&item.Version,
 		&item.Name, &item.Desc, &item.URL,
-		asSeconds{&item.Created}, asSeconds{&item.Updated},
-		&claimedBy, &claimedWhen)
+		&item.Price, &item.Currency, &item.Quantity,
+		&item.GroupGift, &organizer,
+		&item.Priority, &item.Position,
+		asSeconds{&item.Created}, asSeconds{&item.Updated}, &deleted)
+	if err == sql.ErrNoRows {
+		return nil, status.Errorf(codes.NotFound, "no item with ID %v",
+			itemID)
+	} else if err != nil {
+		return nil, err
+	}
+	item.Organizer = int(organizer.Int64)
+	item.Deleted = deleted.Time
+
+	claims, err := readClaims(ctx, txn, "items.id = @id",
+		sql.Named("id", itemID))
+	if err != nil {
+		return nil, err
+	}
+	item.setClaims(claims[itemID])
+
+	pledges, err := readPledges(ctx, txn, "items.id = @id",
+		sql.Named("id", itemID))
 	if err != nil {
 		return nil, err
 	}
+	item.Pledges = pledges[itemID]
 
-	if claimedBy.Valid {
-		item.ClaimedBy = int(claimedBy.Int64)
+	images, err := readItemImages(ctx, txn, "items.id = @id",
+		sql.Named("id", itemID))
+	if err != nil {
+		return nil, err
 	}
-	wasClaimed := claimedBy.Valid && claimedBy.Int64 != 0
+	item.Images = images[itemID]
 
-	if claimedWhen.Valid {
-		item.ClaimedWhen = claimedWhen.Time
+	// Removed items only exist for their claimers (and the server), so
+	// nobody else gets to learn anything about them, even their version.
+	if actorID != 0 && !item.VisibleTo(actorID) {
+		return nil, status.Errorf(codes.NotFound, "no item with ID %v",
+			itemID)
 	}
 
 	if item.Version != itemVersion {
-		return nil, status.Errorf(codes.FailedPrecondition,
-			"item version ID mismatch; requested %v, need %v",
-			itemVersion, item.Version)
+		return nil, &VersionError{Requested: itemVersion, Item: item}
 	}
 
+	before := item.ListItemData
+	beforeClaims := append([]*Claim{}, item.Claims...)
+	beforeDeleted := item.Deleted
+	beforeValues := itemHistoryValues(item)
 	if err := update(&item.ListItemData, &item.ListItemState); err != nil {
 		return nil, err
 	}
 
-	isClaimed := item.ClaimedBy != 0
+	if item.Quantity <= 0 {
+		item.Quantity = 1
+	}
+
+	// Tell the claimers about anything that changed under them. Claims
+	// made by this update (which don't have a timestamp yet) were made
+	// against the new data.
+	for _, change := range substantiveChanges(&before, &item.ListItemData) {
+		for _, claim := range item.Claims {
+			if !claim.When.IsZero() {
+				claim.NoteChange(change.Field, change.Old,
+					change.New, now)
+			}
+		}
+	}
+
+	// Deleted items only stick around while they're claimed.
+	if !item.Deleted.IsZero() && len(item.Claims) == 0 {
+		if err := doDeleteListItem(ctx, txn, listID, itemID); err != nil {
+			return nil, err
+		}
+		item.setClaims(nil)
+
+		item.Version++
+		item.Updated = now
+		changes := historyChanges(itemHistoryFields, beforeValues,
+			itemHistoryValues(item))
+		err := writeHistory(ctx, txn, listID, itemID, item.Version,
+			actorID, now, changes)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordChange(ctx, txn, listID, itemID, true); err != nil {
+			return nil, err
+		}
+		err = notifyItemUpdated(ctx, txn, &before, beforeClaims,
+			beforeDeleted, item, actorID, now)
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
 
-	claimedBy = sql.NullInt64{
-		Int64: int64(item.ClaimedBy),
-		Valid: item.ClaimedBy != 0,
+	if err := writeClaims(ctx, txn, itemID, item.Claims, now); err != nil {
+		return nil, err
 	}
+	item.setClaims(item.Claims)
 
-	claimedWhen.Valid = isClaimed
-	if !wasClaimed && isClaimed {
-		claimedWhen.Time = now // update time because claim change
-		item.ClaimedWhen = now
-	} else if !isClaimed {
-		claimedWhen.Time = time.Time{}
-		item.ClaimedWhen = time.Time{}
+	if err := writePledges(ctx, txn, itemID, item.Pledges, now); err != nil {
+		return nil, err
+	}
+
+	organizer = sql.NullInt64{
+		Int64: int64(item.Organizer),
+		Valid: item.Organizer != 0,
 	}
 
 	item.Version++
 	item.Updated = now
 
+	changes := historyChanges(itemHistoryFields, beforeValues,
+		itemHistoryValues(item))
+	err = writeHistory(ctx, txn, listID, itemID, item.Version, actorID, now,
+		changes)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordChange(ctx, txn, listID, itemID, false); err != nil {
+		return nil, err
+	}
+	err = notifyItemUpdated(ctx, txn, &before, beforeClaims, beforeDeleted,
+		item, actorID, now)
+	if err != nil {
+		return nil, err
+	}
+
 	writeQuery := `UPDATE items
-	                  SET ( version, name, desc, url, updated,
-	                        claimed_by, claimed_when ) =
-	                      ( @version, @name, @desc, @url, @updated,
-	                        @claimedBy, @claimedWhen )
+	                  SET ( version, name, desc, url, price, currency,
+	                        quantity, group_gift, organizer, priority,
+	                        updated, deleted ) =
+	                      ( @version, @name, @desc, @url, @price,
+	                        @currency, @quantity, @groupGift, @organizer,
+	                        @priority, @updated, @deleted )
 	                WHERE id = @id AND list_id = @listID`
 
 	_, err = txn.ExecContext(ctx, writeQuery,
@@ -202,9 +467,14 @@ func (db *DB) doUpdateListItem(ctx context.Context, txn *sql.Tx, listID int, ite
 		sql.Named("name", item.Name),
 		sql.Named("desc", item.Desc),
 		sql.Named("url", item.URL),
+		sql.Named("price", item.Price),
+		sql.Named("currency", item.Currency),
+		sql.Named("quantity", item.Quantity),
+		sql.Named("groupGift", item.GroupGift),
+		sql.Named("organizer", organizer),
+		sql.Named("priority", item.Priority),
 		sql.Named("updated", item.Updated.Unix()),
-		sql.Named("claimedBy", claimedBy),
-		sql.Named("claimedWhen", claimedWhen),
+		sql.Named("deleted", timeOrNull(item.Deleted)),
 		sql.Named("id", itemID),
 		sql.Named("listID", listID))
 	if err != nil {
@@ -214,11 +484,59 @@ func (db *DB) doUpdateListItem(ctx context.Context, txn *sql.Tx, listID int, ite
 	return item, err
 }
 
-func (db *DB) DeleteListItem(ctx context.Context, listID int, itemID int) error {
+// DeleteListItem deletes an item. Claimed items are only marked as deleted,
+// so their claimers can see what happened to them. They're removed once the
+// last claim is released.
+func (db *DB) DeleteListItem(ctx context.Context, listID int, itemID int, actorID int, now time.Time) error {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = txn.QueryRowContext(ctx,
+		`SELECT version FROM items WHERE list_id = ? AND id = ?`,
+		listID, itemID).Scan(&version)
+	if err == sql.ErrNoRows {
+		err = status.Errorf(codes.NotFound, "no item with ID %v", itemID)
+	}
+	var item *ListItem
+	if err == nil {
+		item, err = db.doSoftDeleteListItem(ctx, txn, listID, itemID,
+			version, actorID, now)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	db.publish(updateEvent(item))
+	return nil
+}
+
+// doSoftDeleteListItem marks an item at itemVersion deleted, leaving
+// doUpdateListItem to decide whether it has to be kept for its claimers.
+func (db *DB) doSoftDeleteListItem(ctx context.Context, txn *sql.Tx, listID int, itemID int, itemVersion int, actorID int, now time.Time) (*ListItem, error) {
+	return db.doUpdateListItem(ctx, txn, listID, itemID, itemVersion,
+		actorID, now, func(data *ListItemData, state *ListItemState) error {
+			if !state.Deleted.IsZero() {
+				return status.Errorf(codes.NotFound,
+					"no item with ID %v", itemID)
+			}
+			state.Deleted = now
+			return nil
+		})
+}
+
+func doDeleteListItem(ctx context.Context, txn *sql.Tx, listID int, itemID int) error {
 	query := `DELETE FROM items
 	                WHERE list_id = @listID AND id = @itemID`
 
-	result, err := db.db.ExecContext(ctx, query,
+	result, err := txn.ExecContext(ctx, query,
 		sql.Named("listID", listID),
 		sql.Named("itemID", itemID))
 	if err != nil {
@@ -234,3 +552,525 @@ func (db *DB) DeleteListItem(ctx context.Context, listID int, itemID int) error
 
 	return nil
 }
+
+// ReorderListItems sets the order of the items in a list. itemIDs must contain
+// every item in the list exactly once. Reordering is a change to the list, so
+// the list version is checked and incremented.
+func (db *DB) ReorderListItems(ctx context.Context, listID int, listVersion int, userID int, now time.Time, itemIDs []int) (*List, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list, moved, err := db.doReorderListItems(ctx, txn, listID, listVersion, userID, now, itemIDs)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.publishReorder(ctx, listID, moved)
+	return list, nil
+}
+
+// publishReorder reports the items whose positions changed as updated. The
+// reorder has already been committed, so if the items can't be read,
+// watchers just don't hear about it.
+func (db *DB) publishReorder(ctx context.Context, listID int, itemIDs []int) {
+	if db.itemListener == nil || len(itemIDs) == 0 {
+		return
+	}
+
+	items, err := db.ListListItems(ctx, listID, AllItems())
+	if err != nil {
+		return
+	}
+	movedIDs := map[int]bool{}
+	for _, itemID := range itemIDs {
+		movedIDs[itemID] = true
+	}
+
+	for _, item := range items {
+		if movedIDs[item.ID] {
+			db.publish(&ItemEvent{
+				Type:   ItemUpdated,
+				ListID: listID,
+				Item:   item,
+			})
+		}
+	}
+}
+
+// doReorderListItems reorders the list, returning it along with the IDs of
+// the items whose positions changed.
+func (db *DB) doReorderListItems(ctx context.Context, txn *sql.Tx, listID int, listVersion int, userID int, now time.Time, itemIDs []int) (*List, []int, error) {
+	list, err := db.doUpdateList(ctx, txn, listID, listVersion, userID, now,
+		func(listData *ListData) error { return nil })
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := txn.QueryContext(ctx,
+		`SELECT id, position FROM items
+		  WHERE list_id = ? AND deleted IS NULL
+		  ORDER BY position`,
+		listID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	positions := map[int]int{}
+	oldOrder := []int{}
+	for rows.Next() {
+		var id, position int
+		if err := rows.Scan(&id, &position); err != nil {
+			return nil, nil, err
+		}
+		positions[id] = position
+		oldOrder = append(oldOrder, id)
+	}
+	rows.Close()
+
+	if len(positions) != len(itemIDs) {
+		return nil, nil, status.Errorf(codes.FailedPrecondition,
+			"got %v item IDs, list has %v items",
+			len(itemIDs), len(positions))
+	}
+
+	moved := []int{}
+	for i, itemID := range itemIDs {
+		position, found := positions[itemID]
+		if !found {
+			return nil, nil, status.Errorf(codes.FailedPrecondition,
+				"item %v is not in list %v", itemID, listID)
+		}
+		delete(positions, itemID)
+
+		if position == i+1 {
+			continue
+		}
+		moved = append(moved, itemID)
+
+		_, err := txn.ExecContext(ctx,
+			`UPDATE items SET position = ? WHERE id = ?`,
+			i+1, itemID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("position write failed: %v", err)
+		}
+		if err := recordChange(ctx, txn, listID, itemID, false); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	change := &FieldChange{
+		Field: "order",
+		Old:   joinIDs(oldOrder),
+		New:   joinIDs(itemIDs),
+	}
+	if change.Old != change.New {
+		err := writeHistory(ctx, txn, listID, 0, list.Version, userID,
+			now, []*FieldChange{change})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return list, moved, nil
+}
+
+func joinIDs(ids []int) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.Itoa(id)
+	}
+	return strings.Join(strs, ",")
+}
+
+// MoveListItems moves items from one list to another, keeping their IDs,
+// claims and history. Both lists must be owned by userID and match the given
+// versions. Moved items go to the end of the destination list, in the order
+// given.
+func (db *DB) MoveListItems(ctx context.Context, fromListID, fromVersion, toListID, toVersion int, userID int, now time.Time, itemIDs []int) (from, to *List, err error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from, to, err = db.doMoveListItems(ctx, txn, fromListID, fromVersion,
+		toListID, toVersion, userID, now, itemIDs)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	db.publishMoves(ctx, fromListID, toListID, itemIDs)
+	return from, to, nil
+}
+
+// publishMoves reports moved items as deleted from one list and created in
+// the other. The move has already been committed, so if the moved items
+// can't be read, watchers just don't hear about it.
+func (db *DB) publishMoves(ctx context.Context, fromListID, toListID int, itemIDs []int) {
+	if db.itemListener == nil {
+		return
+	}
+
+	moved, err := db.ListListItems(ctx, toListID, AllItems())
+	if err != nil {
+		return
+	}
+	movedIDs := map[int]bool{}
+	for _, itemID := range itemIDs {
+		movedIDs[itemID] = true
+	}
+
+	for _, item := range moved {
+		if !movedIDs[item.ID] {
+			continue
+		}
+		db.publish(&ItemEvent{
+			Type:   ItemDeleted,
+			ListID: fromListID,
+			Item:   &ListItem{ID: item.ID, ListID: fromListID},
+		}, &ItemEvent{
+			Type:   ItemCreated,
+			ListID: toListID,
+			Item:   item,
+		})
+	}
+}
+
+func (db *DB) doMoveListItems(ctx context.Context, txn *sql.Tx, fromListID, fromVersion, toListID, toVersion int, userID int, now time.Time, itemIDs []int) (from, to *List, err error) {
+	if fromListID == toListID {
+		return nil, nil, status.Errorf(codes.InvalidArgument,
+			"can't move items to the list they're in")
+	}
+
+	noChange := func(listData *ListData) error { return nil }
+	from, err = db.doUpdateList(ctx, txn, fromListID, fromVersion, userID,
+		now, noChange)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err = db.doUpdateList(ctx, txn, toListID, toVersion, userID, now,
+		noChange)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkMovableItems(ctx, txn, fromListID, itemIDs); err != nil {
+		return nil, nil, err
+	}
+
+	for _, itemID := range itemIDs {
+		position, err := nextItemPosition(ctx, txn, toListID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, err = txn.ExecContext(ctx,
+			`UPDATE items
+			    SET list_id = ?, position = ?, version = version + 1,
+			        updated = ?
+			  WHERE id = ?`,
+			toListID, position, now.Unix(), itemID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("item move failed: %v", err)
+		}
+
+		var version int
+		err = txn.QueryRowContext(ctx,
+			`SELECT version FROM items WHERE id = ?`,
+			itemID).Scan(&version)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = writeHistory(ctx, txn, toListID, itemID, version, userID,
+			now, []*FieldChange{{
+				Field: "list",
+				Old:   strconv.Itoa(fromListID),
+				New:   strconv.Itoa(toListID),
+			}})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := recordChange(ctx, txn, fromListID, itemID, true); err != nil {
+			return nil, nil, err
+		}
+		if err := recordChange(ctx, txn, toListID, itemID, false); err != nil {
+			return nil, nil, err
+		}
+
+		// Comment threads follow their items.
+		_, err = txn.ExecContext(ctx,
+			`UPDATE comments SET list_id = ? WHERE item_id = ?`,
+			toListID, itemID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("comment move failed: %v", err)
+		}
+	}
+
+	return from, to, nil
+}
+
+// checkMovableItems returns an error unless itemIDs names distinct, live
+// items in listID.
+func checkMovableItems(ctx context.Context, txn *sql.Tx, listID int, itemIDs []int) error {
+	if len(itemIDs) == 0 {
+		return status.Errorf(codes.InvalidArgument, "no items given")
+	}
+
+	seen := map[int]bool{}
+	for _, itemID := range itemIDs {
+		if seen[itemID] {
+			return status.Errorf(codes.InvalidArgument,
+				"item %v given more than once", itemID)
+		}
+		seen[itemID] = true
+
+		var deleted nullSeconds
+		err := txn.QueryRowContext(ctx,
+			`SELECT deleted FROM items WHERE id = ? AND list_id = ?`,
+			itemID, listID).Scan(&deleted)
+		if err == sql.ErrNoRows {
+			return status.Errorf(codes.NotFound,
+				"item %v is not in list %v", itemID, listID)
+		} else if err != nil {
+			return err
+		}
+
+		if deleted.Valid {
+			return status.Errorf(codes.FailedPrecondition,
+				"item %v was removed", itemID)
+		}
+	}
+
+	return nil
+}
+
+// CopyListItems copies items into a list. The copies are new items, without
+// the originals' claims or history. Both lists must be owned by userID, and
+// the destination list must match toVersion. Copies go to the end of the
+// destination list, in the order given.
+func (db *DB) CopyListItems(ctx context.Context, fromListID, toListID, toVersion int, userID int, now time.Time, itemIDs []int) (*List, []*ListItem, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, items, err := db.doCopyListItems(ctx, txn, fromListID, toListID,
+		toVersion, userID, now, itemIDs)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, item := range items {
+		db.publish(&ItemEvent{Type: ItemCreated, ListID: toListID, Item: item})
+	}
+	return to, items, nil
+}
+
+func (db *DB) doCopyListItems(ctx context.Context, txn *sql.Tx, fromListID, toListID, toVersion int, userID int, now time.Time, itemIDs []int) (*List, []*ListItem, error) {
+	var fromOwner int
+	err := txn.QueryRowContext(ctx, `SELECT owner FROM lists WHERE id = ?`,
+		fromListID).Scan(&fromOwner)
+	if err == sql.ErrNoRows {
+		return nil, nil, status.Errorf(codes.NotFound,
+			"no list with ID %v", fromListID)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if fromOwner != userID {
+		return nil, nil, rpcerror.Errorf(codes.PermissionDenied,
+			rpcerror.ReasonNotOwner,
+			"user %v does not own list %v (owner %v)",
+			userID, fromListID, fromOwner)
+	}
+
+	to, err := db.doUpdateList(ctx, txn, toListID, toVersion, userID, now,
+		func(listData *ListData) error { return nil })
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkMovableItems(ctx, txn, fromListID, itemIDs); err != nil {
+		return nil, nil, err
+	}
+
+	items := []*ListItem{}
+	for _, itemID := range itemIDs {
+		data, err := readListItemData(ctx, txn, itemID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		item, err := doCreateListItem(ctx, txn, toListID, userID, data, now)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Blobs are shared, so copying images only copies the rows.
+		_, err = txn.ExecContext(ctx,
+			`INSERT INTO item_images (item_id, blob, thumbnail,
+			                          content_type, width, height,
+			                          created)
+			      SELECT ?, blob, thumbnail, content_type, width,
+			             height, ?
+			        FROM item_images
+			       WHERE item_id = ?
+			    ORDER BY id ASC`,
+			item.ID, now.Unix(), itemID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("image copy failed: %v", err)
+		}
+
+		items = append(items, item)
+	}
+
+	return to, items, nil
+}
+
+func readListItemData(ctx context.Context, txn *sql.Tx, itemID int) (*ListItemData, error) {
+	data := &ListItemData{}
+	err := txn.QueryRowContext(ctx,
+		`SELECT name, desc, url, price, currency, quantity, group_gift,
+		        priority
+		   FROM items
+		  WHERE id = ?`, itemID).Scan(
+		&data.Name, &data.Desc, &data.URL, &data.Price, &data.Currency,
+		&data.Quantity, &data.GroupGift, &data.Priority)
+	if err == sql.ErrNoRows {
+		return nil, status.Errorf(codes.NotFound, "no item with ID %v",
+			itemID)
+	}
+	return data, err
+}
+
+// ItemOperation is one step of a BatchUpdateListItems call. Exactly one of
+// Create, Update and Delete should be set.
+type ItemOperation struct {
+	// The item to be updated or deleted, and its expected version.
+	// Unused for creates.
+	ItemID      int
+	ItemVersion int
+
+	Create *ListItemData
+	Update func(data *ListItemData, state *ListItemState) error
+	Delete bool
+}
+
+// BatchError reports the operation that caused BatchUpdateListItems to fail.
+// Its status is that of the underlying error, with the operation's index
+// added as a BadRequest field violation on "ops[<index>]".
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BatchError) GRPCStatus() *status.Status {
+	st := status.Convert(e.Err)
+	pb := st.Proto()
+	pb.Message = fmt.Sprintf("operation %d: %v", e.Index, st.Message())
+
+	withIndex, err := status.FromProto(pb).WithDetails(
+		&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       fmt.Sprintf("ops[%d]", e.Index),
+				Description: st.Message(),
+			}},
+		})
+	if err != nil {
+		// Only possible for OK statuses, which aren't errors.
+		return status.FromProto(pb)
+	}
+	return withIndex
+}
+
+// BatchUpdateListItems applies ops to the items in listID, in order, in a
+// single transaction. Either all operations are applied or, if one fails,
+// none are and a *BatchError is returned. The returned items correspond to
+// ops; deleted items are returned with Deleted set. actorID is recorded in the
+// items' history.
+func (db *DB) BatchUpdateListItems(ctx context.Context, listID int, actorID int, now time.Time, ops []*ItemOperation) ([]*ListItem, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := db.doBatchUpdateListItems(ctx, txn, listID, actorID, now, ops)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if ops[i].Create != nil {
+			db.publish(&ItemEvent{Type: ItemCreated, ListID: listID, Item: item})
+		} else {
+			db.publish(updateEvent(item))
+		}
+	}
+	return items, nil
+}
+
+func (db *DB) doBatchUpdateListItems(ctx context.Context, txn *sql.Tx, listID int, actorID int, now time.Time, ops []*ItemOperation) ([]*ListItem, error) {
+	items := make([]*ListItem, len(ops))
+	for i, op := range ops {
+		item, err := db.doItemOperation(ctx, txn, listID, actorID, now, op)
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (db *DB) doItemOperation(ctx context.Context, txn *sql.Tx, listID int, actorID int, now time.Time, op *ItemOperation) (*ListItem, error) {
+	switch {
+	case op.Create != nil:
+		return doCreateListItem(ctx, txn, listID, actorID, op.Create, now)
+
+	case op.Update != nil:
+		return db.doUpdateListItem(ctx, txn, listID, op.ItemID,
+			op.ItemVersion, actorID, now, func(data *ListItemData, state *ListItemState) error {
+				if !state.Deleted.IsZero() {
+					return status.Errorf(codes.NotFound,
+						"no item with ID %v", op.ItemID)
+				}
+				return op.Update(data, state)
+			})
+
+	case op.Delete:
+		return db.doSoftDeleteListItem(ctx, txn, listID, op.ItemID,
+			op.ItemVersion, actorID, now)
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"empty operation")
+	}
+}
@@ -29,7 +29,8 @@ func createListItemTestLists(t *testing.T, db *database.DB) testutil.ListSetupRe
 				},
 				&database.ListItemData{
 					Name: "l1i2", Desc: "l1i2desc",
-					URL: "l1i2url",
+					URL: "l1i2url", Price: 1999,
+					Currency: "USD",
 				},
 			},
 		},
@@ -110,7 +111,7 @@ func TestUpdateListItems_Claim(t *testing.T) {
 
 	// Item isn't claimed. Verify that that's the case, then claim it.
 	now := time.Unix(testutil.SetupListsUserStamp, 0)
-	gotItem, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version, now, func(data *database.ListItemData, state *database.ListItemState) error {
+	gotItem, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version, claimUser.ID, now, func(data *database.ListItemData, state *database.ListItemState) error {
 		if !reflect.DeepEqual(data, &item.ListItemData) {
 			return fmt.Errorf(
 				"update cb unexpected data; got %v, want %v",
@@ -122,7 +123,7 @@ func TestUpdateListItems_Claim(t *testing.T) {
 				state, &item.ListItemState)
 		}
 
-		state.ClaimedBy = claimUser.ID
+		state.SetClaim(claimUser.ID, 1)
 		return nil
 	})
 	if err != nil {
@@ -135,6 +136,10 @@ func TestUpdateListItems_Claim(t *testing.T) {
 	wantItem := *item
 	wantItem.Version++
 	wantItem.Updated = now
+	wantItem.Claims = []*database.Claim{
+		{UserID: claimUser.ID, Count: 1, When: now,
+			Purchase: database.PurchaseClaimed},
+	}
 	wantItem.ClaimedBy = claimUser.ID
 	wantItem.ClaimedWhen = now
 
@@ -153,7 +158,7 @@ func TestUpdateListItems_Claim(t *testing.T) {
 	// Item is claimed. Verify that that's the case then unclaim it.
 	now = now.Add(time.Duration(1000) * time.Second)
 	item.Version++
-	gotItem, err = db.UpdateListItem(ctx, list.ID, item.ID, item.Version, now, func(data *database.ListItemData, state *database.ListItemState) error {
+	gotItem, err = db.UpdateListItem(ctx, list.ID, item.ID, item.Version, claimUser.ID, now, func(data *database.ListItemData, state *database.ListItemState) error {
 		// No change from initial update call
 		if !reflect.DeepEqual(data, &wantItem.ListItemData) {
 			return fmt.Errorf(
@@ -169,7 +174,7 @@ func TestUpdateListItems_Claim(t *testing.T) {
 		}
 
 		// Unclaim it
-		state.ClaimedBy = 0
+		state.SetClaim(claimUser.ID, 0)
 		return nil
 	})
 	if err != nil {
@@ -181,6 +186,7 @@ func TestUpdateListItems_Claim(t *testing.T) {
 
 	wantItem.Updated = now
 	wantItem.Version++
+	wantItem.Claims = nil
 	wantItem.ClaimedBy = 0
 	wantItem.ClaimedWhen = time.Time{}
 
@@ -208,13 +214,14 @@ func TestDeleteListItem(t *testing.T) {
 		t.Fatalf("bad test data")
 	}
 
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
 	badItemID := 1000
-	if err := db.DeleteListItem(ctx, list.ID, badItemID); err == nil || status.Code(err) != codes.NotFound {
+	if err := db.DeleteListItem(ctx, list.ID, badItemID, list.OwnerID, now); err == nil || status.Code(err) != codes.NotFound {
 		t.Fatalf("DeleteListItem(_, %v, %v) = %v, want NotFound",
 			list.ID, badItemID, err)
 	}
 
-	if err := db.DeleteListItem(ctx, list.ID, item.ID); err != nil {
+	if err := db.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, now); err != nil {
 		t.Fatalf("DeleteListItem(_, %v, %v) = %v, want nil",
 			list.ID, item.ID, err)
 	}
@@ -225,6 +232,457 @@ func TestDeleteListItem(t *testing.T) {
 	}
 
 	if len(afterItems) != 1 || afterItems[0].Name != "l1i2" {
-		t.Fatalf("after items = %v, want only l1i2")
+		t.Fatalf("after items = %v, want only l1i2", afterItems)
+	}
+}
+
+func TestUpdateListItems_MultipleClaims(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userA := users.UserByUsername("a")
+	userB := users.UserByUsername("b")
+
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+	gotItem, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version, userA.ID, now, func(data *database.ListItemData, state *database.ListItemState) error {
+		data.Quantity = 3
+		state.SetClaim(userB.ID, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateListItem failed: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	gotItem, err = db.UpdateListItem(ctx, list.ID, item.ID, gotItem.Version, userA.ID, later, func(data *database.ListItemData, state *database.ListItemState) error {
+		state.SetClaim(userA.ID, 2)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateListItem failed: %v", err)
+	}
+
+	wantClaims := []*database.Claim{
+		{UserID: userB.ID, Count: 1, When: now,
+			Purchase: database.PurchaseClaimed},
+		{UserID: userA.ID, Count: 2, When: later,
+			Purchase: database.PurchaseClaimed},
+	}
+	if diff := cmp.Diff(wantClaims, gotItem.Claims); diff != "" {
+		t.Errorf("UpdateListItem claims diff:\n%v", diff)
+	}
+	if !gotItem.FullyClaimed() || gotItem.ClaimedBy != userB.ID || !gotItem.ClaimedWhen.Equal(now) {
+		t.Errorf("UpdateListItem = %+v, want fully claimed by %v at %v",
+			gotItem, userB.ID, now)
+	}
+
+	readItem, err := dbutil.GetListItem(ctx, db, list.ID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			list.ID, item.ID, err)
+	}
+	if diff := cmp.Diff(gotItem, readItem); diff != "" {
+		t.Errorf("GetListItem diff:\n%v", diff)
+	}
+}
+
+func TestDeleteListItem_Claimed(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+
+	claimed := time.Unix(testutil.SetupListsUserStamp, 0)
+	item, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version, userB.ID, claimed, func(data *database.ListItemData, state *database.ListItemState) error {
+		state.SetClaim(userB.ID, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateListItem failed: %v", err)
+	}
+
+	// The owner renames the item, then renames it again. The claimer
+	// sees one change, from the name they claimed.
+	for i, name := range []string{"new1", "new2"} {
+		changed := claimed.Add(time.Duration(i+1) * time.Hour)
+		item, err = db.UpdateListItem(ctx, list.ID, item.ID, item.Version, list.OwnerID, changed, func(data *database.ListItemData, state *database.ListItemState) error {
+			data.Name = name
+			data.Priority = database.PriorityMustHave
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateListItem failed: %v", err)
+		}
+	}
+
+	wantChanges := []*database.FieldChange{
+		{Field: "name", Old: "l1i1", New: "new2",
+			When: claimed.Add(2 * time.Hour)},
+	}
+	if diff := cmp.Diff(wantChanges, item.UserClaim(userB.ID).Changes); diff != "" {
+		t.Errorf("UpdateListItem changes diff:\n%v", diff)
+	}
+
+	deleted := claimed.Add(3 * time.Hour)
+	if err := db.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, deleted); err != nil {
+		t.Fatalf("DeleteListItem(_, %v, %v) = %v, want nil",
+			list.ID, item.ID, err)
+	}
+
+	// The item sticks around for the claimer.
+	readItem, err := dbutil.GetListItem(ctx, db, list.ID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, _, %v, %v) = _, %v, want _, nil",
+			list.ID, item.ID, err)
+	}
+	if !readItem.Deleted.Equal(deleted) || readItem.Version != item.Version+1 || readItem.VisibleTo(list.OwnerID) || !readItem.VisibleTo(userB.ID) {
+		t.Errorf("GetListItem = %+v, want deleted at %v, only visible to %v",
+			readItem, deleted, userB.ID)
+	}
+
+	if err := db.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, deleted); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteListItem(_, %v, %v) = %v, want NotFound",
+			list.ID, item.ID, err)
+	}
+
+	// Once the claim is released the item is gone for good.
+	_, err = db.UpdateListItem(ctx, list.ID, item.ID, readItem.Version, userB.ID, deleted, func(data *database.ListItemData, state *database.ListItemState) error {
+		state.SetClaim(userB.ID, 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateListItem failed: %v", err)
+	}
+
+	items, err := db.ListListItems(ctx, list.ID, database.OnlyItemWithID(item.ID))
+	if err != nil || len(items) != 0 {
+		t.Errorf("ListListItems(_, %v, only=%v) = %v, %v, want [], nil",
+			list.ID, item.ID, items, err)
+	}
+}
+
+func TestReorderListItems(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	resp := resps.GetList("l1")
+	list := resp.List
+	owner := users.UserByID(list.OwnerID)
+	item1, item2 := resp.ListItems[0], resp.ListItems[1]
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	for _, tc := range []struct {
+		name     string
+		version  int
+		itemIDs  []int
+		wantCode codes.Code
+	}{
+		{"bad version", list.Version + 1, []int{item2.ID, item1.ID}, codes.FailedPrecondition},
+		{"missing item", list.Version, []int{item2.ID}, codes.FailedPrecondition},
+		{"duplicate item", list.Version, []int{item2.ID, item2.ID}, codes.FailedPrecondition},
+		{"foreign item", list.Version, []int{item2.ID, resps.GetList("l2").ListItems[0].ID}, codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.ReorderListItems(ctx, list.ID, tc.version,
+				owner.ID, now, tc.itemIDs)
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("ReorderListItems(_, %v, %v, _, _, %v) = _, %v, want %v",
+					list.ID, tc.version, tc.itemIDs, err,
+					tc.wantCode)
+			}
+		})
+	}
+
+	gotList, err := db.ReorderListItems(ctx, list.ID, list.Version,
+		owner.ID, now, []int{item2.ID, item1.ID})
+	if err != nil || gotList.Version != list.Version+1 {
+		t.Fatalf("ReorderListItems = %v, %v, want version %v, nil",
+			gotList, err, list.Version+1)
+	}
+
+	items, err := db.ListListItems(ctx, list.ID, database.AllItems())
+	if err != nil {
+		t.Fatalf("ListListItems = _, %v, want _, nil", err)
+	}
+
+	gotOrder := []string{}
+	for _, item := range items {
+		gotOrder = append(gotOrder, item.Name)
+	}
+	if wantOrder := []string{"l1i2", "l1i1"}; !reflect.DeepEqual(gotOrder, wantOrder) {
+		t.Errorf("after reorder got %v, want %v", gotOrder, wantOrder)
+	}
+
+	// New items go at the end.
+	newItem, err := db.CreateListItem(ctx, list.ID, owner.ID,
+		&database.ListItemData{Name: "l1i3"}, now)
+	if err != nil || newItem.Position != 3 {
+		t.Errorf("CreateListItem = %+v, %v, want position 3, nil",
+			newItem, err)
+	}
+}
+
+func TestMoveListItems(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	from := resps.GetList("l1").List
+	item1, item2 := resps.GetList("l1").ListItems[0], resps.GetList("l1").ListItems[1]
+	foreign := resps.GetList("l2")
+	owner := users.UserByID(from.OwnerID)
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	to, err := db.CreateList(ctx, owner.ID, &database.ListData{Name: "l3"}, now)
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	claimed, err := db.UpdateListItem(ctx, from.ID, item2.ID, item2.Version, userB.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+	if _, err := db.CreateComment(ctx, from.ID, item2.ID, userB.ID, "hi", now); err != nil {
+		t.Fatalf("CreateComment() = _, %v, want _, nil", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		fromVersion int
+		toListID    int
+		toVersion   int
+		userID      int
+		itemIDs     []int
+		wantCode    codes.Code
+	}{
+		{"bad from version", from.Version + 1, to.ID, to.Version, owner.ID, []int{item1.ID}, codes.FailedPrecondition},
+		{"bad to version", from.Version, to.ID, to.Version + 1, owner.ID, []int{item1.ID}, codes.FailedPrecondition},
+		{"same list", from.Version, from.ID, from.Version, owner.ID, []int{item1.ID}, codes.InvalidArgument},
+		{"not owner", from.Version, foreign.List.ID, foreign.List.Version, owner.ID, []int{item1.ID}, codes.PermissionDenied},
+		{"foreign item", from.Version, to.ID, to.Version, owner.ID, []int{foreign.ListItems[0].ID}, codes.NotFound},
+		{"duplicate item", from.Version, to.ID, to.Version, owner.ID, []int{item1.ID, item1.ID}, codes.InvalidArgument},
+		{"no items", from.Version, to.ID, to.Version, owner.ID, nil, codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := db.MoveListItems(ctx, from.ID, tc.fromVersion,
+				tc.toListID, tc.toVersion, tc.userID, now, tc.itemIDs)
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("MoveListItems(%v) = _, _, %v, want %v",
+					tc.itemIDs, err, tc.wantCode)
+			}
+		})
+	}
+
+	later := now.Add(time.Hour)
+	gotFrom, gotTo, err := db.MoveListItems(ctx, from.ID, from.Version,
+		to.ID, to.Version, owner.ID, later, []int{item2.ID, item1.ID})
+	if err != nil {
+		t.Fatalf("MoveListItems() = _, _, %v, want _, _, nil", err)
+	}
+	if gotFrom.Version != from.Version+1 || gotTo.Version != to.Version+1 {
+		t.Errorf("MoveListItems() versions = %v, %v, want %v, %v",
+			gotFrom.Version, gotTo.Version, from.Version+1,
+			to.Version+1)
+	}
+
+	if items, err := db.ListListItems(ctx, from.ID, database.AllItems()); err != nil || len(items) != 0 {
+		t.Errorf("ListListItems(from) = %v, %v, want [], nil", items, err)
+	}
+
+	items, err := db.ListListItems(ctx, to.ID, database.AllItems())
+	if err != nil {
+		t.Fatalf("ListListItems(to) = _, %v, want _, nil", err)
+	}
+	if len(items) != 2 || items[0].ID != item2.ID || items[1].ID != item1.ID {
+		t.Fatalf("ListListItems(to) = %v, want [%v, %v]", items,
+			item2.ID, item1.ID)
+	}
+
+	// The claim and creation time come along.
+	moved := items[0]
+	if !moved.Created.Equal(item2.Created) || moved.UserClaim(userB.ID) == nil ||
+		moved.Version != claimed.Version+1 || !moved.Updated.Equal(later) {
+		t.Errorf("moved item = %+v, want created %v, claimed by %v, version %v",
+			moved, item2.Created, userB.ID, claimed.Version+1)
+	}
+
+	comments, err := db.ListComments(ctx, to.ID, item2.ID, 0, 10)
+	if err != nil || len(comments) != 1 {
+		t.Errorf("ListComments(to, %v) = %v, %v, want 1 comment",
+			item2.ID, comments, err)
+	}
+}
+
+func TestCopyListItems(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	from := resps.GetList("l1").List
+	item := resps.GetList("l1").ListItems[1]
+	owner := users.UserByID(from.OwnerID)
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	to, err := db.CreateList(ctx, owner.ID, &database.ListData{Name: "l3"}, now)
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	_, err = db.UpdateListItem(ctx, from.ID, item.ID, item.Version, userB.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+	image := &database.ItemImage{Blob: "b", Thumbnail: "t"}
+	if _, err := db.AddItemImage(ctx, from.ID, item.ID, owner.ID, image, now); err != nil {
+		t.Fatalf("AddItemImage() = _, %v, want _, nil", err)
+	}
+
+	if _, _, err := db.CopyListItems(ctx, from.ID, to.ID, to.Version, userB.ID, now, []int{item.ID}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CopyListItems(non-owner) = _, _, %v, want PermissionDenied",
+			err)
+	}
+
+	later := now.Add(time.Hour)
+	gotTo, copies, err := db.CopyListItems(ctx, from.ID, to.ID, to.Version,
+		owner.ID, later, []int{item.ID})
+	if err != nil {
+		t.Fatalf("CopyListItems() = _, _, %v, want _, _, nil", err)
+	}
+	if gotTo.Version != to.Version+1 || len(copies) != 1 {
+		t.Fatalf("CopyListItems() = %+v, %v, _, want version %v, 1 copy",
+			gotTo, copies, to.Version+1)
+	}
+
+	items, err := db.ListListItems(ctx, to.ID, database.AllItems())
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ListListItems(to) = %v, %v, want 1 item", items, err)
+	}
+	copied := items[0]
+	if copied.ID == item.ID || !reflect.DeepEqual(copied.ListItemData, item.ListItemData) ||
+		len(copied.Claims) != 0 || !copied.Created.Equal(later) ||
+		len(copied.Images) != 1 || copied.Images[0].Blob != "b" {
+		t.Errorf("copied item = %+v, want new unclaimed copy of %+v with image",
+			copied, item)
+	}
+
+	// The original is untouched.
+	orig, err := dbutil.GetListItem(ctx, db, from.ID, item.ID)
+	if err != nil || orig.UserClaim(userB.ID) == nil {
+		t.Errorf("GetListItem(orig) = %+v, %v, want still claimed", orig, err)
+	}
+}
+
+func TestBatchUpdateListItems(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list := resps.GetList("l1").List
+	item1, item2 := resps.GetList("l1").ListItems[0], resps.GetList("l1").ListItems[1]
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	claimed, err := db.UpdateListItem(ctx, list.ID, item2.ID, item2.Version, userB.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+
+	rename := func(name string) func(*database.ListItemData, *database.ListItemState) error {
+		return func(data *database.ListItemData, state *database.ListItemState) error {
+			data.Name = name
+			return nil
+		}
+	}
+
+	// A failing operation undoes the ones before it.
+	_, err = db.BatchUpdateListItems(ctx, list.ID, list.OwnerID, now, []*database.ItemOperation{
+		{Create: &database.ListItemData{Name: "new"}},
+		{ItemID: item1.ID, ItemVersion: item1.Version, Update: rename("renamed")},
+		{ItemID: item2.ID, ItemVersion: claimed.Version + 1, Delete: true},
+	})
+	if batchErr, ok := err.(*database.BatchError); !ok || batchErr.Index != 2 ||
+		status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("BatchUpdateListItems(bad version) = _, %v, want BatchError at 2 with %v",
+			err, codes.FailedPrecondition)
+	}
+
+	items, err := db.ListListItems(ctx, list.ID, database.AllItems())
+	if err != nil || len(items) != 2 || items[0].Name != item1.Name {
+		t.Fatalf("ListListItems() = %v, %v, want unchanged items", items, err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		op       *database.ItemOperation
+		wantCode codes.Code
+	}{
+		{"empty", &database.ItemOperation{}, codes.InvalidArgument},
+		{"foreign item", &database.ItemOperation{ItemID: resps.GetList("l2").ListItems[0].ID, ItemVersion: 1, Delete: true}, codes.NotFound},
+		{"bad version", &database.ItemOperation{ItemID: item1.ID, ItemVersion: item1.Version + 1, Update: rename("x")}, codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.BatchUpdateListItems(ctx, list.ID, list.OwnerID, now,
+				[]*database.ItemOperation{tc.op})
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("BatchUpdateListItems() = _, %v, want %v",
+					err, tc.wantCode)
+			}
+		})
+	}
+
+	later := now.Add(time.Hour)
+	got, err := db.BatchUpdateListItems(ctx, list.ID, list.OwnerID, later, []*database.ItemOperation{
+		{Create: &database.ListItemData{Name: "new"}},
+		{ItemID: item1.ID, ItemVersion: item1.Version, Update: rename("renamed")},
+		{ItemID: item1.ID, ItemVersion: item1.Version + 1, Update: rename("renamed again")},
+		{ItemID: item2.ID, ItemVersion: claimed.Version, Delete: true},
+	})
+	if err != nil {
+		t.Fatalf("BatchUpdateListItems() = _, %v, want _, nil", err)
+	}
+	if len(got) != 4 || got[0].Name != "new" || got[2].Name != "renamed again" ||
+		got[2].Version != item1.Version+2 || !got[3].Deleted.Equal(later) {
+		t.Errorf("BatchUpdateListItems() = %v, want created, renamed twice, deleted", got)
+	}
+
+	// The claimed item is kept for its claimer.
+	items, err = db.ListListItems(ctx, list.ID, database.AllItems())
+	if err != nil {
+		t.Fatalf("ListListItems() = _, %v, want _, nil", err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"renamed again", item2.Name, "new"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListListItems() names = %v, want %v", names, want)
+	}
+	if items[1].Deleted.IsZero() {
+		t.Errorf("claimed item %v not marked deleted", item2.ID)
 	}
 }
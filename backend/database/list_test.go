@@ -61,7 +61,9 @@ func TestCreateAndListLists(t *testing.T) {
 		&testutil.ListSetupRequest{
 			Owner: "b",
 			List: &database.ListData{Name: "l2", Beneficiary: "b2",
-				EventDate: time.Unix(2, 0), Active: true},
+				EventDate: time.Unix(2, 0), Active: true,
+				Budget: 5000, BudgetCurrency: "USD",
+				ClaimTimeoutDays: 14},
 		},
 	}
 	listResponses := testutil.SetupLists(ctx, t, db, listSetupRequests)
@@ -176,12 +178,18 @@ func TestUpdateList(t *testing.T) {
 	want.Version++
 	want.Name = "UL"
 	want.Active = false
+	want.Budget = 2500
+	want.BudgetCurrency = "EUR"
+	want.ClaimTimeoutDays = 7
 	want.Updated = updated
 
 	got, err := db.UpdateList(ctx, list.ID, list.Version, owner.ID, updated,
 		func(listData *database.ListData) error {
 			listData.Name = "UL"
 			listData.Active = false
+			listData.Budget = 2500
+			listData.BudgetCurrency = "EUR"
+			listData.ClaimTimeoutDays = 7
 			return nil
 		})
 	if err != nil || !reflect.DeepEqual(&want, got) {
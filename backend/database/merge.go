@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// itemMergeFields are the item history fields a merged change can set.
+// Claims are left to their own, online, operations.
+var itemMergeFields = []string{
+	"name", "desc", "url", "price", "currency", "quantity", "group_gift",
+	"priority", "deleted",
+}
+
+// listMergeFields are the list history fields a merged change can set.
+var listMergeFields = []string{
+	"name", "beneficiary", "event_date", "active", "budget",
+	"budget_currency", "claim_timeout_days",
+}
+
+// mergeValues works out how to apply a change made against base to current.
+// It returns the fields the change sets, and the fields that it and the
+// changes since base set to different values.
+func mergeValues(fields []string, base, current, changed map[string]string) (apply, conflicts []string) {
+	for _, field := range fields {
+		if changed[field] == base[field] || changed[field] == current[field] {
+			continue
+		}
+		if current[field] != base[field] {
+			conflicts = append(conflicts, field)
+		} else {
+			apply = append(apply, field)
+		}
+	}
+	return apply, conflicts
+}
+
+// undoValues returns values with undos applied.
+func undoValues(values map[string]string, undos []historyUndo) map[string]string {
+	out := map[string]string{}
+	for field, value := range values {
+		out[field] = value
+	}
+	for _, undo := range undos {
+		out[undo.field] = undo.value
+	}
+	return out
+}
+
+// MergeListItem applies update, a change made against baseVersion of an
+// item, to the item's current version. If the item has changed since
+// baseVersion, the update is merged with those changes as long as they set
+// different fields; otherwise a *ConflictError is returned. update is
+// given the item as it was at baseVersion. Only data fields and deletion
+// are merged. merged is true if the item had changed since baseVersion.
+func (db *DB) MergeListItem(ctx context.Context, listID, itemID, baseVersion, actorID int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (item *ListItem, merged bool, err error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	item, merged, err = db.doMergeListItem(ctx, txn, listID, itemID,
+		baseVersion, actorID, now, update)
+	if err != nil {
+		_ = txn.Rollback()
+
+		if conflict, ok := err.(*ConflictError); ok {
+			items, readErr := db.ListListItems(ctx, listID,
+				OnlyItemWithID(itemID))
+			if readErr != nil {
+				return nil, false, readErr
+			}
+			if len(items) == 1 {
+				conflict.Item = items[0]
+			}
+		}
+		return nil, false, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	db.publish(updateEvent(item))
+	return item, merged, nil
+}
+
+func (db *DB) doMergeListItem(ctx context.Context, txn *sql.Tx, listID, itemID, baseVersion, actorID int, now time.Time, update func(data *ListItemData, state *ListItemState) error) (*ListItem, bool, error) {
+	var version int
+	err := txn.QueryRowContext(ctx,
+		`SELECT version FROM items WHERE list_id = ? AND id = ?`,
+		listID, itemID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, false, status.Errorf(codes.NotFound,
+			"no item with ID %v", itemID)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if baseVersion <= 0 || baseVersion > version {
+		return nil, false, status.Errorf(codes.InvalidArgument,
+			"bad base version %v; current version is %v",
+			baseVersion, version)
+	}
+
+	undos, known, err := undoHistory(ctx, txn, listID, itemID, baseVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	if baseVersion != version && !known {
+		return nil, false, &ConflictError{}
+	}
+
+	item, err := db.doUpdateListItem(ctx, txn, listID, itemID, version,
+		actorID, now, func(data *ListItemData, state *ListItemState) error {
+			if !state.Deleted.IsZero() {
+				return status.Errorf(codes.NotFound,
+					"no item with ID %v", itemID)
+			}
+
+			valuesOf := func(data *ListItemData, state *ListItemState) map[string]string {
+				item := &ListItem{ListItemData: *data, ListID: listID}
+				item.Deleted = state.Deleted
+				if item.Quantity <= 0 {
+					item.Quantity = 1
+				}
+				return itemHistoryValues(item)
+			}
+
+			current := valuesOf(data, state)
+			base := undoValues(current, undos)
+
+			changedData := *data
+			for _, undo := range undos {
+				err := setItemHistoryValue(&changedData, undo.field,
+					undo.value)
+				if err != nil {
+					return err
+				}
+			}
+			changedState := *state
+			if err := update(&changedData, &changedState); err != nil {
+				return err
+			}
+
+			changed := valuesOf(&changedData, &changedState)
+			apply, conflicts := mergeValues(itemMergeFields, base,
+				current, changed)
+			if len(conflicts) > 0 {
+				return &ConflictError{Fields: conflicts}
+			}
+
+			for _, field := range apply {
+				if field == "deleted" {
+					state.Deleted = changedState.Deleted
+					continue
+				}
+				err := setItemHistoryValue(data, field,
+					changed[field])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return item, baseVersion != version, nil
+}
+
+// MergeList applies update, a change made against baseVersion of a list's
+// data, to the list's current version, in the same way as MergeListItem.
+// update is given the list data as it was at baseVersion.
+func (db *DB) MergeList(ctx context.Context, listID, baseVersion, userID int, now time.Time, update func(listData *ListData) error) (list *List, merged bool, err error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	list, merged, err = db.doMergeList(ctx, txn, listID, baseVersion,
+		userID, now, update)
+	if err != nil {
+		_ = txn.Rollback()
+
+		if conflict, ok := err.(*ConflictError); ok {
+			lists, readErr := db.ListLists(ctx,
+				OnlyListWithID(listID))
+			if readErr != nil {
+				return nil, false, readErr
+			}
+			if len(lists) == 1 {
+				conflict.List = lists[0]
+			}
+		}
+		return nil, false, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	return list, merged, nil
+}
+
+func (db *DB) doMergeList(ctx context.Context, txn *sql.Tx, listID, baseVersion, userID int, now time.Time, update func(listData *ListData) error) (*List, bool, error) {
+	var version int
+	err := txn.QueryRowContext(ctx,
+		`SELECT version FROM lists WHERE id = ?`, listID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, false, status.Errorf(codes.NotFound,
+			"no list with ID %v", listID)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if baseVersion <= 0 || baseVersion > version {
+		return nil, false, status.Errorf(codes.InvalidArgument,
+			"bad base version %v; current version is %v",
+			baseVersion, version)
+	}
+
+	undos, known, err := undoHistory(ctx, txn, listID, 0, baseVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	if baseVersion != version && !known {
+		return nil, false, &ConflictError{}
+	}
+
+	list, err := db.doUpdateList(ctx, txn, listID, version, userID, now,
+		func(listData *ListData) error {
+			current := listHistoryValues(listData)
+			base := undoValues(current, undos)
+
+			changedData := *listData
+			for _, undo := range undos {
+				err := setListHistoryValue(&changedData,
+					undo.field, undo.value)
+				if err != nil {
+					return err
+				}
+			}
+			if err := update(&changedData); err != nil {
+				return err
+			}
+
+			changed := listHistoryValues(&changedData)
+			apply, conflicts := mergeValues(listMergeFields, base,
+				current, changed)
+			if len(conflicts) > 0 {
+				return &ConflictError{Fields: conflicts}
+			}
+
+			for _, field := range apply {
+				err := setListHistoryValue(listData, field,
+					changed[field])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return list, baseVersion != version, nil
+}
@@ -0,0 +1,177 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMergeListItem(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+	base := item.Version
+
+	// Somebody else changes the description.
+	item, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		list.OwnerID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			data.Desc = "server desc"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+
+	merge := func(baseVersion int, update func(data *database.ListItemData)) (*database.ListItem, bool, error) {
+		return db.MergeListItem(ctx, list.ID, item.ID, baseVersion,
+			list.OwnerID, now,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				update(data)
+				return nil
+			})
+	}
+
+	// A change to a different field merges.
+	merged, wasMerged, err := merge(base, func(data *database.ListItemData) {
+		if data.Desc != "l1i1desc" {
+			t.Errorf("update got desc %q, want base desc", data.Desc)
+		}
+		data.Price = 500
+	})
+	if err != nil || !wasMerged || merged.Desc != "server desc" ||
+		merged.Price != 500 || merged.Version != item.Version+1 {
+		t.Fatalf("MergeListItem(price) = %+v, %v, %v, want merged price change",
+			merged, wasMerged, err)
+	}
+	item = merged
+
+	// A change to the same field conflicts, and reports the current item.
+	_, _, err = merge(base, func(data *database.ListItemData) {
+		data.Desc = "client desc"
+		data.Name = "client name"
+	})
+	conflict, ok := err.(*database.ConflictError)
+	if !ok || status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("MergeListItem(desc) = _, _, %v, want conflict", err)
+	}
+	if diff := cmp.Diff([]string{"desc"}, conflict.Fields); diff != "" {
+		t.Errorf("MergeListItem(desc) conflict fields mismatch; -want,+got:\n%s",
+			diff)
+	}
+	if conflict.Item == nil || conflict.Item.Version != item.Version {
+		t.Errorf("MergeListItem(desc) conflict item = %+v, want version %v",
+			conflict.Item, item.Version)
+	}
+
+	// Making the same change as the server isn't a conflict.
+	if _, _, err := merge(base, func(data *database.ListItemData) {
+		data.Desc = "server desc"
+	}); err != nil {
+		t.Errorf("MergeListItem(same desc) = _, _, %v, want nil", err)
+	}
+
+	// Changes against the current version are just applied.
+	cur, err := db.ListListItems(ctx, list.ID, database.OnlyItemWithID(item.ID))
+	if err != nil {
+		t.Fatalf("ListListItems() = _, %v, want _, nil", err)
+	}
+	item = cur[0]
+	merged, wasMerged, err = merge(item.Version, func(data *database.ListItemData) {
+		data.Desc = "client desc"
+	})
+	if err != nil || wasMerged || merged.Desc != "client desc" {
+		t.Errorf("MergeListItem(current) = %+v, %v, %v, want applied change",
+			merged, wasMerged, err)
+	}
+
+	if _, _, err := merge(merged.Version+1, func(data *database.ListItemData) {}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("MergeListItem(future) = _, _, %v, want InvalidArgument", err)
+	}
+
+	// Claims don't get in the way of a delete made offline. The claimed
+	// item is kept for its claimer.
+	claimed, err := db.UpdateListItem(ctx, list.ID, item.ID, merged.Version,
+		userB.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+	deleted, _, err := db.MergeListItem(ctx, list.ID, item.ID,
+		merged.Version, list.OwnerID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.Deleted = now
+			return nil
+		})
+	if err != nil || deleted.Deleted.IsZero() ||
+		deleted.UserClaim(userB.ID) == nil ||
+		deleted.Version != claimed.Version+1 {
+		t.Errorf("MergeListItem(delete) = %+v, _, %v, want soft delete",
+			deleted, err)
+	}
+}
+
+func TestMergeList(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list := resps.GetList("l1").List
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+	base := list.Version
+
+	list, err := db.UpdateList(ctx, list.ID, list.Version, list.OwnerID, now,
+		func(listData *database.ListData) error {
+			listData.Beneficiary = "server"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+	}
+
+	merged, wasMerged, err := db.MergeList(ctx, list.ID, base, list.OwnerID,
+		now, func(listData *database.ListData) error {
+			listData.Name = "client"
+			listData.EventDate = time.Unix(5000, 0)
+			return nil
+		})
+	if err != nil || !wasMerged || merged.Name != "client" ||
+		merged.Beneficiary != "server" ||
+		!merged.EventDate.Equal(time.Unix(5000, 0)) {
+		t.Fatalf("MergeList(name) = %+v, %v, %v, want merged change",
+			merged, wasMerged, err)
+	}
+
+	_, _, err = db.MergeList(ctx, list.ID, base, list.OwnerID, now,
+		func(listData *database.ListData) error {
+			listData.Beneficiary = "client"
+			return nil
+		})
+	conflict, ok := err.(*database.ConflictError)
+	if !ok || conflict.List == nil || conflict.List.Version != merged.Version ||
+		!cmp.Equal([]string{"beneficiary"}, conflict.Fields) {
+		t.Errorf("MergeList(beneficiary) = _, _, %v (%+v), want beneficiary conflict",
+			err, conflict)
+	}
+
+	// Only the owner can change the list, merged or not.
+	if _, _, err := db.MergeList(ctx, list.ID, base, list.OwnerID+1, now, func(listData *database.ListData) error {
+		return nil
+	}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("MergeList(non-owner) = _, _, %v, want PermissionDenied", err)
+	}
+}
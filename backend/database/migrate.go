@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/simmonmt/xmaslist/db/schema"
+)
+
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`
+
+func tableExists(ctx context.Context, q queryer, name string) (bool, error) {
+	var num int
+	err := q.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master
+		  WHERE type = 'table' AND name = ?`, name).Scan(&num)
+	return num > 0, err
+}
+
+func readSchemaVersion(ctx context.Context, q queryer) (int, error) {
+	found, err := tableExists(ctx, q, "schema_version")
+	if err != nil {
+		return 0, err
+	} else if found {
+		var version int
+		err := q.QueryRowContext(ctx,
+			`SELECT version FROM schema_version`).Scan(&version)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return version, err
+	}
+
+	// Databases created before there were migrations have the initial
+	// schema, and empty ones have none at all.
+	found, err = tableExists(ctx, q, "users")
+	if err != nil {
+		return 0, err
+	} else if found {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// SchemaVersion returns the version of the database's schema, which is the
+// last migration applied to it.
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	return readSchemaVersion(ctx, db.db)
+}
+
+// Migrate applies or reverts migrations until the database's schema is at
+// version target. Each migration is applied in its own transaction, so a
+// failure leaves the schema at the last version that succeeded.
+func (db *DB) Migrate(ctx context.Context, target int) error {
+	if target < 0 || target > schema.Latest() {
+		return fmt.Errorf("no schema version %d", target)
+	}
+
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Migrations that rebuild tables would otherwise trip over (or
+	// cascade) foreign keys. The pragma can't be changed inside a
+	// transaction, so it's turned off around them instead, and each one
+	// is checked before it commits.
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	version, err := readSchemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if version > schema.Latest() {
+		return fmt.Errorf("schema version %d is newer than this binary (%d)",
+			version, schema.Latest())
+	}
+
+	migrations := schema.Migrations()
+	for version < target {
+		m := migrations[version]
+		if err := migrateStep(ctx, conn, m.Up, m.Version); err != nil {
+			return fmt.Errorf("migration %d (%v) failed: %v",
+				m.Version, m.Name, err)
+		}
+		version++
+	}
+	for version > target {
+		m := migrations[version-1]
+		if err := migrateStep(ctx, conn, m.Down, m.Version-1); err != nil {
+			return fmt.Errorf("reverting migration %d (%v) failed: %v",
+				m.Version, m.Name, err)
+		}
+		version--
+	}
+
+	return nil
+}
+
+func migrateStep(ctx context.Context, conn *sql.Conn, step func(ctx context.Context, txn *sql.Tx) error, version int) error {
+	txn, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := doMigrateStep(ctx, txn, step, version); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// countForeignKeyViolations returns the number of rows whose foreign keys
+// don't refer to anything.
+func countForeignKeyViolations(ctx context.Context, txn *sql.Tx) (int, error) {
+	rows, err := txn.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	num := 0
+	for rows.Next() {
+		num++
+	}
+	return num, rows.Err()
+}
+
+func doMigrateStep(ctx context.Context, txn *sql.Tx, step func(ctx context.Context, txn *sql.Tx) error, version int) error {
+	// Older databases may already have dangling references, which
+	// shouldn't stop them from being migrated. Migrations mustn't add to
+	// them, though.
+	before, err := countForeignKeyViolations(ctx, txn)
+	if err != nil {
+		return err
+	}
+
+	if err := step(ctx, txn); err != nil {
+		return err
+	}
+
+	after, err := countForeignKeyViolations(ctx, txn)
+	if err != nil {
+		return err
+	}
+	if after > before {
+		return fmt.Errorf("left %d rows with broken foreign keys",
+			after-before)
+	}
+
+	if _, err := txn.ExecContext(ctx, schemaVersionTable); err != nil {
+		return err
+	}
+	if _, err := txn.ExecContext(ctx, `DELETE FROM schema_version`); err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx,
+		`INSERT INTO schema_version (version) VALUES (?)`, version)
+	return err
+}
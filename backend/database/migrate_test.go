@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/db/schema"
+)
+
+func openTestDatabase(t *testing.T) *DB {
+	db, err := Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("Open() = _, %v, want _, nil", err)
+	}
+	return db
+}
+
+// describeSchema describes the database's tables, columns, indexes and
+// foreign keys in a way that doesn't depend on how they came to be.
+func describeSchema(t *testing.T, db *DB) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	query := func(query string, args ...interface{}) [][]string {
+		t.Helper()
+		rows, err := db.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			t.Fatalf("%v failed: %v", query, err)
+		}
+		defer rows.Close()
+
+		cols, _ := rows.Columns()
+		out := [][]string{}
+		for rows.Next() {
+			vals := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatalf("%v scan failed: %v", query, err)
+			}
+
+			row := []string{}
+			for _, val := range vals {
+				if b, ok := val.([]byte); ok {
+					val = string(b)
+				}
+				row = append(row, fmt.Sprint(val))
+			}
+			out = append(out, row)
+		}
+		return out
+	}
+
+	desc := []string{}
+	tables := query(`SELECT name FROM sqlite_master
+	                  WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+	               ORDER BY name`)
+	for _, table := range tables {
+		name := table[0]
+		for _, col := range query(`SELECT * FROM pragma_table_info(?)`, name) {
+			desc = append(desc, fmt.Sprintf("table %v column %v",
+				name, strings.Join(col, " ")))
+		}
+		for _, fk := range query(`SELECT * FROM pragma_foreign_key_list(?)`, name) {
+			desc = append(desc, fmt.Sprintf("table %v foreign key %v",
+				name, strings.Join(fk, " ")))
+		}
+		for _, index := range query(`SELECT name, "unique", origin, partial
+		                               FROM pragma_index_list(?)
+		                           ORDER BY name`, name) {
+			cols := []string{}
+			for _, col := range query(`SELECT name FROM pragma_index_info(?)
+			                        ORDER BY seqno`, index[0]) {
+				cols = append(cols, col[0])
+			}
+			desc = append(desc, fmt.Sprintf("table %v index %v on %v",
+				name, strings.Join(index, " "),
+				strings.Join(cols, ",")))
+		}
+	}
+	return desc
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	fresh := openTestDatabase(t)
+	defer fresh.Close()
+	if _, err := fresh.db.ExecContext(ctx, schema.Get()); err != nil {
+		t.Fatalf("schema create failed: %v", err)
+	}
+
+	migrated := openTestDatabase(t)
+	defer migrated.Close()
+	if version, err := migrated.SchemaVersion(ctx); version != 0 || err != nil {
+		t.Errorf("SchemaVersion(empty) = %v, %v, want 0, nil", version, err)
+	}
+	if err := migrated.Migrate(ctx, schema.Latest()); err != nil {
+		t.Fatalf("Migrate(%v) = %v, want nil", schema.Latest(), err)
+	}
+
+	for _, db := range []*DB{fresh, migrated} {
+		if version, err := db.SchemaVersion(ctx); version != schema.Latest() || err != nil {
+			t.Errorf("SchemaVersion() = %v, %v, want %v, nil", version,
+				err, schema.Latest())
+		}
+	}
+
+	want := describeSchema(t, fresh)
+	if diff := cmp.Diff(want, describeSchema(t, migrated)); diff != "" {
+		t.Errorf("migrated schema doesn't match schema.txt; -fresh,+migrated:\n%s", diff)
+	}
+
+	// All the way down leaves nothing but the version, and back up again
+	// gets us where we started.
+	if err := fresh.Migrate(ctx, 0); err != nil {
+		t.Fatalf("Migrate(0) = %v, want nil", err)
+	}
+	if version, err := fresh.SchemaVersion(ctx); version != 0 || err != nil {
+		t.Errorf("SchemaVersion() = %v, %v, want 0, nil", version, err)
+	}
+	for _, line := range describeSchema(t, fresh) {
+		if !strings.HasPrefix(line, "table schema_version ") {
+			t.Errorf("%v left after migrating down", line)
+		}
+	}
+
+	if err := fresh.Migrate(ctx, schema.Latest()); err != nil {
+		t.Fatalf("Migrate(%v) = %v, want nil", schema.Latest(), err)
+	}
+	if diff := cmp.Diff(want, describeSchema(t, fresh)); diff != "" {
+		t.Errorf("schema mismatch after down and up; -want,+got:\n%s", diff)
+	}
+
+	if err := fresh.Migrate(ctx, schema.Latest()+1); err == nil {
+		t.Errorf("Migrate(%v) = nil, want error", schema.Latest()+1)
+	}
+}
+
+func TestMigrate_Claims(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t)
+	defer db.Close()
+
+	// A database from before migrations, with a claimed and an unclaimed
+	// item.
+	if err := db.Migrate(ctx, 1); err != nil {
+		t.Fatalf("Migrate(1) = %v, want nil", err)
+	}
+	_, err := db.db.ExecContext(ctx, `
+		DROP TABLE schema_version;
+		INSERT INTO users (id, username) VALUES (1, 'a'), (2, 'b');
+		INSERT INTO lists (id, version, owner, name, beneficiary,
+		                   event_date, created, updated, active)
+		     VALUES (1, 1, 1, 'list', '', 0, 100, 100, TRUE);
+		INSERT INTO items (id, version, list_id, name, desc, url,
+		                   created, updated, claimed_by, claimed_when)
+		     VALUES (1, 1, 1, 'claimed', '', '', 100, 100, 2, 200),
+		            (2, 1, 1, 'unclaimed', '', '', 100, 100, NULL, NULL);`)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	if version, err := db.SchemaVersion(ctx); version != 1 || err != nil {
+		t.Errorf("SchemaVersion(old) = %v, %v, want 1, nil", version, err)
+	}
+	if err := db.Migrate(ctx, schema.Latest()); err != nil {
+		t.Fatalf("Migrate(%v) = %v, want nil", schema.Latest(), err)
+	}
+
+	items, err := db.ListListItems(ctx, 1, AllItems())
+	if err != nil {
+		t.Fatalf("ListListItems() = _, %v, want _, nil", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("ListListItems() = %v, want 2 items", items)
+	}
+	want := []*Claim{{
+		UserID:   2,
+		Count:    1,
+		When:     time.Unix(200, 0),
+		Purchase: PurchaseClaimed,
+	}}
+	if diff := cmp.Diff(want, items[0].Claims); diff != "" {
+		t.Errorf("claims mismatch; -want,+got:\n%s", diff)
+	}
+	if len(items[1].Claims) != 0 || items[1].Quantity != 1 ||
+		items[1].Position != 2 {
+		t.Errorf("unclaimed item = %+v, want no claims, quantity 1, position 2",
+			items[1])
+	}
+
+	// A second claim can't be kept when migrating back down, so the
+	// migration is refused.
+	if _, err := db.UpdateListItem(ctx, 1, 1, items[0].Version, 1,
+		time.Unix(300, 0),
+		func(data *ListItemData, state *ListItemState) error {
+			state.SetClaim(1, 1)
+			return nil
+		}); err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+	if err := db.Migrate(ctx, 1); err == nil {
+		t.Errorf("Migrate(1) = nil, want error")
+	}
+	if version, err := db.SchemaVersion(ctx); version != 3 || err != nil {
+		t.Errorf("SchemaVersion() = %v, %v, want 3, nil", version, err)
+	}
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type NotificationKind string
+
+const (
+	NotifyItemAdded     NotificationKind = "item_added"
+	NotifyItemChanged   NotificationKind = "item_changed"
+	NotifyItemDeleted   NotificationKind = "item_deleted"
+	NotifyClaimReleased NotificationKind = "claim_released"
+	NotifyListChanged   NotificationKind = "list_changed"
+	NotifyListArchived  NotificationKind = "list_archived"
+	NotifyEventReminder NotificationKind = "event_reminder"
+	NotifyClaimExpiring NotificationKind = "claim_expiring"
+	NotifyPriceDropped  NotificationKind = "price_dropped"
+
+	// NotifyDigest is a batch of other notifications, sent to users who
+	// asked for a digest. Digests aren't stored in the outbox.
+	NotifyDigest NotificationKind = "digest"
+)
+
+// A Notification is an entry in the outbox: something a user should be told
+// about, written in the same transaction as the change that caused it.
+type Notification struct {
+	ID      int
+	UserID  int // the recipient
+	Kind    NotificationKind
+	ListID  int
+	ItemID  int // zero for changes to the list itself
+	ActorID int // zero for changes made by the server
+	Message string
+	Created time.Time
+
+	// Delivery state, maintained by the dispatcher.
+	Attempts    int
+	NextAttempt time.Time
+	Channels    []string // the channels that have delivered it
+	LastError   string
+	Delivered   time.Time
+	Failed      time.Time // set when the dispatcher gives up
+}
+
+// enqueueNotification adds a copy of n to the outbox for each of userIDs,
+// other than the actor and users who've said they don't want to hear about
+// n's kind. The list's owner is never notified, as everything notified about
+// so far stems from claims.
+func enqueueNotification(ctx context.Context, txn *sql.Tx, userIDs []int, n *Notification) error {
+	var ownerID int
+	err := txn.QueryRowContext(ctx, `SELECT owner FROM lists WHERE id = ?`,
+		n.ListID).Scan(&ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to read list owner: %v", err)
+	}
+
+	query := `INSERT INTO outbox (user_id, kind, list_id, item_id, actor,
+	                              message, created, next_attempt)
+	                      VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	seen := map[int]bool{}
+	for _, userID := range userIDs {
+		if userID == ownerID || userID == n.ActorID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		prefs, err := readNotificationPreferences(ctx, txn, userID)
+		if err != nil {
+			return fmt.Errorf("failed to read prefs: %v", err)
+		}
+		if !prefs.WantsEvent(n.Kind) {
+			continue
+		}
+
+		_, err = txn.ExecContext(ctx, query, userID, string(n.Kind),
+			n.ListID,
+			sql.NullInt64{Int64: int64(n.ItemID), Valid: n.ItemID != 0},
+			n.ActorID, n.Message, n.Created.Unix(), n.Created.Unix())
+		if err != nil {
+			return fmt.Errorf("outbox write failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// EnqueueNotification adds n to the outbox for userID, following the same
+// rules as the notifications made by changes to lists and items. It's for
+// notifications that don't come from such a change, like reminders.
+func (db *DB) EnqueueNotification(ctx context.Context, userID int, n *Notification) error {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := enqueueNotification(ctx, txn, []int{userID}, n); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// listClaimers returns the users with claims on items in a list.
+func listClaimers(ctx context.Context, txn *sql.Tx, listID int) ([]int, error) {
+	rows, err := txn.QueryContext(ctx,
+		`SELECT DISTINCT claims.user
+		   FROM claims
+		   JOIN items ON items.id = claims.item_id
+		  WHERE items.list_id = ?
+	       ORDER BY claims.user`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// listWatchers returns the users who want to hear about changes to a list:
+// those with claims on its items, and its followers.
+func listWatchers(ctx context.Context, txn *sql.Tx, listID int) ([]int, error) {
+	claimers, err := listClaimers(ctx, txn, listID)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := listFollowers(ctx, txn, listID)
+	if err != nil {
+		return nil, err
+	}
+	return append(claimers, followers...), nil
+}
+
+func readListName(ctx context.Context, txn *sql.Tx, listID int) (string, error) {
+	var name string
+	err := txn.QueryRowContext(ctx, `SELECT name FROM lists WHERE id = ?`,
+		listID).Scan(&name)
+	return name, err
+}
+
+func claimUserIDs(claims []*Claim) []int {
+	userIDs := []int{}
+	for _, claim := range claims {
+		userIDs = append(userIDs, claim.UserID)
+	}
+	return userIDs
+}
+
+func changedFieldNames(changes []*FieldChange) string {
+	fields := []string{}
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// notifyItemCreated tells the givers on a list, and its followers, about a
+// new item.
+func notifyItemCreated(ctx context.Context, txn *sql.Tx, item *ListItem, actorID int) error {
+	watchers, err := listWatchers(ctx, txn, item.ListID)
+	if err != nil || len(watchers) == 0 {
+		return err
+	}
+
+	listName, err := readListName(ctx, txn, item.ListID)
+	if err != nil {
+		return err
+	}
+
+	return enqueueNotification(ctx, txn, watchers, &Notification{
+		Kind:    NotifyItemAdded,
+		ListID:  item.ListID,
+		ItemID:  item.ID,
+		ActorID: actorID,
+		Message: fmt.Sprintf("%q was added to %q", item.Name, listName),
+		Created: item.Updated,
+	})
+}
+
+// notifyItemUpdated tells claimers about an update to an item they claimed,
+// given the item before and after the update.
+func notifyItemUpdated(ctx context.Context, txn *sql.Tx, before *ListItemData, beforeClaims []*Claim, beforeDeleted time.Time, item *ListItem, actorID int, now time.Time) error {
+	var claimed, released []int
+	stillClaimed := map[int]bool{}
+	for _, claim := range item.Claims {
+		stillClaimed[claim.UserID] = true
+	}
+	for _, userID := range claimUserIDs(beforeClaims) {
+		if stillClaimed[userID] {
+			claimed = append(claimed, userID)
+		} else {
+			released = append(released, userID)
+		}
+	}
+
+	changes := substantiveChanges(before, &item.ListItemData)
+	deleted := beforeDeleted.IsZero() && !item.Deleted.IsZero()
+	if len(beforeClaims) == 0 ||
+		!deleted && len(changes) == 0 && len(released) == 0 {
+		return nil
+	}
+
+	listName, err := readListName(ctx, txn, item.ListID)
+	if err != nil {
+		return err
+	}
+
+	n := &Notification{
+		ListID:  item.ListID,
+		ItemID:  item.ID,
+		ActorID: actorID,
+		Created: now,
+	}
+
+	if deleted {
+		n.Kind = NotifyItemDeleted
+		n.Message = fmt.Sprintf("%q was removed from %q", item.Name,
+			listName)
+		return enqueueNotification(ctx, txn,
+			claimUserIDs(beforeClaims), n)
+	}
+
+	if len(changes) > 0 {
+		n.Kind = NotifyItemChanged
+		n.Message = fmt.Sprintf("%q on %q changed: %v", item.Name,
+			listName, changedFieldNames(changes))
+		if err := enqueueNotification(ctx, txn, claimed, n); err != nil {
+			return err
+		}
+	}
+
+	n.Kind = NotifyClaimReleased
+	n.Message = fmt.Sprintf("Your claim on %q from %q was released",
+		item.Name, listName)
+	return enqueueNotification(ctx, txn, released, n)
+}
+
+// notifyListUpdated tells the givers on a list, and its followers, about
+// changes to it. Lists aren't deleted, so archiving one (making it inactive)
+// gets its own notification.
+func notifyListUpdated(ctx context.Context, txn *sql.Tx, list *List, changes []*FieldChange, actorID int) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	watchers, err := listWatchers(ctx, txn, list.ID)
+	if err != nil {
+		return err
+	}
+
+	n := &Notification{
+		Kind:    NotifyListChanged,
+		ListID:  list.ID,
+		ActorID: actorID,
+		Message: fmt.Sprintf("%q changed: %v", list.Name,
+			changedFieldNames(changes)),
+		Created: list.Updated,
+	}
+	for _, change := range changes {
+		if change.Field == "active" && change.New == "false" {
+			n.Kind = NotifyListArchived
+			n.Message = fmt.Sprintf("%q was archived", list.Name)
+		}
+	}
+
+	return enqueueNotification(ctx, txn, watchers, n)
+}
+
+// ListPendingNotifications returns up to limit notifications that are due
+// for immediate delivery at now, oldest first. Notifications for users who
+// get digests are left for the digest.
+func (db *DB) ListPendingNotifications(ctx context.Context, now time.Time, limit int) ([]*Notification, error) {
+	query := `SELECT id, outbox.user_id, kind, list_id, item_id, actor,
+	                 message, created, attempts, next_attempt,
+	                 outbox.channels, last_error
+	            FROM outbox
+	       LEFT JOIN notification_prefs
+	              ON notification_prefs.user_id = outbox.user_id
+	           WHERE delivered IS NULL AND failed IS NULL
+	             AND next_attempt <= ?
+	             AND IFNULL(notification_prefs.digest, ?) = ?
+	        ORDER BY id
+	           LIMIT ?`
+
+	return readNotifications(ctx, db.db, query, now.Unix(),
+		DeliverImmediately, DeliverImmediately, limit)
+}
+
+// ListDigestNotifications returns the undelivered notifications for a user,
+// oldest first, for inclusion in a digest.
+func (db *DB) ListDigestNotifications(ctx context.Context, userID int) ([]*Notification, error) {
+	query := `SELECT id, user_id, kind, list_id, item_id, actor, message,
+	                 created, attempts, next_attempt, channels, last_error
+	            FROM outbox
+	           WHERE delivered IS NULL AND failed IS NULL
+	             AND user_id = ?
+	        ORDER BY id`
+
+	return readNotifications(ctx, db.db, query, userID)
+}
+
+func readNotifications(ctx context.Context, q queryer, query string, args ...interface{}) ([]*Notification, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		var kind, channels string
+		var itemID sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.UserID, &kind, &n.ListID,
+			&itemID, &n.ActorID, &n.Message, asSeconds{&n.Created},
+			&n.Attempts, asSeconds{&n.NextAttempt}, &channels,
+			&n.LastError); err != nil {
+			return nil, err
+		}
+		n.Kind = NotificationKind(kind)
+		n.ItemID = int(itemID.Int64)
+		if channels != "" {
+			n.Channels = strings.Split(channels, ",")
+		}
+		out = append(out, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// UpdateNotificationDelivery records the delivery state of a notification.
+func (db *DB) UpdateNotificationDelivery(ctx context.Context, n *Notification) error {
+	channels := append([]string{}, n.Channels...)
+	sort.Strings(channels)
+
+	query := `UPDATE outbox
+	             SET ( attempts, next_attempt, channels, last_error,
+	                   delivered, failed ) =
+	                 ( @attempts, @nextAttempt, @channels, @lastError,
+	                   @delivered, @failed )
+	           WHERE id = @id`
+
+	_, err := db.db.ExecContext(ctx, query,
+		sql.Named("attempts", n.Attempts),
+		sql.Named("nextAttempt", n.NextAttempt.Unix()),
+		sql.Named("channels", strings.Join(channels, ",")),
+		sql.Named("lastError", n.LastError),
+		sql.Named("delivered", timeOrNull(n.Delivered)),
+		sql.Named("failed", timeOrNull(n.Failed)),
+		sql.Named("id", n.ID))
+	return err
+}
@@ -0,0 +1,113 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestOutbox(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	list, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	update := func(actorID int, update func(data *database.ListItemData, state *database.ListItemState)) {
+		t.Helper()
+		var err error
+		item, err = db.UpdateListItem(ctx, list.ID, item.ID,
+			item.Version, actorID, now,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				update(data, state)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+		}
+	}
+
+	// Claiming doesn't notify anybody. In particular, the owner isn't
+	// told.
+	update(userB.ID, func(data *database.ListItemData, state *database.ListItemState) {
+		state.SetClaim(userB.ID, 1)
+	})
+
+	// The claimer hears about changes to the item and list.
+	update(list.OwnerID, func(data *database.ListItemData, state *database.ListItemState) {
+		data.Desc = "new desc"
+	})
+	if _, err := db.CreateListItem(ctx, list.ID, list.OwnerID,
+		&database.ListItemData{Name: "new"}, now); err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+	if _, err := db.UpdateList(ctx, list.ID, list.Version, list.OwnerID, now,
+		func(listData *database.ListData) error {
+			listData.Name = "renamed"
+			return nil
+		}); err != nil {
+		t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+	}
+
+	// ... and about their claim being released by somebody else.
+	update(0, func(data *database.ListItemData, state *database.ListItemState) {
+		state.SetClaim(userB.ID, 0)
+	})
+
+	pending, err := db.ListPendingNotifications(ctx, now, 100)
+	if err != nil {
+		t.Fatalf("ListPendingNotifications() = _, %v, want _, nil", err)
+	}
+
+	type summary struct {
+		UserID  int
+		Kind    database.NotificationKind
+		Message string
+	}
+	got := []summary{}
+	for _, n := range pending {
+		got = append(got, summary{n.UserID, n.Kind, n.Message})
+	}
+	want := []summary{
+		{userB.ID, database.NotifyItemChanged, `"l1i1" on "l1" changed: desc`},
+		{userB.ID, database.NotifyItemAdded, `"new" was added to "l1"`},
+		{userB.ID, database.NotifyListChanged, `"renamed" changed: name`},
+		{userB.ID, database.NotifyClaimReleased, `Your claim on "l1i1" from "renamed" was released`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ListPendingNotifications() mismatch; -want,+got:\n%s", diff)
+	}
+
+	// Delivered and postponed notifications aren't pending.
+	first, second := pending[0], pending[1]
+	first.Attempts = 1
+	first.Channels = []string{"log"}
+	first.Delivered = now
+	second.Attempts = 1
+	second.NextAttempt = now.Add(time.Minute)
+	second.LastError = "oops"
+	for _, n := range []*database.Notification{first, second} {
+		if err := db.UpdateNotificationDelivery(ctx, n); err != nil {
+			t.Fatalf("UpdateNotificationDelivery() = %v, want nil", err)
+		}
+	}
+
+	pending, err = db.ListPendingNotifications(ctx, now, 100)
+	if err != nil || len(pending) != 2 {
+		t.Errorf("ListPendingNotifications(now) = %v, %v, want 2", pending,
+			err)
+	}
+
+	pending, err = db.ListPendingNotifications(ctx, now.Add(time.Minute), 100)
+	if err != nil || len(pending) != 3 || pending[0].ID != second.ID ||
+		pending[0].LastError != "oops" || pending[0].Attempts != 1 {
+		t.Errorf("ListPendingNotifications(later) = %v, %v, want 3 with retry first",
+			pending, err)
+	}
+}
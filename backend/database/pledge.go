@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Pledge is a user's promised contribution toward a group gift, in the
+// item's currency.
+type Pledge struct {
+	UserID int
+	Amount int64
+	When   time.Time
+}
+
+// PledgedTotal returns the sum of all pledges.
+func (s *ListItemState) PledgedTotal() int64 {
+	var total int64
+	for _, pledge := range s.Pledges {
+		total += pledge.Amount
+	}
+	return total
+}
+
+// UserPledge returns the pledge made by userID, or nil if that user hasn't
+// pledged.
+func (s *ListItemState) UserPledge(userID int) *Pledge {
+	for _, pledge := range s.Pledges {
+		if pledge.UserID == userID {
+			return pledge
+		}
+	}
+	return nil
+}
+
+// SetPledge sets the amount pledged by userID. An amount of zero withdraws
+// the user's pledge. New pledges are timestamped when they're written.
+func (s *ListItemState) SetPledge(userID int, amount int64) {
+	for i, pledge := range s.Pledges {
+		if pledge.UserID != userID {
+			continue
+		}
+
+		if amount == 0 {
+			s.Pledges = append(s.Pledges[:i], s.Pledges[i+1:]...)
+			if len(s.Pledges) == 0 {
+				s.Pledges = nil
+			}
+		} else {
+			pledge.Amount = amount
+		}
+		return
+	}
+
+	if amount > 0 {
+		s.Pledges = append(s.Pledges, &Pledge{UserID: userID, Amount: amount})
+	}
+}
+
+// readPledges returns the pledges, keyed by item ID, for the items matched by
+// the where clause. The clause is evaluated against the items table.
+func readPledges(ctx context.Context, q queryer, where string, args ...interface{}) (map[int][]*Pledge, error) {
+	query := `SELECT pledges.item_id, pledges.user, pledges.amount,
+	                 pledges.created
+	            FROM pledges JOIN items ON pledges.item_id = items.id
+	           WHERE ` + where + `
+	        ORDER BY pledges.created ASC, pledges.user ASC`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pledges := map[int][]*Pledge{}
+	for rows.Next() {
+		var itemID int
+		pledge := &Pledge{}
+		if err := rows.Scan(&itemID, &pledge.UserID, &pledge.Amount, asSeconds{&pledge.When}); err != nil {
+			return nil, err
+		}
+		pledges[itemID] = append(pledges[itemID], pledge)
+	}
+
+	return pledges, rows.Err()
+}
+
+// writePledges replaces the stored pledges for itemID. Pledges without a
+// timestamp are given now.
+func writePledges(ctx context.Context, txn *sql.Tx, itemID int, pledges []*Pledge, now time.Time) error {
+	_, err := txn.ExecContext(ctx, `DELETE FROM pledges WHERE item_id = ?`,
+		itemID)
+	if err != nil {
+		return fmt.Errorf("pledge delete failed: %v", err)
+	}
+
+	if len(pledges) == 0 {
+		return nil
+	}
+
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, pledge := range pledges {
+		if pledge.When.IsZero() {
+			pledge.When = now
+		}
+
+		placeholders = append(placeholders, "(?, ?, ?, ?)")
+		args = append(args, itemID, pledge.UserID, pledge.Amount,
+			pledge.When.Unix())
+	}
+
+	query := `INSERT INTO pledges (item_id, user, amount, created)
+	               VALUES ` + strings.Join(placeholders, ", ")
+	if _, err := txn.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("pledge write failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DigestFrequency says how often a user's notifications are delivered.
+type DigestFrequency int
+
+const (
+	DeliverImmediately DigestFrequency = 0
+	DeliverDaily       DigestFrequency = 1
+	DeliverWeekly      DigestFrequency = 2
+)
+
+// NotificationEvents are the kinds of notification users can ask for.
+// Digests aren't among them, as they're a way of delivering the others.
+var NotificationEvents = []NotificationKind{
+	NotifyItemAdded,
+	NotifyItemChanged,
+	NotifyItemDeleted,
+	NotifyClaimReleased,
+	NotifyListChanged,
+	NotifyListArchived,
+	NotifyEventReminder,
+	NotifyClaimExpiring,
+	NotifyPriceDropped,
+}
+
+// NotificationPreferences say which notifications a user wants and how they
+// want them delivered. Users who haven't set any get every event, delivered
+// immediately through every channel.
+type NotificationPreferences struct {
+	Channels      []string // empty for all channels
+	Events        []NotificationKind
+	Digest        DigestFrequency
+	FollowedLists []int
+	LastDigest    time.Time
+}
+
+func defaultNotificationPreferences() *NotificationPreferences {
+	return &NotificationPreferences{
+		Channels:      []string{},
+		Events:        append([]NotificationKind{}, NotificationEvents...),
+		Digest:        DeliverImmediately,
+		FollowedLists: []int{},
+	}
+}
+
+// WantsEvent returns true if the preferences ask for notifications of kind.
+func (p *NotificationPreferences) WantsEvent(kind NotificationKind) bool {
+	for _, event := range p.Events {
+		if event == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// WantsChannel returns true if the preferences allow delivery through the
+// named channel.
+func (p *NotificationPreferences) WantsChannel(name string) bool {
+	if len(p.Channels) == 0 {
+		return true
+	}
+	for _, channel := range p.Channels {
+		if channel == name {
+			return true
+		}
+	}
+	return false
+}
+
+func splitOrEmpty(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func readNotificationPreferences(ctx context.Context, q queryer, userID int) (*NotificationPreferences, error) {
+	prefs := defaultNotificationPreferences()
+
+	var channels, events string
+	var lastDigest nullSeconds
+	err := q.QueryRowContext(ctx,
+		`SELECT channels, events, digest, last_digest
+		   FROM notification_prefs
+		  WHERE user_id = ?`, userID).Scan(
+		&channels, &events, &prefs.Digest, &lastDigest)
+	if err == nil {
+		prefs.Channels = splitOrEmpty(channels)
+		prefs.Events = []NotificationKind{}
+		for _, event := range splitOrEmpty(events) {
+			prefs.Events = append(prefs.Events,
+				NotificationKind(event))
+		}
+		prefs.LastDigest = lastDigest.Time
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx,
+		`SELECT list_id FROM list_follows
+		  WHERE user_id = ?
+	       ORDER BY list_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var listID int
+		if err := rows.Scan(&listID); err != nil {
+			return nil, err
+		}
+		prefs.FollowedLists = append(prefs.FollowedLists, listID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// GetNotificationPreferences returns a user's notification preferences.
+func (db *DB) GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	return readNotificationPreferences(ctx, db.db, userID)
+}
+
+// SetNotificationPreferences replaces a user's notification preferences.
+// LastDigest is maintained by the server, and is ignored. A user who moves
+// to a digest gets their first one a full period later.
+func (db *DB) SetNotificationPreferences(ctx context.Context, userID int, prefs *NotificationPreferences, now time.Time) (*NotificationPreferences, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := db.doSetNotificationPreferences(ctx, txn, userID, prefs, now)
+	if err != nil {
+		_ = txn.Rollback()
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (db *DB) doSetNotificationPreferences(ctx context.Context, txn *sql.Tx, userID int, prefs *NotificationPreferences, now time.Time) (*NotificationPreferences, error) {
+	switch prefs.Digest {
+	case DeliverImmediately, DeliverDaily, DeliverWeekly:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"bad digest frequency %d", prefs.Digest)
+	}
+
+	known := map[NotificationKind]bool{}
+	for _, kind := range NotificationEvents {
+		known[kind] = true
+	}
+	events := []string{}
+	for _, event := range prefs.Events {
+		if !known[event] {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"unknown notification event %q", event)
+		}
+		events = append(events, string(event))
+	}
+	sort.Strings(events)
+
+	channels := append([]string{}, prefs.Channels...)
+	sort.Strings(channels)
+
+	old, err := readNotificationPreferences(ctx, txn, userID)
+	if err != nil {
+		return nil, err
+	}
+	lastDigest := old.LastDigest
+	if prefs.Digest == DeliverImmediately {
+		lastDigest = time.Time{}
+	} else if old.Digest == DeliverImmediately {
+		lastDigest = now
+	}
+
+	_, err = txn.ExecContext(ctx,
+		`INSERT OR REPLACE INTO notification_prefs
+		        (user_id, channels, events, digest, last_digest)
+		 VALUES (?, ?, ?, ?, ?)`,
+		userID, strings.Join(channels, ","), strings.Join(events, ","),
+		prefs.Digest, timeOrNull(lastDigest))
+	if err != nil {
+		return nil, fmt.Errorf("prefs write failed: %v", err)
+	}
+
+	_, err = txn.ExecContext(ctx,
+		`DELETE FROM list_follows WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("follows delete failed: %v", err)
+	}
+	for _, listID := range prefs.FollowedLists {
+		var exists int
+		err := txn.QueryRowContext(ctx,
+			`SELECT 1 FROM lists WHERE id = ?`, listID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return nil, status.Errorf(codes.NotFound,
+				"no such list %d", listID)
+		} else if err != nil {
+			return nil, err
+		}
+
+		_, err = txn.ExecContext(ctx,
+			`INSERT OR IGNORE INTO list_follows (user_id, list_id)
+			 VALUES (?, ?)`, userID, listID)
+		if err != nil {
+			return nil, fmt.Errorf("follow write failed: %v", err)
+		}
+	}
+
+	return readNotificationPreferences(ctx, txn, userID)
+}
+
+// listFollowers returns the users following a list.
+func listFollowers(ctx context.Context, txn *sql.Tx, listID int) ([]int, error) {
+	rows, err := txn.QueryContext(ctx,
+		`SELECT user_id FROM list_follows
+		  WHERE list_id = ?
+	       ORDER BY user_id`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// DigestUser is a user who has asked for their notifications in a digest.
+type DigestUser struct {
+	UserID     int
+	Digest     DigestFrequency
+	LastDigest time.Time
+}
+
+// ListDigestUsers returns the users who receive digests.
+func (db *DB) ListDigestUsers(ctx context.Context) ([]*DigestUser, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT user_id, digest, last_digest
+		   FROM notification_prefs
+		  WHERE digest != ?
+	       ORDER BY user_id`, DeliverImmediately)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*DigestUser{}
+	for rows.Next() {
+		u := &DigestUser{}
+		var lastDigest nullSeconds
+		if err := rows.Scan(&u.UserID, &u.Digest, &lastDigest); err != nil {
+			return nil, err
+		}
+		u.LastDigest = lastDigest.Time
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RecordDigestSent marks the notifications in a digest as delivered, and
+// notes when the user's digest was sent.
+func (db *DB) RecordDigestSent(ctx context.Context, userID int, notificationIDs []int, now time.Time) error {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := db.doRecordDigestSent(ctx, txn, userID, notificationIDs, now); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (db *DB) doRecordDigestSent(ctx context.Context, txn *sql.Tx, userID int, notificationIDs []int, now time.Time) error {
+	for _, id := range notificationIDs {
+		_, err := txn.ExecContext(ctx,
+			`UPDATE outbox
+			    SET delivered = ?, channels = 'digest'
+			  WHERE id = ? AND user_id = ?`, now.Unix(), id, userID)
+		if err != nil {
+			return fmt.Errorf("outbox update failed: %v", err)
+		}
+	}
+
+	_, err := txn.ExecContext(ctx,
+		`UPDATE notification_prefs SET last_digest = ? WHERE user_id = ?`,
+		now.Unix(), userID)
+	return err
+}
@@ -0,0 +1,179 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b", "c"})
+	resps := createListItemTestLists(t, db)
+
+	list := resps.GetList("l1").List
+	userB, userC := users.UserByUsername("b"), users.UserByUsername("c")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	got, err := db.GetNotificationPreferences(ctx, userC.ID)
+	if err != nil {
+		t.Fatalf("GetNotificationPreferences() = _, %v, want _, nil", err)
+	}
+	want := &database.NotificationPreferences{
+		Channels:      []string{},
+		Events:        database.NotificationEvents,
+		Digest:        database.DeliverImmediately,
+		FollowedLists: []int{},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetNotificationPreferences() default mismatch; -want,+got:\n%s", diff)
+	}
+
+	// c follows l1, but only wants to hear about new items and archiving.
+	prefs := &database.NotificationPreferences{
+		Channels: []string{"smtp"},
+		Events: []database.NotificationKind{
+			database.NotifyListArchived, database.NotifyItemAdded,
+		},
+		FollowedLists: []int{list.ID},
+	}
+	got, err = db.SetNotificationPreferences(ctx, userC.ID, prefs, now)
+	if err != nil {
+		t.Fatalf("SetNotificationPreferences() = _, %v, want _, nil", err)
+	}
+	want = &database.NotificationPreferences{
+		Channels: []string{"smtp"},
+		Events: []database.NotificationKind{
+			database.NotifyItemAdded, database.NotifyListArchived,
+		},
+		Digest:        database.DeliverImmediately,
+		FollowedLists: []int{list.ID},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SetNotificationPreferences() mismatch; -want,+got:\n%s", diff)
+	}
+
+	prefs.FollowedLists = []int{9999}
+	if _, err := db.SetNotificationPreferences(ctx, userC.ID, prefs, now); status.Code(err) != codes.NotFound {
+		t.Errorf("SetNotificationPreferences(bad list) = _, %v, want NotFound", err)
+	}
+	prefs.FollowedLists = nil
+	prefs.Events = []database.NotificationKind{database.NotifyDigest}
+	if _, err := db.SetNotificationPreferences(ctx, userC.ID, prefs, now); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetNotificationPreferences(bad event) = _, %v, want InvalidArgument", err)
+	}
+
+	// b claims an item and takes a daily digest.
+	_, item := resps.GetItem("l1", "l1i1")
+	if _, err := db.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		userB.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		}); err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+	got, err = db.SetNotificationPreferences(ctx, userB.ID,
+		&database.NotificationPreferences{
+			Events: database.NotificationEvents,
+			Digest: database.DeliverDaily,
+		}, now)
+	if err != nil || !got.LastDigest.Equal(now) {
+		t.Fatalf("SetNotificationPreferences(daily) = %+v, %v, want last digest %v",
+			got, err, now)
+	}
+
+	if _, err := db.CreateListItem(ctx, list.ID, list.OwnerID,
+		&database.ListItemData{Name: "new"}, now); err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+	for _, update := range []func(*database.ListData){
+		func(data *database.ListData) { data.Name = "renamed" },
+		func(data *database.ListData) { data.Active = false },
+	} {
+		list, err = db.UpdateList(ctx, list.ID, list.Version,
+			list.OwnerID, now,
+			func(data *database.ListData) error {
+				update(data)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+		}
+	}
+
+	type summary struct {
+		UserID  int
+		Kind    database.NotificationKind
+		Message string
+	}
+	summarize := func(ns []*database.Notification) []summary {
+		out := []summary{}
+		for _, n := range ns {
+			out = append(out, summary{n.UserID, n.Kind, n.Message})
+		}
+		return out
+	}
+
+	// Only c's notifications are sent immediately; b's wait for the
+	// digest.
+	pending, err := db.ListPendingNotifications(ctx, now, 100)
+	if err != nil {
+		t.Fatalf("ListPendingNotifications() = _, %v, want _, nil", err)
+	}
+	wantPending := []summary{
+		{userC.ID, database.NotifyItemAdded, `"new" was added to "l1"`},
+		{userC.ID, database.NotifyListArchived, `"renamed" was archived`},
+	}
+	if diff := cmp.Diff(wantPending, summarize(pending)); diff != "" {
+		t.Errorf("ListPendingNotifications() mismatch; -want,+got:\n%s", diff)
+	}
+
+	digest, err := db.ListDigestNotifications(ctx, userB.ID)
+	if err != nil {
+		t.Fatalf("ListDigestNotifications() = _, %v, want _, nil", err)
+	}
+	wantDigest := []summary{
+		{userB.ID, database.NotifyItemAdded, `"new" was added to "l1"`},
+		{userB.ID, database.NotifyListChanged, `"renamed" changed: name`},
+		{userB.ID, database.NotifyListArchived, `"renamed" was archived`},
+	}
+	if diff := cmp.Diff(wantDigest, summarize(digest)); diff != "" {
+		t.Errorf("ListDigestNotifications() mismatch; -want,+got:\n%s", diff)
+	}
+
+	digestUsers, err := db.ListDigestUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListDigestUsers() = _, %v, want _, nil", err)
+	}
+	wantUsers := []*database.DigestUser{
+		{UserID: userB.ID, Digest: database.DeliverDaily, LastDigest: now},
+	}
+	if diff := cmp.Diff(wantUsers, digestUsers); diff != "" {
+		t.Errorf("ListDigestUsers() mismatch; -want,+got:\n%s", diff)
+	}
+
+	later := now.Add(24 * time.Hour)
+	ids := []int{}
+	for _, n := range digest {
+		ids = append(ids, n.ID)
+	}
+	if err := db.RecordDigestSent(ctx, userB.ID, ids, later); err != nil {
+		t.Fatalf("RecordDigestSent() = %v, want nil", err)
+	}
+
+	if digest, err := db.ListDigestNotifications(ctx, userB.ID); err != nil || len(digest) != 0 {
+		t.Errorf("ListDigestNotifications() = %v, %v, want [], nil",
+			digest, err)
+	}
+	if got, err := db.GetNotificationPreferences(ctx, userB.ID); err != nil || !got.LastDigest.Equal(later) {
+		t.Errorf("GetNotificationPreferences() = %+v, %v, want last digest %v",
+			got, err, later)
+	}
+}
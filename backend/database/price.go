@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PricePoint is an observed price for an item.
+type PricePoint struct {
+	When     time.Time
+	Price    int64
+	Currency string
+}
+
+// PriceAlert asks for UserID to be told when an item's price drops below
+// Threshold, which is in the item's currency.
+type PriceAlert struct {
+	ItemID    int
+	UserID    int
+	Threshold int64
+
+	// When the user was last alerted. Cleared when the price goes back
+	// up, so the user hears about the next drop.
+	AlertedWhen time.Time
+}
+
+// ListItemsForPriceCheck returns the items with URLs, on active lists, that
+// haven't had their price checked since before. Only the IDs, URL and
+// currency are filled in.
+func (db *DB) ListItemsForPriceCheck(ctx context.Context, before time.Time) ([]*ListItem, error) {
+	query := `SELECT items.id, items.list_id, items.url, items.currency
+	            FROM items
+	            JOIN lists ON items.list_id = lists.id
+	       LEFT JOIN price_checks ON price_checks.item_id = items.id
+	           WHERE lists.active
+	             AND items.deleted IS NULL
+	             AND items.url != ''
+	             AND (price_checks.checked IS NULL OR
+	                  price_checks.checked < @before)
+	        ORDER BY items.id ASC`
+
+	rows, err := db.db.QueryContext(ctx, query,
+		sql.Named("before", before.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		item := &ListItem{}
+		err := rows.Scan(&item.ID, &item.ListID, &item.URL,
+			&item.Currency)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// RecordPriceCheck notes that an item's price was checked. If checkErr is
+// nil, point is added to the item's price history.
+func (db *DB) RecordPriceCheck(ctx context.Context, itemID int, now time.Time, point *PricePoint, checkErr error) error {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := doRecordPriceCheck(ctx, txn, itemID, now, point, checkErr); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func doRecordPriceCheck(ctx context.Context, txn *sql.Tx, itemID int, now time.Time, point *PricePoint, checkErr error) error {
+	errStr := ""
+	if checkErr != nil {
+		errStr = checkErr.Error()
+	}
+
+	query := `INSERT OR REPLACE INTO price_checks (item_id, checked, error)
+	                              VALUES (?, ?, ?)`
+	if _, err := txn.ExecContext(ctx, query, itemID, now.Unix(), errStr); err != nil {
+		return fmt.Errorf("price check write failed: %v", err)
+	}
+
+	if checkErr != nil {
+		return nil
+	}
+
+	query = `INSERT INTO price_history (item_id, checked, price, currency)
+	                            VALUES (?, ?, ?, ?)`
+	_, err := txn.ExecContext(ctx, query, itemID, point.When.Unix(),
+		point.Price, point.Currency)
+	if err != nil {
+		return fmt.Errorf("price history write failed: %v", err)
+	}
+
+	return nil
+}
+
+// GetItemPriceHistory returns an item's price history, oldest first.
+func (db *DB) GetItemPriceHistory(ctx context.Context, itemID int) ([]*PricePoint, error) {
+	query := `SELECT checked, price, currency
+	            FROM price_history
+	           WHERE item_id = ?
+	        ORDER BY checked ASC, rowid ASC`
+
+	rows, err := db.db.QueryContext(ctx, query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []*PricePoint{}
+	for rows.Next() {
+		point := &PricePoint{}
+		err := rows.Scan(asSeconds{&point.When}, &point.Price,
+			&point.Currency)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// SetPriceAlert sets userID's alert threshold for an item. A zero threshold
+// removes the alert.
+func (db *DB) SetPriceAlert(ctx context.Context, itemID, userID int, threshold int64) error {
+	if threshold == 0 {
+		_, err := db.db.ExecContext(ctx,
+			`DELETE FROM price_alerts WHERE item_id = ? AND user = ?`,
+			itemID, userID)
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO price_alerts (item_id, user, threshold,
+	                                               alerted)
+	                                       VALUES (?, ?, ?, NULL)`
+	_, err := db.db.ExecContext(ctx, query, itemID, userID, threshold)
+	return err
+}
+
+// ListPriceAlerts returns the alerts set on an item.
+func (db *DB) ListPriceAlerts(ctx context.Context, itemID int) ([]*PriceAlert, error) {
+	query := `SELECT item_id, user, threshold, alerted
+	            FROM price_alerts
+	           WHERE item_id = ?
+	        ORDER BY user ASC`
+
+	rows, err := db.db.QueryContext(ctx, query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []*PriceAlert{}
+	for rows.Next() {
+		alert := &PriceAlert{}
+		var alerted nullSeconds
+		err := rows.Scan(&alert.ItemID, &alert.UserID, &alert.Threshold,
+			&alerted)
+		if err != nil {
+			return nil, err
+		}
+		alert.AlertedWhen = alerted.Time
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// SetPriceAlertAlerted records when a user was last alerted about an item. A
+// zero time re-arms the alert.
+func (db *DB) SetPriceAlertAlerted(ctx context.Context, itemID, userID int, when time.Time) error {
+	query := `UPDATE price_alerts SET alerted = ?
+	           WHERE item_id = ? AND user = ?`
+	_, err := db.db.ExecContext(ctx, query, timeOrNull(when), itemID, userID)
+	return err
+}
@@ -0,0 +1,102 @@
+package database_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func itemIDs(items []*database.ListItem) []int {
+	ids := []int{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestPriceHistory(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b", "c"})
+	resps := createListItemTestLists(t, db)
+
+	_, l1i1 := resps.GetItem("l1", "l1i1")
+	_, l1i2 := resps.GetItem("l1", "l1i2")
+	_, l2i1 := resps.GetItem("l2", "l2i1")
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	items, err := db.ListItemsForPriceCheck(ctx, now)
+	if err != nil {
+		t.Fatalf("ListItemsForPriceCheck() = _, %v, want _, nil", err)
+	}
+	if want := []int{l1i1.ID, l1i2.ID, l2i1.ID}; !cmp.Equal(want, itemIDs(items)) {
+		t.Errorf("ListItemsForPriceCheck() = %v, want %v",
+			itemIDs(items), want)
+	}
+
+	point := &database.PricePoint{When: now, Price: 1500, Currency: "USD"}
+	if err := db.RecordPriceCheck(ctx, l1i2.ID, now, point, nil); err != nil {
+		t.Fatalf("RecordPriceCheck(ok) = %v, want nil", err)
+	}
+	if err := db.RecordPriceCheck(ctx, l2i1.ID, now, nil, fmt.Errorf("failed")); err != nil {
+		t.Fatalf("RecordPriceCheck(failed) = %v, want nil", err)
+	}
+
+	// Both checked items are skipped until they're due again.
+	items, err = db.ListItemsForPriceCheck(ctx, now)
+	if err != nil || !cmp.Equal([]int{l1i1.ID}, itemIDs(items)) {
+		t.Errorf("ListItemsForPriceCheck() = %v, %v, want [%v], nil",
+			itemIDs(items), err, l1i1.ID)
+	}
+
+	later := now.Add(time.Hour)
+	point2 := &database.PricePoint{When: later, Price: 1200, Currency: "USD"}
+	if err := db.RecordPriceCheck(ctx, l1i2.ID, later, point2, nil); err != nil {
+		t.Fatalf("RecordPriceCheck(ok) = %v, want nil", err)
+	}
+
+	history, err := db.GetItemPriceHistory(ctx, l1i2.ID)
+	if err != nil {
+		t.Fatalf("GetItemPriceHistory() = _, %v, want _, nil", err)
+	}
+	if diff := cmp.Diff([]*database.PricePoint{point, point2}, history); diff != "" {
+		t.Errorf("GetItemPriceHistory() mismatch; -want,+got:\n%v", diff)
+	}
+
+	userB := users.UserByUsername("b")
+	userC := users.UserByUsername("c")
+	if err := db.SetPriceAlert(ctx, l1i2.ID, userB.ID, 1000); err != nil {
+		t.Fatalf("SetPriceAlert(b) = %v, want nil", err)
+	}
+	if err := db.SetPriceAlert(ctx, l1i2.ID, userC.ID, 2000); err != nil {
+		t.Fatalf("SetPriceAlert(c) = %v, want nil", err)
+	}
+	if err := db.SetPriceAlertAlerted(ctx, l1i2.ID, userC.ID, later); err != nil {
+		t.Fatalf("SetPriceAlertAlerted(c) = %v, want nil", err)
+	}
+
+	alerts, err := db.ListPriceAlerts(ctx, l1i2.ID)
+	if err != nil {
+		t.Fatalf("ListPriceAlerts() = _, %v, want _, nil", err)
+	}
+	want := []*database.PriceAlert{
+		&database.PriceAlert{ItemID: l1i2.ID, UserID: userB.ID, Threshold: 1000},
+		&database.PriceAlert{ItemID: l1i2.ID, UserID: userC.ID, Threshold: 2000,
+			AlertedWhen: later},
+	}
+	if diff := cmp.Diff(want, alerts); diff != "" {
+		t.Errorf("ListPriceAlerts() mismatch; -want,+got:\n%v", diff)
+	}
+
+	if err := db.SetPriceAlert(ctx, l1i2.ID, userB.ID, 0); err != nil {
+		t.Fatalf("SetPriceAlert(b, 0) = %v, want nil", err)
+	}
+	alerts, err = db.ListPriceAlerts(ctx, l1i2.ID)
+	if err != nil || len(alerts) != 1 || alerts[0].UserID != userC.ID {
+		t.Errorf("ListPriceAlerts() = %v, %v, want only c's", alerts, err)
+	}
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// An EventReminder tells a user that a list's event is coming up. Each is
+// sent at most once for a given list, user, event date and lead.
+type EventReminder struct {
+	ListID     int
+	UserID     int
+	EventDate  time.Time
+	DaysBefore int
+	Message    string
+}
+
+// EnqueueEventReminder queues r for delivery, unless it has been sent
+// before. It returns true if the reminder was queued.
+func (db *DB) EnqueueEventReminder(ctx context.Context, r *EventReminder, now time.Time) (bool, error) {
+	txn, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	queued, err := db.doEnqueueEventReminder(ctx, txn, r, now)
+	if err != nil {
+		_ = txn.Rollback()
+		return false, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return false, err
+	}
+	return queued, nil
+}
+
+func (db *DB) doEnqueueEventReminder(ctx context.Context, txn *sql.Tx, r *EventReminder, now time.Time) (bool, error) {
+	result, err := txn.ExecContext(ctx,
+		`INSERT OR IGNORE INTO event_reminders
+		        (list_id, user_id, event_date, days_before, sent)
+		 VALUES (?, ?, ?, ?, ?)`,
+		r.ListID, r.UserID, r.EventDate.Unix(), r.DaysBefore, now.Unix())
+	if err != nil {
+		return false, fmt.Errorf("reminder write failed: %v", err)
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if num == 0 {
+		return false, nil
+	}
+
+	err = enqueueNotification(ctx, txn, []int{r.UserID}, &Notification{
+		Kind:    NotifyEventReminder,
+		ListID:  r.ListID,
+		Message: r.Message,
+		Created: now,
+	})
+	return err == nil, err
+}
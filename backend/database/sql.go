@@ -42,6 +42,10 @@ func (p *nullSeconds) Scan(src interface{}) error {
 	return nil
 }
 
+func timeOrNull(t time.Time) nullSeconds {
+	return nullSeconds{Time: t, Valid: !t.IsZero()}
+}
+
 func (p nullSeconds) Value() (driver.Value, error) {
 	if !p.Valid {
 		return nil, nil
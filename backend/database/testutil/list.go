@@ -69,7 +69,7 @@ func SetupLists(ctx context.Context, t *testing.T, db *database.DB, reqs []*List
 
 		for i, listItemData := range req.ListItems {
 			listItem, err := db.CreateListItem(
-				ctx, list.ID, listItemData,
+				ctx, list.ID, user.ID, listItemData,
 				time.Unix(stamp+10*int64(i), 0))
 			if err != nil {
 				t.Fatalf("createlistitem #%d: %v", i, err)
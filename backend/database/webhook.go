@@ -0,0 +1,328 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookListCreated WebhookEvent = "list.created"
+	WebhookListUpdated WebhookEvent = "list.updated"
+	WebhookItemCreated WebhookEvent = "item.created"
+	WebhookItemUpdated WebhookEvent = "item.updated"
+	WebhookItemDeleted WebhookEvent = "item.deleted"
+
+	// WebhookPing is sent by test deliveries, and is never queued.
+	WebhookPing WebhookEvent = "ping"
+)
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []WebhookEvent{
+	WebhookListCreated,
+	WebhookListUpdated,
+	WebhookItemCreated,
+	WebhookItemUpdated,
+	WebhookItemDeleted,
+}
+
+// A Webhook is an endpoint that's told about changes to lists and items.
+type Webhook struct {
+	ID      int
+	OwnerID int
+	ListID  int // zero for all lists
+	URL     string
+	Secret  string // for signing deliveries
+	Events  []WebhookEvent
+	Created time.Time
+}
+
+// Wants returns true if the webhook subscribes to event. Webhooks with no
+// events subscribe to all of them.
+func (w *Webhook) Wants(event WebhookEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWebhookEvents(events string) []WebhookEvent {
+	out := []WebhookEvent{}
+	for _, event := range splitOrEmpty(events) {
+		out = append(out, WebhookEvent(event))
+	}
+	return out
+}
+
+// CreateWebhook registers a webhook. Permission checks are up to the
+// caller.
+func (db *DB) CreateWebhook(ctx context.Context, hook *Webhook) (*Webhook, error) {
+	if hook.ID != 0 {
+		panic("ID must be 0")
+	}
+
+	known := map[WebhookEvent]bool{}
+	for _, event := range WebhookEvents {
+		known[event] = true
+	}
+	events := []string{}
+	for _, event := range hook.Events {
+		if !known[event] {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"unknown webhook event %q", event)
+		}
+		events = append(events, string(event))
+	}
+
+	result, err := db.db.ExecContext(ctx,
+		`INSERT INTO webhooks (owner, list_id, url, secret, events, created)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		hook.OwnerID,
+		sql.NullInt64{Int64: int64(hook.ListID), Valid: hook.ListID != 0},
+		hook.URL, hook.Secret, strings.Join(events, ","),
+		hook.Created.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook ID")
+	}
+
+	out := *hook
+	out.ID = int(id)
+	out.Events = parseWebhookEvents(strings.Join(events, ","))
+	return &out, nil
+}
+
+type WebhookFilter struct {
+	where string
+}
+
+func AllWebhooks() WebhookFilter {
+	return WebhookFilter{}
+}
+
+func OnlyWebhookWithID(id int) WebhookFilter {
+	return WebhookFilter{fmt.Sprintf("id = %d", id)}
+}
+
+func OnlyWebhooksOwnedBy(userID int) WebhookFilter {
+	return WebhookFilter{fmt.Sprintf("owner = %d", userID)}
+}
+
+func (db *DB) ListWebhooks(ctx context.Context, filter WebhookFilter) ([]*Webhook, error) {
+	query := `SELECT id, owner, list_id, url, secret, events, created
+	            FROM webhooks`
+	if filter.where != "" {
+		query += " WHERE " + filter.where
+	}
+	query += " ORDER BY id"
+
+	return readWebhooks(ctx, db.db, query)
+}
+
+func readWebhooks(ctx context.Context, q queryer, query string, args ...interface{}) ([]*Webhook, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*Webhook{}
+	for rows.Next() {
+		hook := &Webhook{}
+		var listID sql.NullInt64
+		var events string
+		if err := rows.Scan(&hook.ID, &hook.OwnerID, &listID, &hook.URL,
+			&hook.Secret, &events, asSeconds{&hook.Created}); err != nil {
+			return nil, err
+		}
+		hook.ListID = int(listID.Int64)
+		hook.Events = parseWebhookEvents(events)
+		out = append(out, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// DeleteWebhook unregisters a webhook, discarding its deliveries.
+func (db *DB) DeleteWebhook(ctx context.Context, webhookID int) error {
+	result, err := db.db.ExecContext(ctx,
+		`DELETE FROM webhooks WHERE id = ?`, webhookID)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return status.Errorf(codes.NotFound, "no webhook with ID %v",
+			webhookID)
+	}
+	return nil
+}
+
+// A WebhookDelivery is a change waiting to be, or that has been, sent to a
+// webhook. The change itself is read when the delivery is made.
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	Event     WebhookEvent
+	ListID    int
+	ItemID    int // zero for list events
+
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Delivered   time.Time
+
+	// Failed is set when the dispatcher gives up on the delivery. Failed
+	// deliveries are kept until they're redelivered or the webhook is
+	// deleted.
+	Failed time.Time
+}
+
+// enqueueWebhookDeliveries queues an event for the webhooks that want it.
+func enqueueWebhookDeliveries(ctx context.Context, txn *sql.Tx, event WebhookEvent, listID, itemID int) error {
+	hooks, err := readWebhooks(ctx, txn,
+		`SELECT id, owner, list_id, url, secret, events, created
+		   FROM webhooks
+		  WHERE list_id = ? OR list_id IS NULL
+	       ORDER BY id`, listID)
+	if err != nil {
+		return fmt.Errorf("failed to read webhooks: %v", err)
+	}
+
+	for _, hook := range hooks {
+		if !hook.Wants(event) {
+			continue
+		}
+
+		_, err := txn.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries
+			        (webhook_id, event, list_id, item_id)
+			 VALUES (?, ?, ?, ?)`,
+			hook.ID, string(event), listID, itemID)
+		if err != nil {
+			return fmt.Errorf("webhook delivery write failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+type WebhookDeliveryFilter struct {
+	where string
+	args  []interface{}
+}
+
+// PendingWebhookDeliveries matches up to limit deliveries that are due at
+// now, oldest first.
+func PendingWebhookDeliveries(now time.Time, limit int) WebhookDeliveryFilter {
+	return WebhookDeliveryFilter{
+		where: `delivered IS NULL AND failed IS NULL AND next_attempt <= ?
+		        ORDER BY id LIMIT ?`,
+		args: []interface{}{now.Unix(), limit},
+	}
+}
+
+// OnlyWebhookDeliveryWithID matches a single delivery.
+func OnlyWebhookDeliveryWithID(id int) WebhookDeliveryFilter {
+	return WebhookDeliveryFilter{where: "id = ?", args: []interface{}{id}}
+}
+
+// WebhookDeliveriesFor matches a webhook's deliveries, newest first,
+// optionally only those that have failed.
+func WebhookDeliveriesFor(webhookID int, onlyFailed bool) WebhookDeliveryFilter {
+	where := "webhook_id = ?"
+	if onlyFailed {
+		where += " AND failed IS NOT NULL"
+	}
+	return WebhookDeliveryFilter{
+		where: where + " ORDER BY id DESC",
+		args:  []interface{}{webhookID},
+	}
+}
+
+func (db *DB) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	query := `SELECT id, webhook_id, event, list_id, item_id, attempts,
+	                 next_attempt, last_error, delivered, failed
+	            FROM webhook_deliveries
+	           WHERE ` + filter.where
+
+	rows, err := db.db.QueryContext(ctx, query, filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		var event string
+		var delivered, failed nullSeconds
+		if err := rows.Scan(&d.ID, &d.WebhookID, &event, &d.ListID,
+			&d.ItemID, &d.Attempts, asSeconds{&d.NextAttempt},
+			&d.LastError, &delivered, &failed); err != nil {
+			return nil, err
+		}
+		d.Event = WebhookEvent(event)
+		d.Delivered, d.Failed = delivered.Time, failed.Time
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// UpdateWebhookDelivery records the delivery state of a delivery.
+func (db *DB) UpdateWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries
+	             SET ( attempts, next_attempt, last_error, delivered,
+	                   failed ) =
+	                 ( @attempts, @nextAttempt, @lastError, @delivered,
+	                   @failed )
+	           WHERE id = @id`
+
+	result, err := db.db.ExecContext(ctx, query,
+		sql.Named("attempts", d.Attempts),
+		sql.Named("nextAttempt", d.NextAttempt.Unix()),
+		sql.Named("lastError", d.LastError),
+		sql.Named("delivered", timeOrNull(d.Delivered)),
+		sql.Named("failed", timeOrNull(d.Failed)),
+		sql.Named("id", d.ID))
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return status.Errorf(codes.NotFound,
+			"no webhook delivery with ID %v", d.ID)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	resps := createListItemTestLists(t, db)
+
+	userA, userB := users.UserByUsername("a"), users.UserByUsername("b")
+	l1, l2 := resps.GetList("l1").List, resps.GetList("l2").List
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+
+	// a watches items on l1; b watches everything.
+	itemHook, err := db.CreateWebhook(ctx, &database.Webhook{
+		OwnerID: userA.ID,
+		ListID:  l1.ID,
+		URL:     "http://a/hook",
+		Secret:  "secret",
+		Events: []database.WebhookEvent{
+			database.WebhookItemCreated, database.WebhookItemDeleted,
+		},
+		Created: now,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook() = _, %v, want _, nil", err)
+	}
+	allHook, err := db.CreateWebhook(ctx, &database.Webhook{
+		OwnerID: userB.ID,
+		URL:     "http://b/hook",
+		Secret:  "secret",
+		Created: now,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook() = _, %v, want _, nil", err)
+	}
+
+	if _, err := db.CreateWebhook(ctx, &database.Webhook{
+		OwnerID: userB.ID,
+		URL:     "http://b/hook",
+		Events:  []database.WebhookEvent{database.WebhookPing},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateWebhook(ping) = _, %v, want InvalidArgument", err)
+	}
+
+	hooks, err := db.ListWebhooks(ctx, database.OnlyWebhooksOwnedBy(userA.ID))
+	if err != nil {
+		t.Fatalf("ListWebhooks() = _, %v, want _, nil", err)
+	}
+	if diff := cmp.Diff([]*database.Webhook{itemHook}, hooks); diff != "" {
+		t.Errorf("ListWebhooks() mismatch; -want,+got:\n%s", diff)
+	}
+
+	item, err := db.CreateListItem(ctx, l1.ID, userA.ID,
+		&database.ListItemData{Name: "new"}, now)
+	if err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+	item, err = db.UpdateListItem(ctx, l1.ID, item.ID, item.Version,
+		userA.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			data.Desc = "desc"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+	if _, err := db.UpdateListItem(ctx, l1.ID, item.ID, item.Version,
+		userA.ID, now,
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.Deleted = now
+			return nil
+		}); err != nil {
+		t.Fatalf("UpdateListItem(delete) = _, %v, want _, nil", err)
+	}
+	if _, err := db.UpdateList(ctx, l2.ID, l2.Version, userB.ID, now,
+		func(data *database.ListData) error {
+			data.Name = "renamed"
+			return nil
+		}); err != nil {
+		t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+	}
+
+	type summary struct {
+		WebhookID int
+		Event     database.WebhookEvent
+		ListID    int
+		ItemID    int
+	}
+	summarize := func(deliveries []*database.WebhookDelivery) []summary {
+		out := []summary{}
+		for _, d := range deliveries {
+			out = append(out, summary{d.WebhookID, d.Event, d.ListID,
+				d.ItemID})
+		}
+		return out
+	}
+
+	pending, err := db.ListWebhookDeliveries(ctx,
+		database.PendingWebhookDeliveries(now, 100))
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() = _, %v, want _, nil", err)
+	}
+	want := []summary{
+		{itemHook.ID, database.WebhookItemCreated, l1.ID, item.ID},
+		{allHook.ID, database.WebhookItemCreated, l1.ID, item.ID},
+		{allHook.ID, database.WebhookItemUpdated, l1.ID, item.ID},
+		{itemHook.ID, database.WebhookItemDeleted, l1.ID, item.ID},
+		{allHook.ID, database.WebhookItemDeleted, l1.ID, item.ID},
+		{allHook.ID, database.WebhookListUpdated, l2.ID, 0},
+	}
+	if diff := cmp.Diff(want, summarize(pending)); diff != "" {
+		t.Fatalf("ListWebhookDeliveries(pending) mismatch; -want,+got:\n%s", diff)
+	}
+
+	// Delivered, postponed and failed deliveries aren't pending.
+	pending[0].Attempts = 1
+	pending[0].Delivered = now
+	pending[1].Attempts = 1
+	pending[1].NextAttempt = now.Add(time.Minute)
+	pending[1].LastError = "oops"
+	pending[2].Attempts = 8
+	pending[2].Failed = now
+	pending[2].LastError = "gave up"
+	for _, d := range pending[:3] {
+		if err := db.UpdateWebhookDelivery(ctx, d); err != nil {
+			t.Fatalf("UpdateWebhookDelivery() = %v, want nil", err)
+		}
+	}
+
+	got, err := db.ListWebhookDeliveries(ctx,
+		database.PendingWebhookDeliveries(now, 100))
+	if err != nil || len(got) != 3 {
+		t.Errorf("ListWebhookDeliveries(pending) = %v, %v, want 3", got, err)
+	}
+
+	got, err = db.ListWebhookDeliveries(ctx,
+		database.WebhookDeliveriesFor(allHook.ID, true))
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries(failed) = _, %v, want _, nil", err)
+	}
+	if diff := cmp.Diff([]*database.WebhookDelivery{pending[2]}, got); diff != "" {
+		t.Errorf("ListWebhookDeliveries(failed) mismatch; -want,+got:\n%s", diff)
+	}
+
+	// Deleting a webhook discards its deliveries.
+	if err := db.DeleteWebhook(ctx, allHook.ID); err != nil {
+		t.Fatalf("DeleteWebhook() = %v, want nil", err)
+	}
+	if err := db.DeleteWebhook(ctx, allHook.ID); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteWebhook(again) = %v, want NotFound", err)
+	}
+	got, err = db.ListWebhookDeliveries(ctx,
+		database.WebhookDeliveriesFor(allHook.ID, false))
+	if err != nil || len(got) != 0 {
+		t.Errorf("ListWebhookDeliveries(deleted) = %v, %v, want [], nil",
+			got, err)
+	}
+}
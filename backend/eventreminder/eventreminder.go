@@ -0,0 +1,159 @@
+// Package eventreminder reminds givers that a list's event is coming up:
+// those who haven't claimed anything from the list are nudged, and those
+// with claims they haven't bought yet are reminded about them.
+package eventreminder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var logger = grpclog.Component("eventreminder")
+
+const day = 24 * time.Hour
+
+type Scheduler struct {
+	db    *database.DB
+	clock util.Clock
+	days  []int
+}
+
+// NewScheduler returns a Scheduler that sends reminders the given numbers
+// of days before each list's event.
+func NewScheduler(db *database.DB, clock util.Clock, days []int) *Scheduler {
+	days = append([]int{}, days...)
+	sort.Ints(days)
+
+	return &Scheduler{
+		db:    db,
+		clock: clock,
+		days:  days,
+	}
+}
+
+// dueLead returns the reminder lead that applies at now, which is the
+// smallest one whose time has come. Leads that were missed, say because
+// the event date was set late, are skipped rather than sent all at once.
+func (s *Scheduler) dueLead(eventDate, now time.Time) (int, bool) {
+	if eventDate.IsZero() || !now.Before(eventDate) {
+		return 0, false
+	}
+
+	for _, days := range s.days {
+		if !now.Before(eventDate.Add(-time.Duration(days) * day)) {
+			return days, true
+		}
+	}
+	return 0, false
+}
+
+// Run calls RunOnce every interval, as measured by the Scheduler's clock,
+// until ctx is done.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			logger.Errorf("event reminders failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce queues the reminders that are due. Reminders already sent are
+// skipped, so it's safe to run as often as needed.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	lists, err := s.db.ListLists(ctx, database.IncludeInactiveLists(false))
+	if err != nil {
+		return err
+	}
+
+	users, err := s.db.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	for _, list := range lists {
+		lead, found := s.dueLead(list.EventDate, now)
+		if !found {
+			continue
+		}
+
+		if err := s.remind(ctx, list, users, lead, now); err != nil {
+			logger.Errorf("failed to send reminders for list %v: %v",
+				list.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) remind(ctx context.Context, list *database.List, users []*database.User, lead int, now time.Time) error {
+	items, err := s.db.ListListItems(ctx, list.ID, database.AllItems())
+	if err != nil {
+		return err
+	}
+
+	claimed := map[int]bool{}
+	unpurchased := map[int][]string{}
+	for _, item := range items {
+		if !item.Deleted.IsZero() {
+			continue
+		}
+		for _, claim := range item.Claims {
+			claimed[claim.UserID] = true
+			if claim.Purchase == database.PurchaseClaimed {
+				unpurchased[claim.UserID] = append(
+					unpurchased[claim.UserID],
+					fmt.Sprintf("%q", item.Name))
+			}
+		}
+	}
+
+	daysLeft := int((list.EventDate.Sub(now) + day - 1) / day)
+	when := fmt.Sprintf("%d days", daysLeft)
+	if daysLeft == 1 {
+		when = "1 day"
+	}
+
+	for _, user := range users {
+		if user.ID == list.OwnerID {
+			continue
+		}
+
+		var message string
+		if names := unpurchased[user.ID]; len(names) > 0 {
+			message = fmt.Sprintf("%q is %v away and you haven't bought %v yet",
+				list.Name, when, strings.Join(names, ", "))
+		} else if !claimed[user.ID] {
+			message = fmt.Sprintf("%q is %v away and you haven't claimed anything from it yet",
+				list.Name, when)
+		} else {
+			continue
+		}
+
+		_, err := s.db.EnqueueEventReminder(ctx, &database.EventReminder{
+			ListID:     list.ID,
+			UserID:     user.ID,
+			EventDate:  list.EventDate,
+			DaysBefore: lead,
+			Message:    message,
+		}, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package eventreminder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+var (
+	ctx = context.Background()
+)
+
+func TestScheduler(t *testing.T) {
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db,
+		[]string{"a", "b", "c", "d"})
+
+	start := time.Unix(testutil.SetupListsUserStamp, 0)
+	eventDate := start.Add(20 * day)
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: eventDate, Active: true},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+				&database.ListItemData{Name: "l1i2"},
+			},
+		},
+	})
+
+	userB := users.UserByUsername("b")
+	userC := users.UserByUsername("c")
+	userD := users.UserByUsername("d")
+
+	claim := func(itemName string, userID int, purchase bool) {
+		t.Helper()
+		list, item := resps.GetItem("l1", itemName)
+		_, err := db.UpdateListItem(ctx, list.ID, item.ID,
+			item.Version, userID, start,
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				state.SetClaim(userID, 1)
+				if purchase {
+					return state.UserClaim(userID).SetPurchaseState(
+						database.PurchasePurchased, start)
+				}
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %v, %v) = _, %v, want _, nil",
+				list.ID, item.ID, err)
+		}
+	}
+
+	// b has an item to buy, c has bought theirs, and d hasn't claimed
+	// anything.
+	claim("l1i1", userB.ID, false)
+	claim("l1i2", userC.ID, true)
+
+	clock := &util.MonoClock{Time: start}
+	scheduler := NewScheduler(db, clock, []int{3, 30, 14})
+
+	type summary struct {
+		UserID  int
+		Message string
+	}
+	sent := 0
+	checkSent := func(want []summary) {
+		t.Helper()
+		if err := scheduler.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce() = %v, want nil", err)
+		}
+
+		pending, err := db.ListPendingNotifications(ctx,
+			eventDate.Add(day), 100)
+		if err != nil {
+			t.Fatalf("ListPendingNotifications() = _, %v, want _, nil", err)
+		}
+		got := []summary{}
+		for _, n := range pending[sent:] {
+			if n.Kind != database.NotifyEventReminder {
+				continue
+			}
+			got = append(got, summary{n.UserID, n.Message})
+		}
+		sent = len(pending)
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("reminders mismatch; -want,+got:\n%s", diff)
+		}
+	}
+
+	// 20 days out, the 30 day reminders are due. The 3 and 14 day ones
+	// aren't.
+	checkSent([]summary{
+		{userB.ID, `"l1" is 20 days away and you haven't bought "l1i1" yet`},
+		{userD.ID, `"l1" is 20 days away and you haven't claimed anything from it yet`},
+	})
+
+	// They're only sent once.
+	clock.Advance(time.Hour)
+	checkSent([]summary{})
+
+	// 14 days out, the next ones are due.
+	clock.Time = eventDate.Add(-14 * day)
+	checkSent([]summary{
+		{userB.ID, `"l1" is 14 days away and you haven't bought "l1i1" yet`},
+		{userD.ID, `"l1" is 14 days away and you haven't claimed anything from it yet`},
+	})
+
+	// Nothing is sent once the event has passed.
+	clock.Time = eventDate
+	checkSent([]summary{})
+}
+
+func TestDueLead(t *testing.T) {
+	s := NewScheduler(nil, nil, []int{30, 14, 3})
+	eventDate := time.Unix(100*int64(day/time.Second), 0)
+
+	type testCase struct {
+		now      time.Time
+		wantLead int
+		wantDue  bool
+	}
+	testCases := []testCase{
+		{eventDate.Add(-31 * day), 0, false},
+		{eventDate.Add(-30 * day), 30, true},
+		{eventDate.Add(-15 * day), 30, true},
+		{eventDate.Add(-10 * day), 14, true},
+		{eventDate.Add(-time.Hour), 3, true},
+		{eventDate, 0, false},
+	}
+
+	for _, tc := range testCases {
+		lead, due := s.dueLead(eventDate, tc.now)
+		if lead != tc.wantLead || due != tc.wantDue {
+			t.Errorf("dueLead(%v, %v) = %v, %v, want %v, %v",
+				eventDate, tc.now, lead, due, tc.wantLead,
+				tc.wantDue)
+		}
+	}
+
+	if _, due := s.dueLead(time.Time{}, eventDate); due {
+		t.Errorf("dueLead(zero, _) = _, true, want _, false")
+	}
+}
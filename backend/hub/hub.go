@@ -0,0 +1,111 @@
+// Package hub fans item changes out to the clients watching their lists.
+package hub
+
+import (
+	"sync"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+// DefaultBuffer is the number of events a subscriber can fall behind by
+// before it's dropped.
+const DefaultBuffer = 64
+
+// A Hub delivers published events to the subscribers for their lists. It's
+// meant to be the database's item listener.
+type Hub struct {
+	buffer int
+
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]bool
+}
+
+func New(buffer int) *Hub {
+	return &Hub{
+		buffer: buffer,
+		subs:   map[int]map[*Subscription]bool{},
+	}
+}
+
+// A Subscription receives the events for one list.
+type Subscription struct {
+	hub    *Hub
+	listID int
+
+	// Events are delivered on C. C is closed when the subscription is
+	// closed, or if the subscriber falls too far behind, in which case
+	// Overflowed returns true.
+	C <-chan *database.ItemEvent
+	c chan *database.ItemEvent
+
+	overflowed bool // guarded by hub.mu
+}
+
+// Subscribe starts delivering events for listID. The subscription must be
+// closed when it's no longer needed.
+func (h *Hub) Subscribe(listID int) *Subscription {
+	c := make(chan *database.ItemEvent, h.buffer)
+	sub := &Subscription{hub: h, listID: listID, C: c, c: c}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[listID] == nil {
+		h.subs[listID] = map[*Subscription]bool{}
+	}
+	h.subs[listID][sub] = true
+
+	return sub
+}
+
+// Publish delivers event to the list's subscribers without blocking.
+// Subscribers whose buffers are full are dropped.
+func (h *Hub) Publish(event *database.ItemEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[event.ListID] {
+		select {
+		case sub.c <- event:
+		default:
+			sub.overflowed = true
+			h.removeLocked(sub)
+		}
+	}
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	subs := h.subs[sub.listID]
+	if !subs[sub] {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.listID)
+	}
+	close(sub.c)
+}
+
+// NumSubscribers returns the number of subscribers for listID.
+func (h *Hub) NumSubscribers(listID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[listID])
+}
+
+// Close stops delivery of events. It's safe to call more than once, and
+// after the subscription has overflowed.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.removeLocked(s)
+}
+
+// Overflowed returns true if the subscription was dropped because the
+// subscriber fell behind.
+func (s *Subscription) Overflowed() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.overflowed
+}
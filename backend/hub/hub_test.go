@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+func itemEvent(listID, itemID int) *database.ItemEvent {
+	return &database.ItemEvent{
+		Type:   database.ItemUpdated,
+		ListID: listID,
+		Item:   &database.ListItem{ID: itemID, ListID: listID},
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := New(2)
+
+	sub1 := h.Subscribe(1)
+	sub2 := h.Subscribe(2)
+	defer sub2.Close()
+
+	h.Publish(itemEvent(1, 10))
+	h.Publish(itemEvent(2, 20))
+
+	if ev := <-sub1.C; ev.Item.ID != 10 {
+		t.Errorf("sub1 got item %v, want 10", ev.Item.ID)
+	}
+	if ev := <-sub2.C; ev.Item.ID != 20 {
+		t.Errorf("sub2 got item %v, want 20", ev.Item.ID)
+	}
+
+	sub1.Close()
+	sub1.Close()
+	if _, ok := <-sub1.C; ok {
+		t.Errorf("sub1.C open after Close")
+	}
+	if got := h.NumSubscribers(1); got != 0 {
+		t.Errorf("NumSubscribers(1) = %v, want 0", got)
+	}
+
+	// Publishing to a list without subscribers is fine.
+	h.Publish(itemEvent(1, 11))
+}
+
+func TestHub_Overflow(t *testing.T) {
+	h := New(2)
+	sub := h.Subscribe(1)
+	defer sub.Close()
+
+	for i := 0; i < 3; i++ {
+		h.Publish(itemEvent(1, i))
+	}
+
+	var got []int
+	for ev := range sub.C {
+		got = append(got, ev.Item.ID)
+	}
+	if len(got) != 2 || !sub.Overflowed() {
+		t.Errorf("got %v, overflowed %v; want 2 events, overflowed",
+			got, sub.Overflowed())
+	}
+	if n := h.NumSubscribers(1); n != 0 {
+		t.Errorf("NumSubscribers(1) = %v, want 0", n)
+	}
+}
+
+func TestHub_Concurrent(t *testing.T) {
+	h := New(DefaultBuffer)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := h.Subscribe(1)
+			defer sub.Close()
+			h.Publish(itemEvent(1, 1))
+			<-sub.C
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,66 @@
+package images
+
+import (
+	"context"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/blobstore"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var (
+	logger = grpclog.Component("images")
+)
+
+// CollectGarbage deletes blobs that no item image refers to. Uploads store
+// their blobs before recording the image, so blobs newer than grace are left
+// alone to avoid racing with an upload in progress. It returns the number of
+// blobs deleted.
+func CollectGarbage(ctx context.Context, db *database.DB, store blobstore.Store, now time.Time, grace time.Duration) (int, error) {
+	// List the blobs first. Anything referenced after this point is
+	// either already in the referenced set or too new to be collected.
+	blobs, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	referenced, err := db.ListReferencedBlobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	num := 0
+	for _, blob := range blobs {
+		if referenced[blob.Key] || now.Sub(blob.Created) < grace {
+			continue
+		}
+
+		if err := store.Delete(ctx, blob.Key); err != nil {
+			return num, err
+		}
+		num++
+	}
+
+	return num, nil
+}
+
+// RunGarbageCollector calls CollectGarbage every interval, as measured by
+// clock, until ctx is cancelled.
+func RunGarbageCollector(ctx context.Context, db *database.DB, store blobstore.Store, clock util.Clock, interval, grace time.Duration) {
+	for {
+		num, err := CollectGarbage(ctx, db, store, clock.Now(), grace)
+		if err != nil {
+			logger.Errorf("blob garbage collection failed: %v", err)
+		} else if num > 0 {
+			logger.Infof("deleted %d orphaned blobs", num)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		}
+	}
+}
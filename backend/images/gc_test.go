@@ -0,0 +1,71 @@
+package images
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/blobstore"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a"})
+
+	store, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() = %v", err)
+	}
+
+	now := time.Now()
+	owner := users.UserByUsername("a")
+	list, err := db.CreateList(ctx, owner.ID,
+		&database.ListData{Name: "l"}, now)
+	if err != nil {
+		t.Fatalf("CreateList() = %v", err)
+	}
+	item, err := db.CreateListItem(ctx, list.ID, owner.ID,
+		&database.ListItemData{Name: "i"}, now)
+	if err != nil {
+		t.Fatalf("CreateListItem() = %v", err)
+	}
+
+	put := func(data string) string {
+		key, err := store.Put(ctx, []byte(data))
+		if err != nil {
+			t.Fatalf("Put(%q) = %v", data, err)
+		}
+		return key
+	}
+
+	blob, thumb, orphan := put("blob"), put("thumb"), put("orphan")
+	_, err = db.AddItemImage(ctx, list.ID, item.ID, owner.ID,
+		&database.ItemImage{Blob: blob, Thumbnail: thumb}, now)
+	if err != nil {
+		t.Fatalf("AddItemImage() = %v", err)
+	}
+
+	// Everything is within the grace period, so nothing goes.
+	if num, err := CollectGarbage(ctx, db, store, now, time.Hour); err != nil || num != 0 {
+		t.Errorf("CollectGarbage(now) = %v, %v, want 0, nil", num, err)
+	}
+
+	later := now.Add(2 * time.Hour)
+	if num, err := CollectGarbage(ctx, db, store, later, time.Hour); err != nil || num != 1 {
+		t.Errorf("CollectGarbage(later) = %v, %v, want 1, nil", num, err)
+	}
+
+	if _, err := store.Get(ctx, orphan); err != blobstore.ErrNotFound {
+		t.Errorf("Get(orphan) = _, %v, want ErrNotFound", err)
+	}
+	for _, key := range []string{blob, thumb} {
+		if _, err := store.Get(ctx, key); err != nil {
+			t.Errorf("Get(%v) = _, %v, want _, nil", key, err)
+		}
+	}
+}
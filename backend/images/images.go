@@ -0,0 +1,162 @@
+// Package images validates uploaded item images and makes thumbnails of them.
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif"
+)
+
+const (
+	MaxImageBytes     = 10 << 20
+	MaxImagePixels    = 40 << 20
+	ThumbnailMaxSide  = 256
+	thumbnailJPEGQual = 85
+)
+
+var contentTypes = map[string]string{
+	"gif":  "image/gif",
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+}
+
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Validate checks that data is a supported image of reasonable size, and
+// returns a description of it.
+func Validate(data []byte) (*Info, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if len(data) > MaxImageBytes {
+		return nil, fmt.Errorf("image too large (%d bytes, max %d)",
+			len(data), MaxImageBytes)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized image: %v", err)
+	}
+
+	contentType, found := contentTypes[format]
+	if !found {
+		return nil, fmt.Errorf("unsupported image format %v", format)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("bad image dimensions %dx%d",
+			cfg.Width, cfg.Height)
+	}
+	// Check before decoding so a tiny file claiming to be enormous
+	// can't make us allocate gigabytes.
+	if cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, fmt.Errorf("image too large (%dx%d)",
+			cfg.Width, cfg.Height)
+	}
+
+	return &Info{
+		ContentType: contentType,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// Thumbnail decodes the image in data (which should already have been
+// validated) and returns a copy scaled so neither side exceeds
+// ThumbnailMaxSide. Images with transparency become PNGs; everything else
+// becomes a JPEG.
+func Thumbnail(data []byte) ([]byte, *Info, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	b := src.Bounds()
+	w, h := thumbnailSize(b.Dx(), b.Dy())
+	dst := scale(src, w, h)
+
+	var buf bytes.Buffer
+	info := &Info{Width: w, Height: h}
+	if dst.Opaque() {
+		info.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst,
+			&jpeg.Options{Quality: thumbnailJPEGQual})
+	} else {
+		info.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+
+	return buf.Bytes(), info, nil
+}
+
+func thumbnailSize(w, h int) (int, int) {
+	if w <= ThumbnailMaxSide && h <= ThumbnailMaxSide {
+		return w, h
+	}
+
+	if w >= h {
+		return ThumbnailMaxSide, max(1, h*ThumbnailMaxSide/w)
+	}
+	return max(1, w*ThumbnailMaxSide/h), ThumbnailMaxSide
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// scale resizes src to w x h by averaging the source pixels covered by each
+// destination pixel (a box filter). That's plenty for thumbnails.
+func scale(src image.Image, w, h int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sh/h
+		y1 := sb.Min.Y + max((y+1)*sh/h, y*sh/h+1)
+
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sw/w
+			x1 := sb.Min.X + max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			// Averaged values are alpha-premultiplied, so
+			// convert back via color.RGBA64.
+			c := color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			}
+			dst.Set(x, y, c)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,102 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func makePNG(t *testing.T, w, h int, alpha uint8) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 10, B: 10, A: alpha})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidate(t *testing.T) {
+	data := makePNG(t, 40, 30, 255)
+	info, err := Validate(data)
+	if err != nil {
+		t.Fatalf("Validate(png) = _, %v, want _, nil", err)
+	}
+	if want := (Info{"image/png", 40, 30}); *info != want {
+		t.Errorf("Validate(png) = %+v, _, want %+v", *info, want)
+	}
+
+	for name, bad := range map[string][]byte{
+		"empty": nil,
+		"text":  []byte("this is not an image"),
+		"huge":  make([]byte, MaxImageBytes+1),
+	} {
+		if _, err := Validate(bad); err == nil {
+			t.Errorf("Validate(%v) = _, nil, want error", name)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	type testCase struct {
+		name            string
+		w, h            int
+		alpha           uint8
+		wantW, wantH    int
+		wantContentType string
+	}
+
+	testCases := []testCase{
+		{"small", 40, 30, 255, 40, 30, "image/jpeg"},
+		{"wide", 1024, 512, 255, 256, 128, "image/jpeg"},
+		{"tall", 300, 600, 255, 128, 256, "image/jpeg"},
+		{"sliver", 2000, 2, 255, 256, 1, "image/jpeg"},
+		{"transparent", 512, 512, 128, 256, 256, "image/png"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			thumb, info, err := Thumbnail(makePNG(t, tc.w, tc.h, tc.alpha))
+			if err != nil {
+				t.Fatalf("Thumbnail() = _, _, %v, want _, _, nil", err)
+			}
+
+			want := Info{tc.wantContentType, tc.wantW, tc.wantH}
+			if *info != want {
+				t.Errorf("Thumbnail() = _, %+v, _, want %+v",
+					*info, want)
+			}
+
+			var img image.Image
+			if tc.wantContentType == "image/jpeg" {
+				img, err = jpeg.Decode(bytes.NewReader(thumb))
+			} else {
+				img, err = png.Decode(bytes.NewReader(thumb))
+			}
+			if err != nil {
+				t.Fatalf("failed to decode thumbnail: %v", err)
+			}
+
+			b := img.Bounds()
+			if b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+				t.Errorf("thumbnail is %dx%d, want %dx%d",
+					b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+			}
+
+			c := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+			if c.R < 150 {
+				t.Errorf("thumbnail pixel red = %d, want ~200", c.R)
+			}
+		})
+	}
+}
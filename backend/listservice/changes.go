@@ -0,0 +1,161 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+const (
+	defaultMaxChanges = 1000
+	maxMaxChanges     = 1000
+)
+
+// snapshotChanges returns everything the viewer can see, as of the change
+// numbered seq or later.
+func (s *listServer) snapshotChanges(ctx context.Context, viewerID int, seq int64) (*lspb.GetChangesResponse, error) {
+	lists, err := s.db.ListLists(ctx, database.IncludeInactiveLists(true))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.GetChangesResponse{
+		NextCursor: strconv.FormatInt(seq, 10),
+	}
+	for _, list := range lists {
+		resp.Lists = append(resp.Lists, listFromDatabaseList(list))
+
+		items, err := s.visibleItems(ctx, list.ID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Items = append(resp.Items, items...)
+	}
+
+	return resp, nil
+}
+
+func (s *listServer) GetChanges(ctx context.Context, req *lspb.GetChangesRequest) (*lspb.GetChangesResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	limit := int(req.GetMaxChanges())
+	if limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"bad max changes")
+	} else if limit == 0 || limit > maxMaxChanges {
+		limit = defaultMaxChanges
+	}
+
+	if req.GetSinceCursor() == "" {
+		// Read the cursor first, so anything that changes while the
+		// snapshot is being put together is picked up by the next
+		// request.
+		seq, err := s.db.LatestChangeSeq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.snapshotChanges(ctx, session.User.ID, seq)
+	}
+
+	since, err := strconv.ParseInt(req.GetSinceCursor(), 10, 64)
+	if err != nil || since < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad cursor")
+	}
+
+	changes, err := s.db.ListChanges(ctx, since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.GetChangesResponse{
+		NextCursor: req.GetSinceCursor(),
+		More:       len(changes) == limit,
+	}
+	if len(changes) == 0 {
+		return resp, nil
+	}
+	resp.NextCursor = strconv.FormatInt(changes[len(changes)-1].Seq, 10)
+
+	// Group the changes by list, so each list is only read once.
+	listIDs := []int{}
+	changedLists := map[int]bool{}
+	changedItems := map[int][]int{}
+	for _, change := range changes {
+		if _, found := changedItems[change.ListID]; !found && !changedLists[change.ListID] {
+			listIDs = append(listIDs, change.ListID)
+		}
+		if change.ItemID == 0 {
+			changedLists[change.ListID] = true
+		} else {
+			changedItems[change.ListID] = append(
+				changedItems[change.ListID], change.ItemID)
+		}
+	}
+
+	for _, listID := range listIDs {
+		if changedLists[listID] {
+			lists, err := s.db.ListLists(ctx,
+				database.OnlyListWithID(listID))
+			if err != nil {
+				return nil, err
+			}
+			for _, list := range lists {
+				resp.Lists = append(resp.Lists,
+					listFromDatabaseList(list))
+			}
+		}
+
+		itemIDs := changedItems[listID]
+		if len(itemIDs) == 0 {
+			continue
+		}
+
+		items, err := s.db.ListListItems(ctx, listID,
+			database.AllItems())
+		if err != nil {
+			return nil, err
+		}
+		itemsByID := map[int]*database.ListItem{}
+		for _, item := range items {
+			itemsByID[item.ID] = item
+		}
+
+		for _, itemID := range itemIDs {
+			item := itemsByID[itemID]
+			if item == nil || !item.VisibleTo(session.User.ID) {
+				resp.DeletedItemIds = append(resp.DeletedItemIds,
+					strconv.Itoa(itemID))
+				continue
+			}
+			resp.Items = append(resp.Items,
+				itemFromDatabaseItem(item, session.User.ID))
+		}
+	}
+
+	// Moved items are deleted from their old lists, but clients know
+	// items by ID alone, so they mustn't be told to delete one that's
+	// turned up in another list.
+	if len(resp.DeletedItemIds) > 0 {
+		present := map[string]bool{}
+		for _, item := range resp.Items {
+			present[item.GetId()] = true
+		}
+		deleted := []string{}
+		for _, id := range resp.DeletedItemIds {
+			if !present[id] {
+				deleted = append(deleted, id)
+			}
+		}
+		resp.DeletedItemIds = deleted
+	}
+
+	return resp, nil
+}
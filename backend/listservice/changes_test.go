@@ -0,0 +1,189 @@
+package listservice
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestGetChanges(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list := state.Lists.GetList("l1").List
+	_, item1 := state.Lists.GetItem("l1", "l1i1")
+	_, item2 := state.Lists.GetItem("l1", "l1i2")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	giverCtx := makeRequestContext(ctx, state, "b")
+	userB := state.Users.UserByUsername("b")
+
+	itemIDs := func(items []*lspb.ListItem) []string {
+		out := []string{}
+		for _, item := range items {
+			out = append(out, item.GetId())
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	// An empty cursor gets everything.
+	snapshot, err := state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{})
+	if err != nil {
+		t.Fatalf("GetChanges(snapshot) = _, %v, want _, nil", err)
+	}
+	wantIDs := []string{strconv.Itoa(item1.ID), strconv.Itoa(item2.ID)}
+	if len(snapshot.GetLists()) != 1 ||
+		!cmp.Equal(wantIDs, itemIDs(snapshot.GetItems())) ||
+		snapshot.GetNextCursor() == "" {
+		t.Fatalf("GetChanges(snapshot) = %v, want l1, its items and a cursor",
+			snapshot)
+	}
+
+	cursor := snapshot.GetNextCursor()
+	resp, err := state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{SinceCursor: cursor})
+	if err != nil || len(resp.GetLists())+len(resp.GetItems())+len(resp.GetDeletedItemIds()) != 0 ||
+		resp.GetNextCursor() != cursor || resp.GetMore() {
+		t.Errorf("GetChanges(unchanged) = %v, %v, want no changes, same cursor",
+			resp, err)
+	}
+
+	// b claims item1, then the owner deletes both items. item1 stays
+	// visible to b because of the claim. item2 is gone.
+	_, err = state.DB.UpdateListItem(ctx, list.ID, item1.ID, item1.Version,
+		userB.ID, state.Clock.Now(),
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+	for _, item := range []*database.ListItem{item1, item2} {
+		if _, err := state.Server.DeleteListItem(ownerCtx, &lspb.DeleteListItemRequest{
+			ListId: strconv.Itoa(list.ID),
+			ItemId: strconv.Itoa(item.ID),
+		}); err != nil {
+			t.Fatalf("DeleteListItem(%v) = _, %v, want _, nil", item.ID, err)
+		}
+	}
+
+	resp, err = state.Server.GetChanges(ownerCtx,
+		&lspb.GetChangesRequest{SinceCursor: cursor})
+	if err != nil {
+		t.Fatalf("GetChanges(owner) = _, %v, want _, nil", err)
+	}
+	sort.Strings(resp.DeletedItemIds)
+	if len(resp.GetItems()) != 0 || !cmp.Equal(wantIDs, resp.GetDeletedItemIds()) {
+		t.Errorf("GetChanges(owner) = %v, want tombstones for both items",
+			resp)
+	}
+
+	resp, err = state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{SinceCursor: cursor})
+	if err != nil {
+		t.Fatalf("GetChanges(giver) = _, %v, want _, nil", err)
+	}
+	if got := itemIDs(resp.GetItems()); !cmp.Equal(wantIDs[:1], got) ||
+		!cmp.Equal(wantIDs[1:], resp.GetDeletedItemIds()) {
+		t.Errorf("GetChanges(giver) = %v, want item %v and tombstone %v",
+			resp, wantIDs[0], wantIDs[1])
+	}
+
+	// Paging.
+	resp, err = state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{SinceCursor: cursor, MaxChanges: 1})
+	if err != nil || !resp.GetMore() ||
+		len(resp.GetItems())+len(resp.GetDeletedItemIds()) != 1 {
+		t.Errorf("GetChanges(max 1) = %v, %v, want one change and more",
+			resp, err)
+	}
+	resp, err = state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{SinceCursor: resp.GetNextCursor()})
+	if err != nil || resp.GetMore() ||
+		len(resp.GetItems())+len(resp.GetDeletedItemIds()) != 1 {
+		t.Errorf("GetChanges(rest) = %v, %v, want the other change", resp,
+			err)
+	}
+
+	for _, bad := range []string{"bad", "-1"} {
+		_, err := state.Server.GetChanges(giverCtx,
+			&lspb.GetChangesRequest{SinceCursor: bad})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetChanges(%q) = _, %v, want InvalidArgument", bad,
+				err)
+		}
+	}
+}
+
+func TestGetChanges_Move(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	from, item := state.Lists.GetItem("l1", "l1i1")
+	giverCtx := makeRequestContext(ctx, state, "b")
+
+	to, err := state.DB.CreateList(ctx, from.OwnerID,
+		&database.ListData{Name: "l2", Active: true}, state.Clock.Now())
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	resp, err := state.Server.GetChanges(giverCtx, &lspb.GetChangesRequest{})
+	if err != nil {
+		t.Fatalf("GetChanges(snapshot) = _, %v, want _, nil", err)
+	}
+	cursor := resp.GetNextCursor()
+
+	_, _, err = state.DB.MoveListItems(ctx, from.ID, from.Version, to.ID,
+		to.Version, from.OwnerID, state.Clock.Now(), []int{item.ID})
+	if err != nil {
+		t.Fatalf("MoveListItems() = _, _, %v, want nil", err)
+	}
+
+	// The item is reported in its new list, and not as deleted.
+	resp, err = state.Server.GetChanges(giverCtx,
+		&lspb.GetChangesRequest{SinceCursor: cursor})
+	if err != nil {
+		t.Fatalf("GetChanges() = _, %v, want _, nil", err)
+	}
+	if len(resp.GetItems()) != 1 || resp.GetItems()[0].GetId() != strconv.Itoa(item.ID) ||
+		len(resp.GetDeletedItemIds()) != 0 {
+		t.Errorf("GetChanges() = %v, want moved item and no tombstones",
+			resp)
+	}
+
+	// Clients that page through the changes see it leave the old list
+	// before it arrives in the new one.
+	deleted := false
+	for cursor != "" {
+		resp, err := state.Server.GetChanges(giverCtx,
+			&lspb.GetChangesRequest{SinceCursor: cursor, MaxChanges: 1})
+		if err != nil {
+			t.Fatalf("GetChanges(%v) = _, %v, want _, nil", cursor, err)
+		}
+		if len(resp.GetDeletedItemIds()) == 1 {
+			deleted = true
+		}
+		if len(resp.GetItems()) == 1 && !deleted {
+			t.Errorf("GetChanges(%v) = %v before the tombstone", cursor,
+				resp)
+		}
+		if !resp.GetMore() {
+			break
+		}
+		cursor = resp.GetNextCursor()
+	}
+	if !deleted {
+		t.Errorf("paged GetChanges() never reported the move out of %v",
+			from.ID)
+	}
+}
@@ -0,0 +1,242 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+const (
+	defaultCommentPageSize = 50
+	maxCommentPageSize     = 100
+	maxCommentLength       = 4096
+)
+
+// isBeneficiary guesses whether user is the person the list is for. The
+// beneficiary is free text, so the best we can do is compare it to the
+// user's names.
+func isBeneficiary(list *database.List, user *database.User) bool {
+	beneficiary := strings.TrimSpace(list.Beneficiary)
+	return strings.EqualFold(beneficiary, user.Fullname) ||
+		strings.EqualFold(beneficiary, user.Username)
+}
+
+// checkCommenter returns an error unless user is allowed to read and write
+// comments on list. Comments are only for givers.
+func checkCommenter(list *database.List, user *database.User) error {
+	if list.OwnerID == user.ID || isBeneficiary(list, user) {
+		return status.Errorf(codes.PermissionDenied,
+			"comments are only for givers")
+	}
+	return nil
+}
+
+func validCommentBody(body string) bool {
+	return strings.TrimSpace(body) != "" && len(body) <= maxCommentLength
+}
+
+func commentFromDatabaseComment(comment *database.Comment) *lspb.Comment {
+	itemID := ""
+	if comment.ItemID != 0 {
+		itemID = strconv.Itoa(comment.ItemID)
+	}
+
+	return &lspb.Comment{
+		Id:      strconv.Itoa(comment.ID),
+		ListId:  strconv.Itoa(comment.ListID),
+		ItemId:  itemID,
+		Author:  int32(comment.AuthorID),
+		Body:    comment.Body,
+		Created: comment.Created.Unix(),
+		Updated: comment.Updated.Unix(),
+	}
+}
+
+// commentThread parses and checks the list and (optional) item IDs that name
+// a comment thread.
+func (s *listServer) commentThread(ctx context.Context, user *database.User, listIDStr, itemIDStr string) (listID, itemID int, err error) {
+	listID, err = strconv.Atoi(listIDStr)
+	if listIDStr == "" || err != nil {
+		return 0, 0, status.Errorf(codes.InvalidArgument,
+			"invalid list id")
+	}
+
+	if itemIDStr != "" {
+		itemID, err = strconv.Atoi(itemIDStr)
+		if err != nil {
+			return 0, 0, status.Errorf(codes.InvalidArgument,
+				"invalid item id")
+		}
+	}
+
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := checkCommenter(list, user); err != nil {
+		return 0, 0, err
+	}
+
+	if itemID != 0 {
+		if _, err := dbutil.GetListItem(ctx, s.db, listID, itemID); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return listID, itemID, nil
+}
+
+// getOwnComment returns the comment with the given ID if user wrote it.
+func (s *listServer) getOwnComment(ctx context.Context, user *database.User, commentIDStr string) (*database.Comment, error) {
+	commentID, err := strconv.Atoi(commentIDStr)
+	if commentIDStr == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid comment id")
+	}
+
+	comment, err := s.db.GetComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.AuthorID != user.ID {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"user did not write comment")
+	}
+
+	return comment, nil
+}
+
+func (s *listServer) PostComment(ctx context.Context, req *lspb.PostCommentRequest) (*lspb.PostCommentResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if !validCommentBody(req.GetBody()) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid comment body")
+	}
+
+	listID, itemID, err := s.commentThread(ctx, session.User,
+		req.GetListId(), req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.db.CreateComment(ctx, listID, itemID,
+		session.User.ID, req.GetBody(), s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.PostCommentResponse{
+		Comment: commentFromDatabaseComment(comment),
+	}, nil
+}
+
+func (s *listServer) EditComment(ctx context.Context, req *lspb.EditCommentRequest) (*lspb.EditCommentResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if !validCommentBody(req.GetBody()) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid comment body")
+	}
+
+	comment, err := s.getOwnComment(ctx, session.User, req.GetCommentId())
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err = s.db.UpdateComment(ctx, comment.ID, session.User.ID,
+		req.GetBody(), s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.EditCommentResponse{
+		Comment: commentFromDatabaseComment(comment),
+	}, nil
+}
+
+func (s *listServer) DeleteComment(ctx context.Context, req *lspb.DeleteCommentRequest) (*lspb.DeleteCommentResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	comment, err := s.getOwnComment(ctx, session.User, req.GetCommentId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.DeleteComment(ctx, comment.ID, session.User.ID); err != nil {
+		return nil, err
+	}
+
+	return &lspb.DeleteCommentResponse{}, nil
+}
+
+func (s *listServer) ListComments(ctx context.Context, req *lspb.ListCommentsRequest) (*lspb.ListCommentsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid page size")
+	} else if pageSize == 0 {
+		pageSize = defaultCommentPageSize
+	} else if pageSize > maxCommentPageSize {
+		pageSize = maxCommentPageSize
+	}
+
+	// Page tokens are the ID of the last comment returned.
+	afterID := 0
+	if req.GetPageToken() != "" {
+		afterID, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || afterID <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"invalid page token")
+		}
+	}
+
+	listID, itemID, err := s.commentThread(ctx, session.User,
+		req.GetListId(), req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask for one extra so we know whether there's another page.
+	comments, err := s.db.ListComments(ctx, listID, itemID, afterID,
+		pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.ListCommentsResponse{}
+	if len(comments) > pageSize {
+		comments = comments[:pageSize]
+		resp.NextPageToken = strconv.Itoa(comments[pageSize-1].ID)
+	}
+
+	for _, comment := range comments {
+		resp.Comments = append(resp.Comments,
+			commentFromDatabaseComment(comment))
+	}
+
+	return resp, nil
+}
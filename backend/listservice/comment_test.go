@@ -0,0 +1,154 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestComments(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+	b := state.Users.UserByUsername("b")
+
+	listID := strconv.Itoa(list.ID)
+	itemID := strconv.Itoa(item.ID)
+
+	post := func(reqCtx context.Context, itemID, body string) (*lspb.Comment, error) {
+		req := &lspb.PostCommentRequest{
+			ListId: listID,
+			ItemId: itemID,
+			Body:   body,
+		}
+		resp, err := state.Server.PostComment(reqCtx, req)
+		return resp.GetComment(), err
+	}
+
+	// The owner can't take part.
+	if _, err := post(ownerCtx, "", "hi"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("PostComment(owner) = _, %v, want _, PermissionDenied",
+			err)
+	}
+	if _, err := post(bCtx, "", " "); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PostComment(empty) = _, %v, want _, InvalidArgument",
+			err)
+	}
+	if _, err := post(bCtx, "1000", "hi"); status.Code(err) != codes.NotFound {
+		t.Errorf("PostComment(bad item) = _, %v, want _, NotFound",
+			err)
+	}
+
+	created := state.Clock.Time
+	itemComment, err := post(bCtx, itemID, "I'll get the blue one")
+	if err != nil {
+		t.Fatalf("PostComment = _, %v, want _, nil", err)
+	}
+
+	want := &lspb.Comment{
+		Id:      itemComment.GetId(),
+		ListId:  listID,
+		ItemId:  itemID,
+		Author:  int32(b.ID),
+		Body:    "I'll get the blue one",
+		Created: created.Unix(),
+		Updated: created.Unix(),
+	}
+	if diff := cmp.Diff(want, itemComment, protocmp.Transform()); diff != "" {
+		t.Errorf("PostComment mismatch; -want,+got:\n%v", diff)
+	}
+
+	listComments := []*lspb.Comment{}
+	for _, body := range []string{"one", "two", "three"} {
+		comment, err := post(cCtx, "", body)
+		if err != nil {
+			t.Fatalf("PostComment = _, %v, want _, nil", err)
+		}
+		listComments = append(listComments, comment)
+	}
+
+	// Page through the list thread.
+	got := []*lspb.Comment{}
+	listReq := &lspb.ListCommentsRequest{ListId: listID, PageSize: 2}
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatalf("too many pages")
+		}
+
+		resp, err := state.Server.ListComments(bCtx, listReq)
+		if err != nil {
+			t.Fatalf("ListComments(_, %+v) = _, %v, want _, nil",
+				listReq, err)
+		}
+		got = append(got, resp.GetComments()...)
+
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		listReq.PageToken = resp.GetNextPageToken()
+	}
+	if diff := cmp.Diff(listComments, got, protocmp.Transform()); diff != "" {
+		t.Errorf("ListComments mismatch; -want,+got:\n%v", diff)
+	}
+
+	listReq = &lspb.ListCommentsRequest{ListId: listID}
+	if _, err := state.Server.ListComments(ownerCtx, listReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListComments(owner) = _, %v, want _, PermissionDenied",
+			err)
+	}
+
+	// Only the author can edit or delete.
+	editReq := &lspb.EditCommentRequest{
+		CommentId: itemComment.GetId(),
+		Body:      "I'll get the red one",
+	}
+	if _, err := state.Server.EditComment(cCtx, editReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("EditComment(c) = _, %v, want _, PermissionDenied", err)
+	}
+	editResp, err := state.Server.EditComment(bCtx, editReq)
+	if err != nil || editResp.GetComment().GetBody() != editReq.GetBody() {
+		t.Errorf("EditComment(b) = %v, %v, want body %q, nil",
+			editResp, err, editReq.GetBody())
+	}
+
+	deleteReq := &lspb.DeleteCommentRequest{CommentId: itemComment.GetId()}
+	if _, err := state.Server.DeleteComment(cCtx, deleteReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("DeleteComment(c) = _, %v, want _, PermissionDenied", err)
+	}
+	if _, err := state.Server.DeleteComment(bCtx, deleteReq); err != nil {
+		t.Errorf("DeleteComment(b) = _, %v, want _, nil", err)
+	}
+
+	itemReq := &lspb.ListCommentsRequest{ListId: listID, ItemId: itemID}
+	resp, err := state.Server.ListComments(bCtx, itemReq)
+	if err != nil || len(resp.GetComments()) != 0 {
+		t.Errorf("ListComments(_, %+v) = %v, %v, want [], nil",
+			itemReq, resp, err)
+	}
+
+	// Once c is known to be the beneficiary, they're shut out too.
+	_, err = state.DB.UpdateList(ctx, list.ID, list.Version, list.OwnerID,
+		state.Clock.Now(), func(listData *database.ListData) error {
+			listData.Beneficiary = "user c"
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateList = _, %v, want _, nil", err)
+	}
+	if _, err := state.Server.ListComments(cCtx, listReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListComments(beneficiary) = _, %v, want _, PermissionDenied",
+			err)
+	}
+}
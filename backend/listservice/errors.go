@@ -0,0 +1,142 @@
+package listservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/rpcerror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func errNotOwner() error {
+	return rpcerror.Errorf(codes.PermissionDenied, rpcerror.ReasonNotOwner,
+		"user does not own list")
+}
+
+// entityDetails returns the precondition subject for a list or item, and
+// the current version of it as viewerID would see it. The entity is nil if
+// the viewer can't see the item.
+func entityDetails(list *database.List, item *database.ListItem, viewerID int) (string, proto.Message) {
+	if item != nil {
+		subject := fmt.Sprintf("lists/%d/items/%d", item.ListID, item.ID)
+		if !item.VisibleTo(viewerID) {
+			return subject, nil
+		}
+		return subject, itemFromDatabaseItem(item, viewerID)
+	}
+	return fmt.Sprintf("lists/%d", list.ID), listFromDatabaseList(list)
+}
+
+// detailedError adds error details to err. Version mismatches and merge
+// conflicts get a PreconditionFailure and the current list or item, so
+// clients can resolve them without fetching it again. Other permission and
+// validation failures get an ErrorInfo with a generic reason, unless they
+// already have details.
+func detailedError(err error, viewerID int) error {
+	// Batch failures keep their index, and get the details of the
+	// operation that failed.
+	var batchErr *database.BatchError
+	if errors.As(err, &batchErr) {
+		return &database.BatchError{
+			Index: batchErr.Index,
+			Err:   detailedError(batchErr.Err, viewerID),
+		}
+	}
+
+	if err == nil || rpcerror.HasDetails(err) {
+		return err
+	}
+
+	code := status.Code(err)
+	msg := status.Convert(err).Message()
+
+	var versionErr *database.VersionError
+	var conflictErr *database.ConflictError
+	switch {
+	case errors.As(err, &versionErr):
+		subject, current := entityDetails(versionErr.List,
+			versionErr.Item, viewerID)
+		details := []proto.Message{&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        rpcerror.ReasonVersionMismatch,
+				Subject:     subject,
+				Description: versionErr.Error(),
+			}},
+		}}
+		if current == nil {
+			// The viewer can't see the item, so they don't get
+			// to know its version either.
+			return status.Errorf(codes.NotFound, "no item with ID %v",
+				versionErr.Item.ID)
+		}
+		details = append(details, current)
+		return rpcerror.New(code, rpcerror.ReasonVersionMismatch,
+			map[string]string{
+				"requested_version": strconv.Itoa(versionErr.Requested),
+				"current_version":   strconv.Itoa(versionErr.Current()),
+			}, msg, details...).Err()
+
+	case errors.As(err, &conflictErr) && (conflictErr.List != nil || conflictErr.Item != nil):
+		subject, current := entityDetails(conflictErr.List,
+			conflictErr.Item, viewerID)
+		failure := &errdetails.PreconditionFailure{}
+		for _, field := range conflictErr.Fields {
+			failure.Violations = append(failure.Violations,
+				&errdetails.PreconditionFailure_Violation{
+					Type:        rpcerror.ReasonMergeConflict,
+					Subject:     subject,
+					Description: field,
+				})
+		}
+		details := []proto.Message{failure}
+		if current != nil {
+			details = append(details, current)
+		}
+		return rpcerror.New(code, rpcerror.ReasonMergeConflict,
+			map[string]string{
+				"fields": strings.Join(conflictErr.Fields, ","),
+			}, msg, details...).Err()
+
+	case code == codes.PermissionDenied:
+		return rpcerror.New(code, rpcerror.ReasonPermissionDenied, nil,
+			msg).Err()
+
+	case code == codes.InvalidArgument:
+		return rpcerror.New(code, rpcerror.ReasonInvalidArgument, nil,
+			msg).Err()
+	}
+
+	return err
+}
+
+func viewerID(ctx context.Context) int {
+	if session, _ := getSession(ctx); session != nil {
+		return session.User.ID
+	}
+	return 0
+}
+
+// ErrorDetailsInterceptor adds error details to errors returned by unary
+// handlers. It must run after authentication, so the current version of
+// lists and items can be shown as the caller would see them.
+func ErrorDetailsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	res, err := handler(ctx, req)
+	if err != nil {
+		return nil, detailedError(err, viewerID(ctx))
+	}
+	return res, nil
+}
+
+// ErrorDetailsStreamInterceptor is ErrorDetailsInterceptor for streaming
+// handlers.
+func ErrorDetailsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return detailedError(handler(srv, ss), viewerID(ss.Context()))
+}
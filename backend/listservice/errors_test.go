@@ -0,0 +1,265 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/rpcerror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// callWithDetails calls a handler through ErrorDetailsInterceptor.
+func callWithDetails(ctx context.Context, req interface{}, handler func(ctx context.Context, req interface{}) (interface{}, error)) error {
+	_, err := ErrorDetailsInterceptor(ctx, req, &grpc.UnaryServerInfo{},
+		handler)
+	return err
+}
+
+func TestErrorDetails_VersionMismatch(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+
+	req := &lspb.UpdateListItemRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ItemId:      strconv.Itoa(item.ID),
+		ItemVersion: int32(item.Version + 1),
+		Data:        &lspb.ListItemData{Name: "new"},
+	}
+	err := callWithDetails(ownerCtx, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return state.Server.UpdateListItem(ctx,
+				req.(*lspb.UpdateListItemRequest))
+		})
+
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition ||
+		rpcerror.Reason(err) != rpcerror.ReasonVersionMismatch {
+		t.Fatalf("UpdateListItem(stale) = %v, want version mismatch", err)
+	}
+
+	var failure *errdetails.PreconditionFailure
+	var current *lspb.ListItem
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.PreconditionFailure:
+			failure = d
+		case *lspb.ListItem:
+			current = d
+		case *errdetails.ErrorInfo:
+			if got := d.GetMetadata()["current_version"]; got != strconv.Itoa(item.Version) {
+				t.Errorf("ErrorInfo current_version = %v, want %v",
+					got, item.Version)
+			}
+		}
+	}
+
+	wantSubject := "lists/" + req.ListId + "/items/" + req.ItemId
+	if failure == nil || len(failure.GetViolations()) != 1 ||
+		failure.GetViolations()[0].GetSubject() != wantSubject {
+		t.Errorf("PreconditionFailure = %v, want subject %v", failure,
+			wantSubject)
+	}
+	if current == nil || current.GetVersion() != int32(item.Version) ||
+		current.GetData().GetName() != item.Name {
+		t.Errorf("current item = %v, want version %v", current,
+			item.Version)
+	}
+}
+
+func TestErrorDetails_ListVersionMismatch(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list := state.Lists.GetList("l1").List
+	ownerCtx := makeRequestContext(ctx, state, "a")
+
+	err := callWithDetails(ownerCtx, &lspb.UpdateListRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ListVersion: int32(list.Version + 1),
+		Data:        &lspb.ListData{Name: "new"},
+	}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return state.Server.UpdateList(ctx,
+			req.(*lspb.UpdateListRequest))
+	})
+
+	var current *lspb.List
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*lspb.List); ok {
+			current = d
+		}
+	}
+	if rpcerror.Reason(err) != rpcerror.ReasonVersionMismatch ||
+		current == nil || current.GetVersion() != int32(list.Version) {
+		t.Errorf("UpdateList(stale) = %v, want mismatch with current list",
+			err)
+	}
+}
+
+func TestErrorDetails_Reasons(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	giverCtx := makeRequestContext(ctx, state, "b")
+
+	updateItem := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return state.Server.UpdateListItem(ctx,
+			req.(*lspb.UpdateListItemRequest))
+	}
+
+	type testCase struct {
+		req        *lspb.UpdateListItemRequest
+		wantCode   codes.Code
+		wantReason string
+	}
+	for _, tc := range []testCase{
+		{
+			req: &lspb.UpdateListItemRequest{
+				ListId:      strconv.Itoa(list.ID),
+				ItemId:      strconv.Itoa(item.ID),
+				ItemVersion: int32(item.Version),
+				Data:        &lspb.ListItemData{Name: "new"},
+			},
+			wantCode:   codes.PermissionDenied,
+			wantReason: rpcerror.ReasonNotOwner,
+		},
+		{
+			req: &lspb.UpdateListItemRequest{
+				ListId: strconv.Itoa(list.ID),
+				ItemId: "bad",
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: rpcerror.ReasonInvalidArgument,
+		},
+	} {
+		err := callWithDetails(giverCtx, tc.req, updateItem)
+		if status.Code(err) != tc.wantCode ||
+			rpcerror.Reason(err) != tc.wantReason {
+			t.Errorf("UpdateListItem(%v) = %v, want %v with reason %v",
+				tc.req, err, tc.wantCode, tc.wantReason)
+		}
+	}
+}
+
+func TestErrorDetails_RemovedItem(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	b := state.Users.UserByUsername("b")
+	c := state.Users.UserByUsername("c")
+
+	// The item is removed by its owner but kept for b, who claimed it.
+	item, err := state.DB.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		b.ID, state.Clock.Now(),
+		func(data *database.ListItemData, s *database.ListItemState) error {
+			s.SetClaim(b.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+	if err := state.DB.DeleteListItem(ctx, list.ID, item.ID, list.OwnerID, state.Clock.Now()); err != nil {
+		t.Fatalf("DeleteListItem() = %v, want nil", err)
+	}
+
+	// Nobody but the claimer learns anything about it, even with a stale
+	// version.
+	for _, username := range []string{"a", "c"} {
+		req := &lspb.UpdateListItemRequest{
+			ListId:      strconv.Itoa(list.ID),
+			ItemId:      strconv.Itoa(item.ID),
+			ItemVersion: int32(item.Version),
+			State:       &lspb.ListItemState{Claimed: true},
+		}
+		err := callWithDetails(makeRequestContext(ctx, state, username), req,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return state.Server.UpdateListItem(ctx,
+					req.(*lspb.UpdateListItemRequest))
+			})
+		if st := status.Convert(err); st.Code() != codes.NotFound || len(st.Details()) != 0 {
+			t.Errorf("UpdateListItem(%v, stale) = %v, want NotFound without details",
+				username, err)
+		}
+	}
+
+	got, err := dbutil.GetListItem(ctx, state.DB, list.ID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem() = _, %v, want _, nil", err)
+	}
+	versionErr := &database.VersionError{Requested: item.Version, Item: got}
+	if st := status.Convert(detailedError(versionErr, c.ID)); st.Code() != codes.NotFound || len(st.Details()) != 0 {
+		t.Errorf("detailedError(removed, c) = %v, want NotFound without details",
+			st.Err())
+	}
+	if err := detailedError(versionErr, b.ID); rpcerror.Reason(err) != rpcerror.ReasonVersionMismatch {
+		t.Errorf("detailedError(removed, b) = %v, want version mismatch",
+			err)
+	}
+}
+
+func TestErrorDetails_Batch(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+
+	req := &lspb.BatchUpdateListItemsRequest{
+		ListId: strconv.Itoa(list.ID),
+		Ops: []*lspb.ItemOperation{
+			{Op: &lspb.ItemOperation_Create_{
+				Create: &lspb.ItemOperation_Create{
+					Data: &lspb.ListItemData{Name: "new"},
+				},
+			}},
+			{Op: &lspb.ItemOperation_Delete_{
+				Delete: &lspb.ItemOperation_Delete{
+					ItemId:      strconv.Itoa(item.ID),
+					ItemVersion: int32(item.Version + 1),
+				},
+			}},
+		},
+	}
+	err := callWithDetails(ownerCtx, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return state.Server.BatchUpdateListItems(ctx,
+				req.(*lspb.BatchUpdateListItemsRequest))
+		})
+
+	if status.Code(err) != codes.FailedPrecondition ||
+		rpcerror.Reason(err) != rpcerror.ReasonVersionMismatch {
+		t.Fatalf("BatchUpdateListItems(stale) = %v, want version mismatch",
+			err)
+	}
+
+	var badReq *errdetails.BadRequest
+	var failure *errdetails.PreconditionFailure
+	for _, detail := range status.Convert(err).Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			badReq = d
+		case *errdetails.PreconditionFailure:
+			failure = d
+		}
+	}
+	if badReq == nil || len(badReq.GetFieldViolations()) != 1 ||
+		badReq.GetFieldViolations()[0].GetField() != "ops[1]" {
+		t.Errorf("BadRequest = %v, want violation on ops[1]", badReq)
+	}
+	if failure == nil {
+		t.Errorf("BatchUpdateListItems(stale) = %v, want PreconditionFailure",
+			err)
+	}
+}
@@ -0,0 +1,174 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/sessions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func groupGiftStatus(item *database.ListItem) *lspb.GroupGiftStatus {
+	gg := &lspb.GroupGiftStatus{
+		PledgedTotal: item.PledgedTotal(),
+		Organizer:    int32(item.Organizer),
+	}
+
+	for _, pledge := range item.Pledges {
+		gg.Pledges = append(gg.Pledges, &lspb.Pledge{
+			UserId: int32(pledge.UserID),
+			Amount: pledge.Amount,
+			When:   pledge.When.Unix(),
+		})
+	}
+
+	return gg
+}
+
+// updateGroupGift performs the checks common to all group gift requests and
+// then applies update to the item. List owners can't take part in their own
+// group gifts.
+func (s *listServer) updateGroupGift(ctx context.Context, session *sessions.Session, listIDStr, itemIDStr string, itemVersion int32, update func(userID int, data *database.ListItemData, state *database.ListItemState) error) (*database.ListItem, error) {
+	listID, err := strconv.Atoi(listIDStr)
+	if listIDStr == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid list id")
+	}
+
+	itemID, err := strconv.Atoi(itemIDStr)
+	if itemIDStr == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid item id")
+	}
+
+	if itemVersion <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"missing item version")
+	}
+
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !list.Active {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"list is not active")
+	}
+
+	if list.OwnerID == session.User.ID {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"owner can't contribute to own list")
+	}
+
+	return s.db.UpdateListItem(ctx, list.ID, itemID, int(itemVersion),
+		session.User.ID, s.clock.Now(),
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			if !state.Deleted.IsZero() {
+				return status.Errorf(codes.NotFound,
+					"no item with ID %v", itemID)
+			}
+
+			if !data.GroupGift {
+				return status.Errorf(codes.FailedPrecondition,
+					"item is not a group gift")
+			}
+
+			return update(session.User.ID, data, state)
+		})
+}
+
+func (s *listServer) PledgeToItem(ctx context.Context, req *lspb.PledgeToItemRequest) (*lspb.PledgeToItemResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if req.GetAmount() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid amount")
+	}
+
+	item, err := s.updateGroupGift(ctx, session, req.GetListId(), req.GetItemId(),
+		req.GetItemVersion(),
+		func(userID int, data *database.ListItemData, state *database.ListItemState) error {
+			if req.GetAmount() == 0 && state.Organizer == userID {
+				return status.Errorf(codes.FailedPrecondition,
+					"organizer can't withdraw pledge")
+			}
+
+			state.SetPledge(userID, req.GetAmount())
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.PledgeToItemResponse{
+		Item: itemFromDatabaseItem(item, session.User.ID),
+	}, nil
+}
+
+// SetGroupGiftOrganizer volunteers the caller to make the purchase for a
+// group gift. The organizer holds the item's claim so it shows as claimed to
+// everybody else, so an item someone else has already claimed can't be
+// organized.
+func (s *listServer) SetGroupGiftOrganizer(ctx context.Context, req *lspb.SetGroupGiftOrganizerRequest) (*lspb.SetGroupGiftOrganizerResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	item, err := s.updateGroupGift(ctx, session, req.GetListId(), req.GetItemId(),
+		req.GetItemVersion(),
+		func(userID int, data *database.ListItemData, state *database.ListItemState) error {
+			if !req.GetOrganize() {
+				if state.Organizer != userID {
+					return status.Errorf(
+						codes.FailedPrecondition,
+						"user is not the organizer")
+				}
+
+				state.Organizer = 0
+				state.SetClaim(userID, 0)
+				return nil
+			}
+
+			if state.Organizer != 0 {
+				return status.Errorf(codes.FailedPrecondition,
+					"item already has an organizer")
+			}
+			if state.UserPledge(userID) == nil {
+				return status.Errorf(codes.FailedPrecondition,
+					"organizer must pledge first")
+			}
+			for _, claim := range state.Claims {
+				if claim.UserID != userID {
+					return status.Errorf(
+						codes.FailedPrecondition,
+						"item is claimed by another user")
+				}
+			}
+
+			quantity := data.Quantity
+			if quantity <= 0 {
+				quantity = 1
+			}
+
+			state.Organizer = userID
+			state.SetClaim(userID, quantity)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.SetGroupGiftOrganizerResponse{
+		Item: itemFromDatabaseItem(item, session.User.ID),
+	}, nil
+}
@@ -0,0 +1,243 @@
+package listservice
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestGroupGift(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+	b := state.Users.UserByUsername("b")
+	c := state.Users.UserByUsername("c")
+
+	listID := strconv.Itoa(list.ID)
+	itemID := strconv.Itoa(item.ID)
+
+	pledgeReq := &lspb.PledgeToItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: int32(item.Version),
+		Amount:      500,
+	}
+
+	// Not a group gift yet.
+	if _, err := state.Server.PledgeToItem(bCtx, pledgeReq); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("PledgeToItem(_, %+v) = _, %v, want _, FailedPrecondition",
+			pledgeReq, err)
+	}
+
+	updateReq := &lspb.UpdateListItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: int32(item.Version),
+		Data: &lspb.ListItemData{
+			Name:      item.Name,
+			Price:     1000,
+			Currency:  "USD",
+			GroupGift: true,
+		},
+	}
+	updateResp, err := state.Server.UpdateListItem(ownerCtx, updateReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			updateReq, err)
+	}
+	version := updateResp.GetItem().GetVersion()
+
+	// The owner can't pledge toward their own list.
+	pledgeReq.ItemVersion = version
+	if _, err := state.Server.PledgeToItem(ownerCtx, pledgeReq); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("PledgeToItem(owner, %+v) = _, %v, want _, PermissionDenied",
+			pledgeReq, err)
+	}
+
+	pledgeResp, err := state.Server.PledgeToItem(bCtx, pledgeReq)
+	if err != nil {
+		t.Fatalf("PledgeToItem(b, %+v) = _, %v, want _, nil",
+			pledgeReq, err)
+	}
+
+	pledgeReq.ItemVersion = pledgeResp.GetItem().GetVersion()
+	pledgeReq.Amount = 300
+	pledgeResp, err = state.Server.PledgeToItem(cCtx, pledgeReq)
+	if err != nil {
+		t.Fatalf("PledgeToItem(c, %+v) = _, %v, want _, nil",
+			pledgeReq, err)
+	}
+
+	organizeReq := &lspb.SetGroupGiftOrganizerRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: pledgeResp.GetItem().GetVersion(),
+		Organize:    true,
+	}
+	organizeResp, err := state.Server.SetGroupGiftOrganizer(bCtx, organizeReq)
+	if err != nil {
+		t.Fatalf("SetGroupGiftOrganizer(b, %+v) = _, %v, want _, nil",
+			organizeReq, err)
+	}
+
+	gotItem := organizeResp.GetItem()
+	pledges := gotItem.GetMetadata().GetGroupGift().GetPledges()
+	if len(pledges) != 2 {
+		t.Fatalf("pledges = %v, want 2 pledges", pledges)
+	}
+
+	wantStatus := &lspb.GroupGiftStatus{
+		Pledges: []*lspb.Pledge{
+			{UserId: int32(b.ID), Amount: 500, When: pledges[0].GetWhen()},
+			{UserId: int32(c.ID), Amount: 300, When: pledges[1].GetWhen()},
+		},
+		PledgedTotal: 800,
+		Organizer:    int32(b.ID),
+	}
+	if diff := cmp.Diff(wantStatus, gotItem.GetMetadata().GetGroupGift(), protocmp.Transform()); diff != "" {
+		t.Errorf("group gift status diff:\n%v", diff)
+	}
+
+	if !gotItem.GetState().GetClaimed() || gotItem.GetMetadata().GetClaimedBy() != int32(b.ID) {
+		t.Errorf("item = %v, want claimed by organizer %v", gotItem, b.ID)
+	}
+
+	// There can only be one organizer, and group gifts can't be claimed
+	// directly.
+	organizeReq.ItemVersion = gotItem.GetVersion()
+	if _, err := state.Server.SetGroupGiftOrganizer(cCtx, organizeReq); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SetGroupGiftOrganizer(c, %+v) = _, %v, want _, FailedPrecondition",
+			organizeReq, err)
+	}
+
+	claimReq := &lspb.UpdateListItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: gotItem.GetVersion(),
+		State:       &lspb.ListItemState{Claimed: false},
+	}
+	if _, err := state.Server.UpdateListItem(bCtx, claimReq); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("UpdateListItem(b, %+v) = _, %v, want _, FailedPrecondition",
+			claimReq, err)
+	}
+
+	// The organizer can step down, which releases the claim.
+	organizeReq.Organize = false
+	organizeResp, err = state.Server.SetGroupGiftOrganizer(bCtx, organizeReq)
+	if err != nil {
+		t.Fatalf("SetGroupGiftOrganizer(b, %+v) = _, %v, want _, nil",
+			organizeReq, err)
+	}
+	if gotItem := organizeResp.GetItem(); gotItem.GetState().GetClaimed() || gotItem.GetMetadata().GetGroupGift().GetOrganizer() != 0 {
+		t.Errorf("after step down, item = %v, want unclaimed, no organizer",
+			gotItem)
+	}
+}
+
+func TestGroupGift_ClaimedAndRemoved(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i2")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+	c := state.Users.UserByUsername("c")
+
+	listID := strconv.Itoa(list.ID)
+	itemID := strconv.Itoa(item.ID)
+
+	// c claims the item before the owner turns it into a group gift.
+	claimReq := &lspb.UpdateListItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: int32(item.Version),
+		State:       &lspb.ListItemState{Claimed: true},
+	}
+	claimResp, err := state.Server.UpdateListItem(cCtx, claimReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(c, %+v) = _, %v, want _, nil",
+			claimReq, err)
+	}
+
+	updateReq := &lspb.UpdateListItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: claimResp.GetItem().GetVersion(),
+		Data: &lspb.ListItemData{
+			Name:      item.Name,
+			GroupGift: true,
+		},
+	}
+	updateResp, err := state.Server.UpdateListItem(ownerCtx, updateReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			updateReq, err)
+	}
+
+	pledgeReq := &lspb.PledgeToItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: updateResp.GetItem().GetVersion(),
+		Amount:      500,
+	}
+	pledgeResp, err := state.Server.PledgeToItem(bCtx, pledgeReq)
+	if err != nil {
+		t.Fatalf("PledgeToItem(b, %+v) = _, %v, want _, nil",
+			pledgeReq, err)
+	}
+
+	// b can't take over the item while c holds a claim on it.
+	organizeReq := &lspb.SetGroupGiftOrganizerRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: pledgeResp.GetItem().GetVersion(),
+		Organize:    true,
+	}
+	if _, err := state.Server.SetGroupGiftOrganizer(bCtx, organizeReq); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SetGroupGiftOrganizer(b, %+v) = _, %v, want _, FailedPrecondition",
+			organizeReq, err)
+	}
+
+	// Removing the claimed item only hides it, but it can no longer be
+	// pledged to or organized.
+	deleteReq := &lspb.DeleteListItemRequest{ListId: listID, ItemId: itemID}
+	if _, err := state.Server.DeleteListItem(ownerCtx, deleteReq); err != nil {
+		t.Fatalf("DeleteListItem(_, %+v) = _, %v, want _, nil",
+			deleteReq, err)
+	}
+
+	dbItem, err := dbutil.GetListItem(ctx, state.DB, list.ID, item.ID)
+	if err != nil {
+		t.Fatalf("GetListItem(_, %v, %v) = _, %v, want _, nil", list.ID,
+			item.ID, err)
+	}
+	if dbItem.Deleted.IsZero() || dbItem.UserClaim(c.ID) == nil {
+		t.Fatalf("item = %+v, want removed and claimed by c", dbItem)
+	}
+
+	pledgeReq.ItemVersion = int32(dbItem.Version)
+	pledgeReq.Amount = 600
+	if _, err := state.Server.PledgeToItem(bCtx, pledgeReq); status.Code(err) != codes.NotFound {
+		t.Errorf("PledgeToItem(b, %+v) = _, %v, want _, NotFound",
+			pledgeReq, err)
+	}
+
+	organizeReq.ItemVersion = int32(dbItem.Version)
+	if _, err := state.Server.SetGroupGiftOrganizer(bCtx, organizeReq); status.Code(err) != codes.NotFound {
+		t.Errorf("SetGroupGiftOrganizer(b, %+v) = _, %v, want _, NotFound",
+			organizeReq, err)
+	}
+}
@@ -0,0 +1,135 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// claimsForViewer trims a claims history value, a list of
+// user:count:purchase claims, so that the purchase state is only shown for
+// viewerID's own claim.
+func claimsForViewer(value string, viewerID int) string {
+	if value == "" {
+		return value
+	}
+
+	viewer := strconv.Itoa(viewerID)
+	claims := strings.Split(value, ",")
+	for i, claim := range claims {
+		parts := strings.SplitN(claim, ":", 3)
+		if len(parts) == 3 && parts[0] != viewer {
+			claims[i] = parts[0] + ":" + parts[1]
+		}
+	}
+	return strings.Join(claims, ",")
+}
+
+// historyForViewer converts item history for display to viewerID. Owners
+// don't get to see changes to claims, and givers don't get to see how far
+// along other givers' purchases are, so changes that only differ in those
+// are dropped, as are entries left with no changes.
+func historyForViewer(entries []*database.HistoryEntry, list *database.List, viewerID int) []*lspb.HistoryEntry {
+	out := []*lspb.HistoryEntry{}
+	for _, entry := range entries {
+		pbEntry := &lspb.HistoryEntry{
+			Version: int32(entry.Version),
+			ActorId: int32(entry.ActorID),
+			When:    entry.When.Unix(),
+		}
+
+		for _, change := range entry.Changes {
+			if viewerID == list.OwnerID && database.ClaimHistoryFields[change.Field] {
+				continue
+			}
+
+			oldValue, newValue := change.Old, change.New
+			if change.Field == "claims" {
+				oldValue = claimsForViewer(oldValue, viewerID)
+				newValue = claimsForViewer(newValue, viewerID)
+				if oldValue == newValue {
+					continue
+				}
+			}
+
+			pbEntry.Changes = append(pbEntry.Changes,
+				&lspb.FieldChange{
+					Field:    change.Field,
+					OldValue: oldValue,
+					NewValue: newValue,
+					When:     entry.When.Unix(),
+				})
+		}
+
+		if len(pbEntry.Changes) > 0 {
+			out = append(out, pbEntry)
+		}
+	}
+	return out
+}
+
+func (s *listServer) GetItemHistory(ctx context.Context, req *lspb.GetItemHistoryRequest) (*lspb.GetItemHistoryResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	list, item, err := s.getVisibleItem(ctx, session, req.GetListId(),
+		req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.db.ListHistory(ctx, list.ID, item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.GetItemHistoryResponse{
+		Entries: historyForViewer(entries, list, session.User.ID),
+	}, nil
+}
+
+func (s *listServer) RevertListItem(ctx context.Context, req *lspb.RevertListItemRequest) (*lspb.RevertListItemResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	list, item, err := s.getVisibleItem(ctx, session, req.GetListId(),
+		req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID != session.User.ID {
+		return nil, errNotOwner()
+	}
+
+	if !list.Active {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"list is not active")
+	}
+
+	if req.GetItemVersion() <= 0 || req.GetToVersion() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"missing item version")
+	}
+
+	reverted, err := s.db.RevertListItem(ctx, list.ID, item.ID,
+		int(req.GetItemVersion()), int(req.GetToVersion()),
+		session.User.ID, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.RevertListItemResponse{
+		Item: itemFromDatabaseItem(reverted, session.User.ID),
+	}, nil
+}
@@ -0,0 +1,177 @@
+package listservice
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestItemHistory(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	listID, itemID := strconv.Itoa(list.ID), strconv.Itoa(item.ID)
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	giverCtx := makeRequestContext(ctx, state, "b")
+
+	updateResp, err := state.Server.UpdateListItem(ownerCtx,
+		&lspb.UpdateListItemRequest{
+			ListId:      listID,
+			ItemId:      itemID,
+			ItemVersion: int32(item.Version),
+			Data:        &lspb.ListItemData{Name: "renamed"},
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(data) = _, %v, want _, nil", err)
+	}
+
+	claimResp, err := state.Server.UpdateListItem(giverCtx,
+		&lspb.UpdateListItemRequest{
+			ListId:      listID,
+			ItemId:      itemID,
+			ItemVersion: updateResp.GetItem().GetVersion(),
+			State:       &lspb.ListItemState{Claimed: true},
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+
+	histReq := &lspb.GetItemHistoryRequest{ListId: listID, ItemId: itemID}
+	fields := func(resp *lspb.GetItemHistoryResponse) map[string]bool {
+		out := map[string]bool{}
+		for _, entry := range resp.GetEntries() {
+			for _, change := range entry.GetChanges() {
+				out[change.GetField()] = true
+			}
+		}
+		return out
+	}
+
+	// The owner sees their own edits, but not the claim.
+	ownerResp, err := state.Server.GetItemHistory(ownerCtx, histReq)
+	if err != nil {
+		t.Fatalf("GetItemHistory(owner) = _, %v, want _, nil", err)
+	}
+	if got := fields(ownerResp); got["claims"] || !got["name"] || len(ownerResp.GetEntries()) != 2 {
+		t.Errorf("GetItemHistory(owner) = %v, want create and rename only",
+			ownerResp)
+	}
+
+	giverResp, err := state.Server.GetItemHistory(giverCtx, histReq)
+	if err != nil {
+		t.Fatalf("GetItemHistory(giver) = _, %v, want _, nil", err)
+	}
+	if got := fields(giverResp); !got["claims"] || len(giverResp.GetEntries()) != 3 {
+		t.Errorf("GetItemHistory(giver) = %v, want create, rename and claim",
+			giverResp)
+	}
+
+	revertReq := &lspb.RevertListItemRequest{
+		ListId:      listID,
+		ItemId:      itemID,
+		ItemVersion: claimResp.GetItem().GetVersion(),
+		ToVersion:   int32(item.Version),
+	}
+	if _, err := state.Server.RevertListItem(giverCtx, revertReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RevertListItem(giver) = _, %v, want PermissionDenied", err)
+	}
+
+	revertResp, err := state.Server.RevertListItem(ownerCtx, revertReq)
+	if err != nil {
+		t.Fatalf("RevertListItem(owner) = _, %v, want _, nil", err)
+	}
+	if revertResp.GetItem().GetData().GetName() != item.Name {
+		t.Errorf("RevertListItem(owner) = %v, want name %q", revertResp,
+			item.Name)
+	}
+
+	// The giver still has their claim.
+	got, err := state.DB.ListListItems(ctx, list.ID,
+		database.OnlyItemWithID(item.ID))
+	userB := state.Users.UserByUsername("b")
+	if err != nil || len(got) != 1 || got[0].UserClaim(userB.ID) == nil {
+		t.Errorf("ListListItems() = %v, %v, want item claimed by b",
+			got, err)
+	}
+
+	// Reverting with a stale version fails like any other update.
+	if _, err := state.Server.RevertListItem(ownerCtx, revertReq); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RevertListItem(stale) = _, %v, want FailedPrecondition", err)
+	}
+}
+
+func TestItemHistory_PurchaseState(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	b := state.Users.UserByUsername("b")
+
+	update := func(version int, update func(state *database.ListItemState) error) *database.ListItem {
+		t.Helper()
+		item, err := state.DB.UpdateListItem(ctx, list.ID, item.ID, version,
+			b.ID, state.Clock.Now(),
+			func(data *database.ListItemData, state *database.ListItemState) error {
+				return update(state)
+			})
+		if err != nil {
+			t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+		}
+		return item
+	}
+
+	item = update(item.Version, func(s *database.ListItemState) error {
+		s.SetClaim(b.ID, 1)
+		return nil
+	})
+	update(item.Version, func(s *database.ListItemState) error {
+		return s.UserClaim(b.ID).SetPurchaseState(database.PurchasePurchased,
+			state.Clock.Now())
+	})
+
+	histReq := &lspb.GetItemHistoryRequest{
+		ListId: strconv.Itoa(list.ID),
+		ItemId: strconv.Itoa(item.ID),
+	}
+	claimChanges := func(username string) []string {
+		t.Helper()
+		resp, err := state.Server.GetItemHistory(
+			makeRequestContext(ctx, state, username), histReq)
+		if err != nil {
+			t.Fatalf("GetItemHistory(%v) = _, %v, want _, nil", username,
+				err)
+		}
+		out := []string{}
+		for _, entry := range resp.GetEntries() {
+			for _, change := range entry.GetChanges() {
+				if change.GetField() == "claims" {
+					out = append(out, change.GetOldValue()+
+						"->"+change.GetNewValue())
+				}
+			}
+		}
+		return out
+	}
+
+	// b sees their purchase, but c only sees the claim. History is
+	// newest first.
+	claimed := fmt.Sprintf("%d:1:%d", b.ID, database.PurchaseClaimed)
+	purchased := fmt.Sprintf("%d:1:%d", b.ID, database.PurchasePurchased)
+	want := []string{claimed + "->" + purchased, "->" + claimed}
+	if got := claimChanges("b"); !cmp.Equal(want, got) {
+		t.Errorf("claim changes for b = %v, want %v", got, want)
+	}
+
+	want = []string{fmt.Sprintf("->%d:1", b.ID)}
+	if got := claimChanges("c"); !cmp.Equal(want, got) {
+		t.Errorf("claim changes for c = %v, want %v", got, want)
+	}
+}
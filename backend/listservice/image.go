@@ -0,0 +1,172 @@
+package listservice
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/images"
+	"github.com/simmonmt/xmaslist/backend/sessions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+const (
+	maxItemImages = 10
+)
+
+func imageFromDatabaseImage(image *database.ItemImage) *lspb.ItemImage {
+	return &lspb.ItemImage{
+		Id:           strconv.Itoa(image.ID),
+		Key:          image.Blob,
+		ThumbnailKey: image.Thumbnail,
+		ContentType:  image.ContentType,
+		Width:        int32(image.Width),
+		Height:       int32(image.Height),
+		Created:      image.Created.Unix(),
+	}
+}
+
+// getOwnedItem parses and checks the IDs of an item whose images are being
+// changed. Only the list owner can change images.
+func (s *listServer) getOwnedItem(ctx context.Context, session *sessions.Session, listIDStr, itemIDStr string) (*database.ListItem, error) {
+	list, item, err := s.getVisibleItem(ctx, session, listIDStr, itemIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID != session.User.ID {
+		return nil, errNotOwner()
+	}
+
+	return item, nil
+}
+
+// readImageUpload reads the image data that follows the header in an upload
+// stream.
+func readImageUpload(stream lspb.ListService_UploadItemImageServer) ([]byte, error) {
+	data := []byte{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if req.GetHeader() != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"unexpected header")
+		}
+
+		data = append(data, req.GetChunk()...)
+		if len(data) > images.MaxImageBytes {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"image is larger than %d bytes",
+				images.MaxImageBytes)
+		}
+	}
+}
+
+func (s *listServer) UploadItemImage(stream lspb.ListService_UploadItemImageServer) error {
+	ctx := stream.Context()
+	session, err := getSession(ctx)
+	if session == nil {
+		return err
+	}
+
+	if s.blobs == nil {
+		return status.Errorf(codes.Unimplemented,
+			"image uploads are disabled")
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := req.GetHeader()
+	if header == nil {
+		return status.Errorf(codes.InvalidArgument,
+			"first message must be a header")
+	}
+
+	item, err := s.getOwnedItem(ctx, session,
+		header.GetListId(), header.GetItemId())
+	if err != nil {
+		return err
+	}
+
+	if len(item.Images) >= maxItemImages {
+		return status.Errorf(codes.FailedPrecondition,
+			"item already has %d images", len(item.Images))
+	}
+
+	data, err := readImageUpload(stream)
+	if err != nil {
+		return err
+	}
+
+	info, err := images.Validate(data)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	thumbnail, _, err := images.Thumbnail(data)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	blobKey, err := s.blobs.Put(ctx, data)
+	if err != nil {
+		return err
+	}
+	thumbnailKey, err := s.blobs.Put(ctx, thumbnail)
+	if err != nil {
+		return err
+	}
+
+	image, err := s.db.AddItemImage(ctx, item.ListID, item.ID,
+		session.User.ID, &database.ItemImage{
+			Blob:        blobKey,
+			Thumbnail:   thumbnailKey,
+			ContentType: info.ContentType,
+			Width:       info.Width,
+			Height:      info.Height,
+		}, s.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&lspb.UploadItemImageResponse{
+		Image: imageFromDatabaseImage(image),
+	})
+}
+
+func (s *listServer) DeleteItemImage(ctx context.Context, req *lspb.DeleteItemImageRequest) (*lspb.DeleteItemImageResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	item, err := s.getOwnedItem(ctx, session, req.GetListId(), req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	imageID, err := strconv.Atoi(req.GetImageId())
+	if req.GetImageId() == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid image id")
+	}
+
+	err = s.db.DeleteItemImage(ctx, item.ListID, item.ID, imageID,
+		session.User.ID, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.DeleteItemImageResponse{}, nil
+}
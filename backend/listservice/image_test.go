@@ -0,0 +1,181 @@
+package listservice
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/simmonmt/xmaslist/backend/blobstore"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// fakeUploadStream feeds reqs to UploadItemImage.
+type fakeUploadStream struct {
+	grpc.ServerStream
+
+	ctx  context.Context
+	reqs []*lspb.UploadItemImageRequest
+	resp *lspb.UploadItemImageResponse
+}
+
+func (s *fakeUploadStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeUploadStream) Recv() (*lspb.UploadItemImageRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *fakeUploadStream) SendAndClose(resp *lspb.UploadItemImageResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func makeUploadRequests(list *database.List, item *database.ListItem, data []byte) []*lspb.UploadItemImageRequest {
+	reqs := []*lspb.UploadItemImageRequest{
+		&lspb.UploadItemImageRequest{
+			Part: &lspb.UploadItemImageRequest_Header_{
+				Header: &lspb.UploadItemImageRequest_Header{
+					ListId: strconv.Itoa(list.ID),
+					ItemId: strconv.Itoa(item.ID),
+				},
+			},
+		},
+	}
+
+	for len(data) > 0 {
+		n := 100
+		if n > len(data) {
+			n = len(data)
+		}
+		reqs = append(reqs, &lspb.UploadItemImageRequest{
+			Part: &lspb.UploadItemImageRequest_Chunk{Chunk: data[:n]},
+		})
+		data = data[n:]
+	}
+
+	return reqs
+}
+
+func TestItemImages(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	store, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() = %v", err)
+	}
+	state.Server.blobs = store
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatalf("png.Encode() = %v", err)
+	}
+	data := buf.Bytes()
+
+	// Only the owner can upload.
+	stream := &fakeUploadStream{
+		ctx:  makeRequestContext(ctx, state, "b"),
+		reqs: makeUploadRequests(list, item, data),
+	}
+	if err := state.Server.UploadItemImage(stream); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("UploadItemImage(non-owner) = %v, want PermissionDenied",
+			err)
+	}
+
+	// Garbage is rejected.
+	stream = &fakeUploadStream{
+		ctx:  makeRequestContext(ctx, state, "a"),
+		reqs: makeUploadRequests(list, item, []byte("not an image")),
+	}
+	if err := state.Server.UploadItemImage(stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UploadItemImage(garbage) = %v, want InvalidArgument",
+			err)
+	}
+
+	// As is data without a header.
+	stream = &fakeUploadStream{
+		ctx:  makeRequestContext(ctx, state, "a"),
+		reqs: makeUploadRequests(list, item, data)[1:],
+	}
+	if err := state.Server.UploadItemImage(stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UploadItemImage(no header) = %v, want InvalidArgument",
+			err)
+	}
+
+	stream = &fakeUploadStream{
+		ctx:  makeRequestContext(ctx, state, "a"),
+		reqs: makeUploadRequests(list, item, data),
+	}
+	if err := state.Server.UploadItemImage(stream); err != nil {
+		t.Fatalf("UploadItemImage() = %v, want nil", err)
+	}
+
+	got := stream.resp.GetImage()
+	if got.GetKey() != blobstore.Key(data) || got.GetContentType() != "image/png" ||
+		got.GetWidth() != 600 || got.GetHeight() != 300 {
+		t.Errorf("UploadItemImage() image = %v, want png 600x300 key %v",
+			got, blobstore.Key(data))
+	}
+
+	thumbnail, err := store.Get(ctx, got.GetThumbnailKey())
+	if err != nil {
+		t.Errorf("thumbnail Get() = _, %v, want _, nil", err)
+	} else if cfg, _, err := image.DecodeConfig(bytes.NewReader(thumbnail)); err != nil ||
+		cfg.Width != 256 || cfg.Height != 128 {
+		t.Errorf("thumbnail = %+v, %v, want 256x128", cfg, err)
+	}
+
+	// The image is visible to everyone looking at the item.
+	listResp, err := state.Server.ListListItems(
+		makeRequestContext(ctx, state, "b"),
+		&lspb.ListListItemsRequest{ListId: strconv.Itoa(list.ID)})
+	if err != nil {
+		t.Fatalf("ListListItems() = _, %v, want _, nil", err)
+	}
+	found := false
+	for _, pbItem := range listResp.GetItems() {
+		if pbItem.GetId() == strconv.Itoa(item.ID) {
+			found = len(pbItem.GetMetadata().GetImages()) == 1
+		}
+	}
+	if !found {
+		t.Errorf("ListListItems() = %v, want item %v with one image",
+			listResp, item.ID)
+	}
+
+	delReq := &lspb.DeleteItemImageRequest{
+		ListId:  strconv.Itoa(list.ID),
+		ItemId:  strconv.Itoa(item.ID),
+		ImageId: got.GetId(),
+	}
+	if _, err := state.Server.DeleteItemImage(makeRequestContext(ctx, state, "b"), delReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("DeleteItemImage(non-owner) = _, %v, want PermissionDenied",
+			err)
+	}
+	if _, err := state.Server.DeleteItemImage(makeRequestContext(ctx, state, "a"), delReq); err != nil {
+		t.Errorf("DeleteItemImage(%v) = _, %v, want _, nil", delReq, err)
+	}
+
+	dbItem, err := dbutil.GetListItem(ctx, state.DB, list.ID, item.ID)
+	if err != nil || len(dbItem.Images) != 0 {
+		t.Errorf("GetListItem() = %+v, %v, want no images", dbItem, err)
+	}
+}
@@ -2,17 +2,26 @@ package listservice
 
 import (
 	"context"
+	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/simmonmt/xmaslist/backend/blobstore"
 	"github.com/simmonmt/xmaslist/backend/database"
 	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/hub"
 	"github.com/simmonmt/xmaslist/backend/request"
+	"github.com/simmonmt/xmaslist/backend/rpcerror"
 	"github.com/simmonmt/xmaslist/backend/sessions"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
 	"github.com/simmonmt/xmaslist/backend/util"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	lspb "github.com/simmonmt/xmaslist/proto/list_service"
 )
@@ -23,6 +32,18 @@ type listServer struct {
 	clock          util.Clock
 	sessionManager *sessions.Manager
 	db             *database.DB
+
+	// Where item images are stored. Image uploads are disabled if nil.
+	blobs blobstore.Store
+
+	// Unfurling is disabled if nil.
+	unfurler *unfurl.Unfurler
+
+	// Delivers item changes to WatchList. Watching is disabled if nil.
+	hub *hub.Hub
+
+	// Sends test webhook deliveries. Testing webhooks is disabled if nil.
+	webhookClient *http.Client
 }
 
 func getSession(ctx context.Context) (*sessions.Session, error) {
@@ -34,7 +55,102 @@ func getSession(ctx context.Context) (*sessions.Session, error) {
 	return val.(*sessions.Session), nil
 }
 
+var (
+	logger = grpclog.Component("listservice")
+
+	currencyRE = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Prices and budgets are optional, but if one is set it must be
+// non-negative and come with an ISO 4217 currency code.
+func validPrice(price int64, currency string) bool {
+	if price == 0 {
+		return currency == "" || currencyRE.MatchString(currency)
+	}
+	return price > 0 && currencyRE.MatchString(currency)
+}
+
+func validPriority(priority lspb.ItemPriority) bool {
+	_, found := lspb.ItemPriority_name[int32(priority)]
+	return found
+}
+
+// validItemData checks owner-supplied item data.
+func validItemData(data *lspb.ListItemData) error {
+	if data.GetName() == "" {
+		return status.Errorf(codes.InvalidArgument, "invalid item name")
+	}
+
+	if !validPrice(data.GetPrice(), data.GetCurrency()) {
+		return status.Errorf(codes.InvalidArgument, "invalid price")
+	}
+
+	if data.GetQuantity() < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid quantity")
+	}
+
+	if !validPriority(data.GetPriority()) {
+		return status.Errorf(codes.InvalidArgument, "invalid priority")
+	}
+
+	return nil
+}
+
+func setItemData(data *database.ListItemData, pbData *lspb.ListItemData) {
+	data.Name = pbData.GetName()
+	data.Desc = pbData.GetDesc()
+	data.URL = pbData.GetUrl()
+	data.Price = pbData.GetPrice()
+	data.Currency = pbData.GetCurrency()
+	data.Quantity = int(pbData.GetQuantity())
+	data.GroupGift = pbData.GetGroupGift()
+	data.Priority = database.ItemPriority(pbData.GetPriority())
+}
+
+// setListData applies the fields set in an UpdateList request's data.
+func setListData(listData *database.ListData, pbData *lspb.ListData) error {
+	num := 0
+
+	if pbData.GetName() != "" {
+		listData.Name = pbData.GetName()
+		num++
+	}
+	if pbData.GetBeneficiary() != "" {
+		listData.Beneficiary = pbData.GetBeneficiary()
+		num++
+	}
+	if pbData.GetEventDate() > 0 {
+		listData.EventDate = time.Unix(pbData.GetEventDate(), 0)
+		num++
+	}
+	if pbData.Budget != nil {
+		listData.Budget = pbData.GetBudget()
+		listData.BudgetCurrency = pbData.GetBudgetCurrency()
+		if listData.Budget == 0 {
+			listData.BudgetCurrency = ""
+		}
+		num++
+	}
+	if days := pbData.GetClaimTimeoutDays(); days != 0 {
+		listData.ClaimTimeoutDays = int(days)
+		if days < 0 {
+			listData.ClaimTimeoutDays = 0
+		}
+		num++
+	}
+
+	if num == 0 {
+		return status.Errorf(codes.InvalidArgument, "no values to set")
+	}
+	return nil
+}
+
 func listFromDatabaseList(list *database.List) *lspb.List {
+	var budget *int64
+	if list.Budget != 0 {
+		budget = proto.Int64(list.Budget)
+	}
+
 	return &lspb.List{
 		Id:      strconv.Itoa(list.ID),
 		Version: int32(list.Version),
@@ -43,6 +159,10 @@ func listFromDatabaseList(list *database.List) *lspb.List {
 			Name:        list.Name,
 			Beneficiary: list.Beneficiary,
 			EventDate:   list.EventDate.Unix(),
+
+			Budget:           budget,
+			BudgetCurrency:   list.BudgetCurrency,
+			ClaimTimeoutDays: int32(list.ClaimTimeoutDays),
 		},
 
 		Metadata: &lspb.ListMetadata{
@@ -54,34 +174,230 @@ func listFromDatabaseList(list *database.List) *lspb.List {
 	}
 }
 
-func itemFromDatabaseItem(item *database.ListItem) *lspb.ListItem {
+func secondsOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func purchaseStatus(claim *database.Claim) *lspb.PurchaseStatus {
+	return &lspb.PurchaseStatus{
+		State:     lspb.PurchaseState(claim.Purchase),
+		Purchased: secondsOrZero(claim.PurchasedWhen),
+		Delivered: secondsOrZero(claim.DeliveredWhen),
+		Wrapped:   secondsOrZero(claim.WrappedWhen),
+		Notes:     claim.Notes,
+	}
+}
+
+// itemFromDatabaseItem converts item for display to viewerID. Purchase
+// progress is private, so only the viewer's own is included.
+func itemFromDatabaseItem(item *database.ListItem, viewerID int) *lspb.ListItem {
 	claimedWhen := item.ClaimedWhen.Unix()
 	if item.ClaimedWhen.IsZero() {
 		claimedWhen = 0
 	}
 
-	return &lspb.ListItem{
+	var claims []*lspb.ItemClaim
+	for _, claim := range item.Claims {
+		claims = append(claims, &lspb.ItemClaim{
+			UserId: int32(claim.UserID),
+			Count:  int32(claim.Count),
+			When:   claim.When.Unix(),
+		})
+	}
+
+	pbItem := &lspb.ListItem{
 		Id:      strconv.Itoa(item.ID),
 		Version: int32(item.Version),
 		ListId:  strconv.Itoa(item.ListID),
 
 		Data: &lspb.ListItemData{
-			Name: item.Name,
-			Desc: item.Desc,
-			Url:  item.URL,
+			Name:      item.Name,
+			Desc:      item.Desc,
+			Url:       item.URL,
+			Price:     item.Price,
+			Currency:  item.Currency,
+			Quantity:  int32(item.Quantity),
+			GroupGift: item.GroupGift,
+			Priority:  lspb.ItemPriority(item.Priority),
 		},
 
 		Metadata: &lspb.ListItemMetadata{
-			Created:     item.Created.Unix(),
-			Updated:     item.Updated.Unix(),
-			ClaimedBy:   int32(item.ClaimedBy),
-			ClaimedWhen: claimedWhen,
+			Created:      item.Created.Unix(),
+			Updated:      item.Updated.Unix(),
+			ClaimedBy:    int32(item.ClaimedBy),
+			ClaimedWhen:  claimedWhen,
+			ClaimedCount: int32(item.ClaimedCount()),
+			Claims:       claims,
+			Position:     int32(item.Position),
 		},
 
 		State: &lspb.ListItemState{
-			Claimed: bool(item.ClaimedBy != 0),
+			Claimed: item.FullyClaimed(),
 		},
 	}
+
+	if item.GroupGift {
+		pbItem.Metadata.GroupGift = groupGiftStatus(item)
+	}
+
+	for _, image := range item.Images {
+		pbItem.Metadata.Images = append(pbItem.Metadata.Images,
+			imageFromDatabaseImage(image))
+	}
+
+	if claim := item.UserClaim(viewerID); claim != nil {
+		pbItem.Metadata.MyPurchase = purchaseStatus(claim)
+		pbItem.Metadata.RemovedByOwner = secondsOrZero(item.Deleted)
+
+		for _, change := range claim.Changes {
+			pbItem.Metadata.ChangesSinceClaim = append(
+				pbItem.Metadata.ChangesSinceClaim,
+				&lspb.FieldChange{
+					Field:    change.Field,
+					OldValue: change.Old,
+					NewValue: change.New,
+					When:     change.When.Unix(),
+				})
+		}
+	}
+
+	return pbItem
+}
+
+// valueTotals sums item prices by currency. Claimed values are only included
+// if includeClaimed is set, as they would tell the list owner which items have
+// been claimed.
+func valueTotals(items []*database.ListItem, includeClaimed bool) []*lspb.ValueTotal {
+	byCurrency := map[string]*lspb.ValueTotal{}
+	for _, item := range items {
+		if item.Price == 0 || !item.Deleted.IsZero() {
+			continue
+		}
+
+		total, found := byCurrency[item.Currency]
+		if !found {
+			total = &lspb.ValueTotal{Currency: item.Currency}
+			byCurrency[item.Currency] = total
+		}
+
+		total.Total += item.Price * int64(item.Quantity)
+		if includeClaimed {
+			claimed := item.ClaimedCount()
+			if claimed > item.Quantity {
+				claimed = item.Quantity
+			}
+			total.Claimed += item.Price * int64(claimed)
+		}
+	}
+
+	totals := []*lspb.ValueTotal{}
+	for _, total := range byCurrency {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Currency < totals[j].Currency
+	})
+
+	return totals
+}
+
+// setClaimed implements ListItemState.claimed, which claims or unclaims
+// everything at once. Claiming takes whatever quantity remains. Unclaiming
+// releases the caller's claim, or, for the list owner, all claims.
+func setClaimed(state *database.ListItemState, claimed bool, quantity int, userID int, ownerID int) error {
+	if claimed {
+		remaining := quantity - state.ClaimedCount()
+		if remaining <= 0 {
+			return status.Errorf(codes.FailedPrecondition,
+				"item is already claimed")
+		}
+
+		prev := 0
+		if claim := state.UserClaim(userID); claim != nil {
+			prev = claim.Count
+		}
+		state.SetClaim(userID, prev+remaining)
+		return nil
+	}
+
+	if len(state.Claims) == 0 {
+		return status.Errorf(codes.FailedPrecondition,
+			"item isn't claimed")
+	}
+
+	if state.UserClaim(userID) != nil {
+		state.SetClaim(userID, 0)
+		return nil
+	}
+
+	if userID != ownerID {
+		return status.Errorf(codes.PermissionDenied,
+			"can't unclaim item already claimed by another user")
+	}
+
+	state.Claims = nil
+	return nil
+}
+
+// applyClaimOperation claims or unclaims part of an item's quantity on behalf
+// of userID.
+func applyClaimOperation(state *database.ListItemState, op *lspb.ClaimOperation, quantity int, userID int) error {
+	count := int(op.GetCount())
+	prev := 0
+	if claim := state.UserClaim(userID); claim != nil {
+		prev = claim.Count
+	}
+
+	switch op.GetType() {
+	case lspb.ClaimOperation_CLAIM:
+		if remaining := quantity - state.ClaimedCount(); count > remaining {
+			return status.Errorf(codes.FailedPrecondition,
+				"only %v unclaimed", remaining)
+		}
+		state.SetClaim(userID, prev+count)
+
+	case lspb.ClaimOperation_UNCLAIM:
+		if count > prev {
+			return status.Errorf(codes.FailedPrecondition,
+				"user has only claimed %v", prev)
+		}
+		state.SetClaim(userID, prev-count)
+
+	default:
+		return status.Errorf(codes.InvalidArgument,
+			"unknown claim operation")
+	}
+
+	return nil
+}
+
+func validPurchaseState(state lspb.PurchaseState) bool {
+	_, found := lspb.PurchaseState_name[int32(state)]
+	return found
+}
+
+// applyPurchaseUpdate updates userID's purchase progress. Only claimers have
+// purchases to track.
+func applyPurchaseUpdate(state *database.ListItemState, update *lspb.PurchaseUpdate, userID int, now time.Time) error {
+	claim := state.UserClaim(userID)
+	if claim == nil {
+		return status.Errorf(codes.FailedPrecondition,
+			"user hasn't claimed item")
+	}
+
+	if update.GetState() != lspb.PurchaseState_PURCHASE_STATE_UNSPECIFIED {
+		err := claim.SetPurchaseState(
+			database.PurchaseState(update.GetState()), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	claim.Notes = update.GetNotes()
+	return nil
 }
 
 func (s *listServer) ListLists(ctx context.Context, req *lspb.ListListsRequest) (*lspb.ListListsResponse, error) {
@@ -138,11 +454,24 @@ func (s *listServer) CreateList(ctx context.Context, req *lspb.CreateListRequest
 			"missing/bad args")
 	}
 
+	if !validPrice(pbData.GetBudget(), pbData.GetBudgetCurrency()) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid budget")
+	}
+
+	if pbData.GetClaimTimeoutDays() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid claim timeout")
+	}
+
 	listData := &database.ListData{
-		Name:        pbData.GetName(),
-		Beneficiary: pbData.GetBeneficiary(),
-		EventDate:   time.Unix(pbData.GetEventDate(), 0),
-		Active:      true,
+		Name:             pbData.GetName(),
+		Beneficiary:      pbData.GetBeneficiary(),
+		EventDate:        time.Unix(pbData.GetEventDate(), 0),
+		Active:           true,
+		Budget:           pbData.GetBudget(),
+		BudgetCurrency:   pbData.GetBudgetCurrency(),
+		ClaimTimeoutDays: int(pbData.GetClaimTimeoutDays()),
 	}
 
 	list, err := s.db.CreateList(ctx, session.User.ID, listData,
@@ -194,30 +523,15 @@ func (s *listServer) UpdateList(ctx context.Context, req *lspb.UpdateListRequest
 	}
 
 	pbData := req.GetData()
+	if !validPrice(pbData.GetBudget(), pbData.GetBudgetCurrency()) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid budget")
+	}
+
 	list, err := s.db.UpdateList(ctx, listID, int(req.GetListVersion()),
 		session.User.ID, s.clock.Now(),
 		func(listData *database.ListData) error {
-			num := 0
-
-			if pbData.GetName() != "" {
-				listData.Name = pbData.GetName()
-				num++
-			}
-			if pbData.GetBeneficiary() != "" {
-				listData.Beneficiary = pbData.GetBeneficiary()
-				num++
-			}
-			if pbData.GetEventDate() > 0 {
-				listData.EventDate =
-					time.Unix(pbData.GetEventDate(), 0)
-				num++
-			}
-
-			if num == 0 {
-				return status.Errorf(codes.InvalidArgument,
-					"no values to set")
-			}
-			return nil
+			return setListData(listData, pbData)
 		})
 	if err != nil {
 		return nil, err
@@ -240,6 +554,11 @@ func (s *listServer) ListListItems(ctx context.Context, req *lspb.ListListItemsR
 			"invalid list id")
 	}
 
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return nil, err
+	}
+
 	items, err := s.db.ListListItems(ctx, listID, database.AllItems())
 	if err != nil {
 		return nil, err
@@ -247,8 +566,11 @@ func (s *listServer) ListListItems(ctx context.Context, req *lspb.ListListItemsR
 
 	resp := &lspb.ListListItemsResponse{}
 	for _, item := range items {
-		resp.Items = append(resp.Items, itemFromDatabaseItem(item))
+		if item.VisibleTo(session.User.ID) {
+			resp.Items = append(resp.Items, itemFromDatabaseItem(item, session.User.ID))
+		}
 	}
+	resp.Totals = valueTotals(items, list.OwnerID != session.User.ID)
 
 	return resp, nil
 }
@@ -271,30 +593,24 @@ func (s *listServer) CreateListItem(ctx context.Context, req *lspb.CreateListIte
 	}
 
 	if list.OwnerID != session.User.ID {
-		return nil, status.Errorf(codes.PermissionDenied,
-			"user does not own list")
+		return nil, errNotOwner()
 	}
 
-	pbData := req.GetData()
-	if pbData.GetName() == "" {
-		return nil, status.Errorf(codes.InvalidArgument,
-			"missing/bad args")
+	if err := validItemData(req.GetData()); err != nil {
+		return nil, err
 	}
 
-	listItemData := &database.ListItemData{
-		Name: pbData.GetName(),
-		Desc: pbData.GetDesc(),
-		URL:  pbData.GetUrl(),
-	}
+	listItemData := &database.ListItemData{}
+	setItemData(listItemData, req.GetData())
 
-	listItem, err := s.db.CreateListItem(ctx, listID, listItemData,
-		s.clock.Now())
+	listItem, err := s.db.CreateListItem(ctx, listID, session.User.ID,
+		listItemData, s.clock.Now())
 	if err != nil {
 		return nil, err
 	}
 
 	return &lspb.CreateListItemResponse{
-		Item: itemFromDatabaseItem(listItem),
+		Item: itemFromDatabaseItem(listItem, session.User.ID),
 	}, nil
 }
 
@@ -322,11 +638,10 @@ func (s *listServer) DeleteListItem(ctx context.Context, req *lspb.DeleteListIte
 	}
 
 	if list.OwnerID != session.User.ID {
-		return nil, status.Errorf(codes.PermissionDenied,
-			"user does not own list")
+		return nil, errNotOwner()
 	}
 
-	if err := s.db.DeleteListItem(ctx, listID, itemID); err != nil {
+	if err := s.db.DeleteListItem(ctx, listID, itemID, session.User.ID, s.clock.Now()); err != nil {
 		return nil, err
 	}
 
@@ -368,52 +683,96 @@ func (s *listServer) UpdateListItem(ctx context.Context, req *lspb.UpdateListIte
 
 	if req.Data != nil {
 		if list.OwnerID != session.User.ID {
-			return nil, status.Errorf(codes.PermissionDenied,
+			return nil, rpcerror.Errorf(codes.PermissionDenied,
+				rpcerror.ReasonNotOwner,
 				"only owner can update list data")
 		}
 
-		if req.Data.GetName() == "" {
+		if err := validItemData(req.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Claim != nil {
+		if req.State != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"state and claim are mutually exclusive")
+		}
+
+		if req.Claim.GetCount() <= 0 {
 			return nil, status.Errorf(codes.InvalidArgument,
-				"invalid item name")
+				"invalid claim count")
 		}
 	}
 
+	if req.Purchase != nil && !validPurchaseState(req.Purchase.GetState()) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid purchase state")
+	}
+
 	now := s.clock.Now()
 	item, err := s.db.UpdateListItem(ctx, list.ID, itemID,
-		int(req.GetItemVersion()), now,
+		int(req.GetItemVersion()), session.User.ID, now,
 		func(data *database.ListItemData, state *database.ListItemState) error {
 			if req.Data != nil {
-				data.Name = req.Data.GetName()
-				data.Desc = req.Data.GetDesc()
-				data.URL = req.Data.GetUrl()
+				setItemData(data, req.Data)
+			}
+
+			if !state.Deleted.IsZero() {
+				if req.Data != nil {
+					return status.Errorf(codes.NotFound,
+						"no item with ID %v", itemID)
+				}
+				if req.GetState().GetClaimed() || req.GetClaim().GetType() == lspb.ClaimOperation_CLAIM {
+					return status.Errorf(
+						codes.FailedPrecondition,
+						"item was removed by owner")
+				}
+			}
+
+			if data.GroupGift && (req.State != nil || req.Claim != nil) {
+				return status.Errorf(codes.FailedPrecondition,
+					"group gifts are claimed by their "+
+						"organizer")
+			}
+
+			quantity := data.Quantity
+			if quantity <= 0 {
+				quantity = 1
 			}
 
 			if req.State != nil {
-				if state.ClaimedBy != 0 {
-					if req.State.GetClaimed() {
-						return status.Errorf(
-							codes.FailedPrecondition,
-							"item is already claimed")
-					}
-					if session.User.ID != list.OwnerID && session.User.ID != state.ClaimedBy {
-						return status.Errorf(
-							codes.PermissionDenied,
-							"can't unclaim item already "+
-								"claimed by another user")
-					}
-				} else {
-					if !req.State.GetClaimed() {
-						return status.Errorf(
-							codes.FailedPrecondition,
-							"item isn't claimed")
-					}
+				err := setClaimed(state, req.State.GetClaimed(),
+					quantity, session.User.ID, list.OwnerID)
+				if err != nil {
+					return err
+				}
+			}
+
+			if req.Claim != nil {
+				err := applyClaimOperation(state, req.Claim,
+					quantity, session.User.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			if req.Purchase != nil {
+				err := applyPurchaseUpdate(state, req.Purchase,
+					session.User.ID, now)
+				if err != nil {
+					return err
 				}
+			}
 
-				if req.State.GetClaimed() {
-					state.ClaimedBy = session.User.ID
-				} else {
-					state.ClaimedBy = 0
+			if req.GetAcknowledgeChanges() {
+				claim := state.UserClaim(session.User.ID)
+				if claim == nil {
+					return status.Errorf(
+						codes.FailedPrecondition,
+						"user hasn't claimed item")
 				}
+				claim.Changes = nil
 			}
 
 			return nil
@@ -423,15 +782,347 @@ func (s *listServer) UpdateListItem(ctx context.Context, req *lspb.UpdateListIte
 	}
 
 	return &lspb.UpdateListItemResponse{
-		Item: itemFromDatabaseItem(item),
+		Item: itemFromDatabaseItem(item, session.User.ID),
+	}, nil
+}
+
+// ListMyClaims returns the items the caller has claimed, grouped by list.
+func (s *listServer) ListMyClaims(ctx context.Context, req *lspb.ListMyClaimsRequest) (*lspb.ListMyClaimsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	claimedItems, err := s.db.ListClaimedItems(ctx, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.ListMyClaimsResponse{}
+	var cur *lspb.ClaimedList
+	for _, claimedItem := range claimedItems {
+		list := claimedItem.List
+		if !list.Active && !req.GetIncludeInactive() {
+			continue
+		}
+
+		if cur == nil || cur.GetList().GetId() != strconv.Itoa(list.ID) {
+			cur = &lspb.ClaimedList{List: listFromDatabaseList(list)}
+			resp.Lists = append(resp.Lists, cur)
+		}
+
+		cur.Items = append(cur.Items, itemFromDatabaseItem(
+			claimedItem.Item, session.User.ID))
+	}
+
+	return resp, nil
+}
+
+func (s *listServer) ReorderListItems(ctx context.Context, req *lspb.ReorderListItemsRequest) (*lspb.ReorderListItemsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	listID, err := strconv.Atoi(req.GetListId())
+	if req.GetListId() == "" || err != nil || req.GetListVersion() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"missing/bad args")
+	}
+
+	itemIDs, err := parseItemIDs(req.GetItemIds())
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.db.ReorderListItems(ctx, listID,
+		int(req.GetListVersion()), session.User.ID, s.clock.Now(),
+		itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.visibleItems(ctx, listID, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.ReorderListItemsResponse{
+		List:  listFromDatabaseList(list),
+		Items: items,
+	}, nil
+}
+
+func parseItemIDs(idStrs []string) ([]int, error) {
+	itemIDs := []int{}
+	for _, idStr := range idStrs {
+		itemID, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"invalid item id %v", idStr)
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+	return itemIDs, nil
+}
+
+// visibleItems returns the items in a list that viewerID can see.
+func (s *listServer) visibleItems(ctx context.Context, listID int, viewerID int) ([]*lspb.ListItem, error) {
+	items, err := s.db.ListListItems(ctx, listID, database.AllItems())
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*lspb.ListItem{}
+	for _, item := range items {
+		if item.VisibleTo(viewerID) {
+			out = append(out, itemFromDatabaseItem(item, viewerID))
+		}
+	}
+	return out, nil
+}
+
+// parseListVersion parses and checks a list ID and version from a request.
+// The list must exist.
+func (s *listServer) parseListVersion(ctx context.Context, listIDStr string, version int32) (int, error) {
+	listID, err := strconv.Atoi(listIDStr)
+	if listIDStr == "" || err != nil || version <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument,
+			"missing/bad args")
+	}
+
+	if _, err := dbutil.GetList(ctx, s.db, listID); err != nil {
+		return 0, err
+	}
+
+	return listID, nil
+}
+
+func (s *listServer) MoveListItems(ctx context.Context, req *lspb.MoveListItemsRequest) (*lspb.MoveListItemsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	fromListID, err := s.parseListVersion(ctx, req.GetFromListId(),
+		req.GetFromListVersion())
+	if err != nil {
+		return nil, err
+	}
+	toListID, err := s.parseListVersion(ctx, req.GetToListId(),
+		req.GetToListVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs, err := parseItemIDs(req.GetItemIds())
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := s.db.MoveListItems(ctx,
+		fromListID, int(req.GetFromListVersion()),
+		toListID, int(req.GetToListVersion()),
+		session.User.ID, s.clock.Now(), itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	fromItems, err := s.visibleItems(ctx, fromListID, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	toItems, err := s.visibleItems(ctx, toListID, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.MoveListItemsResponse{
+		FromList:  listFromDatabaseList(from),
+		FromItems: fromItems,
+		ToList:    listFromDatabaseList(to),
+		ToItems:   toItems,
 	}, nil
 }
 
-func RegisterHandlers(server *grpc.Server, clock util.Clock, sessionManager *sessions.Manager, db *database.DB) {
+func (s *listServer) CopyListItems(ctx context.Context, req *lspb.CopyListItemsRequest) (*lspb.CopyListItemsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	fromListID, err := strconv.Atoi(req.GetFromListId())
+	if req.GetFromListId() == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid from list id")
+	}
+	toListID, err := s.parseListVersion(ctx, req.GetToListId(),
+		req.GetToListVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs, err := parseItemIDs(req.GetItemIds())
+	if err != nil {
+		return nil, err
+	}
+
+	to, _, err := s.db.CopyListItems(ctx, fromListID, toListID,
+		int(req.GetToListVersion()), session.User.ID, s.clock.Now(),
+		itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	toItems, err := s.visibleItems(ctx, toListID, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.CopyListItemsResponse{
+		ToList:  listFromDatabaseList(to),
+		ToItems: toItems,
+	}, nil
+}
+
+// maxBatchOps limits the size of a BatchUpdateListItems request.
+const maxBatchOps = 500
+
+// itemOperationFromProto converts and checks one BatchUpdateListItems
+// operation.
+func itemOperationFromProto(op *lspb.ItemOperation, list *database.List) (*database.ItemOperation, error) {
+	parseItem := func(idStr string, version int32) (int, error) {
+		itemID, err := strconv.Atoi(idStr)
+		if idStr == "" || err != nil {
+			return 0, status.Errorf(codes.InvalidArgument,
+				"invalid item id")
+		}
+		if version <= 0 {
+			return 0, status.Errorf(codes.InvalidArgument,
+				"missing item version")
+		}
+		return itemID, nil
+	}
+
+	switch {
+	case op.GetCreate() != nil:
+		pbData := op.GetCreate().GetData()
+		if err := validItemData(pbData); err != nil {
+			return nil, err
+		}
+		data := &database.ListItemData{}
+		setItemData(data, pbData)
+		return &database.ItemOperation{Create: data}, nil
+
+	case op.GetUpdate() != nil:
+		update := op.GetUpdate()
+		if !list.Active {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"list is not active")
+		}
+		itemID, err := parseItem(update.GetItemId(),
+			update.GetItemVersion())
+		if err != nil {
+			return nil, err
+		}
+		if err := validItemData(update.GetData()); err != nil {
+			return nil, err
+		}
+		return &database.ItemOperation{
+			ItemID:      itemID,
+			ItemVersion: int(update.GetItemVersion()),
+			Update: func(data *database.ListItemData, state *database.ListItemState) error {
+				setItemData(data, update.GetData())
+				return nil
+			},
+		}, nil
+
+	case op.GetDelete() != nil:
+		itemID, err := parseItem(op.GetDelete().GetItemId(),
+			op.GetDelete().GetItemVersion())
+		if err != nil {
+			return nil, err
+		}
+		return &database.ItemOperation{
+			ItemID:      itemID,
+			ItemVersion: int(op.GetDelete().GetItemVersion()),
+			Delete:      true,
+		}, nil
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"empty operation")
+	}
+}
+
+// BatchUpdateListItems applies a sequence of item creates, updates and
+// deletes to a list in one transaction. If any operation fails, none are
+// applied, and the error's BadRequest detail names the failed operation's
+// index.
+func (s *listServer) BatchUpdateListItems(ctx context.Context, req *lspb.BatchUpdateListItemsRequest) (*lspb.BatchUpdateListItemsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	listID, err := strconv.Atoi(req.GetListId())
+	if req.GetListId() == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid list id")
+	}
+
+	if len(req.GetOps()) == 0 || len(req.GetOps()) > maxBatchOps {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"need between 1 and %d operations", maxBatchOps)
+	}
+
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID != session.User.ID {
+		return nil, errNotOwner()
+	}
+
+	ops := make([]*database.ItemOperation, len(req.GetOps()))
+	for i, pbOp := range req.GetOps() {
+		op, err := itemOperationFromProto(pbOp, list)
+		if err != nil {
+			return nil, &database.BatchError{Index: i, Err: err}
+		}
+		ops[i] = op
+	}
+
+	items, err := s.db.BatchUpdateListItems(ctx, listID, session.User.ID,
+		s.clock.Now(), ops)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.BatchUpdateListItemsResponse{}
+	for i, item := range items {
+		result := &lspb.ItemOperationResult{}
+		if ops[i].Delete {
+			result.DeletedItemId = strconv.Itoa(item.ID)
+		} else {
+			result.Item = itemFromDatabaseItem(item, session.User.ID)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
+
+func RegisterHandlers(server *grpc.Server, clock util.Clock, sessionManager *sessions.Manager, db *database.DB, blobs blobstore.Store, unfurler *unfurl.Unfurler, hub *hub.Hub, webhookClient *http.Client) {
 	handlers := &listServer{
 		clock:          clock,
 		sessionManager: sessionManager,
 		db:             db,
+		blobs:          blobs,
+		unfurler:       unfurler,
+		hub:            hub,
+		webhookClient:  webhookClient,
 	}
 
 	lspb.RegisterListServiceServer(server, handlers)
@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 
 	"github.com/simmonmt/xmaslist/backend/database"
@@ -188,16 +190,18 @@ func TestUpdateListItem(t *testing.T) {
 			ListId:  req.GetListId(),
 
 			Data: &lspb.ListItemData{
-				Name: "name",
-				Desc: "",
-				Url:  "",
+				Name:     "name",
+				Desc:     "",
+				Url:      "",
+				Quantity: 1,
 			},
 
 			State: &lspb.ListItemState{},
 
 			Metadata: &lspb.ListItemMetadata{
-				Created: item.Created.Unix(),
-				Updated: state.Clock.Time.Unix(),
+				Created:  item.Created.Unix(),
+				Updated:  state.Clock.Time.Unix(),
+				Position: int32(item.Position),
 			},
 		},
 	}
@@ -225,13 +229,30 @@ func TestUpdateListItem(t *testing.T) {
 	}
 
 	wantResp.Item.Version = req.ItemVersion + 1
-	wantResp.Item.Data = req.Data
+	wantResp.Item.Data = &lspb.ListItemData{
+		Name:     "name",
+		Desc:     "desc",
+		Url:      "url",
+		Quantity: 1,
+	}
 	wantResp.Item.State.Claimed = true
 	wantResp.Item.Metadata = &lspb.ListItemMetadata{
-		Created:     wantResp.Item.Metadata.Created,
-		Updated:     state.Clock.Time.Unix(),
-		ClaimedBy:   int32(user.ID),
-		ClaimedWhen: state.Clock.Time.Unix(),
+		Created:      wantResp.Item.Metadata.Created,
+		Updated:      state.Clock.Time.Unix(),
+		ClaimedBy:    int32(user.ID),
+		ClaimedWhen:  state.Clock.Time.Unix(),
+		ClaimedCount: 1,
+		Claims: []*lspb.ItemClaim{
+			{
+				UserId: int32(user.ID),
+				Count:  1,
+				When:   state.Clock.Time.Unix(),
+			},
+		},
+		Position: int32(item.Position),
+		MyPurchase: &lspb.PurchaseStatus{
+			State: lspb.PurchaseState_CLAIMED,
+		},
 	}
 
 	resp, err = state.Server.UpdateListItem(reqCtx, req)
@@ -302,18 +323,31 @@ func TestUpdateListItem_Claim(t *testing.T) {
 					ListId:  req.GetListId(),
 
 					Data: &lspb.ListItemData{
-						Name: "l1i2",
-						Desc: "l1i2desc",
-						Url:  "l1i2url",
+						Name:     "l1i2",
+						Desc:     "l1i2desc",
+						Url:      "l1i2url",
+						Quantity: 1,
 					},
 
 					State: &lspb.ListItemState{Claimed: true},
 
 					Metadata: &lspb.ListItemMetadata{
-						Created:     item.Created.Unix(),
-						Updated:     claimedWhen.Unix(),
-						ClaimedBy:   int32(claimUser.ID),
-						ClaimedWhen: claimedWhen.Unix(),
+						Created:      item.Created.Unix(),
+						Updated:      claimedWhen.Unix(),
+						ClaimedBy:    int32(claimUser.ID),
+						ClaimedWhen:  claimedWhen.Unix(),
+						ClaimedCount: 1,
+						Claims: []*lspb.ItemClaim{
+							{
+								UserId: int32(claimUser.ID),
+								Count:  1,
+								When:   claimedWhen.Unix(),
+							},
+						},
+						Position: int32(item.Position),
+						MyPurchase: &lspb.PurchaseStatus{
+							State: lspb.PurchaseState_CLAIMED,
+						},
 					},
 				},
 			}
@@ -357,12 +391,15 @@ func TestUpdateListItem_Claim(t *testing.T) {
 			wantResp.GetItem().GetState().Claimed = false
 			wantResp.GetItem().GetMetadata().ClaimedBy = 0
 			wantResp.GetItem().GetMetadata().ClaimedWhen = 0
+			wantResp.GetItem().GetMetadata().ClaimedCount = 0
+			wantResp.GetItem().GetMetadata().Claims = nil
+			wantResp.GetItem().GetMetadata().MyPurchase = nil
 			wantResp.GetItem().GetMetadata().Updated =
 				state.Clock.Time.Unix()
 
 			resp, err = state.Server.UpdateListItem(reqCtx, req)
 			if err != nil {
-				t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+				t.Fatalf("UpdateListItem(_, %+v) = %v, %v, want %v, nil",
 					req, resp, err, wantResp)
 			}
 
@@ -459,3 +496,761 @@ func TestDeleteListItem(t *testing.T) {
 			req, err)
 	}
 }
+
+func TestListListItems_Totals(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item1 := state.Lists.GetItem("l1", "l1i1")
+	_, item2 := state.Lists.GetItem("l1", "l1i2")
+
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	nonOwnerCtx := makeRequestContext(ctx, state, "b")
+
+	// Price both items, and have the non-owner claim one of them.
+	for _, update := range []struct {
+		item  *database.ListItem
+		price int64
+		claim bool
+	}{
+		{item1, 1000, false},
+		{item2, 250, true},
+	} {
+		req := &lspb.UpdateListItemRequest{
+			ListId:      strconv.Itoa(list.ID),
+			ItemId:      strconv.Itoa(update.item.ID),
+			ItemVersion: int32(update.item.Version),
+			Data: &lspb.ListItemData{
+				Name:     update.item.Name,
+				Price:    update.price,
+				Currency: "USD",
+			},
+		}
+
+		resp, err := state.Server.UpdateListItem(ownerCtx, req)
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+				req, err)
+		}
+
+		if update.claim {
+			req.ItemVersion = resp.GetItem().GetVersion()
+			req.Data = nil
+			req.State = &lspb.ListItemState{Claimed: true}
+			if _, err := state.Server.UpdateListItem(nonOwnerCtx, req); err != nil {
+				t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+					req, err)
+			}
+		}
+	}
+
+	req := &lspb.ListListItemsRequest{ListId: strconv.Itoa(list.ID)}
+
+	for _, tc := range []struct {
+		name       string
+		ctx        context.Context
+		wantTotals []*lspb.ValueTotal
+	}{
+		{
+			name: "owner",
+			ctx:  ownerCtx,
+			wantTotals: []*lspb.ValueTotal{
+				{Currency: "USD", Total: 1250},
+			},
+		},
+		{
+			name: "nonowner",
+			ctx:  nonOwnerCtx,
+			wantTotals: []*lspb.ValueTotal{
+				{Currency: "USD", Total: 1250, Claimed: 250},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := state.Server.ListListItems(tc.ctx, req)
+			if err != nil {
+				t.Fatalf("ListListItems(_, %+v) = _, %v, want _, nil",
+					req, err)
+			}
+
+			if diff := cmp.Diff(tc.wantTotals, resp.GetTotals(), protocmp.Transform()); diff != "" {
+				t.Errorf("ListListItems(_, %+v) totals diff:\n%v",
+					req, diff)
+			}
+		})
+	}
+}
+
+func TestCreateListItem_BadPrice(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list := state.Lists.GetList("l1").List
+	ownerCtx := makeRequestContext(ctx, state, "a")
+
+	for _, data := range []*lspb.ListItemData{
+		{Name: "n", Price: 100},
+		{Name: "n", Price: -100, Currency: "USD"},
+		{Name: "n", Price: 100, Currency: "dollars"},
+	} {
+		req := &lspb.CreateListItemRequest{
+			ListId: strconv.Itoa(list.ID),
+			Data:   data,
+		}
+
+		if _, err := state.Server.CreateListItem(ownerCtx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateListItem(_, %+v) = _, %v, want _, InvalidArgument",
+				req, err)
+		}
+	}
+}
+
+func TestUpdateList_Budget(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list := state.Lists.GetList("l1").List
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	version := list.Version
+
+	update := func(data *lspb.ListData) *lspb.List {
+		t.Helper()
+		req := &lspb.UpdateListRequest{
+			ListId:      strconv.Itoa(list.ID),
+			ListVersion: int32(version),
+			Data:        data,
+		}
+		resp, err := state.Server.UpdateList(ownerCtx, req)
+		if err != nil {
+			t.Fatalf("UpdateList(_, %+v) = _, %v, want _, nil", req, err)
+		}
+		version = int(resp.GetList().GetVersion())
+		return resp.GetList()
+	}
+
+	got := update(&lspb.ListData{Budget: proto.Int64(2500), BudgetCurrency: "USD"})
+	if got.GetData().Budget == nil || got.GetData().GetBudget() != 2500 ||
+		got.GetData().GetBudgetCurrency() != "USD" {
+		t.Errorf("UpdateList(set budget) data = %v, want budget 2500 USD",
+			got.GetData())
+	}
+
+	// Updates that don't mention the budget leave it alone.
+	got = update(&lspb.ListData{Name: "renamed"})
+	if got.GetData().GetBudget() != 2500 {
+		t.Errorf("UpdateList(name) data = %v, want budget 2500",
+			got.GetData())
+	}
+
+	got = update(&lspb.ListData{Budget: proto.Int64(0)})
+	if got.GetData().Budget != nil || got.GetData().GetBudgetCurrency() != "" {
+		t.Errorf("UpdateList(clear budget) data = %v, want no budget",
+			got.GetData())
+	}
+}
+
+func TestUpdateListItem_PartialClaims(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+	b := state.Users.UserByUsername("b")
+	c := state.Users.UserByUsername("c")
+
+	req := &lspb.UpdateListItemRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ItemId:      strconv.Itoa(item.ID),
+		ItemVersion: int32(item.Version),
+		Data:        &lspb.ListItemData{Name: item.Name, Quantity: 5},
+	}
+	resp, err := state.Server.UpdateListItem(ownerCtx, req)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil", req, err)
+	}
+
+	claimOp := func(reqCtx context.Context, opType lspb.ClaimOperation_Type, count int32) (*lspb.UpdateListItemResponse, error) {
+		req := &lspb.UpdateListItemRequest{
+			ListId:      strconv.Itoa(list.ID),
+			ItemId:      strconv.Itoa(item.ID),
+			ItemVersion: resp.GetItem().GetVersion(),
+			Claim:       &lspb.ClaimOperation{Type: opType, Count: count},
+		}
+
+		opResp, err := state.Server.UpdateListItem(reqCtx, req)
+		if err == nil {
+			resp = opResp
+		}
+		return opResp, err
+	}
+
+	for _, op := range []struct {
+		ctx   context.Context
+		count int32
+	}{
+		{bCtx, 2},
+		{cCtx, 1},
+		{bCtx, 1},
+	} {
+		if _, err := claimOp(op.ctx, lspb.ClaimOperation_CLAIM, op.count); err != nil {
+			t.Fatalf("claim %v = %v, want nil", op.count, err)
+		}
+	}
+
+	wantClaims := []*lspb.ItemClaim{
+		{UserId: int32(b.ID), Count: 3, When: resp.GetItem().GetMetadata().GetClaims()[0].GetWhen()},
+		{UserId: int32(c.ID), Count: 1, When: resp.GetItem().GetMetadata().GetClaims()[1].GetWhen()},
+	}
+	if diff := cmp.Diff(wantClaims, resp.GetItem().GetMetadata().GetClaims(), protocmp.Transform()); diff != "" {
+		t.Errorf("claims diff:\n%v", diff)
+	}
+	if resp.GetItem().GetState().GetClaimed() || resp.GetItem().GetMetadata().GetClaimedBy() != int32(b.ID) {
+		t.Errorf("claimed = %v, claimed_by = %v, want false, %v",
+			resp.GetItem().GetState().GetClaimed(),
+			resp.GetItem().GetMetadata().GetClaimedBy(), b.ID)
+	}
+
+	// Only one unit is left.
+	if _, err := claimOp(cCtx, lspb.ClaimOperation_CLAIM, 2); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("over-claim = %v, want FailedPrecondition", err)
+	}
+
+	// c can't release more than it claimed.
+	if _, err := claimOp(cCtx, lspb.ClaimOperation_UNCLAIM, 2); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("over-unclaim = %v, want FailedPrecondition", err)
+	}
+
+	// Claiming via state takes whatever remains.
+	stateReq := &lspb.UpdateListItemRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ItemId:      strconv.Itoa(item.ID),
+		ItemVersion: resp.GetItem().GetVersion(),
+		State:       &lspb.ListItemState{Claimed: true},
+	}
+	resp, err = state.Server.UpdateListItem(cCtx, stateReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil", stateReq, err)
+	}
+	if !resp.GetItem().GetState().GetClaimed() || resp.GetItem().GetMetadata().GetClaimedCount() != 5 {
+		t.Errorf("after state claim, claimed = %v, count = %v, want true, 5",
+			resp.GetItem().GetState().GetClaimed(),
+			resp.GetItem().GetMetadata().GetClaimedCount())
+	}
+
+	// Unclaiming via state only releases the caller's claim.
+	if _, err := claimOp(bCtx, lspb.ClaimOperation_UNCLAIM, 3); err != nil {
+		t.Fatalf("unclaim = %v, want nil", err)
+	}
+	if got := resp.GetItem().GetMetadata().GetClaimedCount(); got != 2 {
+		t.Errorf("after unclaim, count = %v, want 2", got)
+	}
+	if got := resp.GetItem().GetMetadata().GetClaimedBy(); got != int32(c.ID) {
+		t.Errorf("after unclaim, claimed_by = %v, want %v", got, c.ID)
+	}
+}
+
+func TestUpdateListItem_Purchase(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+
+	version := int32(item.Version)
+	update := func(reqCtx context.Context, req *lspb.UpdateListItemRequest) (*lspb.UpdateListItemResponse, error) {
+		req.ListId = strconv.Itoa(list.ID)
+		req.ItemId = strconv.Itoa(item.ID)
+		req.ItemVersion = version
+
+		resp, err := state.Server.UpdateListItem(reqCtx, req)
+		if err == nil {
+			version = resp.GetItem().GetVersion()
+		}
+		return resp, err
+	}
+
+	// Only claimers have purchases.
+	purchaseReq := &lspb.UpdateListItemRequest{
+		Purchase: &lspb.PurchaseUpdate{
+			State: lspb.PurchaseState_PURCHASED,
+		},
+	}
+	if _, err := update(bCtx, purchaseReq); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, FailedPrecondition",
+			purchaseReq, err)
+	}
+
+	claimReq := &lspb.UpdateListItemRequest{
+		State: &lspb.ListItemState{Claimed: true},
+	}
+	if _, err := update(bCtx, claimReq); err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			claimReq, err)
+	}
+
+	// Can't skip purchasing.
+	wrapReq := &lspb.UpdateListItemRequest{
+		Purchase: &lspb.PurchaseUpdate{
+			State: lspb.PurchaseState_WRAPPED,
+		},
+	}
+	if _, err := update(bCtx, wrapReq); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, FailedPrecondition",
+			wrapReq, err)
+	}
+
+	purchaseReq.Purchase.Notes = "hall closet"
+	purchased := state.Clock.Time
+	resp, err := update(bCtx, purchaseReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			purchaseReq, err)
+	}
+
+	state.Clock.Advance(time.Hour)
+	wrapped := state.Clock.Time
+	resp, err = update(bCtx, wrapReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			wrapReq, err)
+	}
+
+	// Notes are replaced on every update.
+	wantPurchase := &lspb.PurchaseStatus{
+		State:     lspb.PurchaseState_WRAPPED,
+		Purchased: purchased.Unix(),
+		Wrapped:   wrapped.Unix(),
+	}
+	if diff := cmp.Diff(wantPurchase, resp.GetItem().GetMetadata().GetMyPurchase(), protocmp.Transform()); diff != "" {
+		t.Errorf("UpdateListItem(_, %+v) purchase diff:\n%v", wrapReq, diff)
+	}
+
+	// Nobody else sees b's purchase.
+	for _, reqCtx := range []context.Context{ownerCtx, cCtx} {
+		listResp, err := state.Server.ListListItems(reqCtx,
+			&lspb.ListListItemsRequest{ListId: strconv.Itoa(list.ID)})
+		if err != nil {
+			t.Fatalf("ListListItems = _, %v, want _, nil", err)
+		}
+
+		for _, got := range listResp.GetItems() {
+			if got.GetMetadata().GetMyPurchase() != nil {
+				t.Errorf("ListListItems item %v purchase = %v, want nil",
+					got.GetId(), got.GetMetadata().GetMyPurchase())
+			}
+		}
+	}
+}
+
+func TestOwnerChangesToClaimedItem(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	bCtx := makeRequestContext(ctx, state, "b")
+
+	version := int32(item.Version)
+	update := func(reqCtx context.Context, req *lspb.UpdateListItemRequest) *lspb.ListItem {
+		req.ListId = strconv.Itoa(list.ID)
+		req.ItemId = strconv.Itoa(item.ID)
+		req.ItemVersion = version
+
+		resp, err := state.Server.UpdateListItem(reqCtx, req)
+		if err != nil {
+			t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+				req, err)
+		}
+		version = resp.GetItem().GetVersion()
+		return resp.GetItem()
+	}
+
+	listItems := func(reqCtx context.Context) []*lspb.ListItem {
+		req := &lspb.ListListItemsRequest{ListId: strconv.Itoa(list.ID)}
+		resp, err := state.Server.ListListItems(reqCtx, req)
+		if err != nil {
+			t.Fatalf("ListListItems(_, %+v) = _, %v, want _, nil",
+				req, err)
+		}
+		return resp.GetItems()
+	}
+
+	update(bCtx, &lspb.UpdateListItemRequest{
+		State: &lspb.ListItemState{Claimed: true},
+	})
+
+	changed := state.Clock.Time
+	ownerItem := update(ownerCtx, &lspb.UpdateListItemRequest{
+		Data: &lspb.ListItemData{Name: "new name", Desc: item.Desc,
+			Url: item.URL},
+	})
+	if changes := ownerItem.GetMetadata().GetChangesSinceClaim(); len(changes) != 0 {
+		t.Errorf("owner changes = %v, want none", changes)
+	}
+
+	wantChanges := []*lspb.FieldChange{
+		{Field: "name", OldValue: "l1i1", NewValue: "new name",
+			When: changed.Unix()},
+	}
+	got := listItems(bCtx)[0]
+	if diff := cmp.Diff(wantChanges, got.GetMetadata().GetChangesSinceClaim(), protocmp.Transform()); diff != "" {
+		t.Errorf("claimer changes diff:\n%v", diff)
+	}
+
+	got = update(bCtx, &lspb.UpdateListItemRequest{AcknowledgeChanges: true})
+	if changes := got.GetMetadata().GetChangesSinceClaim(); len(changes) != 0 {
+		t.Errorf("acknowledged changes = %v, want none", changes)
+	}
+
+	// Deleting the claimed item looks the same to the owner as deleting
+	// any other item.
+	deleted := state.Clock.Time
+	req := &lspb.DeleteListItemRequest{
+		ListId: strconv.Itoa(list.ID),
+		ItemId: strconv.Itoa(item.ID),
+	}
+	if _, err := state.Server.DeleteListItem(ownerCtx, req); err != nil {
+		t.Fatalf("DeleteListItem(_, %+v) = _, %v, want _, nil", req, err)
+	}
+	version++
+
+	if items := listItems(ownerCtx); len(items) != 1 || items[0].GetData().GetName() != "l1i2" {
+		t.Errorf("owner items = %v, want only l1i2", items)
+	}
+
+	items := listItems(bCtx)
+	if len(items) != 2 || items[0].GetMetadata().GetRemovedByOwner() != deleted.Unix() {
+		t.Errorf("claimer items = %v, want l1i1 removed at %v", items,
+			deleted.Unix())
+	}
+
+	claimReq := &lspb.UpdateListItemRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ItemId:      strconv.Itoa(item.ID),
+		ItemVersion: version,
+		Claim: &lspb.ClaimOperation{
+			Type:  lspb.ClaimOperation_CLAIM,
+			Count: 1,
+		},
+	}
+	if _, err := state.Server.UpdateListItem(bCtx, claimReq); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("UpdateListItem(_, %+v) = _, %v, want _, FailedPrecondition",
+			claimReq, err)
+	}
+
+	// Releasing the claim makes the item go away.
+	update(bCtx, &lspb.UpdateListItemRequest{
+		State: &lspb.ListItemState{Claimed: false},
+	})
+	if items := listItems(bCtx); len(items) != 1 {
+		t.Errorf("claimer items = %v, want only l1i2", items)
+	}
+}
+
+func TestListMyClaims(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i2")
+	bCtx := makeRequestContext(ctx, state, "b")
+	cCtx := makeRequestContext(ctx, state, "c")
+
+	claimReq := &lspb.UpdateListItemRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ItemId:      strconv.Itoa(item.ID),
+		ItemVersion: int32(item.Version),
+		State:       &lspb.ListItemState{Claimed: true},
+	}
+	claimResp, err := state.Server.UpdateListItem(bCtx, claimReq)
+	if err != nil {
+		t.Fatalf("UpdateListItem(_, %+v) = _, %v, want _, nil",
+			claimReq, err)
+	}
+
+	req := &lspb.ListMyClaimsRequest{}
+	resp, err := state.Server.ListMyClaims(bCtx, req)
+	if err != nil {
+		t.Fatalf("ListMyClaims(_, %+v) = _, %v, want _, nil", req, err)
+	}
+
+	wantResp := &lspb.ListMyClaimsResponse{
+		Lists: []*lspb.ClaimedList{
+			{
+				List:  listFromDatabaseList(list),
+				Items: []*lspb.ListItem{claimResp.GetItem()},
+			},
+		},
+	}
+	if diff := cmp.Diff(wantResp, resp, protocmp.Transform()); diff != "" {
+		t.Errorf("ListMyClaims(_, %+v) mismatch; -want,+got:\n%v",
+			req, diff)
+	}
+
+	resp, err = state.Server.ListMyClaims(cCtx, req)
+	if err != nil || len(resp.GetLists()) != 0 {
+		t.Errorf("ListMyClaims(_, %+v) = %v, %v, want [], nil",
+			req, resp, err)
+	}
+
+	// Inactive lists are only returned on request.
+	_, err = state.DB.UpdateList(ctx, list.ID, list.Version, list.OwnerID,
+		state.Clock.Now(), func(listData *database.ListData) error {
+			listData.Active = false
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateList(_, %v) = _, %v, want _, nil", list.ID, err)
+	}
+
+	resp, err = state.Server.ListMyClaims(bCtx, req)
+	if err != nil || len(resp.GetLists()) != 0 {
+		t.Errorf("ListMyClaims(_, %+v) = %v, %v, want [], nil",
+			req, resp, err)
+	}
+
+	req.IncludeInactive = true
+	resp, err = state.Server.ListMyClaims(bCtx, req)
+	if err != nil || len(resp.GetLists()) != 1 {
+		t.Errorf("ListMyClaims(_, %+v) = %v, %v, want 1 list, nil",
+			req, resp, err)
+	}
+}
+
+func TestReorderListItems(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	resp := state.Lists.GetList("l1")
+	list := resp.List
+
+	req := &lspb.ReorderListItemsRequest{
+		ListId:      strconv.Itoa(list.ID),
+		ListVersion: int32(list.Version),
+		ItemIds: []string{
+			strconv.Itoa(resp.ListItems[1].ID),
+			strconv.Itoa(resp.ListItems[0].ID),
+		},
+	}
+
+	nonOwnerCtx := makeRequestContext(ctx, state, "b")
+	if _, err := state.Server.ReorderListItems(nonOwnerCtx, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ReorderListItems(nonowner, %+v) = _, %v, want _, PermissionDenied",
+			req, err)
+	}
+
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	gotResp, err := state.Server.ReorderListItems(ownerCtx, req)
+	if err != nil {
+		t.Fatalf("ReorderListItems(owner, %+v) = _, %v, want _, nil",
+			req, err)
+	}
+
+	if gotResp.GetList().GetVersion() != int32(list.Version+1) {
+		t.Errorf("list version = %v, want %v",
+			gotResp.GetList().GetVersion(), list.Version+1)
+	}
+
+	gotIDs := []string{}
+	for _, item := range gotResp.GetItems() {
+		gotIDs = append(gotIDs, item.GetId())
+	}
+	if diff := cmp.Diff(req.GetItemIds(), gotIDs); diff != "" {
+		t.Errorf("item order diff:\n%v", diff)
+	}
+}
+
+func TestMoveAndCopyListItems(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	resp := state.Lists.GetList("l1")
+	from := resp.List
+	owner := state.Users.UserByUsername("a")
+
+	to, err := state.DB.CreateList(ctx, owner.ID,
+		&database.ListData{Name: "l2", Active: true}, state.Clock.Now())
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	moveReq := &lspb.MoveListItemsRequest{
+		FromListId:      strconv.Itoa(from.ID),
+		FromListVersion: int32(from.Version),
+		ToListId:        strconv.Itoa(to.ID),
+		ToListVersion:   int32(to.Version),
+		ItemIds:         []string{strconv.Itoa(resp.ListItems[1].ID)},
+	}
+
+	nonOwnerCtx := makeRequestContext(ctx, state, "b")
+	if _, err := state.Server.MoveListItems(nonOwnerCtx, moveReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("MoveListItems(nonowner, %+v) = _, %v, want _, PermissionDenied",
+			moveReq, err)
+	}
+
+	badReq := proto.Clone(moveReq).(*lspb.MoveListItemsRequest)
+	badReq.ToListId = "999"
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	if _, err := state.Server.MoveListItems(ownerCtx, badReq); status.Code(err) != codes.NotFound {
+		t.Errorf("MoveListItems(owner, %+v) = _, %v, want _, NotFound",
+			badReq, err)
+	}
+
+	moveResp, err := state.Server.MoveListItems(ownerCtx, moveReq)
+	if err != nil {
+		t.Fatalf("MoveListItems(owner, %+v) = _, %v, want _, nil",
+			moveReq, err)
+	}
+	if len(moveResp.GetFromItems()) != 1 || len(moveResp.GetToItems()) != 1 ||
+		moveResp.GetToItems()[0].GetId() != moveReq.GetItemIds()[0] {
+		t.Errorf("MoveListItems(owner, %+v) = %v, want item moved",
+			moveReq, moveResp)
+	}
+
+	copyReq := &lspb.CopyListItemsRequest{
+		FromListId:    strconv.Itoa(from.ID),
+		ToListId:      strconv.Itoa(to.ID),
+		ToListVersion: moveResp.GetToList().GetVersion(),
+		ItemIds:       []string{strconv.Itoa(resp.ListItems[0].ID)},
+	}
+	copyResp, err := state.Server.CopyListItems(ownerCtx, copyReq)
+	if err != nil {
+		t.Fatalf("CopyListItems(owner, %+v) = _, %v, want _, nil",
+			copyReq, err)
+	}
+
+	gotNames := []string{}
+	for _, item := range copyResp.GetToItems() {
+		gotNames = append(gotNames, item.GetData().GetName())
+	}
+	if want := []string{"l1i2", "l1i1"}; !cmp.Equal(want, gotNames) {
+		t.Errorf("CopyListItems(owner, %+v) items = %v, want %v",
+			copyReq, gotNames, want)
+	}
+	if copyResp.GetToItems()[1].GetId() == copyReq.GetItemIds()[0] {
+		t.Errorf("copy has the original's ID %v", copyReq.GetItemIds()[0])
+	}
+}
+
+func TestBatchUpdateListItems(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	resp := state.Lists.GetList("l1")
+	item1, item2 := resp.ListItems[0], resp.ListItems[1]
+
+	req := &lspb.BatchUpdateListItemsRequest{
+		ListId: strconv.Itoa(resp.List.ID),
+		Ops: []*lspb.ItemOperation{
+			{Op: &lspb.ItemOperation_Create_{
+				Create: &lspb.ItemOperation_Create{
+					Data: &lspb.ListItemData{Name: "new"},
+				},
+			}},
+			{Op: &lspb.ItemOperation_Update_{
+				Update: &lspb.ItemOperation_Update{
+					ItemId:      strconv.Itoa(item1.ID),
+					ItemVersion: int32(item1.Version),
+					Data:        &lspb.ListItemData{Name: "renamed"},
+				},
+			}},
+			{Op: &lspb.ItemOperation_Delete_{
+				Delete: &lspb.ItemOperation_Delete{
+					ItemId:      strconv.Itoa(item2.ID),
+					ItemVersion: int32(item2.Version),
+				},
+			}},
+		},
+	}
+
+	nonOwnerCtx := makeRequestContext(ctx, state, "b")
+	if _, err := state.Server.BatchUpdateListItems(nonOwnerCtx, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("BatchUpdateListItems(nonowner) = _, %v, want _, PermissionDenied",
+			err)
+	}
+
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	for _, tc := range []struct {
+		name      string
+		mutate    func(req *lspb.BatchUpdateListItemsRequest)
+		wantCode  codes.Code
+		wantMsg   string
+		wantField string
+	}{
+		{
+			name: "invalid data",
+			mutate: func(req *lspb.BatchUpdateListItemsRequest) {
+				req.Ops[1].GetUpdate().Data.Name = ""
+			},
+			wantCode:  codes.InvalidArgument,
+			wantMsg:   "operation 1:",
+			wantField: "ops[1]",
+		},
+		{
+			name: "stale version",
+			mutate: func(req *lspb.BatchUpdateListItemsRequest) {
+				req.Ops[2].GetDelete().ItemVersion++
+			},
+			wantCode:  codes.FailedPrecondition,
+			wantMsg:   "operation 2:",
+			wantField: "ops[2]",
+		},
+		{
+			name: "empty op",
+			mutate: func(req *lspb.BatchUpdateListItemsRequest) {
+				req.Ops = append(req.Ops, &lspb.ItemOperation{})
+			},
+			wantCode:  codes.InvalidArgument,
+			wantMsg:   "operation 3:",
+			wantField: "ops[3]",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			badReq := proto.Clone(req).(*lspb.BatchUpdateListItemsRequest)
+			tc.mutate(badReq)
+			_, err := state.Server.BatchUpdateListItems(ownerCtx, badReq)
+			if status.Code(err) != tc.wantCode ||
+				!strings.HasPrefix(status.Convert(err).Message(), tc.wantMsg) {
+				t.Errorf("BatchUpdateListItems() = _, %v, want %v %q...",
+					err, tc.wantCode, tc.wantMsg)
+			}
+
+			var fields []string
+			for _, detail := range status.Convert(err).Details() {
+				if badReq, ok := detail.(*errdetails.BadRequest); ok {
+					for _, v := range badReq.GetFieldViolations() {
+						fields = append(fields, v.GetField())
+					}
+				}
+			}
+			if len(fields) != 1 || fields[0] != tc.wantField {
+				t.Errorf("BatchUpdateListItems() violations = %v, want %v",
+					fields, tc.wantField)
+			}
+		})
+	}
+
+	// The failed batches didn't change anything.
+	listResp, err := state.Server.ListListItems(ownerCtx,
+		&lspb.ListListItemsRequest{ListId: req.GetListId()})
+	if err != nil || len(listResp.GetItems()) != 2 {
+		t.Fatalf("ListListItems() = %v, %v, want 2 items", listResp, err)
+	}
+
+	batchResp, err := state.Server.BatchUpdateListItems(ownerCtx, req)
+	if err != nil {
+		t.Fatalf("BatchUpdateListItems() = _, %v, want _, nil", err)
+	}
+
+	results := batchResp.GetResults()
+	if len(results) != 3 ||
+		results[0].GetItem().GetData().GetName() != "new" ||
+		results[1].GetItem().GetData().GetName() != "renamed" ||
+		results[2].GetDeletedItemId() != strconv.Itoa(item2.ID) {
+		t.Errorf("BatchUpdateListItems() = %v, want created, renamed, deleted",
+			batchResp)
+	}
+}
@@ -0,0 +1,160 @@
+package listservice
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func mergeOutcome(merged bool) lspb.OfflineMutationResult_Outcome {
+	if merged {
+		return lspb.OfflineMutationResult_MERGED
+	}
+	return lspb.OfflineMutationResult_APPLIED
+}
+
+func (s *listServer) applyOfflineMutation(ctx context.Context, userID int, mutation *lspb.OfflineMutation, now time.Time) (*lspb.OfflineMutationResult, error) {
+	listID, err := strconv.Atoi(mutation.GetListId())
+	if mutation.GetListId() == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid list id")
+	}
+
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID != userID {
+		return nil, errNotOwner()
+	}
+
+	if pbData := mutation.GetListData(); pbData != nil {
+		if mutation.GetListVersion() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"missing list version")
+		}
+		if !validPrice(pbData.GetBudget(), pbData.GetBudgetCurrency()) {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"invalid budget")
+		}
+
+		list, merged, err := s.db.MergeList(ctx, listID,
+			int(mutation.GetListVersion()), userID, now,
+			func(listData *database.ListData) error {
+				return setListData(listData, pbData)
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		return &lspb.OfflineMutationResult{
+			Outcome: mergeOutcome(merged),
+			List:    listFromDatabaseList(list),
+		}, nil
+	}
+
+	if mutation.GetItemOp() == nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"empty mutation")
+	}
+
+	if !list.Active {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"list is not active")
+	}
+
+	op, err := itemOperationFromProto(mutation.GetItemOp(), list)
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Create != nil {
+		item, err := s.db.CreateListItem(ctx, listID, userID, op.Create,
+			now)
+		if err != nil {
+			return nil, err
+		}
+		return &lspb.OfflineMutationResult{
+			Outcome: lspb.OfflineMutationResult_APPLIED,
+			Item:    itemFromDatabaseItem(item, userID),
+		}, nil
+	}
+
+	update := op.Update
+	if op.Delete {
+		update = func(data *database.ListItemData, state *database.ListItemState) error {
+			state.Deleted = now
+			return nil
+		}
+	}
+
+	item, merged, err := s.db.MergeListItem(ctx, listID, op.ItemID,
+		op.ItemVersion, userID, now, update)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &lspb.OfflineMutationResult{Outcome: mergeOutcome(merged)}
+	if op.Delete {
+		result.DeletedItemId = strconv.Itoa(item.ID)
+	} else {
+		result.Item = itemFromDatabaseItem(item, userID)
+	}
+	return result, nil
+}
+
+// ApplyOfflineMutations applies changes that a list owner made while
+// offline. Changes made against old versions are merged with the changes
+// made since, unless both changed the same fields, in which case the
+// conflict is reported along with the current list or item.
+func (s *listServer) ApplyOfflineMutations(ctx context.Context, req *lspb.ApplyOfflineMutationsRequest) (*lspb.ApplyOfflineMutationsResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if len(req.GetMutations()) == 0 || len(req.GetMutations()) > maxBatchOps {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"need between 1 and %d mutations", maxBatchOps)
+	}
+
+	now := s.clock.Now()
+	resp := &lspb.ApplyOfflineMutationsResponse{}
+	for _, mutation := range req.GetMutations() {
+		result, err := s.applyOfflineMutation(ctx, session.User.ID,
+			mutation, now)
+
+		var conflict *database.ConflictError
+		if errors.As(err, &conflict) {
+			result = &lspb.OfflineMutationResult{
+				Outcome:           lspb.OfflineMutationResult_CONFLICT,
+				ConflictingFields: conflict.Fields,
+			}
+			if conflict.List != nil {
+				result.List = listFromDatabaseList(conflict.List)
+			}
+			if conflict.Item != nil {
+				result.Item = itemFromDatabaseItem(conflict.Item,
+					session.User.ID)
+			}
+		} else if err != nil {
+			result = &lspb.OfflineMutationResult{
+				Outcome: lspb.OfflineMutationResult_FAILED,
+				Error:   status.Convert(err).Message(),
+			}
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,228 @@
+package listservice
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestApplyOfflineMutations(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list := state.Lists.GetList("l1").List
+	_, item1 := state.Lists.GetItem("l1", "l1i1")
+	_, item2 := state.Lists.GetItem("l1", "l1i2")
+	listID := strconv.Itoa(list.ID)
+	item1ID, item2ID := strconv.Itoa(item1.ID), strconv.Itoa(item2.ID)
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	giverCtx := makeRequestContext(ctx, state, "b")
+
+	// The owner renames item1 from another device while the offline
+	// changes are queued.
+	_, err := state.Server.UpdateListItem(ownerCtx, &lspb.UpdateListItemRequest{
+		ListId:      listID,
+		ItemId:      item1ID,
+		ItemVersion: int32(item1.Version),
+		Data:        &lspb.ListItemData{Name: "online", Desc: item1.Desc, Url: item1.URL},
+	})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+
+	updateItem1 := func(name, desc string) *lspb.OfflineMutation {
+		return &lspb.OfflineMutation{
+			ListId: listID,
+			Mutation: &lspb.OfflineMutation_ItemOp{
+				ItemOp: &lspb.ItemOperation{
+					Op: &lspb.ItemOperation_Update_{
+						Update: &lspb.ItemOperation_Update{
+							ItemId:      item1ID,
+							ItemVersion: int32(item1.Version),
+							Data: &lspb.ListItemData{
+								Name: name,
+								Desc: desc,
+								Url:  item1.URL,
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	req := &lspb.ApplyOfflineMutationsRequest{
+		Mutations: []*lspb.OfflineMutation{
+			updateItem1(item1.Name, "offline desc"),
+			updateItem1("offline", item1.Desc),
+			{
+				ListId: listID,
+				Mutation: &lspb.OfflineMutation_ItemOp{
+					ItemOp: &lspb.ItemOperation{
+						Op: &lspb.ItemOperation_Create_{
+							Create: &lspb.ItemOperation_Create{
+								Data: &lspb.ListItemData{Name: "new"},
+							},
+						},
+					},
+				},
+			},
+			{
+				ListId: listID,
+				Mutation: &lspb.OfflineMutation_ItemOp{
+					ItemOp: &lspb.ItemOperation{
+						Op: &lspb.ItemOperation_Delete_{
+							Delete: &lspb.ItemOperation_Delete{
+								ItemId:      item2ID,
+								ItemVersion: int32(item2.Version),
+							},
+						},
+					},
+				},
+			},
+			{
+				ListId:      listID,
+				ListVersion: int32(list.Version),
+				Mutation: &lspb.OfflineMutation_ListData{
+					ListData: &lspb.ListData{Beneficiary: "offline"},
+				},
+			},
+			{
+				ListId: "999",
+				Mutation: &lspb.OfflineMutation_ListData{
+					ListData: &lspb.ListData{Name: "missing"},
+				},
+			},
+		},
+	}
+
+	resp, err := state.Server.ApplyOfflineMutations(ownerCtx, req)
+	if err != nil {
+		t.Fatalf("ApplyOfflineMutations() = _, %v, want _, nil", err)
+	}
+
+	var outcomes []lspb.OfflineMutationResult_Outcome
+	for _, result := range resp.GetResults() {
+		outcomes = append(outcomes, result.GetOutcome())
+	}
+	wantOutcomes := []lspb.OfflineMutationResult_Outcome{
+		lspb.OfflineMutationResult_MERGED,
+		lspb.OfflineMutationResult_CONFLICT,
+		lspb.OfflineMutationResult_APPLIED,
+		lspb.OfflineMutationResult_APPLIED,
+		lspb.OfflineMutationResult_APPLIED,
+		lspb.OfflineMutationResult_FAILED,
+	}
+	if diff := cmp.Diff(wantOutcomes, outcomes); diff != "" {
+		t.Fatalf("ApplyOfflineMutations() outcomes mismatch; -want,+got:\n%s\n%v",
+			diff, resp)
+	}
+
+	results := resp.GetResults()
+	if got := results[0].GetItem().GetData(); got.GetName() != "online" || got.GetDesc() != "offline desc" {
+		t.Errorf("merged item data = %v, want online name, offline desc", got)
+	}
+
+	conflict := results[1]
+	if !cmp.Equal([]string{"name"}, conflict.GetConflictingFields()) ||
+		conflict.GetItem().GetData().GetDesc() != "offline desc" {
+		t.Errorf("conflict = %v, want name conflict with current item",
+			conflict)
+	}
+
+	if results[2].GetItem().GetData().GetName() != "new" {
+		t.Errorf("create result = %v, want new item", results[2])
+	}
+	if results[3].GetDeletedItemId() != item2ID {
+		t.Errorf("delete result = %v, want deleted %v", results[3], item2ID)
+	}
+	if results[4].GetList().GetData().GetBeneficiary() != "offline" {
+		t.Errorf("list result = %v, want new beneficiary", results[4])
+	}
+	if results[5].GetError() == "" {
+		t.Errorf("missing list result = %v, want error", results[5])
+	}
+
+	// Only owners can queue changes.
+	resp, err = state.Server.ApplyOfflineMutations(giverCtx,
+		&lspb.ApplyOfflineMutationsRequest{
+			Mutations: []*lspb.OfflineMutation{
+				updateItem1("giver", item1.Desc),
+			},
+		})
+	if err != nil || len(resp.GetResults()) != 1 ||
+		resp.GetResults()[0].GetOutcome() != lspb.OfflineMutationResult_FAILED {
+		t.Errorf("ApplyOfflineMutations(giver) = %v, %v, want failure",
+			resp, err)
+	}
+
+	_, err = state.Server.ApplyOfflineMutations(ownerCtx,
+		&lspb.ApplyOfflineMutationsRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ApplyOfflineMutations(empty) = _, %v, want InvalidArgument",
+			err)
+	}
+
+	// Items on inactive lists can't be changed, even offline.
+	listResp, err := state.Server.GetList(ownerCtx,
+		&lspb.GetListRequest{ListId: listID})
+	if err != nil {
+		t.Fatalf("GetList() = _, %v, want _, nil", err)
+	}
+	_, err = state.Server.ChangeActiveState(ownerCtx,
+		&lspb.ChangeActiveStateRequest{
+			ListId:      listID,
+			ListVersion: listResp.GetList().GetVersion(),
+			NewState:    false,
+		})
+	if err != nil {
+		t.Fatalf("ChangeActiveState() = _, %v, want _, nil", err)
+	}
+
+	resp, err = state.Server.ApplyOfflineMutations(ownerCtx,
+		&lspb.ApplyOfflineMutationsRequest{
+			Mutations: []*lspb.OfflineMutation{
+				{
+					ListId: listID,
+					Mutation: &lspb.OfflineMutation_ItemOp{
+						ItemOp: &lspb.ItemOperation{
+							Op: &lspb.ItemOperation_Create_{
+								Create: &lspb.ItemOperation_Create{
+									Data: &lspb.ListItemData{Name: "inactive"},
+								},
+							},
+						},
+					},
+				},
+				{
+					ListId: listID,
+					Mutation: &lspb.OfflineMutation_ItemOp{
+						ItemOp: &lspb.ItemOperation{
+							Op: &lspb.ItemOperation_Delete_{
+								Delete: &lspb.ItemOperation_Delete{
+									ItemId:      item1ID,
+									ItemVersion: int32(item1.Version),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	if err != nil || len(resp.GetResults()) != 2 {
+		t.Fatalf("ApplyOfflineMutations(inactive) = %v, %v, want 2 results, nil",
+			resp, err)
+	}
+	for i, result := range resp.GetResults() {
+		if result.GetOutcome() != lspb.OfflineMutationResult_FAILED ||
+			result.GetError() != "list is not active" {
+			t.Errorf("ApplyOfflineMutations(inactive) result %d = %v, want inactive failure",
+				i, result)
+		}
+	}
+}
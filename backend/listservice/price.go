@@ -0,0 +1,106 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/sessions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// getVisibleItem parses and checks the IDs of an item the caller wants to
+// look at.
+func (s *listServer) getVisibleItem(ctx context.Context, session *sessions.Session, listIDStr, itemIDStr string) (*database.List, *database.ListItem, error) {
+	listID, err := strconv.Atoi(listIDStr)
+	if listIDStr == "" || err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument,
+			"invalid list id")
+	}
+
+	itemID, err := strconv.Atoi(itemIDStr)
+	if itemIDStr == "" || err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument,
+			"invalid item id")
+	}
+
+	list, err := dbutil.GetList(ctx, s.db, listID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	item, err := dbutil.GetListItem(ctx, s.db, listID, itemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !item.VisibleTo(session.User.ID) {
+		return nil, nil, status.Errorf(codes.NotFound,
+			"no item with ID %v", itemID)
+	}
+
+	return list, item, nil
+}
+
+func (s *listServer) GetItemPriceHistory(ctx context.Context, req *lspb.GetItemPriceHistoryRequest) (*lspb.GetItemPriceHistoryResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	_, item, err := s.getVisibleItem(ctx, session, req.GetListId(),
+		req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := s.db.GetItemPriceHistory(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.GetItemPriceHistoryResponse{}
+	for _, point := range points {
+		resp.Points = append(resp.Points, &lspb.PricePoint{
+			When:     point.When.Unix(),
+			Price:    point.Price,
+			Currency: point.Currency,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *listServer) SetPriceAlert(ctx context.Context, req *lspb.SetPriceAlertRequest) (*lspb.SetPriceAlertResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	list, item, err := s.getVisibleItem(ctx, session, req.GetListId(),
+		req.GetItemId())
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID == session.User.ID {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"price alerts are for givers")
+	}
+
+	if req.GetThreshold() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid threshold")
+	}
+
+	err = s.db.SetPriceAlert(ctx, item.ID, session.User.ID,
+		req.GetThreshold())
+	if err != nil {
+		return nil, err
+	}
+
+	return &lspb.SetPriceAlertResponse{}, nil
+}
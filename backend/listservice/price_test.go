@@ -0,0 +1,83 @@
+package listservice
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+func TestItemPrices(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	listID, itemID := strconv.Itoa(list.ID), strconv.Itoa(item.ID)
+
+	for i, price := range []int64{2000, 1500} {
+		point := &database.PricePoint{
+			When:     time.Unix(int64(100+i), 0),
+			Price:    price,
+			Currency: "USD",
+		}
+		if err := state.DB.RecordPriceCheck(ctx, item.ID, point.When, point, nil); err != nil {
+			t.Fatalf("RecordPriceCheck() = %v", err)
+		}
+	}
+
+	histReq := &lspb.GetItemPriceHistoryRequest{ListId: listID, ItemId: itemID}
+	resp, err := state.Server.GetItemPriceHistory(
+		makeRequestContext(ctx, state, "b"), histReq)
+	if err != nil {
+		t.Fatalf("GetItemPriceHistory(_, %v) = _, %v, want _, nil",
+			histReq, err)
+	}
+
+	want := &lspb.GetItemPriceHistoryResponse{
+		Points: []*lspb.PricePoint{
+			&lspb.PricePoint{When: 100, Price: 2000, Currency: "USD"},
+			&lspb.PricePoint{When: 101, Price: 1500, Currency: "USD"},
+		},
+	}
+	if diff := cmp.Diff(want, resp, protocmp.Transform()); diff != "" {
+		t.Errorf("GetItemPriceHistory(_, %v) mismatch; -want,+got:\n%v",
+			histReq, diff)
+	}
+
+	histReq = &lspb.GetItemPriceHistoryRequest{ListId: listID, ItemId: "999"}
+	if _, err := state.Server.GetItemPriceHistory(makeRequestContext(ctx, state, "b"), histReq); status.Code(err) != codes.NotFound {
+		t.Errorf("GetItemPriceHistory(_, %v) = _, %v, want NotFound",
+			histReq, err)
+	}
+
+	alertReq := &lspb.SetPriceAlertRequest{ListId: listID, ItemId: itemID,
+		Threshold: 1000}
+	if _, err := state.Server.SetPriceAlert(makeRequestContext(ctx, state, "a"), alertReq); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("SetPriceAlert(owner, %v) = _, %v, want PermissionDenied",
+			alertReq, err)
+	}
+	if _, err := state.Server.SetPriceAlert(makeRequestContext(ctx, state, "b"), alertReq); err != nil {
+		t.Errorf("SetPriceAlert(_, %v) = _, %v, want _, nil", alertReq, err)
+	}
+
+	alerts, err := state.DB.ListPriceAlerts(ctx, item.ID)
+	userB := state.Users.UserByUsername("b")
+	if err != nil || len(alerts) != 1 || alerts[0].UserID != userB.ID ||
+		alerts[0].Threshold != 1000 {
+		t.Errorf("ListPriceAlerts() = %v, %v, want b's at 1000", alerts,
+			err)
+	}
+
+	alertReq.Threshold = -1
+	if _, err := state.Server.SetPriceAlert(makeRequestContext(ctx, state, "b"), alertReq); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetPriceAlert(_, %v) = _, %v, want InvalidArgument",
+			alertReq, err)
+	}
+}
@@ -0,0 +1,69 @@
+package listservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// unfurlError converts an unfurling failure into something suitable for the
+// client. Network errors are summarized, as their details describe our
+// network rather than the user's request.
+func unfurlError(err error) error {
+	var blocked *unfurl.ErrBlockedAddress
+	var notHTML *unfurl.ErrNotHTML
+
+	switch {
+	case errors.As(err, &blocked):
+		return status.Errorf(codes.InvalidArgument, "URL not allowed")
+	case errors.As(err, &notHTML):
+		return status.Errorf(codes.InvalidArgument, "%v", notHTML)
+	case errors.Is(err, context.Canceled):
+		return status.Errorf(codes.Canceled, "request cancelled")
+	default:
+		logger.Infof("unfurl failed: %v", err)
+		return status.Errorf(codes.Unavailable, "failed to fetch URL")
+	}
+}
+
+func (s *listServer) UnfurlURL(ctx context.Context, req *lspb.UnfurlURLRequest) (*lspb.UnfurlURLResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if s.unfurler == nil {
+		return nil, status.Errorf(codes.Unimplemented,
+			"URL unfurling is disabled")
+	}
+
+	if _, err := unfurl.ParseURL(req.GetUrl()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid url: %v", err)
+	}
+
+	preview, err := s.unfurler.Unfurl(ctx, req.GetUrl())
+	if err != nil {
+		return nil, unfurlError(err)
+	}
+
+	suggestion := &lspb.ListItemData{
+		Name: preview.Title,
+		Desc: preview.Description,
+		Url:  req.GetUrl(),
+	}
+	if validPrice(preview.Price, preview.Currency) {
+		suggestion.Price = preview.Price
+		suggestion.Currency = preview.Currency
+	}
+
+	return &lspb.UnfurlURLResponse{
+		Suggestion: suggestion,
+		ImageUrl:   preview.ImageURL,
+	}, nil
+}
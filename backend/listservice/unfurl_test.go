@@ -0,0 +1,110 @@
+package listservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+type fakeFetcher map[string]*unfurl.Page
+
+func (f fakeFetcher) Fetch(ctx context.Context, rawURL string) (*unfurl.Page, error) {
+	if rawURL == "http://internal.example.com/" {
+		return nil, &url.Error{Op: "Get", URL: rawURL,
+			Err: &unfurl.ErrBlockedAddress{IP: net.ParseIP("10.0.0.1")}}
+	}
+
+	page, found := f[rawURL]
+	if !found {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return page, nil
+}
+
+func TestUnfurlURL(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	pageURL, _ := url.Parse("https://shop.example.com/widget")
+	fetcher := fakeFetcher{
+		"https://shop.example.com/widget": &unfurl.Page{
+			URL:         pageURL,
+			ContentType: "text/html",
+			Body: []byte(`<title>Widget</title>
+			    <meta property="og:image" content="/w.jpg">
+			    <meta property="product:price:amount" content="12.50">
+			    <meta property="product:price:currency" content="USD">`),
+		},
+		"https://shop.example.com/bad-price": &unfurl.Page{
+			URL:         pageURL,
+			ContentType: "text/html",
+			Body: []byte(`<title>Widget</title>
+			    <meta property="product:price:amount" content="12.50">
+			    <meta property="product:price:currency" content="dollars">`),
+		},
+		"https://shop.example.com/w.jpg": &unfurl.Page{
+			URL:         pageURL,
+			ContentType: "image/jpeg",
+		},
+	}
+	state.Server.unfurler = unfurl.New(fetcher, state.Clock, time.Hour)
+
+	reqCtx := makeRequestContext(ctx, state, "a")
+
+	req := &lspb.UnfurlURLRequest{Url: "https://shop.example.com/widget"}
+	resp, err := state.Server.UnfurlURL(reqCtx, req)
+	if err != nil {
+		t.Fatalf("UnfurlURL(_, %v) = _, %v, want _, nil", req, err)
+	}
+
+	want := &lspb.UnfurlURLResponse{
+		Suggestion: &lspb.ListItemData{
+			Name:     "Widget",
+			Url:      "https://shop.example.com/widget",
+			Price:    1250,
+			Currency: "USD",
+		},
+		ImageUrl: "https://shop.example.com/w.jpg",
+	}
+	if diff := cmp.Diff(want, resp, protocmp.Transform()); diff != "" {
+		t.Errorf("UnfurlURL(_, %v) mismatch; -want,+got:\n%v", req, diff)
+	}
+
+	req = &lspb.UnfurlURLRequest{Url: "https://shop.example.com/bad-price"}
+	resp, err = state.Server.UnfurlURL(reqCtx, req)
+	if err != nil || resp.GetSuggestion().GetPrice() != 0 ||
+		resp.GetSuggestion().GetCurrency() != "" {
+		t.Errorf("UnfurlURL(_, %v) = %v, %v, want no price", req, resp,
+			err)
+	}
+
+	type errorTestCase struct {
+		url  string
+		want codes.Code
+	}
+
+	for _, tc := range []errorTestCase{
+		{"", codes.InvalidArgument},
+		{"file:///etc/passwd", codes.InvalidArgument},
+		{"http://internal.example.com/", codes.InvalidArgument},
+		{"https://shop.example.com/w.jpg", codes.InvalidArgument},
+		{"https://unreachable.example.com/", codes.Unavailable},
+	} {
+		req := &lspb.UnfurlURLRequest{Url: tc.url}
+		if _, err := state.Server.UnfurlURL(reqCtx, req); status.Code(err) != tc.want {
+			t.Errorf("UnfurlURL(_, %v) = _, %v, want _, %v", req,
+				err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package listservice
+
+import (
+	"strconv"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// watchResponse converts an item event for viewerID. Items the viewer can't
+// see, like deleted items they haven't claimed, are reported as deleted.
+func watchResponse(event *database.ItemEvent, viewerID int) *lspb.WatchListResponse {
+	resp := &lspb.WatchListResponse{
+		ItemId: strconv.Itoa(event.Item.ID),
+	}
+
+	if event.Type == database.ItemDeleted || !event.Item.VisibleTo(viewerID) {
+		resp.Type = lspb.WatchListResponse_DELETED
+		return resp
+	}
+
+	resp.Type = lspb.WatchListResponse_UPDATED
+	if event.Type == database.ItemCreated {
+		resp.Type = lspb.WatchListResponse_CREATED
+	}
+	resp.Item = itemFromDatabaseItem(event.Item, viewerID)
+	return resp
+}
+
+// WatchList streams changes to a list's items until the client goes away.
+// Watchers that fall behind are cut off with Aborted, after which they
+// should reload the list and watch again.
+func (s *listServer) WatchList(req *lspb.WatchListRequest, stream lspb.ListService_WatchListServer) error {
+	ctx := stream.Context()
+	session, err := getSession(ctx)
+	if session == nil {
+		return err
+	}
+
+	if s.hub == nil {
+		return status.Errorf(codes.Unimplemented,
+			"watching is disabled")
+	}
+
+	listID, err := strconv.Atoi(req.GetListId())
+	if req.GetListId() == "" || err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid list id")
+	}
+
+	if _, err := dbutil.GetList(ctx, s.db, listID); err != nil {
+		return err
+	}
+
+	sub := s.hub.Subscribe(listID)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+
+		case event, ok := <-sub.C:
+			if !ok {
+				return status.Errorf(codes.Aborted,
+					"watcher fell behind")
+			}
+
+			if err := stream.Send(watchResponse(event, session.User.ID)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package listservice
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/hub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// fakeWatchStream passes WatchList responses to a channel.
+type fakeWatchStream struct {
+	grpc.ServerStream
+
+	ctx   context.Context
+	resps chan *lspb.WatchListResponse
+}
+
+func (s *fakeWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchStream) Send(resp *lspb.WatchListResponse) error {
+	s.resps <- resp
+	return nil
+}
+
+type watcher struct {
+	stream *fakeWatchStream
+	cancel func()
+	done   chan error
+}
+
+func startWatching(server *listServer, ctx context.Context, listID string) *watcher {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{
+		stream: &fakeWatchStream{
+			ctx:   ctx,
+			resps: make(chan *lspb.WatchListResponse, 10),
+		},
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+
+	id, _ := strconv.Atoi(listID)
+	before := server.hub.NumSubscribers(id)
+	go func() {
+		w.done <- server.WatchList(&lspb.WatchListRequest{ListId: listID}, w.stream)
+	}()
+
+	for server.hub.NumSubscribers(id) == before {
+		time.Sleep(time.Millisecond)
+	}
+	return w
+}
+
+func (w *watcher) next(t *testing.T) *lspb.WatchListResponse {
+	t.Helper()
+	select {
+	case resp := <-w.stream.resps:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for watch event")
+		return nil
+	}
+}
+
+func TestWatchList(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	state.Server.hub = hub.New(hub.DefaultBuffer)
+	state.DB.SetItemListener(state.Server.hub.Publish)
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	listID, itemID := strconv.Itoa(list.ID), strconv.Itoa(item.ID)
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	giverCtx := makeRequestContext(ctx, state, "b")
+
+	req := &lspb.WatchListRequest{ListId: "999"}
+	stream := &fakeWatchStream{ctx: ownerCtx}
+	if err := state.Server.WatchList(req, stream); status.Code(err) != codes.NotFound {
+		t.Errorf("WatchList(%v) = %v, want NotFound", req, err)
+	}
+
+	ownerWatch := startWatching(state.Server, ownerCtx, listID)
+	giverWatch := startWatching(state.Server, giverCtx, listID)
+
+	claimResp, err := state.Server.UpdateListItem(giverCtx,
+		&lspb.UpdateListItemRequest{
+			ListId:      listID,
+			ItemId:      itemID,
+			ItemVersion: int32(item.Version),
+			State:       &lspb.ListItemState{Claimed: true},
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(claim) = _, %v, want _, nil", err)
+	}
+
+	for _, w := range []*watcher{ownerWatch, giverWatch} {
+		resp := w.next(t)
+		if resp.GetType() != lspb.WatchListResponse_UPDATED ||
+			resp.GetItem().GetVersion() != claimResp.GetItem().GetVersion() {
+			t.Errorf("claim event = %v, want update to version %v",
+				resp, claimResp.GetItem().GetVersion())
+		}
+	}
+
+	// The claimed item sticks around for its claimer, but the owner
+	// sees it go away.
+	_, err = state.Server.DeleteListItem(ownerCtx,
+		&lspb.DeleteListItemRequest{ListId: listID, ItemId: itemID})
+	if err != nil {
+		t.Fatalf("DeleteListItem() = _, %v, want _, nil", err)
+	}
+
+	if resp := ownerWatch.next(t); resp.GetType() != lspb.WatchListResponse_DELETED ||
+		resp.GetItemId() != itemID || resp.GetItem() != nil {
+		t.Errorf("owner delete event = %v, want delete of %v", resp, itemID)
+	}
+	if resp := giverWatch.next(t); resp.GetType() != lspb.WatchListResponse_UPDATED ||
+		resp.GetItem().GetMetadata().GetRemovedByOwner() == 0 {
+		t.Errorf("giver delete event = %v, want update with removal", resp)
+	}
+
+	createResp, err := state.Server.CreateListItem(ownerCtx,
+		&lspb.CreateListItemRequest{
+			ListId: listID,
+			Data:   &lspb.ListItemData{Name: "new"},
+		})
+	if err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+	for _, w := range []*watcher{ownerWatch, giverWatch} {
+		if resp := w.next(t); resp.GetType() != lspb.WatchListResponse_CREATED ||
+			resp.GetItemId() != createResp.GetItem().GetId() {
+			t.Errorf("create event = %v, want create of %v", resp,
+				createResp.GetItem().GetId())
+		}
+	}
+
+	// Moving the new item to the top only changes its position.
+	_, item2 := state.Lists.GetItem("l1", "l1i2")
+	_, err = state.Server.ReorderListItems(ownerCtx,
+		&lspb.ReorderListItemsRequest{
+			ListId:      listID,
+			ListVersion: int32(list.Version),
+			ItemIds: []string{createResp.GetItem().GetId(),
+				strconv.Itoa(item2.ID)},
+		})
+	if err != nil {
+		t.Fatalf("ReorderListItems() = _, %v, want _, nil", err)
+	}
+	for _, w := range []*watcher{ownerWatch, giverWatch} {
+		if resp := w.next(t); resp.GetType() != lspb.WatchListResponse_UPDATED ||
+			resp.GetItemId() != createResp.GetItem().GetId() ||
+			resp.GetItem().GetMetadata().GetPosition() != 1 {
+			t.Errorf("reorder event = %v, want update of %v to position 1",
+				resp, createResp.GetItem().GetId())
+		}
+	}
+
+	for _, w := range []*watcher{ownerWatch, giverWatch} {
+		w.cancel()
+		if err := <-w.done; status.Code(err) != codes.Canceled {
+			t.Errorf("WatchList() = %v, want Canceled", err)
+		}
+	}
+	if n := state.Server.hub.NumSubscribers(list.ID); n != 0 {
+		t.Errorf("NumSubscribers() = %v, want 0", n)
+	}
+}
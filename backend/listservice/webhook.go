@@ -0,0 +1,355 @@
+package listservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/sessions"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"github.com/simmonmt/xmaslist/backend/webhooks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+var webhookEventToDatabase = map[lspb.Webhook_Event]database.WebhookEvent{
+	lspb.Webhook_LIST_CREATED: database.WebhookListCreated,
+	lspb.Webhook_LIST_UPDATED: database.WebhookListUpdated,
+	lspb.Webhook_ITEM_CREATED: database.WebhookItemCreated,
+	lspb.Webhook_ITEM_UPDATED: database.WebhookItemUpdated,
+	lspb.Webhook_ITEM_DELETED: database.WebhookItemDeleted,
+}
+
+func webhookFromDatabaseWebhook(hook *database.Webhook) *lspb.Webhook {
+	out := &lspb.Webhook{
+		Id:      strconv.Itoa(hook.ID),
+		Owner:   int32(hook.OwnerID),
+		Url:     hook.URL,
+		Created: hook.Created.Unix(),
+	}
+	if hook.ListID != 0 {
+		out.ListId = strconv.Itoa(hook.ListID)
+	}
+	for _, event := range hook.Events {
+		for pbEvent, dbEvent := range webhookEventToDatabase {
+			if dbEvent == event {
+				out.Events = append(out.Events, pbEvent)
+			}
+		}
+	}
+	return out
+}
+
+func webhookDeliveryFromDatabaseDelivery(d *database.WebhookDelivery) *lspb.WebhookDelivery {
+	out := &lspb.WebhookDelivery{
+		Id:        strconv.Itoa(d.ID),
+		WebhookId: strconv.Itoa(d.WebhookID),
+		Event:     string(d.Event),
+		ListId:    strconv.Itoa(d.ListID),
+		Attempts:  int32(d.Attempts),
+		LastError: d.LastError,
+	}
+	if d.ItemID != 0 {
+		out.ItemId = strconv.Itoa(d.ItemID)
+	}
+	if d.Attempts > 0 && d.Delivered.IsZero() && d.Failed.IsZero() {
+		out.NextAttempt = d.NextAttempt.Unix()
+	}
+	if !d.Delivered.IsZero() {
+		out.Delivered = d.Delivered.Unix()
+	}
+	if !d.Failed.IsZero() {
+		out.Failed = d.Failed.Unix()
+	}
+	return out
+}
+
+// renderWebhookPayload returns the payload for a change to a list or item,
+// rendered for the webhook's owner with the same claim redaction as the
+// API. Items the owner can't see are reported as deleted.
+func renderWebhookPayload(ctx context.Context, db *database.DB, hook *database.Webhook, deliveryID int, event database.WebhookEvent, listID, itemID int, now time.Time) (database.WebhookEvent, []byte, error) {
+	payload := &lspb.WebhookPayload{Timestamp: now.Unix()}
+	if deliveryID != 0 {
+		payload.DeliveryId = strconv.Itoa(deliveryID)
+	}
+
+	if listID != 0 {
+		lists, err := db.ListLists(ctx, database.OnlyListWithID(listID))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(lists) > 0 {
+			payload.List = listFromDatabaseList(lists[0])
+		}
+	}
+
+	if itemID != 0 {
+		items, err := db.ListListItems(ctx, listID,
+			database.OnlyItemWithID(itemID))
+		if err != nil {
+			return "", nil, err
+		}
+
+		if event == database.WebhookItemDeleted || len(items) == 0 ||
+			!items[0].VisibleTo(hook.OwnerID) {
+			event = database.WebhookItemDeleted
+			payload.DeletedItemId = strconv.Itoa(itemID)
+		} else {
+			payload.Item = itemFromDatabaseItem(items[0], hook.OwnerID)
+		}
+	}
+
+	payload.Event = string(event)
+	body, err := protojson.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return event, body, nil
+}
+
+// WebhookPayloadFunc returns the function the webhook dispatcher uses to
+// render deliveries.
+func WebhookPayloadFunc(db *database.DB) webhooks.PayloadFunc {
+	return func(ctx context.Context, hook *database.Webhook, d *database.WebhookDelivery, now time.Time) (database.WebhookEvent, []byte, error) {
+		return renderWebhookPayload(ctx, db, hook, d.ID, d.Event,
+			d.ListID, d.ItemID, now)
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// getWebhook returns the webhook with the given ID if the session's user
+// may manage it. Users manage their own webhooks; admins manage all of
+// them.
+func (s *listServer) getWebhook(ctx context.Context, session *sessions.Session, webhookID string) (*database.Webhook, error) {
+	id, err := strconv.Atoi(webhookID)
+	if webhookID == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid webhook id")
+	}
+
+	hooks, err := s.db.ListWebhooks(ctx, database.OnlyWebhookWithID(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(hooks) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no such webhook")
+	}
+
+	hook := hooks[0]
+	if hook.OwnerID != session.User.ID && !session.User.Admin {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"user does not own webhook")
+	}
+	return hook, nil
+}
+
+func (s *listServer) CreateWebhook(ctx context.Context, req *lspb.CreateWebhookRequest) (*lspb.CreateWebhookResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	hook := &database.Webhook{
+		OwnerID: session.User.ID,
+		URL:     req.GetUrl(),
+		Created: s.clock.Now(),
+	}
+
+	if req.GetListId() != "" {
+		listID, err := strconv.Atoi(req.GetListId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"invalid list id")
+		}
+		list, err := dbutil.GetList(ctx, s.db, listID)
+		if err != nil {
+			return nil, err
+		}
+		if list.OwnerID != session.User.ID && !session.User.Admin {
+			return nil, errNotOwner()
+		}
+		hook.ListID = listID
+	} else if !session.User.Admin {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"only admins can watch all lists")
+	}
+
+	if _, err := unfurl.ParseURL(hook.URL); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid webhook url")
+	}
+
+	for _, event := range req.GetEvents() {
+		dbEvent, found := webhookEventToDatabase[event]
+		if !found {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"invalid webhook event %v", event)
+		}
+		hook.Events = append(hook.Events, dbEvent)
+	}
+
+	hook.Secret, err = newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err = s.db.CreateWebhook(ctx, hook)
+	if err != nil {
+		return nil, err
+	}
+
+	out := webhookFromDatabaseWebhook(hook)
+	out.Secret = hook.Secret
+	return &lspb.CreateWebhookResponse{Webhook: out}, nil
+}
+
+func (s *listServer) ListWebhooks(ctx context.Context, req *lspb.ListWebhooksRequest) (*lspb.ListWebhooksResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	filter := database.OnlyWebhooksOwnedBy(session.User.ID)
+	if session.User.Admin {
+		filter = database.AllWebhooks()
+	}
+
+	hooks, err := s.db.ListWebhooks(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.ListWebhooksResponse{}
+	for _, hook := range hooks {
+		resp.Webhooks = append(resp.Webhooks,
+			webhookFromDatabaseWebhook(hook))
+	}
+	return resp, nil
+}
+
+func (s *listServer) DeleteWebhook(ctx context.Context, req *lspb.DeleteWebhookRequest) (*lspb.DeleteWebhookResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	hook, err := s.getWebhook(ctx, session, req.GetWebhookId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.DeleteWebhook(ctx, hook.ID); err != nil {
+		return nil, err
+	}
+	return &lspb.DeleteWebhookResponse{}, nil
+}
+
+func (s *listServer) TestWebhook(ctx context.Context, req *lspb.TestWebhookRequest) (*lspb.TestWebhookResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	if s.webhookClient == nil {
+		return nil, status.Errorf(codes.Unimplemented,
+			"webhooks are disabled")
+	}
+
+	hook, err := s.getWebhook(ctx, session, req.GetWebhookId())
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	event, body, err := renderWebhookPayload(ctx, s.db, hook, 0,
+		database.WebhookPing, hook.ListID, 0, now)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.TestWebhookResponse{Delivered: true}
+	if err := webhooks.Post(ctx, s.webhookClient, hook, 0, event, body, now); err != nil {
+		resp.Delivered = false
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
+
+func (s *listServer) ListWebhookDeliveries(ctx context.Context, req *lspb.ListWebhookDeliveriesRequest) (*lspb.ListWebhookDeliveriesResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	hook, err := s.getWebhook(ctx, session, req.GetWebhookId())
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx,
+		database.WebhookDeliveriesFor(hook.ID, req.GetFailedOnly()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &lspb.ListWebhookDeliveriesResponse{}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries,
+			webhookDeliveryFromDatabaseDelivery(d))
+	}
+	return resp, nil
+}
+
+func (s *listServer) RedeliverWebhook(ctx context.Context, req *lspb.RedeliverWebhookRequest) (*lspb.RedeliverWebhookResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(req.GetDeliveryId())
+	if req.GetDeliveryId() == "" || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid delivery id")
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx,
+		database.OnlyWebhookDeliveryWithID(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no such delivery")
+	}
+	d := deliveries[0]
+
+	if _, err := s.getWebhook(ctx, session, strconv.Itoa(d.WebhookID)); err != nil {
+		return nil, err
+	}
+
+	d.Attempts = 0
+	d.NextAttempt = s.clock.Now()
+	d.LastError = ""
+	d.Delivered = time.Time{}
+	d.Failed = time.Time{}
+	if err := s.db.UpdateWebhookDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+
+	return &lspb.RedeliverWebhookResponse{
+		Delivery: webhookDeliveryFromDatabaseDelivery(d),
+	}, nil
+}
@@ -0,0 +1,254 @@
+package listservice
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"github.com/simmonmt/xmaslist/backend/webhooks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	lspb "github.com/simmonmt/xmaslist/proto/list_service"
+)
+
+// webhookReceiver records the payloads posted to it.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	payloads []*lspb.WebhookPayload
+	signed   bool
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	payload := &lspb.WebhookPayload{}
+	if err := protojson.Unmarshal(body, payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, payload)
+	r.signed = req.Header.Get(webhooks.SignatureHeader) != ""
+}
+
+func TestWebhooks(t *testing.T) {
+	state := setupListItemTestState(ctx, t)
+	defer state.DB.Close()
+
+	rcv := &webhookReceiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+	state.Server.webhookClient = server.Client()
+
+	list, item := state.Lists.GetItem("l1", "l1i1")
+	listID := strconv.Itoa(list.ID)
+	ownerCtx := makeRequestContext(ctx, state, "a")
+	giverCtx := makeRequestContext(ctx, state, "b")
+	adminCtx := makeRequestContext(ctx, state, "c")
+	userB := state.Users.UserByUsername("b")
+	userC := state.Users.UserByUsername("c")
+	state.SessionsByUserID[userC.ID].User.Admin = true
+
+	badReqs := []struct {
+		ctx  context.Context
+		req  *lspb.CreateWebhookRequest
+		code codes.Code
+	}{
+		{giverCtx, &lspb.CreateWebhookRequest{ListId: listID, Url: server.URL}, codes.PermissionDenied},
+		{giverCtx, &lspb.CreateWebhookRequest{Url: server.URL}, codes.PermissionDenied},
+		{ownerCtx, &lspb.CreateWebhookRequest{ListId: listID, Url: "ftp://x/"}, codes.InvalidArgument},
+		{ownerCtx, &lspb.CreateWebhookRequest{ListId: listID, Url: "http://u:p@example.com/"}, codes.InvalidArgument},
+		{ownerCtx, &lspb.CreateWebhookRequest{ListId: "9999", Url: server.URL}, codes.NotFound},
+	}
+	for _, bad := range badReqs {
+		if _, err := state.Server.CreateWebhook(bad.ctx, bad.req); status.Code(err) != bad.code {
+			t.Errorf("CreateWebhook(%v) = _, %v, want %v", bad.req, err,
+				bad.code)
+		}
+	}
+
+	// The owner watches their list, and an admin watches everything.
+	ownerResp, err := state.Server.CreateWebhook(ownerCtx,
+		&lspb.CreateWebhookRequest{
+			ListId: listID,
+			Url:    server.URL,
+			Events: []lspb.Webhook_Event{lspb.Webhook_ITEM_UPDATED},
+		})
+	if err != nil {
+		t.Fatalf("CreateWebhook(owner) = _, %v, want _, nil", err)
+	}
+	ownerHook := ownerResp.GetWebhook()
+	if ownerHook.GetSecret() == "" || ownerHook.GetListId() != listID {
+		t.Errorf("CreateWebhook(owner) = %v, want secret and list", ownerHook)
+	}
+	adminResp, err := state.Server.CreateWebhook(adminCtx,
+		&lspb.CreateWebhookRequest{Url: server.URL})
+	if err != nil {
+		t.Fatalf("CreateWebhook(admin) = _, %v, want _, nil", err)
+	}
+	adminHook := adminResp.GetWebhook()
+
+	listResp, err := state.Server.ListWebhooks(ownerCtx,
+		&lspb.ListWebhooksRequest{})
+	if err != nil || len(listResp.GetWebhooks()) != 1 ||
+		listResp.GetWebhooks()[0].GetSecret() != "" {
+		t.Errorf("ListWebhooks(owner) = %v, %v, want 1 without secret",
+			listResp, err)
+	}
+	listResp, err = state.Server.ListWebhooks(adminCtx,
+		&lspb.ListWebhooksRequest{})
+	if err != nil || len(listResp.GetWebhooks()) != 2 {
+		t.Errorf("ListWebhooks(admin) = %v, %v, want 2", listResp, err)
+	}
+
+	// b claims the item. Payloads are rendered as the API would render
+	// them for each webhook's owner, so b's purchase progress is left out.
+	item, err = state.DB.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		userB.ID, state.Clock.Now(),
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+
+	dispatcher := webhooks.NewDispatcher(state.DB, state.Clock,
+		server.Client(), WebhookPayloadFunc(state.DB), 3, time.Minute,
+		time.Hour)
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+
+	if len(rcv.payloads) != 2 || !rcv.signed {
+		t.Fatalf("received %v, want 2 signed payloads", rcv.payloads)
+	}
+	for i, viewer := range []string{"a", "c"} {
+		viewerID := state.Users.UserByUsername(viewer).ID
+		got := rcv.payloads[i]
+		want := &lspb.WebhookPayload{
+			DeliveryId: got.GetDeliveryId(),
+			Event:      "item.updated",
+			Timestamp:  got.GetTimestamp(),
+			List:       listFromDatabaseList(list),
+			Item:       itemFromDatabaseItem(item, viewerID),
+		}
+		if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("payload for %v mismatch; -want,+got:\n%s", viewer, diff)
+		}
+	}
+	for _, payload := range rcv.payloads {
+		if payload.GetItem().GetMetadata().GetMyPurchase() != nil {
+			t.Errorf("payload %v includes b's purchase", payload)
+		}
+	}
+
+	// The owner removes the item. b's claim keeps it around, but the
+	// webhooks' owners can't see it any more.
+	rcv.payloads = nil
+	item, err = state.DB.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		list.OwnerID, state.Clock.Now(),
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.Deleted = time.Unix(1, 0)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem(delete) = _, %v, want _, nil", err)
+	}
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	if len(rcv.payloads) != 2 {
+		t.Fatalf("received %v, want 2 payloads", rcv.payloads)
+	}
+	for _, payload := range rcv.payloads {
+		if payload.GetEvent() != "item.deleted" || payload.GetItem() != nil ||
+			payload.GetDeletedItemId() != strconv.Itoa(item.ID) {
+			t.Errorf("payload = %v, want item.deleted without item", payload)
+		}
+	}
+
+	// Test deliveries go out straight away.
+	rcv.payloads = nil
+	testResp, err := state.Server.TestWebhook(ownerCtx,
+		&lspb.TestWebhookRequest{WebhookId: ownerHook.GetId()})
+	if err != nil || !testResp.GetDelivered() {
+		t.Fatalf("TestWebhook() = %v, %v, want delivered", testResp, err)
+	}
+	if len(rcv.payloads) != 1 || rcv.payloads[0].GetEvent() != "ping" ||
+		rcv.payloads[0].GetList().GetId() != listID {
+		t.Errorf("test delivery = %v, want ping for list", rcv.payloads)
+	}
+
+	// The real client won't deliver to internal addresses like the
+	// test server's.
+	state.Server.webhookClient = unfurl.NewPublicClient(time.Second)
+	rcv.payloads = nil
+	testResp, err = state.Server.TestWebhook(ownerCtx,
+		&lspb.TestWebhookRequest{WebhookId: ownerHook.GetId()})
+	if err != nil || testResp.GetDelivered() ||
+		!strings.Contains(testResp.GetError(), "not allowed") ||
+		len(rcv.payloads) != 0 {
+		t.Errorf("TestWebhook(internal) = %v, %v, want blocked", testResp,
+			err)
+	}
+	state.Server.webhookClient = server.Client()
+
+	// Only the webhook's owner and admins can see and redeliver its
+	// deliveries.
+	if _, err := state.Server.ListWebhookDeliveries(giverCtx,
+		&lspb.ListWebhookDeliveriesRequest{WebhookId: ownerHook.GetId()}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListWebhookDeliveries(giver) = _, %v, want PermissionDenied", err)
+	}
+	deliveriesResp, err := state.Server.ListWebhookDeliveries(ownerCtx,
+		&lspb.ListWebhookDeliveriesRequest{WebhookId: ownerHook.GetId()})
+	if err != nil || len(deliveriesResp.GetDeliveries()) != 2 ||
+		deliveriesResp.GetDeliveries()[0].GetDelivered() == 0 {
+		t.Fatalf("ListWebhookDeliveries() = %v, %v, want 2 delivered",
+			deliveriesResp, err)
+	}
+	delivery := deliveriesResp.GetDeliveries()[0]
+
+	if _, err := state.Server.RedeliverWebhook(giverCtx,
+		&lspb.RedeliverWebhookRequest{DeliveryId: delivery.GetId()}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RedeliverWebhook(giver) = _, %v, want PermissionDenied", err)
+	}
+	redeliverResp, err := state.Server.RedeliverWebhook(ownerCtx,
+		&lspb.RedeliverWebhookRequest{DeliveryId: delivery.GetId()})
+	if err != nil || redeliverResp.GetDelivery().GetDelivered() != 0 ||
+		redeliverResp.GetDelivery().GetAttempts() != 0 {
+		t.Fatalf("RedeliverWebhook() = %v, %v, want reset delivery",
+			redeliverResp, err)
+	}
+
+	rcv.payloads = nil
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	if len(rcv.payloads) != 1 || rcv.payloads[0].GetDeliveryId() != delivery.GetId() {
+		t.Errorf("received %v after redelivery, want delivery %v",
+			rcv.payloads, delivery.GetId())
+	}
+
+	if _, err := state.Server.DeleteWebhook(giverCtx,
+		&lspb.DeleteWebhookRequest{WebhookId: adminHook.GetId()}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("DeleteWebhook(giver) = _, %v, want PermissionDenied", err)
+	}
+	if _, err := state.Server.DeleteWebhook(adminCtx,
+		&lspb.DeleteWebhookRequest{WebhookId: ownerHook.GetId()}); err != nil {
+		t.Errorf("DeleteWebhook(admin) = _, %v, want _, nil", err)
+	}
+}
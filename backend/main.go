@@ -7,16 +7,29 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/simmonmt/xmaslist/backend/authservice"
+	"github.com/simmonmt/xmaslist/backend/blobstore"
+	"github.com/simmonmt/xmaslist/backend/calendar"
+	"github.com/simmonmt/xmaslist/backend/claimexpiry"
 	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/eventreminder"
+	"github.com/simmonmt/xmaslist/backend/hub"
+	"github.com/simmonmt/xmaslist/backend/images"
 	"github.com/simmonmt/xmaslist/backend/listservice"
+	"github.com/simmonmt/xmaslist/backend/notifications"
+	"github.com/simmonmt/xmaslist/backend/pricetrack"
 	"github.com/simmonmt/xmaslist/backend/sessions"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
 	"github.com/simmonmt/xmaslist/backend/userservice"
 	"github.com/simmonmt/xmaslist/backend/util"
+	"github.com/simmonmt/xmaslist/backend/webhooks"
+	"github.com/simmonmt/xmaslist/db/schema"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
@@ -31,10 +44,81 @@ var (
 		"user_session_length", 24*time.Hour, "length of user sessions")
 	sessionSecretPath = flag.String(
 		"session_secret", "", "path to session secret file")
+	autoMigrate = flag.Bool("auto_migrate", false,
+		"if the database schema is out of date, migrate it rather than "+
+			"refusing to start")
 	slowResponses = flag.String("slow_responses", "",
 		"if a duration, sleep before each response. if a comma-separated "+
 			"list of k=v pairs (method=duration), sleep the specific "+
 			"methods by the specified amounts")
+	claimExpiryInterval = flag.Duration("claim_expiry_interval",
+		time.Hour, "how often to look for expired claims")
+	claimReminderLead = flag.Duration("claim_reminder_lead",
+		48*time.Hour, "how long before a claim expires to remind "+
+			"the claimer")
+	blobDir = flag.String("blob_dir", "",
+		"directory for item images. image uploads are disabled if "+
+			"unset")
+	imagePort = flag.Int("image_port", -1,
+		"port for the item image server. requires --blob_dir")
+	blobGCInterval = flag.Duration("blob_gc_interval", 24*time.Hour,
+		"how often to delete unused item images")
+	blobGCGrace = flag.Duration("blob_gc_grace", time.Hour,
+		"how old an unused item image must be before it's deleted")
+	unfurlTimeout = flag.Duration("unfurl_timeout", unfurl.DefaultTimeout,
+		"how long to wait when fetching a page to unfurl")
+	unfurlMaxBytes = flag.Int64("unfurl_max_bytes", unfurl.DefaultMaxBytes,
+		"the most to read from a page being unfurled")
+	unfurlCacheTTL = flag.Duration("unfurl_cache_ttl", unfurl.DefaultCacheTTL,
+		"how long to cache unfurled pages")
+	priceCheckInterval = flag.Duration("price_check_interval",
+		24*time.Hour, "how often to check the price of each item")
+	priceCheckRunInterval = flag.Duration("price_check_run_interval",
+		time.Hour, "how often to look for items due a price check")
+	priceCheckHostInterval = flag.Duration("price_check_host_interval",
+		10*time.Second, "the minimum time between price checks on the "+
+			"same site")
+	notifyInterval = flag.Duration("notify_interval", time.Minute,
+		"how often to deliver queued notifications")
+	notifyMaxAttempts = flag.Int("notify_max_attempts",
+		notifications.DefaultMaxAttempts,
+		"how many times to try delivering a notification")
+	digestInterval = flag.Duration("digest_interval", 15*time.Minute,
+		"how often to check for notification digests that are due")
+	notifyLog  = flag.Bool("notify_log", true, "log notifications")
+	notifyFile = flag.String("notify_file", "",
+		"if set, append notifications to this file as JSON")
+	notifyWebhookURL = flag.String("notify_webhook_url", "",
+		"if set, post notifications to this URL as JSON")
+	smtpAddr = flag.String("smtp_addr", "",
+		"if set, email notifications through this host:port")
+	smtpFrom = flag.String("smtp_from", "",
+		"the address notification emails are sent from")
+	smtpDomain = flag.String("smtp_domain", "",
+		"notification emails go to username@smtp_domain")
+	eventReminderDays = flag.String("event_reminder_days", "30,14,3",
+		"comma-separated numbers of days before a list's event to "+
+			"remind givers about it")
+	eventReminderInterval = flag.Duration("event_reminder_interval",
+		time.Hour, "how often to look for event reminders that are due")
+	webhookInterval = flag.Duration("webhook_interval", time.Minute,
+		"how often to send queued webhook deliveries")
+	webhookMaxAttempts = flag.Int("webhook_max_attempts",
+		webhooks.DefaultMaxAttempts,
+		"how many times to try a webhook delivery before giving up")
+	webhookTimeout = flag.Duration("webhook_timeout", 30*time.Second,
+		"how long to wait for a webhook endpoint to respond")
+	calendarPort = flag.Int("calendar_port", -1,
+		"port for the calendar feed server. feeds are disabled if unset")
+	calendarURL = flag.String("calendar_url", "",
+		"the externally visible URL of the calendar feed server, used "+
+			"to give users their feed URLs")
+	calendarAlarmDays = flag.String("calendar_alarm_days", "7,1",
+		"comma-separated numbers of days before each event to set "+
+			"calendar alarms")
+	appURL = flag.String("app_url", "",
+		"the externally visible URL of the web app, used to link to "+
+			"lists")
 	errorResponses = flag.String("error_responses", "",
 		"if a code, return for all requests. if a comma-separated "+
 			"list of k=v pairs (method=code), fail the specified "+
@@ -70,18 +154,41 @@ func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnarySe
 	return
 }
 
+func loggingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	err = handler(srv, ss)
+	grpcLog.Infof("Stream - Method:%s Duration:%s Error:%v\n",
+		info.FullMethod, time.Since(start), err)
+	return
+}
+
+// rewriteError turns errors that aren't gRPC statuses into Internal errors.
+// Statuses are passed through as is, so that their error details reach the
+// client.
+func rewriteError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
+
 func errorRewriteInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	res, err := handler(ctx, req)
 	if err != nil {
-		if _, ok := status.FromError(err); ok {
-			return nil, err
-		}
-		return nil, status.Errorf(codes.Internal, "%v", err)
+		return nil, rewriteError(err)
 	}
 
 	return res, err
 }
 
+func errorRewriteStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := handler(srv, ss); err != nil {
+		return rewriteError(err)
+	}
+
+	return nil
+}
+
 type SlowResponseInterceptor struct {
 	allDelay time.Duration
 	delays   map[string]time.Duration
@@ -132,6 +239,21 @@ func makeSlowResponseInterceptor(specStr string) (*SlowResponseInterceptor, erro
 	return &SlowResponseInterceptor{delays: delays}, nil
 }
 
+func parseReminderDays(str string) ([]int, error) {
+	days := []int{}
+	for _, part := range strings.Split(str, ",") {
+		if part == "" {
+			continue
+		}
+		d, err := strconv.Atoi(part)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("bad number of days %q", part)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
 func parseCode(str string) (codes.Code, error) {
 	str = `"` + str + `"`
 
@@ -190,6 +312,39 @@ func makeErrorResponseInterceptor(specStr string) (*ErrorResponseInterceptor, er
 	return &ErrorResponseInterceptor{errors: errors}, nil
 }
 
+func makeNotificationChannels() ([]notifications.Channel, error) {
+	channels := []notifications.Channel{}
+
+	if *notifyLog {
+		channels = append(channels, &notifications.LogChannel{})
+	}
+
+	if *notifyFile != "" {
+		f, err := os.OpenFile(*notifyFile,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, notifications.NewWriterChannel(f))
+	}
+
+	if *notifyWebhookURL != "" {
+		channels = append(channels, notifications.NewWebhookChannel(
+			*notifyWebhookURL, &http.Client{Timeout: time.Minute}))
+	}
+
+	if *smtpAddr != "" {
+		if *smtpFrom == "" || *smtpDomain == "" {
+			return nil, fmt.Errorf(
+				"--smtp_addr requires --smtp_from and --smtp_domain")
+		}
+		channels = append(channels, notifications.NewSMTPChannel(
+			*smtpAddr, nil, *smtpFrom, *smtpDomain))
+	}
+
+	return channels, nil
+}
+
 func main() {
 	flag.Parse()
 
@@ -215,9 +370,111 @@ func main() {
 		log.Fatalf("failed to open database: %v", err)
 	}
 
+	version, err := db.SchemaVersion(context.Background())
+	if err != nil {
+		log.Fatalf("failed to read schema version: %v", err)
+	}
+	if version != schema.Latest() {
+		if !*autoMigrate {
+			log.Fatalf("database schema is at version %d, want %d; "+
+				"run db_util migrate up or pass --auto_migrate",
+				version, schema.Latest())
+		}
+
+		log.Printf("migrating database schema from version %d to %d\n",
+			version, schema.Latest())
+		if err := db.Migrate(context.Background(), schema.Latest()); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+	}
+
+	itemHub := hub.New(hub.DefaultBuffer)
+	db.SetItemListener(itemHub.Publish)
+
 	sessionManager := sessions.NewManager(
 		db, clock, *userSessionLength, sessionSecret)
 
+	expirer := claimexpiry.NewExpirer(db, clock,
+		claimexpiry.NewOutboxReminder(db, clock), *claimReminderLead)
+	go expirer.Run(context.Background(), *claimExpiryInterval)
+
+	var blobs blobstore.Store
+	if *blobDir != "" {
+		store, err := blobstore.NewLocalStore(*blobDir)
+		if err != nil {
+			log.Fatalf("failed to open blob store: %v", err)
+		}
+		blobs = store
+
+		go images.RunGarbageCollector(context.Background(), db, store,
+			clock, *blobGCInterval, *blobGCGrace)
+
+		if *imagePort != -1 {
+			mux := http.NewServeMux()
+			mux.Handle("/images/", blobstore.Handler(store))
+			go func() {
+				log.Printf("serving images on port %v...\n", *imagePort)
+				err := http.ListenAndServe(
+					fmt.Sprintf(":%d", *imagePort), mux)
+				log.Fatalf("failed to serve images: %v", err)
+			}()
+		}
+	} else if *imagePort != -1 {
+		log.Fatalf("--image_port requires --blob_dir")
+	}
+
+	channels, err := makeNotificationChannels()
+	if err != nil {
+		log.Fatalf("failed to set up notifications: %v", err)
+	}
+	dispatcher := notifications.NewDispatcher(db, clock, channels,
+		*notifyMaxAttempts, notifications.DefaultMinBackoff,
+		notifications.DefaultMaxBackoff)
+	go dispatcher.Run(context.Background(), *notifyInterval)
+	go notifications.NewDigestScheduler(db, clock, channels).Run(
+		context.Background(), *digestInterval)
+
+	reminderDays, err := parseReminderDays(*eventReminderDays)
+	if err != nil {
+		log.Fatalf("bad --event_reminder_days: %v", err)
+	}
+	go eventreminder.NewScheduler(db, clock, reminderDays).Run(
+		context.Background(), *eventReminderInterval)
+
+	// Webhook URLs come from users, so like unfurling, deliveries mustn't
+	// reach internal addresses.
+	webhookClient := unfurl.NewPublicClient(*webhookTimeout)
+	webhookDispatcher := webhooks.NewDispatcher(db, clock, webhookClient,
+		listservice.WebhookPayloadFunc(db), *webhookMaxAttempts,
+		webhooks.DefaultMinBackoff, webhooks.DefaultMaxBackoff)
+	go webhookDispatcher.Run(context.Background(), *webhookInterval)
+
+	if *calendarPort != -1 {
+		alarmDays, err := parseReminderDays(*calendarAlarmDays)
+		if err != nil {
+			log.Fatalf("bad --calendar_alarm_days: %v", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(calendar.PathPrefix,
+			calendar.NewServer(db, clock, *appURL, alarmDays))
+		go func() {
+			log.Printf("serving calendar feeds on port %v...\n",
+				*calendarPort)
+			err := http.ListenAndServe(
+				fmt.Sprintf(":%d", *calendarPort), mux)
+			log.Fatalf("failed to serve calendar feeds: %v", err)
+		}()
+	}
+
+	fetcher := unfurl.NewHTTPFetcher(*unfurlTimeout, *unfurlMaxBytes)
+	unfurler := unfurl.New(fetcher, clock, *unfurlCacheTTL)
+
+	tracker := pricetrack.NewTracker(db, clock, fetcher,
+		&pricetrack.UnfurlParser{}, pricetrack.NewOutboxAlerter(db, clock),
+		*priceCheckInterval, *priceCheckHostInterval)
+	go tracker.Run(context.Background(), *priceCheckRunInterval)
+
 	sock, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
@@ -231,6 +488,7 @@ func main() {
 		loggingInterceptor,
 		errorRewriteInterceptor,
 		authInterceptor.intercept,
+		listservice.ErrorDetailsInterceptor,
 	}
 
 	if *slowResponses != "" {
@@ -253,12 +511,19 @@ func main() {
 
 	opts := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(
+			loggingStreamInterceptor,
+			errorRewriteStreamInterceptor,
+			authInterceptor.interceptStream,
+			listservice.ErrorDetailsStreamInterceptor,
+		),
 	}
 
 	server := grpc.NewServer(opts...)
 	authservice.RegisterHandlers(server, clock, sessionManager, db)
-	listservice.RegisterHandlers(server, clock, sessionManager, db)
-	userservice.RegisterHandlers(server, clock, db)
+	listservice.RegisterHandlers(server, clock, sessionManager, db, blobs,
+		unfurler, itemHub, webhookClient)
+	userservice.RegisterHandlers(server, clock, db, *calendarURL)
 	reflection.Register(server)
 
 	log.Printf("serving on port %v...\n", *port)
@@ -0,0 +1,252 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+// A Channel delivers notifications to users.
+type Channel interface {
+	// Name identifies the channel in the outbox's record of where a
+	// notification has been delivered. It must not contain commas.
+	Name() string
+
+	Send(ctx context.Context, user *database.User, n *database.Notification) error
+}
+
+// Payload is the JSON form of a notification, as written by WriterChannel
+// and posted by WebhookChannel.
+type Payload struct {
+	ID      int    `json:"id"`
+	User    string `json:"user"`
+	Kind    string `json:"kind"`
+	ListID  int    `json:"list_id"`
+	ItemID  int    `json:"item_id,omitempty"`
+	Message string `json:"message"`
+	Created int64  `json:"created"`
+}
+
+func makePayload(user *database.User, n *database.Notification) *Payload {
+	return &Payload{
+		ID:      n.ID,
+		User:    user.Username,
+		Kind:    string(n.Kind),
+		ListID:  n.ListID,
+		ItemID:  n.ItemID,
+		Message: n.Message,
+		Created: n.Created.Unix(),
+	}
+}
+
+// LogChannel logs notifications.
+type LogChannel struct{}
+
+func (c *LogChannel) Name() string { return "log" }
+
+func (c *LogChannel) Send(ctx context.Context, user *database.User, n *database.Notification) error {
+	logger.Infof("notify %v: %v", user.Username, n.Message)
+	return nil
+}
+
+// WriterChannel writes notifications to a file or other writer, one JSON
+// payload per line.
+type WriterChannel struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterChannel(w io.Writer) *WriterChannel {
+	return &WriterChannel{w: w}
+}
+
+func (c *WriterChannel) Name() string { return "file" }
+
+func (c *WriterChannel) Send(ctx context.Context, user *database.User, n *database.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.NewEncoder(c.w).Encode(makePayload(user, n))
+}
+
+// WebhookChannel posts notifications as JSON to a URL.
+type WebhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookChannel(url string, client *http.Client) *WebhookChannel {
+	return &WebhookChannel{url: url, client: client}
+}
+
+func (c *WebhookChannel) Name() string { return "webhook" }
+
+func (c *WebhookChannel) Send(ctx context.Context, user *database.User, n *database.Notification) error {
+	body, err := json.Marshal(makePayload(user, n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
+
+// SMTPChannel emails notifications. Users don't have email addresses of
+// their own, so mail is sent to their username at domain.
+type SMTPChannel struct {
+	addr   string
+	auth   smtp.Auth
+	from   string
+	domain string
+
+	sendMail func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// smtpTimeout bounds a single SMTP conversation, so a stalled server can't
+// hold up the dispatcher.
+const smtpTimeout = time.Minute
+
+// NewSMTPChannel returns a channel that sends mail from from through the
+// server at addr (host:port). auth may be nil.
+func NewSMTPChannel(addr string, auth smtp.Auth, from, domain string) *SMTPChannel {
+	return &SMTPChannel{
+		addr:     addr,
+		auth:     auth,
+		from:     from,
+		domain:   domain,
+		sendMail: sendMail,
+	}
+}
+
+func (c *SMTPChannel) Name() string { return "smtp" }
+
+func (c *SMTPChannel) Send(ctx context.Context, user *database.User, n *database.Notification) error {
+	to := user.Username + "@" + c.domain
+
+	msg := &strings.Builder{}
+	fmt.Fprintf(msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(msg, "To: %s\r\n", to)
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject(n))
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(msg, "\r\n%s\r\n", n.Message)
+
+	return c.sendMail(ctx, c.addr, c.auth, c.from, []string{to},
+		[]byte(msg.String()))
+}
+
+// sendMail is smtp.SendMail, but with the connection dialed under ctx and the
+// whole conversation bounded by ctx's deadline or smtpTimeout, whichever is
+// sooner.
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(a); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func subject(n *database.Notification) string {
+	switch n.Kind {
+	case database.NotifyItemAdded:
+		return "New item on a list"
+	case database.NotifyItemChanged:
+		return "An item you claimed changed"
+	case database.NotifyItemDeleted:
+		return "An item you claimed was removed"
+	case database.NotifyClaimReleased:
+		return "Your claim was released"
+	case database.NotifyListChanged:
+		return "A list changed"
+	case database.NotifyListArchived:
+		return "A list was archived"
+	case database.NotifyEventReminder:
+		return "An event is coming up"
+	case database.NotifyClaimExpiring:
+		return "Your claim is about to be released"
+	case database.NotifyPriceDropped:
+		return "A price dropped"
+	case database.NotifyDigest:
+		return "Your xmaslist digest"
+	default:
+		return "xmaslist update"
+	}
+}
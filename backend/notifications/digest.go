@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+var digestTemplate = template.Must(template.New("digest").Parse(
+	`Here's what happened on xmaslist since {{.Since.Format "Mon Jan 2"}}:
+{{range .Lists}}
+{{.Name}}:
+{{range .Messages}}  * {{.}}
+{{end}}{{end}}`))
+
+type digestList struct {
+	Name     string
+	Messages []string
+}
+
+type digestData struct {
+	Since time.Time
+	Lists []*digestList
+}
+
+// digestPeriod returns how long a user waits between digests.
+func digestPeriod(digest database.DigestFrequency) time.Duration {
+	if digest == database.DeliverWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// A DigestScheduler sends batched notifications to the users who've asked
+// for daily or weekly digests instead of immediate delivery.
+type DigestScheduler struct {
+	db       *database.DB
+	clock    util.Clock
+	channels []Channel
+}
+
+// NewDigestScheduler returns a DigestScheduler that sends digests through
+// channels.
+func NewDigestScheduler(db *database.DB, clock util.Clock, channels []Channel) *DigestScheduler {
+	return &DigestScheduler{
+		db:       db,
+		clock:    clock,
+		channels: channels,
+	}
+}
+
+// Run calls RunOnce every interval, as measured by the DigestScheduler's
+// clock, until ctx is done.
+func (s *DigestScheduler) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			logger.Errorf("digest run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce sends the digests that are due. A digest that can't be sent
+// through every channel is tried again on the next run, so that nothing is
+// marked delivered until everything has been.
+func (s *DigestScheduler) RunOnce(ctx context.Context) error {
+	users, err := s.db.ListDigestUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, du := range users {
+		now := s.clock.Now()
+		if now.Before(du.LastDigest.Add(digestPeriod(du.Digest))) {
+			continue
+		}
+		if err := s.send(ctx, du, now); err != nil {
+			logger.Errorf("digest for user %v failed: %v",
+				du.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *DigestScheduler) send(ctx context.Context, du *database.DigestUser, now time.Time) error {
+	pending, err := s.db.ListDigestNotifications(ctx, du.UserID)
+	if err != nil {
+		return err
+	}
+
+	data := &digestData{Since: du.LastDigest}
+	byList := map[int]*digestList{}
+	ids := []int{}
+	for _, n := range pending {
+		surprise, err := surprising(ctx, s.db, n)
+		if err != nil {
+			return err
+		}
+		if surprise {
+			logger.Warningf("dropping notification %v to list owner %v",
+				n.ID, n.UserID)
+			n.Failed = now
+			n.LastError = "recipient owns list"
+			if err := s.db.UpdateNotificationDelivery(ctx, n); err != nil {
+				return err
+			}
+			continue
+		}
+
+		list, found := byList[n.ListID]
+		if !found {
+			lists, err := s.db.ListLists(ctx,
+				database.OnlyListWithID(n.ListID))
+			if err != nil {
+				return err
+			}
+			list = &digestList{Name: lists[0].Name}
+			byList[n.ListID] = list
+			data.Lists = append(data.Lists, list)
+		}
+		list.Messages = append(list.Messages, n.Message)
+		ids = append(ids, n.ID)
+	}
+
+	if len(ids) > 0 {
+		if err := s.deliver(ctx, du.UserID, data, now); err != nil {
+			return err
+		}
+	}
+
+	return s.db.RecordDigestSent(ctx, du.UserID, ids, now)
+}
+
+func (s *DigestScheduler) deliver(ctx context.Context, userID int, data *digestData, now time.Time) error {
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render digest: %v", err)
+	}
+
+	user, err := s.db.LookupUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	prefs, err := s.db.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	n := &database.Notification{
+		UserID:  userID,
+		Kind:    database.NotifyDigest,
+		Message: buf.String(),
+		Created: now,
+	}
+
+	errs := []string{}
+	for _, channel := range userChannels(s.channels, prefs) {
+		if err := channel.Send(ctx, user, n); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", channel.Name(),
+				err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
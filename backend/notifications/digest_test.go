@@ -0,0 +1,90 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+func TestDigestScheduler(t *testing.T) {
+	ctx := context.Background()
+	state := setupTestState(ctx, t)
+	defer state.db.Close()
+
+	wanted := &flakyChannel{name: "wanted", failures: 1}
+	unwanted := &flakyChannel{name: "unwanted"}
+	channels := []Channel{wanted, unwanted}
+	dispatcher := NewDispatcher(state.db, state.clock, channels, 5,
+		time.Minute, time.Hour)
+	scheduler := NewDigestScheduler(state.db, state.clock, channels)
+
+	since := state.clock.Now()
+	if _, err := state.db.SetNotificationPreferences(ctx, state.userB.ID,
+		&database.NotificationPreferences{
+			Channels: []string{"wanted"},
+			Events:   database.NotificationEvents,
+			Digest:   database.DeliverDaily,
+		}, since); err != nil {
+		t.Fatalf("SetNotificationPreferences() = _, %v, want _, nil", err)
+	}
+
+	state.notify()
+	state.notify()
+
+	run := func() {
+		t.Helper()
+		if err := dispatcher.RunOnce(ctx); err != nil {
+			t.Fatalf("dispatcher.RunOnce() = %v, want nil", err)
+		}
+		if err := scheduler.RunOnce(ctx); err != nil {
+			t.Fatalf("scheduler.RunOnce() = %v, want nil", err)
+		}
+	}
+
+	// Nothing goes out until a day has passed.
+	run()
+	if len(wanted.sent) != 0 || wanted.failures != 1 {
+		t.Fatalf("sent %v before the digest was due", wanted.sent)
+	}
+
+	// The first attempt at the digest fails, and is retried on the next
+	// run.
+	state.clock.Advance(24 * time.Hour)
+	run()
+	if len(wanted.sent) != 0 || wanted.failures != 0 {
+		t.Fatalf("sent %v, want a failed attempt", wanted.sent)
+	}
+	run()
+	if len(wanted.sent) != 1 || len(unwanted.sent) != 0 {
+		t.Fatalf("sent %v/%v, want 1/0", len(wanted.sent),
+			len(unwanted.sent))
+	}
+
+	n := wanted.sent[0]
+	want := "Here's what happened on xmaslist since " +
+		since.Format("Mon Jan 2") + ":\n" +
+		"\n" +
+		"list:\n" +
+		"  * \"item\" on \"list\" changed: desc\n" +
+		"  * \"item\" on \"list\" changed: desc\n"
+	if n.Kind != database.NotifyDigest || n.UserID != state.userB.ID ||
+		n.Message != want {
+		t.Errorf("sent %+v, want digest for b with message\n%s", n, want)
+	}
+
+	// The digested notifications are done with, and the next digest
+	// isn't due for another day.
+	state.notify()
+	state.clock.Advance(time.Hour)
+	run()
+	if len(wanted.sent) != 1 {
+		t.Errorf("sent %v digests, want 1", len(wanted.sent))
+	}
+	pending, err := state.db.ListDigestNotifications(ctx, state.userB.ID)
+	if err != nil || len(pending) != 1 {
+		t.Errorf("ListDigestNotifications() = %v, %v, want 1", pending,
+			err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package notifications delivers the notifications queued in the database
+// outbox through pluggable channels, retrying failed deliveries with
+// exponential backoff.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var logger = grpclog.Component("notifications")
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultMinBackoff  = time.Minute
+	DefaultMaxBackoff  = 6 * time.Hour
+
+	batchSize = 100
+)
+
+type Dispatcher struct {
+	db          *database.DB
+	clock       util.Clock
+	channels    []Channel
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewDispatcher returns a Dispatcher that delivers notifications through
+// channels. Failed deliveries are retried after minBackoff, doubling for
+// each attempt up to maxBackoff, until maxAttempts have been made.
+func NewDispatcher(db *database.DB, clock util.Clock, channels []Channel, maxAttempts int, minBackoff, maxBackoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		clock:       clock,
+		channels:    channels,
+		maxAttempts: maxAttempts,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+	}
+}
+
+// Backoff returns how long to wait before the next attempt after attempts
+// failed ones.
+func Backoff(attempts int, min, max time.Duration) time.Duration {
+	delay := min
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Run calls RunOnce every interval, as measured by the Dispatcher's clock,
+// until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := d.RunOnce(ctx); err != nil {
+			logger.Errorf("notification dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce delivers the notifications that are due. Failed deliveries are
+// rescheduled.
+func (d *Dispatcher) RunOnce(ctx context.Context) error {
+	for {
+		pending, err := d.db.ListPendingNotifications(ctx,
+			d.clock.Now(), batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range pending {
+			if err := d.deliver(ctx, n); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < batchSize {
+			return nil
+		}
+	}
+}
+
+// userChannels returns the channels a user has asked to be notified through.
+func userChannels(channels []Channel, prefs *database.NotificationPreferences) []Channel {
+	out := []Channel{}
+	for _, channel := range channels {
+		if prefs.WantsChannel(channel.Name()) {
+			out = append(out, channel)
+		}
+	}
+	return out
+}
+
+// surprising returns true if telling the recipient about n would spoil the
+// surprise. Owners must never hear about claims on their lists, and every
+// notification so far is about something a giver has claimed.
+func surprising(ctx context.Context, db *database.DB, n *database.Notification) (bool, error) {
+	lists, err := db.ListLists(ctx, database.OnlyListWithID(n.ListID))
+	if err != nil {
+		return false, err
+	}
+	return len(lists) == 0 || lists[0].OwnerID == n.UserID, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, n *database.Notification) error {
+	now := d.clock.Now()
+
+	surprise, err := surprising(ctx, d.db, n)
+	if err != nil {
+		return err
+	}
+	if surprise {
+		logger.Warningf("dropping notification %v to list owner %v",
+			n.ID, n.UserID)
+		n.Failed = now
+		n.LastError = "recipient owns list"
+		return d.db.UpdateNotificationDelivery(ctx, n)
+	}
+
+	user, err := d.db.LookupUserByID(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	prefs, err := d.db.GetNotificationPreferences(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+
+	delivered := map[string]bool{}
+	for _, name := range n.Channels {
+		delivered[name] = true
+	}
+
+	errs := []string{}
+	for _, channel := range userChannels(d.channels, prefs) {
+		if delivered[channel.Name()] {
+			continue
+		}
+		if err := channel.Send(ctx, user, n); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", channel.Name(),
+				err))
+			continue
+		}
+		n.Channels = append(n.Channels, channel.Name())
+	}
+
+	n.Attempts++
+	switch {
+	case len(errs) == 0:
+		n.Delivered = now
+		n.LastError = ""
+	case n.Attempts >= d.maxAttempts:
+		n.Failed = now
+		n.LastError = strings.Join(errs, "; ")
+		logger.Errorf("giving up on notification %v after %v attempts: %v",
+			n.ID, n.Attempts, n.LastError)
+	default:
+		n.NextAttempt = now.Add(Backoff(n.Attempts, d.minBackoff,
+			d.maxBackoff))
+		n.LastError = strings.Join(errs, "; ")
+	}
+
+	return d.db.UpdateNotificationDelivery(ctx, n)
+}
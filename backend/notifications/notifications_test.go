@@ -0,0 +1,322 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+// flakyChannel fails until it has failed failures times.
+type flakyChannel struct {
+	name     string
+	failures int
+	sent     []*database.Notification
+}
+
+func (c *flakyChannel) Name() string { return c.name }
+
+func (c *flakyChannel) Send(ctx context.Context, user *database.User, n *database.Notification) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("unavailable")
+	}
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+type testState struct {
+	db     *database.DB
+	clock  *util.MonoClock
+	list   *database.List
+	userB  *database.User
+	notify func()
+}
+
+// setupTestState creates a list owned by a with an item claimed by b.
+// notify queues a notification for b.
+func setupTestState(ctx context.Context, t *testing.T) *testState {
+	db := testutil.SetupTestDatabase(ctx, t)
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+	userA, userB := users.UserByUsername("a"), users.UserByUsername("b")
+	clock := &util.MonoClock{Time: time.Unix(1000, 0)}
+
+	list, err := db.CreateList(ctx, userA.ID,
+		&database.ListData{Name: "list", Active: true}, clock.Now())
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+	item, err := db.CreateListItem(ctx, list.ID, userA.ID,
+		&database.ListItemData{Name: "item"}, clock.Now())
+	if err != nil {
+		t.Fatalf("CreateListItem() = _, %v, want _, nil", err)
+	}
+	item, err = db.UpdateListItem(ctx, list.ID, item.ID, item.Version,
+		userB.ID, clock.Now(),
+		func(data *database.ListItemData, state *database.ListItemState) error {
+			state.SetClaim(userB.ID, 1)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+	}
+
+	return &testState{
+		db:    db,
+		clock: clock,
+		list:  list,
+		userB: userB,
+		notify: func() {
+			item, err = db.UpdateListItem(ctx, list.ID, item.ID,
+				item.Version, userA.ID, clock.Now(),
+				func(data *database.ListItemData, state *database.ListItemState) error {
+					data.Desc += "x"
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("UpdateListItem() = _, %v, want _, nil", err)
+			}
+		},
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	state := setupTestState(ctx, t)
+	defer state.db.Close()
+
+	good := &flakyChannel{name: "good"}
+	flaky := &flakyChannel{name: "flaky", failures: 2}
+	dispatcher := NewDispatcher(state.db, state.clock,
+		[]Channel{good, flaky}, 5, time.Minute, time.Hour)
+
+	state.notify()
+
+	// The first attempt only gets through on one channel.
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	if len(good.sent) != 1 || len(flaky.sent) != 0 {
+		t.Fatalf("after 1 run sent %v/%v, want 1/0", len(good.sent),
+			len(flaky.sent))
+	}
+	if good.sent[0].UserID != state.userB.ID ||
+		good.sent[0].Kind != database.NotifyItemChanged {
+		t.Errorf("sent %+v, want item change for b", good.sent[0])
+	}
+
+	// Nothing is retried until the backoff passes.
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+	if len(flaky.sent) != 0 || flaky.failures != 1 {
+		t.Errorf("retried before backoff")
+	}
+
+	// Retries only go to channels that haven't delivered yet. The second
+	// attempt fails, so the third waits twice as long.
+	for _, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		state.clock.Advance(wait)
+		if err := dispatcher.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce() = %v, want nil", err)
+		}
+	}
+	if len(good.sent) != 1 || len(flaky.sent) != 1 {
+		t.Errorf("after retries sent %v/%v, want 1/1", len(good.sent),
+			len(flaky.sent))
+	}
+
+	pending, err := state.db.ListPendingNotifications(ctx,
+		state.clock.Now().Add(24*time.Hour), 10)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("ListPendingNotifications() = %v, %v, want none", pending,
+			err)
+	}
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	ctx := context.Background()
+	state := setupTestState(ctx, t)
+	defer state.db.Close()
+
+	broken := &flakyChannel{name: "broken", failures: 100}
+	dispatcher := NewDispatcher(state.db, state.clock,
+		[]Channel{broken}, 2, time.Minute, time.Hour)
+
+	state.notify()
+	for i := 0; i < 3; i++ {
+		if err := dispatcher.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce() = %v, want nil", err)
+		}
+		state.clock.Advance(time.Hour)
+	}
+
+	if broken.failures != 98 {
+		t.Errorf("made %v attempts, want 2", 100-broken.failures)
+	}
+}
+
+func TestDispatcher_SurpriseProtection(t *testing.T) {
+	ctx := context.Background()
+	state := setupTestState(ctx, t)
+	defer state.db.Close()
+
+	channel := &flakyChannel{name: "channel"}
+	dispatcher := NewDispatcher(state.db, state.clock,
+		[]Channel{channel}, 5, time.Minute, time.Hour)
+
+	// The outbox never has notifications for owners, but if one shows up
+	// it isn't delivered.
+	n := &database.Notification{
+		UserID: state.list.OwnerID,
+		Kind:   database.NotifyClaimReleased,
+		ListID: state.list.ID,
+	}
+	if err := dispatcher.deliver(ctx, n); err != nil {
+		t.Fatalf("deliver() = %v, want nil", err)
+	}
+	if len(channel.sent) != 0 || n.Failed.IsZero() {
+		t.Errorf("deliver() sent %v, failed %v; want dropped",
+			channel.sent, n.Failed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	got := []time.Duration{}
+	for attempts := 1; attempts <= 5; attempts++ {
+		got = append(got, Backoff(attempts, time.Minute, 5*time.Minute))
+	}
+	want := []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+		5 * time.Minute,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Backoff() mismatch; -want,+got:\n%s", diff)
+	}
+}
+
+var (
+	testUser         = &database.User{ID: 2, Username: "b"}
+	testNotification = &database.Notification{
+		ID:      1,
+		UserID:  2,
+		Kind:    database.NotifyItemAdded,
+		ListID:  3,
+		ItemID:  4,
+		Message: "hello",
+		Created: time.Unix(1000, 0),
+	}
+	testPayload = &Payload{
+		ID: 1, User: "b", Kind: "item_added", ListID: 3, ItemID: 4,
+		Message: "hello", Created: 1000,
+	}
+)
+
+func TestWriterChannel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	channel := NewWriterChannel(buf)
+	if err := channel.Send(context.Background(), testUser, testNotification); err != nil {
+		t.Fatalf("Send() = %v, want nil", err)
+	}
+
+	got := &Payload{}
+	if err := json.Unmarshal(buf.Bytes(), got); err != nil {
+		t.Fatalf("bad payload %q: %v", buf.String(), err)
+	}
+	if diff := cmp.Diff(testPayload, got); diff != "" {
+		t.Errorf("payload mismatch; -want,+got:\n%s", diff)
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var got *Payload
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = &Payload{}
+		if err := json.Unmarshal(body, got); err != nil {
+			t.Errorf("bad payload %q: %v", string(body), err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	channel := NewWebhookChannel(server.URL, server.Client())
+	if err := channel.Send(context.Background(), testUser, testNotification); err != nil {
+		t.Fatalf("Send() = %v, want nil", err)
+	}
+	if diff := cmp.Diff(testPayload, got); diff != "" {
+		t.Errorf("payload mismatch; -want,+got:\n%s", diff)
+	}
+
+	status = http.StatusInternalServerError
+	if err := channel.Send(context.Background(), testUser, testNotification); err == nil {
+		t.Errorf("Send() = nil, want error for server failure")
+	}
+}
+
+func TestSMTPChannel(t *testing.T) {
+	channel := NewSMTPChannel("mail:25", nil, "xmaslist@example.com",
+		"example.com")
+
+	var gotTo []string
+	var gotMsg string
+	channel.sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotTo, gotMsg = to, string(msg)
+		return nil
+	}
+
+	if err := channel.Send(context.Background(), testUser, testNotification); err != nil {
+		t.Fatalf("Send() = %v, want nil", err)
+	}
+	if !cmp.Equal([]string{"b@example.com"}, gotTo) ||
+		!strings.Contains(gotMsg, "Subject: New item on a list\r\n") ||
+		!strings.HasSuffix(gotMsg, "\r\n\r\nhello\r\n") {
+		t.Errorf("sent %v %q, want mail to b", gotTo, gotMsg)
+	}
+}
+
+func TestSendMail_StalledServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v, want nil", err)
+	}
+	defer ln.Close()
+
+	// Accept the connection but never send the greeting.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ioutil.ReadAll(conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = sendMail(ctx, ln.Addr().String(), nil, "xmaslist@example.com",
+		[]string{"b@example.com"}, []byte("hello"))
+	if err == nil {
+		t.Errorf("sendMail() = nil, want error")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("sendMail() took %v, want it bounded by ctx", elapsed)
+	}
+}
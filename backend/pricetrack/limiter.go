@@ -0,0 +1,53 @@
+package pricetrack
+
+import (
+	"context"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+// hostLimiter spaces out requests to each host.
+type hostLimiter struct {
+	clock    util.Clock
+	interval time.Duration
+	last     map[string]time.Time
+
+	// Replaced by tests, which use a fake clock.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newHostLimiter(clock util.Clock, interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		clock:    clock,
+		interval: interval,
+		last:     map[string]time.Time{},
+		sleep:    sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// wait blocks until a request can be made to host, and records that one was.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if last, found := l.last[host]; found {
+		if d := last.Add(l.interval).Sub(l.clock.Now()); d > 0 {
+			if err := l.sleep(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	l.last[host] = l.clock.Now()
+	return nil
+}
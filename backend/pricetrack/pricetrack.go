@@ -0,0 +1,272 @@
+// Package pricetrack periodically checks the prices of items with URLs,
+// records them, and tells givers when prices drop below their thresholds.
+package pricetrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/dbutil"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var (
+	logger = grpclog.Component("pricetrack")
+
+	ErrNoPrice = errors.New("no price found")
+)
+
+// Parser extracts a price from a page.
+type Parser interface {
+	ParsePrice(page *unfurl.Page) (price int64, currency string, err error)
+}
+
+// UnfurlParser finds prices using the page metadata understood by unfurl.
+type UnfurlParser struct{}
+
+func (p *UnfurlParser) ParsePrice(page *unfurl.Page) (int64, string, error) {
+	preview, err := unfurl.Parse(page.URL, page.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	if preview.Price == 0 || preview.Currency == "" {
+		return 0, "", ErrNoPrice
+	}
+	return preview.Price, preview.Currency, nil
+}
+
+// Alerter tells givers about price drops.
+type Alerter interface {
+	PriceDropped(ctx context.Context, userID int, item *database.ListItem, point *database.PricePoint, threshold int64) error
+}
+
+// LogAlerter is an Alerter that only logs.
+type LogAlerter struct{}
+
+func (a *LogAlerter) PriceDropped(ctx context.Context, userID int, item *database.ListItem, point *database.PricePoint, threshold int64) error {
+	logger.Infof("alert user %v: item %v (list %v) is now %v %v, below %v",
+		userID, item.ID, item.ListID, point.Price, point.Currency,
+		threshold)
+	return nil
+}
+
+// OutboxAlerter is an Alerter that queues a notification for the giver.
+type OutboxAlerter struct {
+	db    *database.DB
+	clock util.Clock
+}
+
+func NewOutboxAlerter(db *database.DB, clock util.Clock) *OutboxAlerter {
+	return &OutboxAlerter{db: db, clock: clock}
+}
+
+// formatPrice formats a price given in minor units (e.g. cents) of currency.
+func formatPrice(price int64, currency string) string {
+	sign, abs := "", uint64(price)
+	if price < 0 {
+		sign, abs = "-", uint64(-price)
+	}
+
+	exp := unfurl.CurrencyExponent(currency)
+	if exp == 0 {
+		return fmt.Sprintf("%s%d %v", sign, abs, currency)
+	}
+
+	scale := uint64(1)
+	for i := 0; i < exp; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %v", sign, abs/scale, exp, abs%scale,
+		currency)
+}
+
+func (a *OutboxAlerter) PriceDropped(ctx context.Context, userID int, item *database.ListItem, point *database.PricePoint, threshold int64) error {
+	list, err := dbutil.GetList(ctx, a.db, item.ListID)
+	if err != nil {
+		return err
+	}
+
+	return a.db.EnqueueNotification(ctx, userID, &database.Notification{
+		Kind:   database.NotifyPriceDropped,
+		ListID: item.ListID,
+		ItemID: item.ID,
+		Message: fmt.Sprintf("%q on %q is now %v, below your alert "+
+			"price of %v", item.Name, list.Name,
+			formatPrice(point.Price, point.Currency),
+			formatPrice(threshold, point.Currency)),
+		Created: a.clock.Now(),
+	})
+}
+
+type Tracker struct {
+	db            *database.DB
+	clock         util.Clock
+	fetcher       unfurl.Fetcher
+	parser        Parser
+	alerter       Alerter
+	checkInterval time.Duration
+	limiter       *hostLimiter
+}
+
+// NewTracker returns a Tracker that checks each item's price every
+// checkInterval, fetching from any one host at most once every hostInterval.
+func NewTracker(db *database.DB, clock util.Clock, fetcher unfurl.Fetcher, parser Parser, alerter Alerter, checkInterval, hostInterval time.Duration) *Tracker {
+	return &Tracker{
+		db:            db,
+		clock:         clock,
+		fetcher:       fetcher,
+		parser:        parser,
+		alerter:       alerter,
+		checkInterval: checkInterval,
+		limiter:       newHostLimiter(clock, hostInterval),
+	}
+}
+
+// Run looks for items due a price check every interval, as measured by the
+// Tracker's clock, until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := t.RunOnce(ctx); err != nil {
+			logger.Errorf("price check failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce checks the prices of all items that are due. Failures for
+// individual items are recorded and retried when the items are next due.
+func (t *Tracker) RunOnce(ctx context.Context) error {
+	items, err := t.db.ListItemsForPriceCheck(ctx,
+		t.clock.Now().Add(-t.checkInterval))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range interleaveByHost(items) {
+		host := itemHost(item)
+		if err := t.limiter.wait(ctx, host); err != nil {
+			return err
+		}
+
+		if err := t.checkItem(ctx, item); err != nil {
+			logger.Warningf("price check for item %v failed: %v",
+				item.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func itemHost(item *database.ListItem) string {
+	u, err := url.Parse(item.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// interleaveByHost orders items so consecutive fetches go to different hosts
+// where possible, so the rate limit for one host doesn't hold up the rest.
+func interleaveByHost(items []*database.ListItem) []*database.ListItem {
+	hosts := []string{}
+	byHost := map[string][]*database.ListItem{}
+	for _, item := range items {
+		host := itemHost(item)
+		if _, found := byHost[host]; !found {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], item)
+	}
+
+	out := []*database.ListItem{}
+	for len(out) < len(items) {
+		for _, host := range hosts {
+			if len(byHost[host]) > 0 {
+				out = append(out, byHost[host][0])
+				byHost[host] = byHost[host][1:]
+			}
+		}
+	}
+	return out
+}
+
+func (t *Tracker) fetchPrice(ctx context.Context, item *database.ListItem) (*database.PricePoint, error) {
+	page, err := t.fetcher.Fetch(ctx, item.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	price, currency, err := t.parser.ParsePrice(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.PricePoint{
+		When:     t.clock.Now(),
+		Price:    price,
+		Currency: currency,
+	}, nil
+}
+
+func (t *Tracker) checkItem(ctx context.Context, item *database.ListItem) error {
+	point, checkErr := t.fetchPrice(ctx, item)
+
+	err := t.db.RecordPriceCheck(ctx, item.ID, t.clock.Now(), point, checkErr)
+	if err != nil {
+		return err
+	}
+	if checkErr != nil {
+		return checkErr
+	}
+
+	// Thresholds are in the item's currency, so we can't compare
+	// against prices in anything else.
+	if item.Currency != "" && item.Currency != point.Currency {
+		return nil
+	}
+
+	alerts, err := t.db.ListPriceAlerts(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		below := point.Price < alert.Threshold
+		alerted := !alert.AlertedWhen.IsZero()
+
+		switch {
+		case below && !alerted:
+			err := t.alerter.PriceDropped(ctx, alert.UserID, item,
+				point, alert.Threshold)
+			if err != nil {
+				return err
+			}
+			err = t.db.SetPriceAlertAlerted(ctx, item.ID,
+				alert.UserID, t.clock.Now())
+			if err != nil {
+				return err
+			}
+
+		case !below && alerted:
+			// Re-arm, so the user hears about the next drop.
+			err := t.db.SetPriceAlertAlerted(ctx, item.ID,
+				alert.UserID, time.Time{})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package pricetrack
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/unfurl"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+// plainFetcher fetches without unfurl's address checks, so it can talk to
+// the local stub server.
+type plainFetcher struct{}
+
+func (f *plainFetcher) Fetch(ctx context.Context, rawURL string) (*unfurl.Page, error) {
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch failed: %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return &unfurl.Page{URL: resp.Request.URL, ContentType: contentType,
+		Body: body}, nil
+}
+
+// priceServer serves product pages with settable prices.
+type priceServer struct {
+	mu     sync.Mutex
+	prices map[string]string
+}
+
+func (s *priceServer) set(path, price string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[path] = price
+}
+
+func (s *priceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	price, found := s.prices[r.URL.Path]
+	s.mu.Unlock()
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<meta property="product:price:amount" content="%s">
+	                <meta property="product:price:currency" content="USD">`,
+		price)
+}
+
+type alert struct {
+	UserID    int
+	ItemID    int
+	Price     int64
+	Threshold int64
+}
+
+type fakeAlerter struct {
+	alerts []alert
+}
+
+func (a *fakeAlerter) PriceDropped(ctx context.Context, userID int, item *database.ListItem, point *database.PricePoint, threshold int64) error {
+	a.alerts = append(a.alerts, alert{userID, item.ID, point.Price, threshold})
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+
+	prices := &priceServer{prices: map[string]string{
+		"/a": "20.00",
+		"/b": "5.00",
+	}}
+	srv := httptest.NewServer(prices)
+	defer srv.Close()
+
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	clock := &util.MonoClock{Time: time.Unix(1000, 0)}
+	list, err := db.CreateList(ctx, users.UserByUsername("a").ID,
+		&database.ListData{Name: "l", Active: true}, clock.Now())
+	if err != nil {
+		t.Fatalf("CreateList() = %v", err)
+	}
+
+	createItem := func(url string) *database.ListItem {
+		item, err := db.CreateListItem(ctx, list.ID, list.OwnerID,
+			&database.ListItemData{Name: url, URL: url,
+				Currency: "USD", Price: 100}, clock.Now())
+		if err != nil {
+			t.Fatalf("CreateListItem(%v) = %v", url, err)
+		}
+		return item
+	}
+	itemA := createItem(srv.URL + "/a")
+	itemB := createItem(srv.URL + "/b")
+	itemMissing := createItem(srv.URL + "/missing")
+
+	userB := users.UserByUsername("b")
+	if err := db.SetPriceAlert(ctx, itemA.ID, userB.ID, 1500); err != nil {
+		t.Fatalf("SetPriceAlert() = %v", err)
+	}
+
+	alerter := &fakeAlerter{}
+	tracker := NewTracker(db, clock, &plainFetcher{}, &UnfurlParser{},
+		alerter, 24*time.Hour, 10*time.Second)
+
+	sleeps := []time.Duration{}
+	tracker.limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		clock.Advance(d)
+		return nil
+	}
+
+	runOnce := func() {
+		t.Helper()
+		if err := tracker.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce() = %v, want nil", err)
+		}
+	}
+
+	runOnce()
+
+	// All three items are on the same host, so the second and third
+	// fetches wait.
+	if len(sleeps) != 2 {
+		t.Errorf("sleeps = %v, want 2", sleeps)
+	}
+	for _, d := range sleeps {
+		if d <= 0 || d > 10*time.Second {
+			t.Errorf("sleep %v, want (0, 10s]", d)
+		}
+	}
+	if len(alerter.alerts) != 0 {
+		t.Errorf("alerts = %v, want none", alerter.alerts)
+	}
+
+	// Nothing is due yet.
+	runOnce()
+	if history, _ := db.GetItemPriceHistory(ctx, itemA.ID); len(history) != 1 {
+		t.Errorf("history for a = %v, want 1 point", history)
+	}
+
+	// The price drops below b's threshold, so b is alerted once.
+	prices.set("/a", "12.00")
+	clock.Advance(25 * time.Hour)
+	runOnce()
+	clock.Advance(25 * time.Hour)
+	runOnce()
+
+	want := []alert{{userB.ID, itemA.ID, 1200, 1500}}
+	if diff := cmp.Diff(want, alerter.alerts); diff != "" {
+		t.Errorf("alerts mismatch; -want,+got:\n%v", diff)
+	}
+
+	// Going back up re-arms the alert for the next drop.
+	prices.set("/a", "16.00")
+	clock.Advance(25 * time.Hour)
+	runOnce()
+	prices.set("/a", "14.00")
+	clock.Advance(25 * time.Hour)
+	runOnce()
+
+	want = append(want, alert{userB.ID, itemA.ID, 1400, 1500})
+	if diff := cmp.Diff(want, alerter.alerts); diff != "" {
+		t.Errorf("alerts mismatch; -want,+got:\n%v", diff)
+	}
+
+	history, err := db.GetItemPriceHistory(ctx, itemA.ID)
+	if err != nil {
+		t.Fatalf("GetItemPriceHistory() = _, %v", err)
+	}
+	gotPrices := []int64{}
+	for _, point := range history {
+		gotPrices = append(gotPrices, point.Price)
+	}
+	if want := []int64{2000, 1200, 1200, 1600, 1400}; !cmp.Equal(want, gotPrices) {
+		t.Errorf("prices for a = %v, want %v", gotPrices, want)
+	}
+
+	if history, _ := db.GetItemPriceHistory(ctx, itemB.ID); len(history) != 5 {
+		t.Errorf("history for b = %v, want 5 points", history)
+	}
+	if history, _ := db.GetItemPriceHistory(ctx, itemMissing.ID); len(history) != 0 {
+		t.Errorf("history for missing = %v, want none", history)
+	}
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	items := []*database.ListItem{}
+	for i, url := range []string{"http://a/1", "http://a/2", "http://a/3",
+		"http://b/1", "http://c/1", "http://c/2"} {
+		item := &database.ListItem{ID: i}
+		item.URL = url
+		items = append(items, item)
+	}
+
+	got := []string{}
+	for _, item := range interleaveByHost(items) {
+		got = append(got, item.URL)
+	}
+
+	want := []string{"http://a/1", "http://b/1", "http://c/1",
+		"http://a/2", "http://c/2", "http://a/3"}
+	if !cmp.Equal(want, got) {
+		t.Errorf("interleaveByHost() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	type testCase struct {
+		price    int64
+		currency string
+		want     string
+	}
+
+	testCases := []testCase{
+		testCase{price: 1999, currency: "USD", want: "19.99 USD"},
+		testCase{price: 5, currency: "EUR", want: "0.05 EUR"},
+		testCase{price: -5, currency: "EUR", want: "-0.05 EUR"},
+		testCase{price: -1999, currency: "USD", want: "-19.99 USD"},
+		testCase{price: 1500, currency: "JPY", want: "1500 JPY"},
+		testCase{price: 1234, currency: "KWD", want: "1.234 KWD"},
+	}
+
+	for _, tc := range testCases {
+		if got := formatPrice(tc.price, tc.currency); got != tc.want {
+			t.Errorf("formatPrice(%v, %v) = %q, want %q",
+				tc.price, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestOutboxAlerter(t *testing.T) {
+	ctx := context.Background()
+	db := testutil.SetupTestDatabase(ctx, t)
+	defer db.Close()
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a", "b"})
+
+	resps := testutil.SetupLists(ctx, t, db, []*testutil.ListSetupRequest{
+		&testutil.ListSetupRequest{
+			Owner: "a",
+			List: &database.ListData{Name: "l1", Beneficiary: "b1",
+				EventDate: time.Unix(1, 0), Active: true},
+			ListItems: []*database.ListItemData{
+				&database.ListItemData{Name: "l1i1"},
+			},
+		},
+	})
+	_, item := resps.GetItem("l1", "l1i1")
+	userB := users.UserByUsername("b")
+
+	now := time.Unix(testutil.SetupListsUserStamp, 0)
+	alerter := NewOutboxAlerter(db, &util.MonoClock{Time: now})
+	point := &database.PricePoint{When: now, Price: 1999, Currency: "USD"}
+	if err := alerter.PriceDropped(ctx, userB.ID, item, point, 2500); err != nil {
+		t.Fatalf("PriceDropped() = %v, want nil", err)
+	}
+
+	got, err := db.ListPendingNotifications(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ListPendingNotifications() = _, %v, want _, nil", err)
+	}
+	want := []*database.Notification{{
+		UserID:      userB.ID,
+		Kind:        database.NotifyPriceDropped,
+		ListID:      item.ListID,
+		ItemID:      item.ID,
+		Message:     `"l1i1" on "l1" is now 19.99 USD, below your alert price of 25.00 USD`,
+		Created:     now,
+		NextAttempt: now,
+	}}
+	for _, n := range got {
+		n.ID = 0
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("notifications mismatch; -want,+got:\n%s", diff)
+	}
+}
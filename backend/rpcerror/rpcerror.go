@@ -0,0 +1,80 @@
+// Package rpcerror builds gRPC status errors carrying google.rpc error
+// details, so that clients can act on failures without parsing messages.
+package rpcerror
+
+import (
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Domain is the ErrorInfo domain for all errors from the backend.
+const Domain = "xmaslist"
+
+// ErrorInfo reasons. Clients depend on these, so they must not change.
+const (
+	// A change was made against a version other than the current one.
+	ReasonVersionMismatch = "VERSION_MISMATCH"
+
+	// A change made against an old version couldn't be merged.
+	ReasonMergeConflict = "MERGE_CONFLICT"
+
+	// Only the list's owner can do that.
+	ReasonNotOwner = "NOT_OWNER"
+
+	// Other permission and validation failures.
+	ReasonPermissionDenied = "PERMISSION_DENIED"
+	ReasonInvalidArgument  = "INVALID_ARGUMENT"
+)
+
+// New returns a status with an ErrorInfo detail for reason, followed by
+// any other details.
+func New(code codes.Code, reason string, metadata map[string]string, msg string, details ...proto.Message) *status.Status {
+	st := status.New(code, msg)
+	if code == codes.OK {
+		// OK statuses can't carry details.
+		return st
+	}
+
+	all := []proto.Message{&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   Domain,
+		Metadata: metadata,
+	}}
+	all = append(all, details...)
+
+	pb := st.Proto()
+	for _, detail := range all {
+		packed, err := anypb.New(detail)
+		if err != nil {
+			return st
+		}
+		pb.Details = append(pb.Details, packed)
+	}
+	return status.FromProto(pb)
+}
+
+// Errorf returns an error with an ErrorInfo detail for reason.
+func Errorf(code codes.Code, reason string, format string, args ...interface{}) error {
+	return New(code, reason, nil, fmt.Sprintf(format, args...)).Err()
+}
+
+// Reason returns the ErrorInfo reason carried by err, or the empty string if
+// it doesn't have one.
+func Reason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+// HasDetails returns true if err carries any error details.
+func HasDetails(err error) bool {
+	return len(status.Convert(err).Proto().GetDetails()) > 0
+}
@@ -0,0 +1,60 @@
+package rpcerror
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorf(t *testing.T) {
+	err := Errorf(codes.PermissionDenied, ReasonNotOwner, "user %v", 1)
+	if status.Code(err) != codes.PermissionDenied ||
+		status.Convert(err).Message() != "user 1" {
+		t.Errorf("Errorf() = %v, want PermissionDenied: user 1", err)
+	}
+	if got := Reason(err); got != ReasonNotOwner {
+		t.Errorf("Reason(%v) = %q, want %q", err, got, ReasonNotOwner)
+	}
+}
+
+func TestNew(t *testing.T) {
+	failure := &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{
+			{Type: ReasonVersionMismatch, Subject: "lists/1"},
+		},
+	}
+	st := New(codes.FailedPrecondition, ReasonVersionMismatch,
+		map[string]string{"current_version": "2"}, "mismatch", failure)
+
+	details := st.Details()
+	if len(details) != 2 {
+		t.Fatalf("New().Details() = %v, want 2 details", details)
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok || info.GetDomain() != Domain ||
+		info.GetMetadata()["current_version"] != "2" {
+		t.Errorf("New().Details()[0] = %v, want ErrorInfo", details[0])
+	}
+	if got, ok := details[1].(*errdetails.PreconditionFailure); !ok ||
+		got.GetViolations()[0].GetSubject() != "lists/1" {
+		t.Errorf("New().Details()[1] = %v, want PreconditionFailure",
+			details[1])
+	}
+}
+
+func TestReason(t *testing.T) {
+	for _, err := range []error{
+		errors.New("plain"),
+		status.Errorf(codes.InvalidArgument, "no details"),
+	} {
+		if got := Reason(err); got != "" {
+			t.Errorf("Reason(%v) = %q, want empty", err, got)
+		}
+		if HasDetails(err) {
+			t.Errorf("HasDetails(%v) = true, want false", err)
+		}
+	}
+}
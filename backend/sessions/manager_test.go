@@ -73,7 +73,7 @@ func TestSessionIDFromCookie(t *testing.T) {
 
 	if ok, sessionID := manager.SessionIDFromCookie(cookie); !ok || sessionID <= 0 || wantSessionID != sessionID {
 		t.Fatalf(`SessionIDFromCookie(%v) = %v, %v; want true, %v`,
-			cookie, ok, wantSessionID)
+			cookie, ok, sessionID, wantSessionID)
 	}
 
 	badCookie := cookie + "bad"
@@ -139,8 +139,8 @@ func TestCreateSession_MultipleUsers(t *testing.T) {
 	wantExpiryA := testState.Clock.Time.Add(sessionLength)
 	cookieA, expiryA, err := manager.CreateSession(ctx, userA)
 	if err != nil || expiryA != wantExpiryA {
-		t.Fatalf("CreateSession A = _, %v, %v, want _, %v, nil",
-			cookieA, expiryA, wantExpiryA, err)
+		t.Fatalf("CreateSession A = %v, %v, %v, want _, %v, nil",
+			cookieA, expiryA, err, wantExpiryA)
 	}
 
 	// Advance the clock so we're not creating B's session at the same time
@@ -152,8 +152,8 @@ func TestCreateSession_MultipleUsers(t *testing.T) {
 	wantExpiryB := testState.Clock.Time.Add(sessionLength)
 	cookieB, expiryB, err := manager.CreateSession(ctx, userB)
 	if err != nil || expiryB != wantExpiryB {
-		t.Fatalf("CreateSession B = _, %v, %v, want _, %v, nil",
-			cookieB, expiryB, wantExpiryB, err)
+		t.Fatalf("CreateSession B = %v, %v, %v, want _, %v, nil",
+			cookieB, expiryB, err, wantExpiryB)
 	}
 
 	sessionIDA, _, err := parseCookie(cookieA)
@@ -0,0 +1,226 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout  = 10 * time.Second
+	DefaultMaxBytes = 1 << 20
+	maxRedirects    = 5
+	userAgent       = "xmaslist-unfurl/1.0"
+)
+
+var (
+	// Addresses we refuse to connect to, so clients can't use the server
+	// to probe the network it runs on.
+	blockedNets = mustParseCIDRs(
+		"0.0.0.0/8",      // "this" network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local, incl. cloud metadata
+		"172.16.0.0/12",  // private
+		"192.0.0.0/24",   // IETF protocol assignments
+		"192.168.0.0/16", // private
+		"198.18.0.0/15",  // benchmarking
+		"224.0.0.0/4",    // multicast
+		"240.0.0.0/4",    // reserved, incl. broadcast
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"64:ff9b::/96",   // NAT64
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link-local
+		"ff00::/8",       // multicast
+	)
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("bad cidr %v: %v", cidr, err))
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// ErrBlockedAddress is returned when a URL resolves to an address we won't
+// connect to.
+type ErrBlockedAddress struct {
+	IP net.IP
+}
+
+func (e *ErrBlockedAddress) Error() string {
+	return fmt.Sprintf("address %v is not allowed", e.IP)
+}
+
+func checkPublicIP(ip net.IP) error {
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return &ErrBlockedAddress{IP: ip}
+		}
+	}
+	return nil
+}
+
+// Page is a fetched web page.
+type Page struct {
+	// The URL the page was fetched from, after redirects.
+	URL         *url.URL
+	ContentType string
+	Body        []byte
+}
+
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*Page, error)
+}
+
+// HTTPFetcher fetches pages from the internet. It only connects to public
+// addresses, and reads at most maxBytes of each page.
+type HTTPFetcher struct {
+	client   *http.Client
+	maxBytes int64
+
+	// Returns an error if the fetcher mustn't connect to ip. Replaced
+	// by tests, which need to talk to local servers.
+	checkIP func(ip net.IP) error
+}
+
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	f := &HTTPFetcher{
+		maxBytes: maxBytes,
+		checkIP:  checkPublicIP,
+	}
+	f.client = newCheckedClient(timeout, func(ip net.IP) error {
+		return f.checkIP(ip)
+	})
+	return f
+}
+
+// NewPublicClient returns an HTTP client that, like HTTPFetcher, only
+// connects to public addresses. It's for requests to other user-supplied
+// URLs.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	return newCheckedClient(timeout, checkPublicIP)
+}
+
+// newCheckedClient returns an HTTP client that only connects to addresses
+// checkIP allows.
+func newCheckedClient(timeout time.Duration, checkIP func(ip net.IP) error) *http.Client {
+	// Addresses are checked as the connection is made, after DNS
+	// resolution, so a hostname can't be rebound to a private address
+	// between a check and the connection. This also covers redirects.
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("bad address %v", address)
+			}
+			return checkIP(ip)
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy: we'd be checking the proxy's address
+			// rather than the destination's.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			if err := checkScheme(req.URL); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// ParseURL parses and checks a URL supplied by a user.
+func ParseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("URL has no host")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("URLs with credentials aren't allowed")
+	}
+	return u, nil
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch failed: %v", resp.Status)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	// Pages bigger than the limit are truncated rather than rejected.
+	// The metadata we want is usually at the top.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{
+		URL:         resp.Request.URL,
+		ContentType: contentType,
+		Body:        body,
+	}, nil
+}
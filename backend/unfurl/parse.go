@@ -0,0 +1,334 @@
+package unfurl
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Preview is what we could learn about a page.
+type Preview struct {
+	Title       string
+	Description string
+	ImageURL    string
+
+	// Price in minor currency units (e.g. cents). Zero if unknown.
+	Price    int64
+	Currency string
+}
+
+// metadata collects candidate values from the different sources in a page.
+type metadata struct {
+	title    string // <title>
+	metaDesc string // <meta name=description>
+	og       map[string]string
+	jsonLD   []string
+}
+
+// Parse extracts a preview from an HTML page fetched from base. Structured
+// data (schema.org Product JSON-LD) is preferred, then OpenGraph, then the
+// page title and description.
+func Parse(base *url.URL, body []byte) (*Preview, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	md := &metadata{og: map[string]string{}}
+	md.walk(doc)
+
+	preview := &Preview{
+		Title:       md.title,
+		Description: md.metaDesc,
+	}
+
+	if v := md.og["og:title"]; v != "" {
+		preview.Title = v
+	}
+	if v := md.og["og:description"]; v != "" {
+		preview.Description = v
+	}
+	preview.ImageURL = firstNonEmpty(md.og["og:image:secure_url"],
+		md.og["og:image:url"], md.og["og:image"])
+
+	amount := firstNonEmpty(md.og["product:price:amount"],
+		md.og["og:price:amount"])
+	currency := firstNonEmpty(md.og["product:price:currency"],
+		md.og["og:price:currency"])
+	if price, ok := parsePrice(amount, currency); ok && currency != "" {
+		preview.Price = price
+		preview.Currency = strings.ToUpper(currency)
+	}
+
+	for _, raw := range md.jsonLD {
+		if product := findProduct(raw); product != nil {
+			product.apply(preview)
+			break
+		}
+	}
+
+	preview.Title = cleanText(preview.Title)
+	preview.Description = cleanText(preview.Description)
+	preview.ImageURL = resolveURL(base, preview.ImageURL)
+
+	return preview, nil
+}
+
+func (md *metadata) walk(n *html.Node) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Title:
+			if md.title == "" {
+				md.title = textContent(n)
+			}
+		case atom.Meta:
+			md.meta(n)
+		case atom.Script:
+			if strings.EqualFold(attr(n, "type"), "application/ld+json") {
+				md.jsonLD = append(md.jsonLD, textContent(n))
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		md.walk(c)
+	}
+}
+
+func (md *metadata) meta(n *html.Node) {
+	content := attr(n, "content")
+	if content == "" {
+		return
+	}
+
+	// OpenGraph uses property, but name is common in the wild.
+	key := strings.ToLower(firstNonEmpty(attr(n, "property"), attr(n, "name")))
+	switch {
+	case key == "description":
+		if md.metaDesc == "" {
+			md.metaDesc = content
+		}
+	case strings.HasPrefix(key, "og:") || strings.HasPrefix(key, "product:"):
+		if _, found := md.og[key]; !found {
+			md.og[key] = content
+		}
+	}
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, name) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// product is the subset of a schema.org Product that we use.
+type product struct {
+	Name        string
+	Description string
+	Image       string
+	Price       string
+	Currency    string
+}
+
+func (p *product) apply(preview *Preview) {
+	if p.Name != "" {
+		preview.Title = p.Name
+	}
+	if p.Description != "" {
+		preview.Description = p.Description
+	}
+	if p.Image != "" {
+		preview.ImageURL = p.Image
+	}
+	if price, ok := parsePrice(p.Price, p.Currency); ok && p.Currency != "" {
+		preview.Price = price
+		preview.Currency = strings.ToUpper(p.Currency)
+	}
+}
+
+// findProduct looks for a Product in a JSON-LD block. Blocks can hold a
+// single object, an array of them, or an @graph.
+func findProduct(raw string) *product {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil
+	}
+	return findProductIn(v)
+}
+
+func findProductIn(v interface{}) *product {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			if p := findProductIn(elem); p != nil {
+				return p
+			}
+		}
+
+	case map[string]interface{}:
+		if hasType(v["@type"], "Product") {
+			return productFromJSON(v)
+		}
+		if graph, found := v["@graph"]; found {
+			return findProductIn(graph)
+		}
+	}
+
+	return nil
+}
+
+func hasType(v interface{}, want string) bool {
+	switch v := v.(type) {
+	case string:
+		return v == want || v == "http://schema.org/"+want ||
+			v == "https://schema.org/"+want
+	case []interface{}:
+		for _, elem := range v {
+			if hasType(elem, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func productFromJSON(v map[string]interface{}) *product {
+	p := &product{
+		Name:        jsonString(v["name"]),
+		Description: jsonString(v["description"]),
+		Image:       jsonImage(v["image"]),
+	}
+
+	offers := v["offers"]
+	if list, ok := offers.([]interface{}); ok && len(list) > 0 {
+		offers = list[0]
+	}
+	if offer, ok := offers.(map[string]interface{}); ok {
+		p.Price = firstNonEmpty(jsonString(offer["price"]),
+			jsonString(offer["lowPrice"]))
+		p.Currency = jsonString(offer["priceCurrency"])
+	}
+
+	return p
+}
+
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// jsonImage handles the many ways of specifying a schema.org image: a URL, an
+// ImageObject, or an array of either.
+func jsonImage(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonImage(v[0])
+		}
+	case map[string]interface{}:
+		return jsonString(v["url"])
+	}
+	return ""
+}
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit isn't a
+// hundredth of the major unit.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0,
+	"KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0,
+	"VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3,
+	"TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// CurrencyExponent returns the number of decimal places in currency's minor
+// unit: 2 for USD (cents), 0 for JPY, 3 for KWD. Unknown currencies are
+// assumed to use 2.
+func CurrencyExponent(currency string) int {
+	if exp, found := currencyExponents[strings.ToUpper(currency)]; found {
+		return exp
+	}
+	return 2
+}
+
+// parsePrice converts a decimal price like "1,299.99" into minor units of
+// currency.
+func parsePrice(s, currency string) (int64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 || f > 1e12 {
+		return 0, false
+	}
+
+	return int64(math.Round(f * math.Pow10(CurrencyExponent(currency)))), true
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// cleanText collapses runs of whitespace.
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// resolveURL makes ref absolute relative to base. Only http(s) URLs are
+// returned.
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
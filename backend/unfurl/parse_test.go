@@ -0,0 +1,107 @@
+package unfurl
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://shop.example.com/products/widget?x=1")
+
+	type testCase struct {
+		name string
+		page string
+		want *Preview
+	}
+
+	testCases := []testCase{
+		testCase{
+			name: "title only",
+			page: `<html><head><title>
+			         A  Widget &amp; Friends
+			       </title>
+			       <meta name="description" content="The best widget">
+			       </head><body></body></html>`,
+			want: &Preview{
+				Title:       "A Widget & Friends",
+				Description: "The best widget",
+			},
+		},
+		testCase{
+			name: "opengraph",
+			page: `<html><head><title>Shop | Widget</title>
+			       <meta property="og:title" content="Widget">
+			       <meta property="og:description" content="OG desc">
+			       <meta property="og:image" content="/img/widget.jpg">
+			       <meta property="product:price:amount" content="1,299.50">
+			       <meta property="product:price:currency" content="usd">
+			       </head></html>`,
+			want: &Preview{
+				Title:       "Widget",
+				Description: "OG desc",
+				ImageURL:    "https://shop.example.com/img/widget.jpg",
+				Price:       129950,
+				Currency:    "USD",
+			},
+		},
+		testCase{
+			name: "json-ld beats opengraph",
+			page: `<html><head><title>Shop | Widget</title>
+			       <meta property="og:title" content="OG Widget">
+			       <meta property="og:image" content="https://cdn.example.com/og.jpg">
+			       <script type="application/ld+json">
+			       {"@context": "https://schema.org",
+			        "@graph": [
+			          {"@type": "BreadcrumbList"},
+			          {"@type": ["Product", "Thing"],
+			           "name": "LD Widget",
+			           "description": "LD desc",
+			           "image": [{"@type": "ImageObject", "url": "ld.jpg"}],
+			           "offers": [{"@type": "Offer", "price": 19.99,
+			                       "priceCurrency": "EUR"}]}
+			        ]}
+			       </script>
+			       </head></html>`,
+			want: &Preview{
+				Title:       "LD Widget",
+				Description: "LD desc",
+				ImageURL:    "https://shop.example.com/products/ld.jpg",
+				Price:       1999,
+				Currency:    "EUR",
+			},
+		},
+		testCase{
+			name: "bad json-ld and image scheme ignored",
+			page: `<html><head><title>Widget</title>
+			       <meta property="og:image" content="javascript:alert(1)">
+			       <script type="application/ld+json">{not json</script>
+			       </head></html>`,
+			want: &Preview{Title: "Widget"},
+		},
+		testCase{
+			name: "zero-decimal currency",
+			page: `<meta property="og:price:amount" content="1,500">
+			       <meta property="og:price:currency" content="jpy">`,
+			want: &Preview{Price: 1500, Currency: "JPY"},
+		},
+		testCase{
+			name: "price without currency ignored",
+			page: `<meta property="og:price:amount" content="10">`,
+			want: &Preview{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(base, []byte(tc.page))
+			if err != nil {
+				t.Fatalf("Parse() = _, %v, want _, nil", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse() mismatch; -want,+got:\n%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package unfurl fetches web pages and extracts product details (name,
+// description, image and price) from them.
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+const (
+	DefaultCacheTTL = time.Hour
+	maxCacheEntries = 1000
+)
+
+// ErrNotHTML is returned when the URL doesn't point to a web page.
+type ErrNotHTML struct {
+	ContentType string
+}
+
+func (e *ErrNotHTML) Error() string {
+	return fmt.Sprintf("not a web page (content type %q)", e.ContentType)
+}
+
+type cacheEntry struct {
+	preview *Preview
+	expiry  time.Time
+}
+
+// Unfurler makes previews of pages, caching the results.
+type Unfurler struct {
+	fetcher Fetcher
+	clock   util.Clock
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+func New(fetcher Fetcher, clock util.Clock, ttl time.Duration) *Unfurler {
+	return &Unfurler{
+		fetcher: fetcher,
+		clock:   clock,
+		ttl:     ttl,
+		cache:   map[string]*cacheEntry{},
+	}
+}
+
+func (u *Unfurler) Unfurl(ctx context.Context, rawURL string) (*Preview, error) {
+	if preview := u.lookup(rawURL); preview != nil {
+		return preview, nil
+	}
+
+	page, err := u.fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.ContentType != "text/html" &&
+		page.ContentType != "application/xhtml+xml" {
+		return nil, &ErrNotHTML{ContentType: page.ContentType}
+	}
+
+	preview, err := Parse(page.URL, page.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	u.store(rawURL, preview)
+	return copyPreview(preview), nil
+}
+
+func copyPreview(preview *Preview) *Preview {
+	out := *preview
+	return &out
+}
+
+func (u *Unfurler) lookup(rawURL string) *Preview {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, found := u.cache[rawURL]
+	if !found {
+		return nil
+	}
+	if !u.clock.Now().Before(entry.expiry) {
+		delete(u.cache, rawURL)
+		return nil
+	}
+	return copyPreview(entry.preview)
+}
+
+func (u *Unfurler) store(rawURL string, preview *Preview) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.clock.Now()
+	if len(u.cache) >= maxCacheEntries {
+		// Make room by dropping expired entries, or, failing that,
+		// everything. The cache is only there to absorb repeated
+		// requests for the same URL in a short period.
+		for key, entry := range u.cache {
+			if !now.Before(entry.expiry) {
+				delete(u.cache, key)
+			}
+		}
+		if len(u.cache) >= maxCacheEntries {
+			u.cache = map[string]*cacheEntry{}
+		}
+	}
+
+	u.cache[rawURL] = &cacheEntry{
+		preview: preview,
+		expiry:  now.Add(u.ttl),
+	}
+}
@@ -0,0 +1,64 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+func TestUnfurler(t *testing.T) {
+	ctx := context.Background()
+
+	var fetches int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/widget", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<title>Widget %d</title>`, n)
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "png")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	fetcher := NewHTTPFetcher(DefaultTimeout, DefaultMaxBytes)
+	fetcher.checkIP = allowLoopback
+	clock := &util.MonoClock{Time: time.Unix(1000, 0)}
+	unfurler := New(fetcher, clock, time.Hour)
+
+	want := &Preview{Title: "Widget 1"}
+	for i := 0; i < 2; i++ {
+		got, err := unfurler.Unfurl(ctx, srv.URL+"/widget")
+		if err != nil {
+			t.Fatalf("Unfurl() = _, %v, want _, nil", err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unfurl() #%d mismatch; -want,+got:\n%v", i, diff)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %v, want 1 (cached)", n)
+	}
+
+	clock.Advance(2 * time.Hour)
+	got, err := unfurler.Unfurl(ctx, srv.URL+"/widget")
+	if err != nil || got.Title != "Widget 2" {
+		t.Errorf("Unfurl() after expiry = %+v, %v, want Widget 2", got,
+			err)
+	}
+
+	if _, err := unfurler.Unfurl(ctx, srv.URL+"/image.png"); err == nil {
+		t.Errorf("Unfurl(image) = _, nil, want error")
+	} else if _, ok := err.(*ErrNotHTML); !ok {
+		t.Errorf("Unfurl(image) = _, %v, want ErrNotHTML", err)
+	}
+}
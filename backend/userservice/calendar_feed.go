@@ -0,0 +1,74 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/simmonmt/xmaslist/backend/calendar"
+	"github.com/simmonmt/xmaslist/backend/database"
+
+	uspb "github.com/simmonmt/xmaslist/proto/user_service"
+)
+
+func newCalendarFeedToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *userServer) calendarFeedFromDatabase(feed *database.CalendarFeed) *uspb.CalendarFeed {
+	out := &uspb.CalendarFeed{Token: feed.Token}
+	if s.calendarURL != "" {
+		out.Url = s.calendarURL + calendar.FeedPath(feed.Token)
+	}
+	return out
+}
+
+func (s *userServer) setCalendarFeed(ctx context.Context, userID int) (*database.CalendarFeed, error) {
+	token, err := newCalendarFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	return s.db.SetCalendarFeed(ctx, userID, token, s.clock.Now())
+}
+
+func (s *userServer) CreateCalendarFeed(ctx context.Context, req *uspb.CreateCalendarFeedRequest) (*uspb.CreateCalendarFeedResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	feed, err := s.db.GetCalendarFeed(ctx, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		feed, err = s.setCalendarFeed(ctx, session.User.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &uspb.CreateCalendarFeedResponse{
+		Feed: s.calendarFeedFromDatabase(feed),
+	}, nil
+}
+
+func (s *userServer) RotateCalendarFeed(ctx context.Context, req *uspb.RotateCalendarFeedRequest) (*uspb.RotateCalendarFeedResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	feed, err := s.setCalendarFeed(ctx, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uspb.RotateCalendarFeedResponse{
+		Feed: s.calendarFeedFromDatabase(feed),
+	}, nil
+}
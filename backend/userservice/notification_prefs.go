@@ -0,0 +1,133 @@
+package userservice
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	uspb "github.com/simmonmt/xmaslist/proto/user_service"
+)
+
+var eventToDatabase = map[uspb.NotificationEvent]database.NotificationKind{
+	uspb.NotificationEvent_ITEM_ADDED:     database.NotifyItemAdded,
+	uspb.NotificationEvent_ITEM_CHANGED:   database.NotifyItemChanged,
+	uspb.NotificationEvent_ITEM_DELETED:   database.NotifyItemDeleted,
+	uspb.NotificationEvent_CLAIM_RELEASED: database.NotifyClaimReleased,
+	uspb.NotificationEvent_LIST_CHANGED:   database.NotifyListChanged,
+	uspb.NotificationEvent_LIST_ARCHIVED:  database.NotifyListArchived,
+	uspb.NotificationEvent_EVENT_REMINDER: database.NotifyEventReminder,
+	uspb.NotificationEvent_CLAIM_EXPIRING: database.NotifyClaimExpiring,
+	uspb.NotificationEvent_PRICE_DROPPED:  database.NotifyPriceDropped,
+}
+
+var digestToDatabase = map[uspb.DigestFrequency]database.DigestFrequency{
+	uspb.DigestFrequency_IMMEDIATE: database.DeliverImmediately,
+	uspb.DigestFrequency_DAILY:     database.DeliverDaily,
+	uspb.DigestFrequency_WEEKLY:    database.DeliverWeekly,
+}
+
+func prefsFromDatabase(prefs *database.NotificationPreferences) *uspb.NotificationPreferences {
+	out := &uspb.NotificationPreferences{
+		Channels: prefs.Channels,
+	}
+
+	for _, kind := range prefs.Events {
+		for event, dbKind := range eventToDatabase {
+			if dbKind == kind {
+				out.Events = append(out.Events, event)
+			}
+		}
+	}
+	for digest, dbDigest := range digestToDatabase {
+		if dbDigest == prefs.Digest {
+			out.Digest = digest
+		}
+	}
+	for _, listID := range prefs.FollowedLists {
+		out.FollowedListIds = append(out.FollowedListIds,
+			strconv.Itoa(listID))
+	}
+
+	return out
+}
+
+func prefsFromProto(prefs *uspb.NotificationPreferences) (*database.NotificationPreferences, error) {
+	out := &database.NotificationPreferences{}
+
+	for _, channel := range prefs.GetChannels() {
+		if channel == "" || strings.Contains(channel, ",") {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"bad channel name %q", channel)
+		}
+		out.Channels = append(out.Channels, channel)
+	}
+
+	for _, event := range prefs.GetEvents() {
+		kind, found := eventToDatabase[event]
+		if !found {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"bad notification event %v", event)
+		}
+		out.Events = append(out.Events, kind)
+	}
+
+	digest, found := digestToDatabase[prefs.GetDigest()]
+	if !found {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"bad digest frequency %v", prefs.GetDigest())
+	}
+	out.Digest = digest
+
+	for _, id := range prefs.GetFollowedListIds() {
+		listID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"bad list id")
+		}
+		out.FollowedLists = append(out.FollowedLists, listID)
+	}
+
+	return out, nil
+}
+
+func (s *userServer) GetNotificationPreferences(ctx context.Context, req *uspb.GetNotificationPreferencesRequest) (*uspb.GetNotificationPreferencesResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	prefs, err := s.db.GetNotificationPreferences(ctx, session.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uspb.GetNotificationPreferencesResponse{
+		Preferences: prefsFromDatabase(prefs),
+	}, nil
+}
+
+func (s *userServer) SetNotificationPreferences(ctx context.Context, req *uspb.SetNotificationPreferencesRequest) (*uspb.SetNotificationPreferencesResponse, error) {
+	session, err := getSession(ctx)
+	if session == nil {
+		return nil, err
+	}
+
+	prefs, err := prefsFromProto(req.GetPreferences())
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err = s.db.SetNotificationPreferences(ctx, session.User.ID,
+		prefs, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &uspb.SetNotificationPreferencesResponse{
+		Preferences: prefsFromDatabase(prefs),
+	}, nil
+}
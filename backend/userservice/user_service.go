@@ -2,6 +2,7 @@ package userservice
 
 import (
 	"context"
+	"strings"
 
 	"github.com/simmonmt/xmaslist/backend/database"
 	"github.com/simmonmt/xmaslist/backend/request"
@@ -19,6 +20,9 @@ type userServer struct {
 
 	clock util.Clock
 	db    *database.DB
+
+	// Where calendar feeds are served from, if known.
+	calendarURL string
 }
 
 func getSession(ctx context.Context) (*sessions.Session, error) {
@@ -51,10 +55,11 @@ func (s *userServer) GetUsers(ctx context.Context, req *uspb.GetUsersRequest) (*
 	return resp, nil
 }
 
-func RegisterHandlers(server *grpc.Server, clock util.Clock, db *database.DB) {
+func RegisterHandlers(server *grpc.Server, clock util.Clock, db *database.DB, calendarURL string) {
 	handlers := &userServer{
-		clock: clock,
-		db:    db,
+		clock:       clock,
+		db:          db,
+		calendarURL: strings.TrimSuffix(calendarURL, "/"),
 	}
 
 	uspb.RegisterUserServiceServer(server, handlers)
@@ -4,6 +4,10 @@ import "time"
 
 type Clock interface {
 	Now() time.Time
+
+	// After waits for d to elapse and then sends the current time on the
+	// returned channel.
+	After(d time.Duration) <-chan time.Time
 }
 
 type RealClock struct{}
@@ -12,6 +16,10 @@ func (c *RealClock) Now() time.Time {
 	return time.Now()
 }
 
+func (c *RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
 type MonoClock struct {
 	Time time.Time
 }
@@ -25,3 +33,11 @@ func (c *MonoClock) Now() time.Time {
 func (c *MonoClock) Advance(d time.Duration) {
 	c.Time = c.Time.Add(d)
 }
+
+// After advances the clock by d rather than waiting for it.
+func (c *MonoClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Time
+	return ch
+}
@@ -0,0 +1,186 @@
+// Package webhooks delivers list and item changes to the endpoints
+// registered for them. Deliveries are signed with the webhook's secret, and
+// failed ones are retried with exponential backoff until they're given up
+// on, at which point they're kept as a dead-letter record.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/notifications"
+	"github.com/simmonmt/xmaslist/backend/util"
+	"google.golang.org/grpc/grpclog"
+)
+
+var logger = grpclog.Component("webhooks")
+
+const (
+	EventHeader     = "X-Xmaslist-Event"
+	DeliveryHeader  = "X-Xmaslist-Delivery"
+	TimestampHeader = "X-Xmaslist-Timestamp"
+	SignatureHeader = "X-Xmaslist-Signature"
+
+	DefaultMaxAttempts = 8
+	DefaultMinBackoff  = time.Minute
+	DefaultMaxBackoff  = 6 * time.Hour
+
+	batchSize = 100
+)
+
+// Sign returns the signature for a delivery body sent at timestamp: the
+// hex-encoded HMAC-SHA256, keyed by the webhook's secret, of the decimal
+// timestamp, a period, and the body. Receivers should check the timestamp
+// is recent to guard against replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Post sends a signed delivery to hook. Responses other than 2xx are
+// errors. deliveryID is zero for test deliveries.
+func Post(ctx context.Context, client *http.Client, hook *database.Webhook, deliveryID int, event database.WebhookEvent, body []byte, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event))
+	if deliveryID != 0 {
+		req.Header.Set(DeliveryHeader, strconv.Itoa(deliveryID))
+	}
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, now.Unix(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
+
+// A PayloadFunc renders a delivery at now. It returns the event to report,
+// which may differ from the one queued if the change is no longer visible
+// to the webhook's owner.
+type PayloadFunc func(ctx context.Context, hook *database.Webhook, d *database.WebhookDelivery, now time.Time) (database.WebhookEvent, []byte, error)
+
+type Dispatcher struct {
+	db          *database.DB
+	clock       util.Clock
+	client      *http.Client
+	payload     PayloadFunc
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewDispatcher returns a Dispatcher that renders deliveries with payload
+// and posts them with client. Failed deliveries are retried after
+// minBackoff, doubling for each attempt up to maxBackoff, until maxAttempts
+// have been made.
+func NewDispatcher(db *database.DB, clock util.Clock, client *http.Client, payload PayloadFunc, maxAttempts int, minBackoff, maxBackoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		clock:       clock,
+		client:      client,
+		payload:     payload,
+		maxAttempts: maxAttempts,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+	}
+}
+
+// Run calls RunOnce every interval, as measured by the Dispatcher's clock,
+// until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := d.RunOnce(ctx); err != nil {
+			logger.Errorf("webhook dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(interval):
+		}
+	}
+}
+
+// RunOnce sends the deliveries that are due. Failed deliveries are
+// rescheduled.
+func (d *Dispatcher) RunOnce(ctx context.Context) error {
+	for {
+		pending, err := d.db.ListWebhookDeliveries(ctx,
+			database.PendingWebhookDeliveries(d.clock.Now(), batchSize))
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range pending {
+			if err := d.deliver(ctx, delivery); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *database.WebhookDelivery) error {
+	hooks, err := d.db.ListWebhooks(ctx,
+		database.OnlyWebhookWithID(delivery.WebhookID))
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		// Deleted since we listed the deliveries, taking them with it.
+		return nil
+	}
+	hook := hooks[0]
+
+	now := d.clock.Now()
+	event, body, err := d.payload(ctx, hook, delivery, now)
+	if err == nil {
+		err = Post(ctx, d.client, hook, delivery.ID, event, body, now)
+	}
+
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		delivery.Delivered = now
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Failed = now
+		delivery.LastError = err.Error()
+		logger.Errorf("giving up on webhook delivery %v after %v attempts: %v",
+			delivery.ID, delivery.Attempts, err)
+	default:
+		delivery.NextAttempt = now.Add(notifications.Backoff(
+			delivery.Attempts, d.minBackoff, d.maxBackoff))
+		delivery.LastError = err.Error()
+	}
+
+	return d.db.UpdateWebhookDelivery(ctx, delivery)
+}
@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/backend/database/testutil"
+	"github.com/simmonmt/xmaslist/backend/util"
+)
+
+var (
+	ctx = context.Background()
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+// receiver is a webhook endpoint that fails until it has failed failures
+// times.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*request
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	r.requests = append(r.requests, &request{req.Header, string(body)})
+}
+
+func (r *receiver) received() []*request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*request{}, r.requests...)
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=026360fb6284f077f1148b1ae7c62679730497810a6a0321574de01e8b009e7a"
+	if got := Sign("secret", 1000, []byte("{}")); got != want {
+		t.Errorf(`Sign("secret", 1000, "{}") = %v, want %v`, got, want)
+	}
+}
+
+type testState struct {
+	db         *database.DB
+	clock      *util.MonoClock
+	receiver   *receiver
+	server     *httptest.Server
+	hook       *database.Webhook
+	dispatcher *Dispatcher
+	change     func()
+}
+
+// setupTestState registers a webhook for a list, served by a receiver that
+// fails failures times. change makes a change to the list.
+func setupTestState(t *testing.T, failures int) *testState {
+	db := testutil.SetupTestDatabase(ctx, t)
+	users := testutil.CreateTestUsers(ctx, t, db, []string{"a"})
+	userA := users.UserByUsername("a")
+	clock := &util.MonoClock{Time: time.Unix(1000, 0)}
+
+	rcv := &receiver{failures: failures}
+	server := httptest.NewServer(rcv)
+
+	list, err := db.CreateList(ctx, userA.ID,
+		&database.ListData{Name: "list", Active: true}, clock.Now())
+	if err != nil {
+		t.Fatalf("CreateList() = _, %v, want _, nil", err)
+	}
+
+	hook, err := db.CreateWebhook(ctx, &database.Webhook{
+		OwnerID: userA.ID,
+		ListID:  list.ID,
+		URL:     server.URL,
+		Secret:  "secret",
+		Created: clock.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook() = _, %v, want _, nil", err)
+	}
+
+	payload := func(ctx context.Context, hook *database.Webhook, d *database.WebhookDelivery, now time.Time) (database.WebhookEvent, []byte, error) {
+		return d.Event, []byte(`{"list":` + strconv.Itoa(d.ListID) + `}`), nil
+	}
+
+	return &testState{
+		db:       db,
+		clock:    clock,
+		receiver: rcv,
+		server:   server,
+		hook:     hook,
+		dispatcher: NewDispatcher(db, clock, server.Client(), payload,
+			3, time.Minute, time.Hour),
+		change: func() {
+			list, err = db.UpdateList(ctx, list.ID, list.Version,
+				userA.ID, clock.Now(),
+				func(data *database.ListData) error {
+					data.Name += "x"
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("UpdateList() = _, %v, want _, nil", err)
+			}
+		},
+	}
+}
+
+func (s *testState) close() {
+	s.server.Close()
+	s.db.Close()
+}
+
+func (s *testState) runOnce(t *testing.T) {
+	t.Helper()
+	if err := s.dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() = %v, want nil", err)
+	}
+}
+
+func (s *testState) deliveries(t *testing.T) []*database.WebhookDelivery {
+	t.Helper()
+	deliveries, err := s.db.ListWebhookDeliveries(ctx,
+		database.WebhookDeliveriesFor(s.hook.ID, false))
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() = _, %v, want _, nil", err)
+	}
+	return deliveries
+}
+
+func TestDispatcher(t *testing.T) {
+	state := setupTestState(t, 1)
+	defer state.close()
+
+	state.change()
+
+	// The first attempt fails, and isn't retried until the backoff
+	// passes.
+	state.runOnce(t)
+	state.runOnce(t)
+	if got := state.receiver.received(); len(got) != 0 {
+		t.Fatalf("received %v, want nothing", got)
+	}
+	d := state.deliveries(t)[0]
+	if d.Attempts != 1 || d.LastError == "" || !d.Delivered.IsZero() {
+		t.Errorf("delivery after failure = %+v, want 1 attempt with error", d)
+	}
+
+	state.clock.Advance(time.Minute)
+	state.runOnce(t)
+	got := state.receiver.received()
+	if len(got) != 1 {
+		t.Fatalf("received %v, want 1 delivery", got)
+	}
+
+	req := got[0]
+	wantBody := `{"list":` + strconv.Itoa(d.ListID) + `}`
+	if req.body != wantBody {
+		t.Errorf("body = %v, want %v", req.body, wantBody)
+	}
+	if event := req.header.Get(EventHeader); event != "list.updated" {
+		t.Errorf("event = %v, want list.updated", event)
+	}
+	if id := req.header.Get(DeliveryHeader); id != strconv.Itoa(d.ID) {
+		t.Errorf("delivery = %v, want %v", id, d.ID)
+	}
+	timestamp, err := strconv.ParseInt(req.header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("bad timestamp %v", req.header.Get(TimestampHeader))
+	}
+	if sig := req.header.Get(SignatureHeader); sig != Sign("secret", timestamp, []byte(req.body)) {
+		t.Errorf("signature %v doesn't verify", sig)
+	}
+
+	d = state.deliveries(t)[0]
+	if d.Attempts != 2 || d.LastError != "" || d.Delivered.IsZero() {
+		t.Errorf("delivery after success = %+v, want delivered", d)
+	}
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	state := setupTestState(t, 100)
+	defer state.close()
+
+	state.change()
+	for i := 0; i < 5; i++ {
+		state.runOnce(t)
+		state.clock.Advance(time.Hour)
+	}
+
+	d := state.deliveries(t)[0]
+	if d.Attempts != 3 || d.Failed.IsZero() || d.LastError == "" {
+		t.Errorf("delivery = %+v, want failed after 3 attempts", d)
+	}
+
+	// Redelivery is a matter of resetting the delivery.
+	state.receiver.failures = 0
+	d.Attempts, d.Failed, d.LastError = 0, time.Time{}, ""
+	d.NextAttempt = state.clock.Now()
+	if err := state.db.UpdateWebhookDelivery(ctx, d); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() = %v, want nil", err)
+	}
+	state.runOnce(t)
+	if got := state.receiver.received(); len(got) != 1 {
+		t.Errorf("received %v after redelivery, want 1", got)
+	}
+}
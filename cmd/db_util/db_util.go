@@ -24,6 +24,7 @@ func (c *userCommand) SetFlags(f *flag.FlagSet) {}
 func (c *userCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	cdr := subcommands.NewCommander(f, subcommanderName("user"))
 	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&userClaimsCommand{}, "")
 	cdr.Register(&userCreateCommand{}, "")
 	cdr.Register(&userListCommand{}, "")
 	cdr.Register(&userLookupCommand{}, "")
@@ -60,6 +61,22 @@ func (c *itemCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...inte
 	return cdr.Execute(ctx)
 }
 
+type migrateCommand struct{}
+
+func (c *migrateCommand) Name() string             { return "migrate" }
+func (c *migrateCommand) Synopsis() string         { return "Schema migration commands" }
+func (c *migrateCommand) Usage() string            { return `migrate subcommand` }
+func (c *migrateCommand) SetFlags(f *flag.FlagSet) {}
+
+func (c *migrateCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, subcommanderName("migrate"))
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&migrateDownCommand{}, "")
+	cdr.Register(&migrateStatusCommand{}, "")
+	cdr.Register(&migrateUpCommand{}, "")
+	return cdr.Execute(ctx)
+}
+
 func main() {
 	subcommands.Register(subcommands.HelpCommand(), "")
 	subcommands.Register(subcommands.FlagsCommand(), "")
@@ -67,6 +84,7 @@ func main() {
 	subcommands.Register(&loadCommand{}, "")
 	subcommands.Register(&listCommand{}, "")
 	subcommands.Register(&itemCommand{}, "")
+	subcommands.Register(&migrateCommand{}, "")
 	subcommands.Register(&userCommand{}, "")
 
 	flag.Parse()
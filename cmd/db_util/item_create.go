@@ -12,10 +12,13 @@ import (
 type itemCreateCommand struct {
 	baseCommand
 
-	listID int
-	name   string
-	desc   string
-	url    string
+	listID   int
+	name     string
+	desc     string
+	url      string
+	price    int64
+	currency string
+	quantity int
 }
 
 func (c *itemCreateCommand) Name() string     { return "create" }
@@ -23,6 +26,8 @@ func (c *itemCreateCommand) Synopsis() string { return "Create a single item" }
 func (c *itemCreateCommand) Usage() string {
 	return `item create --list_id list_id
                  --name name [--desc desc] [--url url]
+                 [--price minor_units --currency code]
+                 [--quantity quantity]
                  db_path
 `
 }
@@ -32,6 +37,9 @@ func (c *itemCreateCommand) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.name, "name", "", "Item name")
 	f.StringVar(&c.desc, "desc", "", "Description")
 	f.StringVar(&c.url, "url", "", "URL")
+	f.Int64Var(&c.price, "price", 0, "Price in minor units (e.g. cents)")
+	f.StringVar(&c.currency, "currency", "", "ISO 4217 currency code")
+	f.IntVar(&c.quantity, "quantity", 1, "Number wanted")
 }
 
 func (c *itemCreateCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
@@ -41,11 +49,17 @@ func (c *itemCreateCommand) Execute(ctx context.Context, f *flag.FlagSet, args .
 	if c.name == "" {
 		return c.usage("--name is required")
 	}
+	if c.price != 0 && c.currency == "" {
+		return c.usage("--currency is required with --price")
+	}
 
 	itemData := &database.ListItemData{
-		Name: c.name,
-		Desc: c.desc,
-		URL:  c.url,
+		Name:     c.name,
+		Desc:     c.desc,
+		URL:      c.url,
+		Price:    c.price,
+		Currency: c.currency,
+		Quantity: c.quantity,
 	}
 
 	var dbPath string
@@ -58,7 +72,7 @@ func (c *itemCreateCommand) Execute(ctx context.Context, f *flag.FlagSet, args .
 		return c.failure("failed to open database: %v", err)
 	}
 
-	item, err := db.CreateListItem(ctx, c.listID, itemData, time.Now())
+	item, err := db.CreateListItem(ctx, c.listID, 0, itemData, time.Now())
 	if err != nil {
 		return c.failure("failed to create item: %v", err)
 	}
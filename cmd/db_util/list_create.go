@@ -133,7 +133,7 @@ func createList(ctx context.Context, db *database.DB, spec *ListSpec) (int, erro
 
 	for itemIdx, itemData := range spec.Items {
 		_, err := db.CreateListItem(
-			ctx, list.ID, itemData, time.Now())
+			ctx, list.ID, owner, itemData, time.Now())
 		if err != nil {
 			return -1, fmt.Errorf("failed to create item %d: %v",
 				itemIdx+1, err)
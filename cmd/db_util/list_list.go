@@ -42,12 +42,19 @@ func listItems(ctx context.Context, db *database.DB, list *database.List) error
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
-	fmt.Fprintln(w, "ID\tVr\tName\tDesc\tURL")
-	fmt.Fprintln(w, "--\t--\t----\t----\t---")
+	fmt.Fprintln(w, "ID\tVr\tPos\tPri\tName\tQty\tClaimed\tPrice\tDesc\tURL")
+	fmt.Fprintln(w, "--\t--\t---\t---\t----\t---\t-------\t-----\t----\t---")
 
 	for _, item := range items {
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n",
-			item.ID, item.Version, item.Name, item.Desc, item.URL)
+		price := ""
+		if item.Price != 0 {
+			price = fmt.Sprintf("%v %v", item.Price, item.Currency)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			item.ID, item.Version, item.Position, item.Priority,
+			item.Name, item.Quantity,
+			item.ClaimedCount(), price, item.Desc, item.URL)
 	}
 
 	w.Flush()
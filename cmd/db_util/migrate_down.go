@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/google/subcommands"
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+type migrateDownCommand struct {
+	baseCommand
+
+	to int
+}
+
+func (c *migrateDownCommand) Name() string     { return "down" }
+func (c *migrateDownCommand) Synopsis() string { return "Revert schema migrations" }
+func (c *migrateDownCommand) Usage() string {
+	return `migrate down [--to=version] db_path
+`
+}
+func (c *migrateDownCommand) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.to, "to", -1,
+		"Version to migrate to. Defaults to reverting the last migration")
+}
+
+func (c *migrateDownCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	var dbPath string
+	if err := c.unpackArgs(f, &dbPath); err != nil {
+		return c.usage("Error: %v\n%s", err, c.Usage())
+	}
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return c.failure("failed to open database: %v", err)
+	}
+
+	from, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return c.failure("failed to read schema version: %v", err)
+	}
+	if from == 0 {
+		return c.failure("no migrations to revert")
+	}
+
+	to := c.to
+	if to == -1 {
+		to = from - 1
+	}
+	if to > from {
+		return c.usage("Error: schema is at version %d; use migrate up",
+			from)
+	}
+
+	if err := db.Migrate(ctx, to); err != nil {
+		return c.failure("failed to migrate: %v", err)
+	}
+
+	return c.success("migrated from version %d to %d", from, to)
+}
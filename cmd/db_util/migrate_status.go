@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/db/schema"
+)
+
+type migrateStatusCommand struct {
+	baseCommand
+}
+
+func (c *migrateStatusCommand) Name() string     { return "status" }
+func (c *migrateStatusCommand) Synopsis() string { return "Show schema migrations" }
+func (c *migrateStatusCommand) Usage() string {
+	return `migrate status db_path
+`
+}
+func (c *migrateStatusCommand) SetFlags(f *flag.FlagSet) {}
+
+func (c *migrateStatusCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	var dbPath string
+	if err := c.unpackArgs(f, &dbPath); err != nil {
+		return c.usage("Error: %v\n%s", err, c.Usage())
+	}
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return c.failure("failed to open database: %v", err)
+	}
+
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return c.failure("failed to read schema version: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "Version\tName\tApplied")
+	fmt.Fprintln(w, "-------\t----\t-------")
+
+	for _, m := range schema.Migrations() {
+		applied := ""
+		if m.Version <= version {
+			applied = "yes"
+		}
+
+		fmt.Fprintf(w, "%v\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+
+	w.Flush()
+
+	fmt.Printf("\nschema is at version %d of %d\n", version, schema.Latest())
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/google/subcommands"
+	"github.com/simmonmt/xmaslist/backend/database"
+	"github.com/simmonmt/xmaslist/db/schema"
+)
+
+type migrateUpCommand struct {
+	baseCommand
+
+	to int
+}
+
+func (c *migrateUpCommand) Name() string     { return "up" }
+func (c *migrateUpCommand) Synopsis() string { return "Apply schema migrations" }
+func (c *migrateUpCommand) Usage() string {
+	return `migrate up [--to=version] db_path
+`
+}
+func (c *migrateUpCommand) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.to, "to", -1, "Version to migrate to. Defaults to the latest")
+}
+
+func (c *migrateUpCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	var dbPath string
+	if err := c.unpackArgs(f, &dbPath); err != nil {
+		return c.usage("Error: %v\n%s", err, c.Usage())
+	}
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return c.failure("failed to open database: %v", err)
+	}
+
+	from, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return c.failure("failed to read schema version: %v", err)
+	}
+
+	to := c.to
+	if to == -1 {
+		to = schema.Latest()
+	}
+	if to < from {
+		return c.usage("Error: schema is at version %d; use migrate down",
+			from)
+	}
+
+	if err := db.Migrate(ctx, to); err != nil {
+		return c.failure("failed to migrate: %v", err)
+	}
+
+	return c.success("migrated from version %d to %d", from, to)
+}
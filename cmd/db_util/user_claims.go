@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/simmonmt/xmaslist/backend/database"
+)
+
+type userClaimsCommand struct {
+	baseCommand
+}
+
+func (c *userClaimsCommand) Name() string { return "claims" }
+func (c *userClaimsCommand) Synopsis() string {
+	return "List the items claimed by a user"
+}
+func (c *userClaimsCommand) Usage() string {
+	return `user claims db_path userid
+`
+}
+func (c *userClaimsCommand) SetFlags(f *flag.FlagSet) {}
+
+func (c *userClaimsCommand) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	var dbPath, userArg string
+	if err := c.unpackArgs(f, &dbPath, &userArg); err != nil {
+		return c.usage("Error: %v\n%s", err, c.Usage())
+	}
+
+	userID, err := strconv.Atoi(userArg)
+	if err != nil {
+		return c.usage("Error: invalid userid: %v\n%s", err, c.Usage())
+	}
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return c.failure("failed to open database: %v", err)
+	}
+
+	claimedItems, err := db.ListClaimedItems(ctx, userID)
+	if err != nil {
+		return c.failure("failed to list claims: %v", err)
+	}
+
+	if len(claimedItems) == 0 {
+		return c.success("no claims for user %v\n", userID)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "Event Date\tList\tBeneficiary\tItem\tName\tQty\tState\tPrice")
+	fmt.Fprintln(w, "----------\t----\t-----------\t----\t----\t---\t-----\t-----")
+
+	for _, claimedItem := range claimedItems {
+		list, item := claimedItem.List, claimedItem.Item
+
+		claim := item.UserClaim(userID)
+		if claim == nil {
+			continue
+		}
+
+		price := ""
+		if item.Price != 0 {
+			price = fmt.Sprintf("%v %v", item.Price, item.Currency)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			list.EventDate.Format(time.RFC3339), list.ID,
+			list.Beneficiary, item.ID, item.Name, claim.Count,
+			claim.Purchase, price)
+	}
+
+	w.Flush()
+	return subcommands.ExitSuccess
+}
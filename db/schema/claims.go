@@ -0,0 +1,141 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// claimsMigration moves item claims from items.claimed_by into their own
+// table, which allows more than one claim per item, and adds the item
+// details that came with them. Items are rebuilt rather than altered so
+// that the claim columns can be dropped.
+var claimsMigration = &Migration{
+	Version: 3,
+	Name:    "claims",
+	Up:      claimsUp,
+	Down:    claimsDown,
+}
+
+func execAll(ctx context.Context, txn *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := txn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func claimsUp(ctx context.Context, txn *sql.Tx) error {
+	return execAll(ctx, txn,
+		`CREATE TABLE claims (item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                     user INTEGER REFERENCES users(id),
+                     count INTEGER,
+                     created INTEGER,
+                     purchase_state INTEGER,
+                     purchased INTEGER,
+                     delivered INTEGER,
+                     wrapped INTEGER,
+                     notes TEXT,
+                     reminded INTEGER,
+                     PRIMARY KEY (item_id, user))`,
+
+		`CREATE TABLE pledges (item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                      user INTEGER REFERENCES users(id),
+                      amount INTEGER,
+                      created INTEGER,
+                      PRIMARY KEY (item_id, user))`,
+
+		`CREATE TABLE claim_changes (item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                            user INTEGER REFERENCES users(id),
+                            field TEXT,
+                            old_value TEXT,
+                            new_value TEXT,
+                            changed INTEGER,
+                            PRIMARY KEY (item_id, user, field))`,
+
+		// Existing claims were for the whole item, and hadn't been
+		// bought as far as we know.
+		`INSERT INTO claims (item_id, user, count, created,
+		                     purchase_state, notes)
+		 SELECT id, claimed_by, 1, claimed_when, 1, ''
+		   FROM items
+		  WHERE claimed_by IS NOT NULL`,
+
+		`CREATE TABLE new_items (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    version INTEGER,
+                    list_id INTEGER REFERENCES lists(id),
+                    name TEXT,
+                    desc TEXT,
+                    url TEXT,
+                    price INTEGER,
+                    currency TEXT,
+                    quantity INTEGER,
+                    group_gift BOOL,
+                    organizer INTEGER REFERENCES users(id),
+                    priority INTEGER,
+                    position INTEGER,
+                    created INTEGER,
+                    updated INTEGER,
+                    deleted INTEGER)`,
+
+		// Items keep their order, which was by ID.
+		`INSERT INTO new_items (id, version, list_id, name, desc, url,
+		                        price, currency, quantity, group_gift,
+		                        priority, position, created, updated)
+		 SELECT id, version, list_id, name, desc, url, 0, '', 1, FALSE,
+		        0, (SELECT COUNT(*) FROM items AS prev
+		             WHERE prev.list_id = items.list_id
+		               AND prev.id <= items.id),
+		        created, updated
+		   FROM items`,
+
+		`DROP TABLE items`,
+		`ALTER TABLE new_items RENAME TO items`,
+	)
+}
+
+func claimsDown(ctx context.Context, txn *sql.Tx) error {
+	// Going back to one claim per item would lose the others.
+	var itemID, num int
+	err := txn.QueryRowContext(ctx,
+		`SELECT item_id, COUNT(*) FROM claims
+		  GROUP BY item_id
+		 HAVING COUNT(*) > 1
+		  LIMIT 1`).Scan(&itemID, &num)
+	if err == nil {
+		return fmt.Errorf("item %d has %d claims; only one can be kept",
+			itemID, num)
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	return execAll(ctx, txn,
+		`CREATE TABLE old_items (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    version INTEGER,
+                    list_id INTEGER REFERENCES lists(id),
+                    name TEXT,
+                    desc TEXT,
+                    url TEXT,
+                    created INTEGER,
+                    updated INTEGER,
+                    claimed_by INTEGER REFERENCES users(id),
+                    claimed_when INTEGER)`,
+
+		// Deleted items only stuck around for their claimers, and
+		// there's nowhere to put them.
+		`INSERT INTO old_items (id, version, list_id, name, desc, url,
+		                        created, updated, claimed_by,
+		                        claimed_when)
+		 SELECT id, version, list_id, name, desc, url, items.created,
+		        updated, claims.user, claims.created
+		   FROM items LEFT JOIN claims ON claims.item_id = items.id
+		  WHERE deleted IS NULL`,
+
+		`DROP TABLE claim_changes`,
+		`DROP TABLE pledges`,
+		`DROP TABLE claims`,
+		`DROP TABLE items`,
+		`ALTER TABLE old_items RENAME TO items`,
+	)
+}
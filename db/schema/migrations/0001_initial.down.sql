@@ -0,0 +1,4 @@
+DROP TABLE items;
+DROP TABLE lists;
+DROP TABLE sessions;
+DROP TABLE users;
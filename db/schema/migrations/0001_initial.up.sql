@@ -0,0 +1,34 @@
+CREATE TABLE users (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                                username TEXT UNIQUE,
+                                fullname TEXT,
+                                password TEXT,
+                                admin BOOL);
+
+CREATE UNIQUE INDEX users_by_username ON users (username);
+
+CREATE TABLE sessions (id INTEGER NOT NULL PRIMARY KEY
+	                              AUTOINCREMENT,
+	                           user INTEGER REFERENCES users(id),
+	                           created INTEGER,
+                                   expiry INTEGER);
+
+CREATE TABLE lists (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    version INTEGER,
+                    owner INTEGER REFERENCES users(id),
+                    name TEXT,
+                    beneficiary TEXT,
+                    event_date INTEGER,
+                    created INTEGER,
+                    updated INTEGER,
+                    active BOOL);
+
+CREATE TABLE items (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    version INTEGER,
+                    list_id INTEGER REFERENCES lists(id),
+                    name TEXT,
+                    desc TEXT,
+                    url TEXT,
+                    created INTEGER,
+                    updated INTEGER,
+                    claimed_by INTEGER REFERENCES users(id),
+                    claimed_when INTEGER);
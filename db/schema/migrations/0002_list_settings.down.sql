@@ -0,0 +1,3 @@
+ALTER TABLE lists DROP COLUMN claim_timeout_days;
+ALTER TABLE lists DROP COLUMN budget_currency;
+ALTER TABLE lists DROP COLUMN budget;
@@ -0,0 +1,5 @@
+ALTER TABLE lists ADD COLUMN budget INTEGER;
+ALTER TABLE lists ADD COLUMN budget_currency TEXT;
+ALTER TABLE lists ADD COLUMN claim_timeout_days INTEGER;
+
+UPDATE lists SET budget = 0, budget_currency = '', claim_timeout_days = 0;
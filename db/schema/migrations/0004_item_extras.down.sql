@@ -0,0 +1,7 @@
+DROP TABLE changes;
+DROP TABLE history;
+DROP TABLE price_alerts;
+DROP TABLE price_checks;
+DROP TABLE price_history;
+DROP TABLE item_images;
+DROP TABLE comments;
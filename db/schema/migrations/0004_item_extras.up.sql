@@ -0,0 +1,56 @@
+CREATE TABLE comments (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                       list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+                       item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                       author INTEGER REFERENCES users(id),
+                       body TEXT,
+                       created INTEGER,
+                       updated INTEGER);
+
+CREATE INDEX comments_by_thread ON comments (list_id, item_id, id);
+
+CREATE TABLE item_images (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                          item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                          blob TEXT,
+                          thumbnail TEXT,
+                          content_type TEXT,
+                          width INTEGER,
+                          height INTEGER,
+                          created INTEGER);
+
+CREATE INDEX item_images_by_item ON item_images (item_id, id);
+
+CREATE TABLE price_history (item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                            checked INTEGER,
+                            price INTEGER,
+                            currency TEXT);
+
+CREATE INDEX price_history_by_item ON price_history (item_id, checked);
+
+CREATE TABLE price_checks (item_id INTEGER PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+                           checked INTEGER,
+                           error TEXT);
+
+CREATE TABLE price_alerts (item_id INTEGER REFERENCES items(id) ON DELETE CASCADE,
+                           user INTEGER REFERENCES users(id),
+                           threshold INTEGER,
+                           alerted INTEGER,
+                           PRIMARY KEY (item_id, user));
+
+CREATE TABLE history (list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+                      item_id INTEGER,
+                      version INTEGER,
+                      actor INTEGER,
+                      changed INTEGER,
+                      field TEXT,
+                      old_value TEXT,
+                      new_value TEXT);
+
+CREATE INDEX history_by_list ON history (list_id, item_id, version);
+CREATE INDEX history_by_item ON history (item_id, version);
+
+CREATE TABLE changes (seq INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                      list_id INTEGER,
+                      item_id INTEGER,
+                      deleted BOOL);
+
+CREATE INDEX changes_by_entity ON changes (item_id, list_id);
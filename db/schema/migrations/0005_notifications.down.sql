@@ -0,0 +1,6 @@
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE event_reminders;
+DROP TABLE list_follows;
+DROP TABLE notification_prefs;
+DROP TABLE outbox;
@@ -0,0 +1,66 @@
+CREATE TABLE outbox (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                     user_id INTEGER NOT NULL REFERENCES users(id)
+                             ON DELETE CASCADE,
+                     kind TEXT NOT NULL,
+                     list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+                     item_id INTEGER,
+                     actor INTEGER,
+                     message TEXT,
+                     created INTEGER NOT NULL,
+                     attempts INTEGER NOT NULL DEFAULT 0,
+                     next_attempt INTEGER NOT NULL,
+                     channels TEXT NOT NULL DEFAULT '',
+                     last_error TEXT NOT NULL DEFAULT '',
+                     delivered INTEGER,
+                     failed INTEGER);
+CREATE INDEX outbox_pending ON outbox (delivered, failed, next_attempt);
+
+CREATE TABLE notification_prefs (user_id INTEGER NOT NULL PRIMARY KEY
+                                         REFERENCES users(id)
+                                         ON DELETE CASCADE,
+                                 channels TEXT NOT NULL,
+                                 events TEXT NOT NULL,
+                                 digest INTEGER NOT NULL,
+                                 last_digest INTEGER);
+
+CREATE TABLE list_follows (user_id INTEGER NOT NULL REFERENCES users(id)
+                                   ON DELETE CASCADE,
+                           list_id INTEGER NOT NULL REFERENCES lists(id)
+                                   ON DELETE CASCADE,
+                           PRIMARY KEY (user_id, list_id));
+
+CREATE TABLE event_reminders (list_id INTEGER NOT NULL REFERENCES lists(id)
+                                      ON DELETE CASCADE,
+                              user_id INTEGER NOT NULL REFERENCES users(id)
+                                      ON DELETE CASCADE,
+                              event_date INTEGER NOT NULL,
+                              days_before INTEGER NOT NULL,
+                              sent INTEGER NOT NULL,
+                              PRIMARY KEY (list_id, user_id, event_date,
+                                           days_before));
+
+CREATE TABLE webhooks (id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                       owner INTEGER NOT NULL REFERENCES users(id)
+                             ON DELETE CASCADE,
+                       list_id INTEGER REFERENCES lists(id)
+                               ON DELETE CASCADE,
+                       url TEXT NOT NULL,
+                       secret TEXT NOT NULL,
+                       events TEXT NOT NULL,
+                       created INTEGER NOT NULL);
+
+CREATE TABLE webhook_deliveries (id INTEGER NOT NULL
+                                    PRIMARY KEY AUTOINCREMENT,
+                                 webhook_id INTEGER NOT NULL
+                                            REFERENCES webhooks(id)
+                                            ON DELETE CASCADE,
+                                 event TEXT NOT NULL,
+                                 list_id INTEGER NOT NULL,
+                                 item_id INTEGER NOT NULL DEFAULT 0,
+                                 attempts INTEGER NOT NULL DEFAULT 0,
+                                 next_attempt INTEGER NOT NULL DEFAULT 0,
+                                 last_error TEXT NOT NULL DEFAULT '',
+                                 delivered INTEGER,
+                                 failed INTEGER);
+CREATE INDEX webhook_deliveries_pending
+       ON webhook_deliveries (delivered, failed, next_attempt);
@@ -0,0 +1,5 @@
+CREATE TABLE calendar_feeds (user_id INTEGER NOT NULL PRIMARY KEY
+                                     REFERENCES users(id)
+                                     ON DELETE CASCADE,
+                             token TEXT NOT NULL UNIQUE,
+                             created INTEGER NOT NULL);
@@ -1,12 +1,134 @@
+// Package schema holds the database schema. Schema.txt creates a fresh
+// database at the latest version; existing databases are brought up to date
+// by applying the migrations in order.
 package schema
 
 import (
-	_ "embed"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 )
 
 //go:embed schema.txt
 var schema string
 
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
 func Get() string {
 	return schema
 }
+
+// A Migration moves the schema from Version-1 to Version (Up) and back
+// again (Down). Both run inside a transaction with foreign key enforcement
+// off, so that tables can be rebuilt.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, txn *sql.Tx) error
+	Down    func(ctx context.Context, txn *sql.Tx) error
+}
+
+// goMigrations are the migrations that need more than SQL. The rest are
+// read from migrations/NNNN_name.{up,down}.sql.
+var goMigrations = []*Migration{
+	claimsMigration,
+}
+
+var migrationFileRE = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+func execSQL(stmts string) func(ctx context.Context, txn *sql.Tx) error {
+	return func(ctx context.Context, txn *sql.Tx) error {
+		_, err := txn.ExecContext(ctx, stmts)
+		return err
+	}
+}
+
+func loadMigrations() ([]*Migration, error) {
+	byVersion := map[int]*Migration{}
+	for _, m := range goMigrations {
+		byVersion[m.Version] = m
+	}
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		parts := migrationFileRE.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("bad migration file name %v",
+				entry.Name())
+		}
+
+		version, _ := strconv.Atoi(parts[1])
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d is both %v and %v",
+				version, m.Name, parts[2])
+		}
+
+		stmts, err := migrationFiles.ReadFile(
+			path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		fn := &m.Up
+		if parts[3] == "down" {
+			fn = &m.Down
+		}
+		if *fn != nil {
+			return nil, fmt.Errorf("migration %d has two %v steps",
+				version, parts[3])
+		}
+		*fn = execSQL(string(stmts))
+	}
+
+	migrations := []*Migration{}
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migration %d needs up and down steps",
+				m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+var migrations = func() []*Migration {
+	migrations, err := loadMigrations()
+	if err != nil {
+		panic(fmt.Sprintf("bad migrations: %v", err))
+	}
+	return migrations
+}()
+
+// Migrations returns the migrations in order. Migration i has version i+1.
+func Migrations() []*Migration {
+	return migrations
+}
+
+// Latest returns the version of the newest migration, which is the version
+// of the schema Get returns.
+func Latest() int {
+	return len(migrations)
+}
@@ -3,11 +3,14 @@ module github.com/simmonmt/xmaslist
 go 1.16
 
 require (
-	github.com/google/go-cmp v0.5.6 // indirect
-	github.com/google/subcommands v1.2.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.7 // indirect
-	github.com/roberthodgen/spa-server v0.0.0-20171007154335-bb87b4ff3253 // indirect
-	google.golang.org/grpc v1.37.0 // indirect
-	google.golang.org/protobuf v1.27.1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/golang/protobuf v1.5.0 // indirect
+	github.com/google/go-cmp v0.5.6
+	github.com/google/subcommands v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.7
+	github.com/roberthodgen/spa-server v0.0.0-20171007154335-bb87b4ff3253
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
+	google.golang.org/grpc v1.37.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 )